@@ -1,90 +1,378 @@
 package api
 
 import (
+	"bytes"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	cloudguardian_faults "cloud-guardian/faults"
+	cloudguardian_tracing "cloud-guardian/tracing"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
 )
 
-func PostRequest(url string, apiKey string, data interface{}) (int, error) {
+// signingKey is the HMAC key used to sign requests, requests are not signed if it is empty
+var signingKey []byte
+
+// signingApiKey is the API key of the requests that are signed
+var signingApiKey string
+
+// SetSigningKey enables HMAC signing of all requests with a key derived from the
+// signing secret the API issued to the host at registration. The secret is never
+// sent again, unlike the API key, so a captured request does not allow forging
+// signatures. Signing is disabled without a signing secret. Requests with another
+// API key, e.g. of a tenant, are not signed.
+//
+// Parameters:
+//   - apiKey: The API key of the signed requests
+//   - signingSecret: The signing secret of the host, see Client.Register
+func SetSigningKey(apiKey string, signingSecret string) {
+	setRedactedSecrets(apiKey, signingSecret)
+	signingApiKey = apiKey
+	if signingSecret == "" {
+		signingKey = nil
+		return
+	}
+	signingKey = cloudguardian_crypto.DeriveHmacKey(signingSecret, cloudguardian_crypto.HmacPurposeRequest)
+}
+
+// signRequest adds the timestamp, body hash and HMAC signature headers to the request,
+// so the API can verify the integrity and authenticity of the payload.
+func signRequest(req *http.Request, body []byte) {
+	if !signs(req) {
+		return
+	}
+	bodyHash := sha256.Sum256(body)
+	signRequestWithHash(req, hex.EncodeToString(bodyHash[:]))
+}
+
+// signs reports whether a request is signed, i.e. a signing key is set and the
+// request is sent with the API key it was derived from
+func signs(req *http.Request) bool {
+	apiKey := req.Header.Get("x-api-key")
+	return len(signingKey) > 0 && (apiKey == "" || apiKey == signingApiKey)
+}
+
+// signRequestWithHash signs a request whose body hash was computed in advance,
+// e.g. for streamed bodies.
+func signRequestWithHash(req *http.Request, bodyHashHex string) {
+	if !signs(req) {
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("x-timestamp", timestamp)
+	req.Header.Set("x-content-sha256", bodyHashHex)
+	req.Header.Set("x-signature", cloudguardian_crypto.SignRequest(signingKey, req.Method, req.URL.RequestURI(), timestamp, bodyHashHex))
+}
+
+const (
+	requestTimeout      = 60 * time.Second // Timeout of a single API request
+	maxIdleConns        = 10               // Idle connections kept in the pool
+	maxIdleConnsPerHost = 4                // Idle connections kept per API host
+	idleConnTimeout     = 90 * time.Second // Time an idle connection stays in the pool
+)
+
+// httpClient is shared by all requests, so connections to the API are kept alive and reused
+var httpClient = &http.Client{
+	Transport: &transferTransport{next: &debugTransport{next: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       idleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}}},
+}
+
+// startRequestSpan opens a client span for the request and propagates it with the
+// traceparent header. The span of the request context is its parent. The span is
+// nil if tracing is disabled.
+func startRequestSpan(req *http.Request) *cloudguardian_tracing.Span {
+	_, span := cloudguardian_tracing.StartWithKind(req.Context(), "HTTP "+req.Method, cloudguardian_tracing.KindClient)
+	if span != nil {
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		req.Header.Set("traceparent", span.TraceParent())
+	}
+	return span
+}
+
+// endRequestSpan records the result of the request and finishes the span
+func endRequestSpan(span *cloudguardian_tracing.Span, statusCode int, err error) {
+	if statusCode > 0 {
+		span.SetAttribute("http.response.status_code", statusCode)
+	}
+	span.SetError(err)
+	span.End()
+}
+
+// doRequest sends a request, unless it is dropped by fault injection
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	if err := cloudguardian_faults.DropApiCall(req.URL.Path); err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// closeBody drains and closes a response body, so the connection can be reused
+func closeBody(resp *http.Response) {
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func PostRequest(ctx context.Context, url string, apiKey string, data interface{}) (int, error) {
+	statusCode, _, err := sendJSON(ctx, "POST", url, apiKey, data)
+	return statusCode, err
+}
+
+func PostRequestWithResponse(ctx context.Context, url string, apiKey string, data interface{}) (int, string, error) {
+	// Send the data like PostRequest, but also return the response body
+	return sendJSON(ctx, "POST", url, apiKey, data)
+}
+
+func PutRequest(ctx context.Context, url string, apiKey string, data interface{}) (int, error) {
+	statusCode, _, err := sendJSON(ctx, "PUT", url, apiKey, data)
+	return statusCode, err
+}
+
+func sendJSON(ctx context.Context, method string, url string, apiKey string, data interface{}) (int, string, error) {
+	// Send the data as JSON with the given method to the specified URL with the API key
+	// Returns the status code, the response body, and an *APIError if the status code is not 200
 
-	client := &http.Client{}
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		log.Println("Error marshalling system info to JSON:", err.Error())
-		return 500, err
+		return 500, "", err
 	}
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	client, url := clientFor(url)
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(jsonData))
 	if err != nil {
 		log.Println("Error creating request:", err.Error())
-		return 500, err
+		return 500, "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", apiKey)
-	resp, err := client.Do(req)
+	setVersionHeaders(req)
+	setMaintenanceHeaders(req)
+	signRequest(req, jsonData)
+	span := startRequestSpan(req)
+	resp, err := doRequest(client, req)
 	if err != nil {
+		endRequestSpan(span, 0, err)
+		Breaker.Record(0, err)
 		log.Println("Error sending request:", err.Error())
-		return 500, err
+		return 500, "", newTransportError(err)
 	}
-	defer resp.Body.Close()
+	Breaker.Record(resp.StatusCode, nil)
+	checkCompatibility(resp)
+	defer closeBody(resp)
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return resp.StatusCode, fmt.Errorf("%s", body)
+		apiErr := newResponseError(resp, body)
+		endRequestSpan(span, resp.StatusCode, apiErr)
+		return resp.StatusCode, "", apiErr
 	}
-	return resp.StatusCode, nil
+	body, err := io.ReadAll(resp.Body)
+	endRequestSpan(span, resp.StatusCode, err)
+	if err != nil {
+		log.Println("Error reading response body:", err.Error())
+		return 500, "", err
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+func GetRequest(ctx context.Context, url string, apiKey string) (int, string, error) {
+	// Send a GET request to the specified URL with the API key
+	// Returns the status code and response body as a string, and an *APIError
+	// if the status code is not 200, 204 or 304
+
+	statusCode, body, _, err := getRequest(ctx, url, apiKey, "", requestTimeout)
+	return statusCode, body, err
 }
 
-func PutRequest(url string, apiKey string, data interface{}) (int, error) {
+func GetRequestWithTimeout(ctx context.Context, url string, apiKey string, timeout time.Duration) (int, string, error) {
+	// Send a GET request like GetRequest, but with a custom timeout, e.g. for long-poll requests
 
-	client := &http.Client{}
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Println("Error marshalling system info to JSON:", err.Error())
-		return 500, err
-	}
-	req, err := http.NewRequest("PUT", url, strings.NewReader(string(jsonData)))
+	statusCode, body, _, err := getRequest(ctx, url, apiKey, "", timeout)
+	return statusCode, body, err
+}
+
+func GetConditionalRequest(ctx context.Context, url string, apiKey string, etag string) (int, string, string, error) {
+	// Send a GET request to the specified URL with the API key
+	// If an ETag is given it is sent as If-None-Match, so the API can answer
+	// with 304 Not Modified when the resource did not change
+	// Returns the status code, response body as a string and the ETag of the response
+
+	return getRequest(ctx, url, apiKey, etag, requestTimeout)
+}
+
+func getRequest(ctx context.Context, url string, apiKey string, etag string, timeout time.Duration) (int, string, string, error) {
+	client, url := clientFor(url)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		log.Println("Error creating request:", err.Error())
-		return 500, err
+		return 500, "", "", err
 	}
-	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", apiKey)
-	resp, err := client.Do(req)
+	setVersionHeaders(req)
+	setMaintenanceHeaders(req)
+	signRequest(req, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	span := startRequestSpan(req)
+	resp, err := doRequest(client, req)
 	if err != nil {
+		endRequestSpan(span, 0, err)
+		Breaker.Record(0, err)
 		log.Println("Error sending request:", err.Error())
-		return 500, err
+		return 500, "", "", newTransportError(err)
+	}
+	Breaker.Record(resp.StatusCode, nil)
+	checkCompatibility(resp)
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusNotModified {
+		endRequestSpan(span, resp.StatusCode, nil)
+		return resp.StatusCode, "", etag, nil
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		endRequestSpan(span, resp.StatusCode, nil)
+		return resp.StatusCode, "", "", nil
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return resp.StatusCode, fmt.Errorf("%s", body)
+		apiErr := newResponseError(resp, body)
+		endRequestSpan(span, resp.StatusCode, apiErr)
+		return resp.StatusCode, "", "", apiErr
 	}
-	return resp.StatusCode, nil
+	body, err := io.ReadAll(resp.Body)
+	endRequestSpan(span, resp.StatusCode, err)
+	if err != nil {
+		log.Println("Error reading response body:", err.Error())
+		return 500, "", "", err
+	}
+	return resp.StatusCode, string(body), resp.Header.Get("ETag"), nil
 }
 
-func GetRequest(url string, apiKey string) (int, string, error) {
-	// Send a GET request to the specified URL with the API key
-	// Returns the status code and response body as a string
+// latestVersionResponse is the response of the latest agent version endpoint
+type latestVersionResponse struct {
+	Code    int               `json:"code"`
+	Content map[string]string `json:"content"`
+	Message string            `json:"message"`
+}
+
+// AgentRelease is a released version of the agent announced by the API. The
+// binary is offered like an update_agent job for the host, signed with a host
+// security key, so a host only installs a release its operators signed.
+type AgentRelease struct {
+	Version   string // The version, e.g. "v1.4.2"
+	CreatedAt string // The creation time of the signed job data
+	JobData   string // The job data of an update_agent job for the binary of the platform, empty if the API offers none
+	Signature string // The signature of the job data, see cloudguardian_crypto.JobMessage
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+// LatestAgentVersion asks the API for the latest released version of the agent.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - apiUrl: The base URL of the API
+//   - apiKey: The API key for authentication
+//
+// Returns:
+//   - string: The latest version, e.g. "v1.4.2"
+//   - error: An error if the API is unreachable or announces no version
+func LatestAgentVersion(ctx context.Context, apiUrl string, apiKey string) (string, error) {
+	release, err := LatestAgentRelease(ctx, apiUrl, apiKey, "")
+	return release.Version, err
+}
+
+// LatestAgentRelease asks the API for the latest released version of the agent
+// and the signed binary for the platform of the agent.
+//
+// Parameters:
+//   - ctx: The context of the request
+//   - apiUrl: The base URL of the API
+//   - apiKey: The API key for authentication
+//   - hostname: The host the binary is signed for, only the version is announced if empty
+//
+// Returns:
+//   - AgentRelease: The latest release
+//   - error: An error if the API is unreachable or announces no version
+func LatestAgentRelease(ctx context.Context, apiUrl string, apiKey string, hostname string) (AgentRelease, error) {
+	query := url.Values{"platform": {runtime.GOOS + "-" + runtime.GOARCH}}
+	if hostname != "" {
+		query.Set("hostname", hostname)
+	}
+	statusCode, body, err := GetRequest(ctx, apiUrl+"agent/version?"+query.Encode(), apiKey)
 	if err != nil {
-		log.Println("Error creating request:", err.Error())
-		return 500, "", err
+		return AgentRelease{}, err
 	}
-	req.Header.Set("x-api-key", apiKey)
+	if statusCode != http.StatusOK {
+		return AgentRelease{}, fmt.Errorf("unexpected status code %d", statusCode)
+	}
+	var response latestVersionResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return AgentRelease{}, fmt.Errorf("error parsing response body: %w", err)
+	}
+	if response.Content["latestVersion"] == "" {
+		return AgentRelease{}, fmt.Errorf("the API announced no agent version")
+	}
+	return AgentRelease{
+		Version:   response.Content["latestVersion"],
+		CreatedAt: response.Content["createdAt"],
+		JobData:   response.Content["jobData"],
+		Signature: response.Content["signature"],
+	}, nil
+}
+
+// ClockSkew compares the clock of the host with the Date header of the API. Request
+// signatures carry a timestamp, so a host with a wrong clock fails authentication.
+//
+// Parameters:
+//   - apiUrl: The base URL of the API
+//
+// Returns:
+//   - time.Duration: The local time minus the time of the API, positive if the host is ahead
+//   - error: An error if the API is unreachable or sends no Date header
+func ClockSkew(apiUrl string) (time.Duration, error) {
+	client, url := clientFor(apiUrl)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	setVersionHeaders(req)
+	setMaintenanceHeaders(req)
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println("Error sending request:", err.Error())
-		return 500, "", err
+		return 0, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return resp.StatusCode, "", nil
+	closeBody(resp)
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("the API sent no valid Date header")
 	}
-	body, _ := io.ReadAll(resp.Body)
-	return resp.StatusCode, string(body), nil
+	// The Date header has a resolution of one second and is taken during the request
+	local := start.Add(time.Since(start) / 2).Truncate(time.Second)
+	return local.Sub(date), nil
 }
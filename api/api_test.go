@@ -0,0 +1,98 @@
+package api
+
+import (
+	cloudguardian_crypto "cloud-guardian/crypto"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	defer SetSigningKey("", "")
+
+	req, _ := http.NewRequest("POST", "https://api.example.com/v1/hosts/ping/host1?x=1", nil)
+	SetSigningKey("", "")
+	signRequest(req, []byte("{}"))
+	if req.Header.Get("x-signature") != "" {
+		t.Errorf("Expected request not to be signed without a signing secret")
+	}
+
+	SetSigningKey("abcdefghijklmnop", "signingsecret")
+	signRequest(req, []byte("{}"))
+	timestamp := req.Header.Get("x-timestamp")
+	bodyHash := req.Header.Get("x-content-sha256")
+	if bodyHash != "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a" {
+		t.Errorf("Unexpected body hash: %s", bodyHash)
+	}
+	key := cloudguardian_crypto.DeriveHmacKey("signingsecret", cloudguardian_crypto.HmacPurposeRequest)
+	expected := cloudguardian_crypto.SignRequest(key, "POST", "/v1/hosts/ping/host1?x=1", timestamp, bodyHash)
+	if signature := req.Header.Get("x-signature"); signature != expected {
+		t.Errorf("Expected signature %s, got %s", expected, signature)
+	}
+}
+
+func TestLatestAgentVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/agent/version" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"code":200,"content":{"latestVersion":"v1.4.2"}}`)
+	}))
+	defer server.Close()
+
+	version, err := LatestAgentVersion(context.Background(), server.URL+"/v1/", "abcdefghijklmnop")
+	if err != nil || version != "v1.4.2" {
+		t.Errorf("Expected v1.4.2, got %q, error %v", version, err)
+	}
+	if _, err := LatestAgentVersion(context.Background(), server.URL+"/", "abcdefghijklmnop"); err == nil {
+		t.Error("Expected an error without a version endpoint")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-10*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	skew, err := ClockSkew(server.URL + "/")
+	if err != nil {
+		t.Fatalf("ClockSkew() error: %v", err)
+	}
+	if skew < 9*time.Minute || skew > 11*time.Minute {
+		t.Errorf("Expected the host to be about 10 minutes ahead, got %s", skew)
+	}
+}
+
+func TestMaintenanceHeaders(t *testing.T) {
+	defer SetMaintenance(false, "")
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Clone())
+	}))
+	defer server.Close()
+
+	PostRequest(context.Background(), server.URL, "key", map[string]any{})
+	SetMaintenance(true, "2026-03-01T12:00:00Z")
+	PostRequest(context.Background(), server.URL, "key", map[string]any{})
+	GetRequest(context.Background(), server.URL, "key")
+	SetMaintenance(false, "2026-03-01T12:00:00Z")
+	GetRequest(context.Background(), server.URL, "key")
+
+	expected := []string{"", "true", "true", ""}
+	if len(headers) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(headers))
+	}
+	for i, header := range headers {
+		if header.Get(maintenanceHeader) != expected[i] {
+			t.Errorf("Request %d: expected the maintenance header %q, got %q", i, expected[i], header.Get(maintenanceHeader))
+		}
+		if expected[i] != "" && header.Get(maintenanceUntilHeader) != "2026-03-01T12:00:00Z" {
+			t.Errorf("Request %d: expected the end of the maintenance mode, got %q", i, header.Get(maintenanceUntilHeader))
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ArchiveSchemaVersion is the version of the archive format
+const ArchiveSchemaVersion = 1
+
+// ArchiveClient implements Client by collecting the payloads in a signed archive
+// instead of sending them, so the data of hosts without access to the API can be
+// transferred and imported out-of-band. The archive is a gzipped tar file with a
+// manifest.json, its signature manifest.sig and one file per payload below
+// payloads/. The manifest lists the SHA-256 hash of every payload file.
+type ArchiveClient struct {
+	*PrintClient
+	hostname   string
+	key        []byte
+	signedWith string
+	entries    bytes.Buffer
+}
+
+// ArchiveManifest describes the payloads of an archive
+type ArchiveManifest struct {
+	SchemaVersion int            `json:"schema_version"`
+	Hostname      string         `json:"hostname"`
+	AgentVersion  string         `json:"agent_version"`
+	CreatedAt     string         `json:"created_at"`  // RFC 3339
+	SignedWith    string         `json:"signed_with"` // "signing_secret", or "none" if the manifest is not signed, see NewArchiveClient
+	Files         []ArchiveEntry `json:"files"`
+}
+
+// ArchiveEntry is a payload file of an archive
+type ArchiveEntry struct {
+	Name     string `json:"name"`     // The file in the archive, e.g. payloads/001-system_info.json
+	Endpoint string `json:"endpoint"` // The endpoint the payload is submitted to, e.g. system_info
+	Path     string `json:"path"`     // The request path of the API, e.g. hosts/osinfo/host1
+	Sha256   string `json:"sha256"`   // Hex encoded hash of the file
+}
+
+// NewArchiveClient creates an ArchiveClient. The manifest is signed with a key
+// derived from the signing secret the API issued to the host at registration, so
+// the API can verify an imported archive. A host that was never registered has
+// no signing secret, its manifest is not signed and has no manifest.sig.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - signingSecret: The signing secret of the host, may be empty
+//
+// Returns:
+//   - *ArchiveClient: The client, the archive is written by WriteArchive
+func NewArchiveClient(hostname string, signingSecret string) *ArchiveClient {
+	client := &ArchiveClient{hostname: hostname, signedWith: "none"}
+	client.PrintClient = NewPrintClient(&client.entries)
+	if signingSecret != "" {
+		client.key = cloudguardian_crypto.DeriveHmacKey(signingSecret, cloudguardian_crypto.HmacPurposeArchive)
+		client.signedWith = "signing_secret"
+	}
+	return client
+}
+
+// WriteArchive writes the collected payloads to an archive file. The file is
+// replaced atomically and only readable by its owner, it contains the inventory
+// of the host.
+//
+// Parameters:
+//   - path: The archive file, e.g. /tmp/host1.cgarchive.tar.gz
+//   - agentVersion: The version of the agent, written to the manifest
+//
+// Returns:
+//   - ArchiveManifest: The manifest of the archive
+//   - error: An error if the payloads could not be encoded or the file could not be written
+func (c *ArchiveClient) WriteArchive(path string, agentVersion string) (ArchiveManifest, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	manifest := ArchiveManifest{
+		SchemaVersion: ArchiveSchemaVersion,
+		Hostname:      c.hostname,
+		AgentVersion:  agentVersion,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+		SignedWith:    c.signedWith,
+		Files:         []ArchiveEntry{},
+	}
+	files := map[string][]byte{}
+	decoder := json.NewDecoder(bytes.NewReader(c.entries.Bytes()))
+	for {
+		var entry struct {
+			Endpoint string          `json:"endpoint"`
+			Path     string          `json:"path"`
+			Payload  json.RawMessage `json:"payload"`
+		}
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return manifest, fmt.Errorf("invalid payload: %w", err)
+		}
+		name := fmt.Sprintf("payloads/%03d-%s.json", len(manifest.Files)+1, entry.Endpoint)
+		hash := sha256.Sum256(entry.Payload)
+		manifest.Files = append(manifest.Files, ArchiveEntry{Name: name, Endpoint: entry.Endpoint, Path: entry.Path, Sha256: hex.EncodeToString(hash[:])})
+		files[name] = entry.Payload
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.Remove(tmpFile.Name()) // Fails harmlessly after the rename
+	gzipWriter := gzip.NewWriter(tmpFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tarWriter.Write(data)
+		return err
+	}
+	err = add("manifest.json", manifestData)
+	if err == nil && c.key != nil {
+		err = add("manifest.sig", []byte(SignArchiveManifest(c.key, manifestData)))
+	}
+	for _, file := range manifest.Files {
+		if err == nil {
+			err = add(file.Name, files[file.Name])
+		}
+	}
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, os.Rename(tmpFile.Name(), path)
+}
+
+// SignArchiveManifest computes the hex encoded HMAC-SHA256 signature of an archive
+// manifest. The signed message is built like the one of a request, with the
+// method "ARCHIVE", the path "manifest.json", no timestamp and the SHA-256 hash
+// of the manifest.
+//
+// Parameters:
+//   - key: The HMAC key, see cloudguardian_crypto.DeriveHmacKey
+//   - manifest: The encoded manifest
+//
+// Returns:
+//   - string: The signature
+func SignArchiveManifest(key []byte, manifest []byte) string {
+	hash := sha256.Sum256(manifest)
+	return cloudguardian_crypto.SignRequest(key, "ARCHIVE", "manifest.json", "", hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"archive/tar"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveClient(t *testing.T) {
+	client := NewArchiveClient("host1", "secret")
+	if _, err := client.SubmitMonitoring(context.Background(), "host1", Monitoring{Uptime: 42}); err != nil {
+		t.Fatalf("SubmitMonitoring() error: %v", err)
+	}
+	if _, err := client.SubmitPackages(context.Background(), "host1", []map[string]string{{"name": "openssl"}}); err != nil {
+		t.Fatalf("SubmitPackages() error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "host1.tar.gz")
+	manifest, err := client.WriteArchive(path, "1.2.3")
+	if err != nil {
+		t.Fatalf("WriteArchive() error: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Endpoint != "monitoring" || manifest.Files[1].Path != "hosts/packages/host1" {
+		t.Fatalf("Unexpected manifest files: %+v", manifest.Files)
+	}
+	if manifest.SignedWith != "signing_secret" {
+		t.Errorf("Expected the signing secret to sign, got %s", manifest.SignedWith)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name], _ = io.ReadAll(tarReader)
+	}
+
+	key := cloudguardian_crypto.DeriveHmacKey("secret", cloudguardian_crypto.HmacPurposeArchive)
+	if string(files["manifest.sig"]) != SignArchiveManifest(key, files["manifest.json"]) {
+		t.Errorf("The manifest signature does not verify")
+	}
+	var written ArchiveManifest
+	if err := json.Unmarshal(files["manifest.json"], &written); err != nil || written.Hostname != "host1" || written.AgentVersion != "1.2.3" {
+		t.Fatalf("Unexpected manifest %+v: %v", written, err)
+	}
+	for _, entry := range written.Files {
+		hash := sha256.Sum256(files[entry.Name])
+		if hex.EncodeToString(hash[:]) != entry.Sha256 {
+			t.Errorf("Hash mismatch of %s", entry.Name)
+		}
+	}
+	var monitoring map[string]any
+	if err := json.Unmarshal(files[written.Files[0].Name], &monitoring); err != nil || monitoring["Uptime"] != float64(42) {
+		t.Errorf("Unexpected monitoring payload %v: %v", monitoring, err)
+	}
+}
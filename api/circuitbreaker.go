@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	circuitBreakerThreshold = 5                // Consecutive failures before the circuit opens
+	circuitBreakerCooldown  = 15 * time.Minute // Time non-critical requests are skipped while the circuit is open
+)
+
+// CircuitBreaker tracks consecutive API failures. After a number of consecutive
+// failures the circuit opens and non-critical submissions should be skipped until
+// the cool-down period has passed or a request succeeds again.
+type CircuitBreaker struct {
+	mu                  sync.Mutex
+	threshold           int
+	cooldown            time.Duration
+	consecutiveFailures int
+	openedAt            time.Time
+	now                 func() time.Time
+}
+
+// Breaker is the circuit breaker shared by all requests of the api package
+var Breaker = NewCircuitBreaker(circuitBreakerThreshold, circuitBreakerCooldown)
+
+// NewCircuitBreaker creates a circuit breaker that opens after threshold
+// consecutive failures and stays open for the cool-down duration.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a non-critical request should be sent. It returns false
+// while the circuit is open and the cool-down period has not passed yet.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.consecutiveFailures < cb.threshold {
+		return true
+	}
+	// After the cool-down period requests are allowed again to probe the API
+	return cb.now().Sub(cb.openedAt) >= cb.cooldown
+}
+
+// IsOpen reports whether the circuit is currently open.
+func (cb *CircuitBreaker) IsOpen() bool {
+	return !cb.Allow()
+}
+
+// Record updates the circuit breaker with the result of a request.
+// Network errors and server errors (5xx) count as failures.
+func (cb *CircuitBreaker) Record(statusCode int, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if err == nil && statusCode < http.StatusInternalServerError {
+		if cb.consecutiveFailures >= cb.threshold {
+			log.Println("API is reachable again, closing circuit breaker")
+		}
+		cb.consecutiveFailures = 0
+		return
+	}
+	cb.consecutiveFailures++
+	if cb.consecutiveFailures >= cb.threshold {
+		if cb.consecutiveFailures == cb.threshold {
+			log.Println("API failed", cb.consecutiveFailures, "times in a row, skipping non-critical submissions for", cb.cooldown)
+		}
+		// Every failure while open (including probes) restarts the cool-down
+		cb.openedAt = cb.now()
+	}
+}
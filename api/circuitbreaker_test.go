@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(3, 10*time.Minute)
+	cb.now = func() time.Time { return now }
+
+	cb.Record(500, nil)
+	cb.Record(0, errors.New("connection refused"))
+	if !cb.Allow() {
+		t.Errorf("Expected circuit to be closed below the threshold")
+	}
+
+	cb.Record(503, nil)
+	if cb.Allow() {
+		t.Errorf("Expected circuit to be open after 3 consecutive failures")
+	}
+
+	now = now.Add(5 * time.Minute)
+	if cb.Allow() {
+		t.Errorf("Expected circuit to stay open during the cool-down")
+	}
+
+	now = now.Add(5 * time.Minute)
+	if !cb.Allow() {
+		t.Errorf("Expected requests to be allowed after the cool-down")
+	}
+
+	// A failing probe restarts the cool-down
+	cb.Record(502, nil)
+	if cb.Allow() {
+		t.Errorf("Expected circuit to be open again after a failed probe")
+	}
+
+	// A client error means the API is reachable and closes the circuit
+	cb.Record(404, nil)
+	if !cb.Allow() {
+		t.Errorf("Expected circuit to be closed after a successful request")
+	}
+}
@@ -0,0 +1,444 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxJobPages = 100 // Upper bound of pages followed when fetching jobs, protects against paging loops
+
+// failbackInterval is how long requests stay with a fallback API URL before the
+// primary API URL is tried again, replaced by tests
+var failbackInterval = 10 * time.Minute
+
+// idempotentEndpoints are the endpoints whose requests can be sent again to another
+// API URL after a transport error, because repeating them has no further effect.
+// Requests of other endpoints only fail over if they could not be sent at all.
+var idempotentEndpoints = map[string]bool{
+	"security_keys": true,
+	"jobs":          true,
+	"jobs_wait":     true,
+	"job_update":    true,
+}
+
+type HostJob struct {
+	JobId     string   `json:"jobId"`
+	Signature string   `json:"signature"`
+	CreatedAt string   `json:"createdAt"`
+	JobType   string   `json:"jobType"`
+	JobData   string   `json:"jobData"`
+	Result    string   `json:"result"`
+	Status    string   `json:"status"`
+	Rollout   *Rollout `json:"rollout,omitempty"` // Batch of a staged rollout, echoed with the result
+}
+
+type HostJobResponse struct {
+	Code       int       `json:"code"`
+	Content    []HostJob `json:"content"`
+	Message    string    `json:"message"`
+	Next       string    `json:"next,omitempty"`        // Link to the next page, if any
+	Page       int       `json:"page,omitempty"`        // Current page, starting at 1
+	TotalPages int       `json:"total_pages,omitempty"` // Number of pages
+}
+
+// RegisterApiResponse is the response of the registration, see Client.Register
+type RegisterApiResponse struct {
+	Code    int               `json:"code"`
+	Content map[string]string `json:"content"`
+	Message string            `json:"message"`
+}
+
+type SecurityKeyApiResponse struct {
+	Code    int                 `json:"code"`
+	Content map[string][]string `json:"content"`
+	Message string              `json:"message"`
+}
+
+// Client is the interface of the Cloud Guardian API as used by the agent.
+// All methods return the HTTP status code of the response, so callers can
+// distinguish client and server errors. The request span is a child of the
+// span in the context, see cloudguardian_tracing.Start.
+type Client interface {
+	Register(ctx context.Context, hostname string, labels map[string]string) (int, string, error)
+	Deregister(ctx context.Context, hostname string) (int, error)
+	FetchSecurityKeys(ctx context.Context) (int, []string, error)
+	Ping(ctx context.Context, hostname string, heartbeat Heartbeat) (int, error)
+	SubmitMonitoring(ctx context.Context, hostname string, data Monitoring) (int, error)
+	SubmitSystemInfo(ctx context.Context, hostname string, data SystemInfo) (int, error)
+	SubmitPackages(ctx context.Context, hostname string, packages []map[string]string) (int, error)
+	SubmitPackageDelta(ctx context.Context, hostname string, delta map[string]any) (int, error)
+	SubmitUpdates(ctx context.Context, hostname string, security bool, updates []map[string]string, size *UpdateSize) (int, error)
+	SubmitServiceFiles(ctx context.Context, hostname string, data map[string]any) (int, error)
+	FetchJobs(ctx context.Context, hostname string, status string) (int, []HostJob, error)
+	WaitForJobs(ctx context.Context, hostname string, timeout int) (int, []HostJob, error)
+	UpdateJob(ctx context.Context, jobId string, status string, result string) (int, error)
+	SubmitJobLogs(ctx context.Context, jobId string, lines []string) (int, error)
+}
+
+// cachedHostJobs is the last job list fetched for a job status, together with its ETag
+type cachedHostJobs struct {
+	etag string
+	jobs []HostJob
+}
+
+// HTTPClient implements Client on top of the HTTP API.
+type HTTPClient struct {
+	ApiUrls []string // Base URLs of the API in order of preference, ending with a slash
+	ApiKey  string   // API key for authentication
+
+	healthy      int       // Index of the last API URL that was reachable
+	failedOverAt time.Time // When the requests last moved to a fallback API URL, see failbackInterval
+	healthyMutex sync.Mutex
+
+	jobsCache      map[string]cachedHostJobs // Cached job lists by URL
+	jobsCacheMutex sync.Mutex
+}
+
+// NewHTTPClient creates a Client for the API at apiUrl. Requests fail over to
+// the fallback URLs in order when an API URL is unreachable, and return to apiUrl
+// after the failbackInterval.
+func NewHTTPClient(apiUrl string, apiKey string, fallbackUrls ...string) *HTTPClient {
+	return &HTTPClient{
+		ApiUrls:   append([]string{apiUrl}, fallbackUrls...),
+		ApiKey:    apiKey,
+		jobsCache: map[string]cachedHostJobs{},
+	}
+}
+
+// ApiUrl returns the API URL that is currently used
+func (c *HTTPClient) ApiUrl() string {
+	c.healthyMutex.Lock()
+	defer c.healthyMutex.Unlock()
+	return c.ApiUrls[c.healthy]
+}
+
+// withFailover sends a request to the last reachable API URL. If it is unreachable,
+// the other API URLs are tried in order and the first reachable one is remembered.
+// Requests of endpoints that are not idempotent are only sent to the next API URL
+// if they were not sent at all, e.g. because the connection was refused, so a
+// submission that timed out is not received twice. Responses with an error status
+// code do not cause a failover. After the failbackInterval the primary API URL is
+// tried first again. The result is recorded in the metrics of the endpoint.
+func (c *HTTPClient) withFailover(endpoint string, request func(apiUrl string) (int, error)) (int, error) {
+	start := time.Now()
+	statusCode, err := c.failover(idempotentEndpoints[endpoint], request)
+	Metrics.Record(endpoint, time.Since(start), statusCode, err)
+	return statusCode, err
+}
+
+func (c *HTTPClient) failover(idempotent bool, request func(apiUrl string) (int, error)) (int, error) {
+	c.healthyMutex.Lock()
+	first := c.healthy
+	if first != 0 && time.Since(c.failedOverAt) >= failbackInterval {
+		first = 0 // Try the primary API URL again
+	}
+	c.healthyMutex.Unlock()
+
+	var statusCode int
+	var err error
+	for i := range c.ApiUrls {
+		index := (first + i) % len(c.ApiUrls)
+		statusCode, err = request(c.ApiUrls[index])
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == 0 && apiErr.Err != nil {
+			if !idempotent && !notSent(apiErr.Err) {
+				return statusCode, err // The API may have received the request
+			}
+			if len(c.ApiUrls) > 1 {
+				log.Println("API URL", c.ApiUrls[index], "is unreachable, trying the next one")
+			}
+			continue
+		}
+		c.healthyMutex.Lock()
+		if c.healthy != index {
+			if index == 0 {
+				log.Println("Failing back to API URL", c.ApiUrls[index])
+			} else {
+				log.Println("Failing over to API URL", c.ApiUrls[index])
+			}
+			c.healthy = index
+		}
+		if index != 0 && index != first {
+			c.failedOverAt = time.Now()
+		}
+		c.healthyMutex.Unlock()
+		return statusCode, err
+	}
+	return statusCode, err
+}
+
+// notSent reports whether a transport error happened before the request was sent,
+// i.e. the API URL could not be resolved or connected to
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || (errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// Register registers the host with the API. The labels group the host, e.g. by
+// environment or team, they may be empty. The API issues a new signing secret
+// with every registration, see SetSigningKey. It is empty if the API does not
+// sign requests.
+func (c *HTTPClient) Register(ctx context.Context, hostname string, labels map[string]string) (int, string, error) {
+	var responseBody string
+	statusCode, err := c.withFailover("register", func(apiUrl string) (statusCode int, err error) {
+		statusCode, responseBody, err = PostRequestWithResponse(ctx, apiUrl+"hosts/register/"+hostname, c.ApiKey, registerPayload(labels))
+		return statusCode, err
+	})
+	if err != nil || statusCode != http.StatusOK || responseBody == "" {
+		return statusCode, "", err
+	}
+	var response RegisterApiResponse
+	if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
+		return statusCode, "", fmt.Errorf("error parsing response body: %w", err)
+	}
+	return statusCode, response.Content["signingSecret"], nil
+}
+
+// Deregister removes the host from the API, its jobs and data are deleted by the API
+func (c *HTTPClient) Deregister(ctx context.Context, hostname string) (int, error) {
+	return c.withFailover("deregister", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/deregister/"+hostname, c.ApiKey, withSchemaVersion(RegisterSchemaVersion, map[string]any{}))
+	})
+}
+
+// registerPayload returns the registration payload with the labels of the host
+func registerPayload(labels map[string]string) map[string]any {
+	data := map[string]any{}
+	if len(labels) > 0 {
+		data["labels"] = labels
+	}
+	return withSchemaVersion(RegisterSchemaVersion, data)
+}
+
+func (c *HTTPClient) FetchSecurityKeys(ctx context.Context) (int, []string, error) {
+	var responseBody string
+	statusCode, err := c.withFailover("security_keys", func(apiUrl string) (statusCode int, err error) {
+		statusCode, responseBody, err = GetRequest(ctx, apiUrl+"hosts/securitykeys", c.ApiKey)
+		return statusCode, err
+	})
+	if err != nil || statusCode != http.StatusOK {
+		return statusCode, nil, err
+	}
+	var response SecurityKeyApiResponse
+	if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
+		return statusCode, nil, fmt.Errorf("error parsing response body: %w", err)
+	}
+	return statusCode, response.Content["hostSecurityKeys"], nil
+}
+
+// Ping sends the heartbeat of the host
+func (c *HTTPClient) Ping(ctx context.Context, hostname string, heartbeat Heartbeat) (int, error) {
+	heartbeat.SchemaVersion = PingSchemaVersion
+	return c.withFailover("ping", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/ping/"+hostname, c.ApiKey, heartbeat)
+	})
+}
+
+func (c *HTTPClient) SubmitMonitoring(ctx context.Context, hostname string, data Monitoring) (int, error) {
+	data.SchemaVersion = MonitoringSchemaVersion
+	return c.withFailover("monitoring", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/monitoring/"+hostname, c.ApiKey, data)
+	})
+}
+
+func (c *HTTPClient) SubmitSystemInfo(ctx context.Context, hostname string, data SystemInfo) (int, error) {
+	data.SchemaVersion = SystemInfoSchemaVersion
+	return c.withFailover("system_info", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/osinfo/"+hostname, c.ApiKey, data)
+	})
+}
+
+// SubmitPackages sends the installed packages. Large inventories are streamed
+// as NDJSON, one package per line.
+func (c *HTTPClient) SubmitPackages(ctx context.Context, hostname string, packages []map[string]string) (int, error) {
+	return c.withFailover("packages", func(apiUrl string) (int, error) {
+		if len(packages) >= StreamingThreshold {
+			return PostNDJSONRequest(ctx, apiUrl+"hosts/packages/"+hostname, c.ApiKey, PackagesSchemaVersion, packages)
+		}
+		return PostRequest(ctx, apiUrl+"hosts/packages/"+hostname, c.ApiKey, Packages{
+			SchemaVersion: PackagesSchemaVersion,
+			Packages:      packages,
+		})
+	})
+}
+
+// SubmitPackageDelta sends the package changes since the inventory identified by
+// the base hash. The API responds with 409 if its inventory has another hash.
+func (c *HTTPClient) SubmitPackageDelta(ctx context.Context, hostname string, delta map[string]any) (int, error) {
+	return c.withFailover("package_delta", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/packages/"+hostname+"/delta", c.ApiKey, withSchemaVersion(PackageDeltaSchemaVersion, delta))
+	})
+}
+
+// SubmitUpdates sends the pending updates of the host. The size estimate is
+// left out of the payload when it is nil, e.g. because the package manager failed.
+func (c *HTTPClient) SubmitUpdates(ctx context.Context, hostname string, security bool, updates []map[string]string, size *UpdateSize) (int, error) {
+	return c.withFailover("updates", func(apiUrl string) (int, error) {
+		url := fmt.Sprintf("%shosts/updates/%s?security=%t", apiUrl, hostname, security)
+		return PostRequest(ctx, url, c.ApiKey, updatesPayload(updates, size))
+	})
+}
+
+// updatesPayload returns the updates payload, the size estimate is left out if it is nil
+func updatesPayload(updates []map[string]string, size *UpdateSize) map[string]any {
+	data := map[string]any{
+		"updates": updates,
+	}
+	if size != nil {
+		data["download_size"] = size.DownloadBytes
+		data["installed_size"] = size.InstalledBytes
+	}
+	return withSchemaVersion(UpdatesSchemaVersion, data)
+}
+
+func (c *HTTPClient) SubmitServiceFiles(ctx context.Context, hostname string, data map[string]any) (int, error) {
+	return c.withFailover("service_files", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"hosts/servicefiles/"+hostname, c.ApiKey, withSchemaVersion(ServiceFilesSchemaVersion, data))
+	})
+}
+
+// FetchJobs retrieves the jobs of the host with the given status. Paged responses
+// are followed until all jobs are retrieved. A job list of a single page is cached
+// with its ETag, so an unchanged list is not downloaded and parsed again. The ETag
+// of the first page does not cover the following pages, so paged lists are not cached.
+// A 404 status code means no jobs were found, it is returned together with an *APIError.
+func (c *HTTPClient) FetchJobs(ctx context.Context, hostname string, status string) (int, []HostJob, error) {
+	var jobs []HostJob
+	statusCode, err := c.withFailover("jobs", func(apiUrl string) (statusCode int, err error) {
+		statusCode, jobs, err = c.fetchJobs(ctx, apiUrl, hostname, status)
+		return statusCode, err
+	})
+	return statusCode, jobs, err
+}
+
+func (c *HTTPClient) fetchJobs(ctx context.Context, apiUrl string, hostname string, status string) (int, []HostJob, error) {
+	firstPageUrl := apiUrl + "jobs/hosts/" + hostname + "?job_status=" + status
+
+	c.jobsCacheMutex.Lock()
+	cached, hasCache := c.jobsCache[firstPageUrl]
+	c.jobsCacheMutex.Unlock()
+
+	statusCode, responseBody, etag, err := GetConditionalRequest(ctx, firstPageUrl, c.ApiKey, cached.etag)
+	if statusCode == http.StatusNotModified && hasCache {
+		// The job list did not change since the last request
+		return http.StatusOK, append([]HostJob(nil), cached.jobs...), nil
+	}
+	if err != nil || statusCode != http.StatusOK {
+		c.jobsCacheMutex.Lock()
+		delete(c.jobsCache, firstPageUrl)
+		c.jobsCacheMutex.Unlock()
+		return statusCode, nil, err
+	}
+
+	var jobs []HostJob
+	pageUrl := firstPageUrl
+	page := 1
+	for ; ; page++ {
+		var response HostJobResponse
+		if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
+			return statusCode, nil, fmt.Errorf("error parsing response body: %w", err)
+		}
+		jobs = append(jobs, response.Content...)
+
+		nextUrl, err := nextPageUrl(apiUrl, firstPageUrl, response)
+		if err != nil {
+			return statusCode, nil, err
+		}
+		if nextUrl == "" {
+			break
+		}
+		if page >= maxJobPages || nextUrl == pageUrl {
+			return statusCode, nil, fmt.Errorf("job list has more than %d pages or does not advance", maxJobPages)
+		}
+		pageUrl = nextUrl
+		statusCode, responseBody, err = GetRequest(ctx, pageUrl, c.ApiKey)
+		if err != nil {
+			return statusCode, nil, err
+		}
+		if statusCode != http.StatusOK {
+			return statusCode, nil, fmt.Errorf("error retrieving job page %s", pageUrl)
+		}
+	}
+
+	c.jobsCacheMutex.Lock()
+	if etag != "" && page == 1 {
+		c.jobsCache[firstPageUrl] = cachedHostJobs{etag: etag, jobs: append([]HostJob(nil), jobs...)}
+	} else {
+		delete(c.jobsCache, firstPageUrl)
+	}
+	c.jobsCacheMutex.Unlock()
+	return http.StatusOK, jobs, nil
+}
+
+// nextPageUrl returns the URL of the page after the given response, or an empty
+// string if it was the last page. A next link takes precedence over page numbers.
+// It has to point to the API, the API key is sent with the request for the page.
+func nextPageUrl(apiUrl string, firstPageUrl string, response HostJobResponse) (string, error) {
+	if response.Next != "" {
+		base, err := url.Parse(apiUrl)
+		if err != nil {
+			return "", fmt.Errorf("invalid API URL: %w", err)
+		}
+		next, err := url.Parse(response.Next)
+		if err != nil {
+			return "", fmt.Errorf("invalid next page link: %w", err)
+		}
+		resolved := base.ResolveReference(next)
+		if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+			return "", fmt.Errorf("next page link %s does not point to the API", response.Next)
+		}
+		return resolved.String(), nil
+	}
+	if response.TotalPages > response.Page && response.Page > 0 {
+		return firstPageUrl + "&page=" + strconv.Itoa(response.Page+1), nil
+	}
+	return "", nil
+}
+
+// WaitForJobs sends a long-poll request that returns as soon as new jobs are
+// submitted for the host or the timeout (in seconds) expires.
+func (c *HTTPClient) WaitForJobs(ctx context.Context, hostname string, timeout int) (int, []HostJob, error) {
+	var responseBody string
+	statusCode, err := c.withFailover("jobs_wait", func(apiUrl string) (statusCode int, err error) {
+		url := fmt.Sprintf("%sjobs/hosts/%s/wait?job_status=submitted&timeout=%d", apiUrl, hostname, timeout)
+		// The request may be held open by the API for the whole long-poll timeout
+		statusCode, responseBody, err = GetRequestWithTimeout(ctx, url, c.ApiKey, time.Duration(timeout)*time.Second+requestTimeout)
+		return statusCode, err
+	})
+	if err != nil || statusCode != http.StatusOK {
+		return statusCode, nil, err
+	}
+	var response HostJobResponse
+	if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
+		return statusCode, nil, fmt.Errorf("error parsing response body: %w", err)
+	}
+	return statusCode, response.Content, nil
+}
+
+func (c *HTTPClient) UpdateJob(ctx context.Context, jobId string, status string, result string) (int, error) {
+	return c.withFailover("job_update", func(apiUrl string) (int, error) {
+		return PutRequest(ctx, apiUrl+"jobs/"+jobId, c.ApiKey, withSchemaVersion(JobUpdateSchemaVersion, map[string]any{
+			"status": status,
+			"result": result,
+		}))
+	})
+}
+
+// SubmitJobLogs sends the log lines a stream_logs job tailed since its last submission
+func (c *HTTPClient) SubmitJobLogs(ctx context.Context, jobId string, lines []string) (int, error) {
+	return c.withFailover("job_logs", func(apiUrl string) (int, error) {
+		return PostRequest(ctx, apiUrl+"jobs/"+jobId+"/logs", c.ApiKey, withSchemaVersion(JobLogsSchemaVersion, map[string]any{
+			"lines": lines,
+		}))
+	})
+}
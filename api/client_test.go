@@ -0,0 +1,426 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchJobsFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprint(w, `{"code":200,"content":[{"jobId":"1"}],"page":1,"total_pages":3}`)
+		case "2":
+			fmt.Fprint(w, `{"code":200,"content":[{"jobId":"2"}],"next":"/v1/jobs/hosts/host1?job_status=submitted&page=3"}`)
+		case "3":
+			fmt.Fprint(w, `{"code":200,"content":[{"jobId":"3"}],"page":3,"total_pages":3}`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/v1/", "abcdefghijklmnop")
+	statusCode, jobs, err := client.FetchJobs(context.Background(), "host1", "submitted")
+	if err != nil || statusCode != http.StatusOK {
+		t.Fatalf("FetchJobs() = %d, %v", statusCode, err)
+	}
+	if len(jobs) != 3 || jobs[0].JobId != "1" || jobs[1].JobId != "2" || jobs[2].JobId != "3" {
+		t.Errorf("Expected jobs 1, 2 and 3, got %+v", jobs)
+	}
+}
+
+func TestFetchJobsRejectsForeignNextLink(t *testing.T) {
+	foreignRequests := 0
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		foreignRequests++
+		fmt.Fprint(w, `{"code":200,"content":[]}`)
+	}))
+	defer foreign.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"code":200,"content":[{"jobId":"1"}],"next":"%s/v1/jobs?page=2"}`, foreign.URL)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/v1/", "abcdefghijklmnop")
+	if _, _, err := client.FetchJobs(context.Background(), "host1", "submitted"); err == nil {
+		t.Errorf("Expected a next link to another host to be rejected")
+	}
+	if foreignRequests != 0 {
+		t.Errorf("Expected no request with the API key to another host, got %d", foreignRequests)
+	}
+}
+
+func TestFetchJobsDoesNotCachePagedLists(t *testing.T) {
+	secondPage := "2"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprintf(w, `{"code":200,"content":[{"jobId":"%s"}],"page":2,"total_pages":2}`, secondPage)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"code":200,"content":[{"jobId":"1"}],"page":1,"total_pages":2}`)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/", "abcdefghijklmnop")
+	client.FetchJobs(context.Background(), "host1", "submitted")
+	secondPage = "3" // Only the second page changed
+	_, jobs, err := client.FetchJobs(context.Background(), "host1", "submitted")
+	if err != nil || len(jobs) != 2 || jobs[1].JobId != "3" {
+		t.Errorf("Expected the changed second page, got %+v, %v", jobs, err)
+	}
+	if requests != 4 {
+		t.Errorf("Expected both pages to be requested twice, got %d requests", requests)
+	}
+}
+
+func TestFetchJobsUsesETag(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"code":200,"content":[{"jobId":"1"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/", "abcdefghijklmnop")
+	for i := 0; i < 2; i++ {
+		statusCode, jobs, err := client.FetchJobs(context.Background(), "host1", "running")
+		if err != nil || statusCode != http.StatusOK || len(jobs) != 1 {
+			t.Fatalf("FetchJobs() = %d, %+v, %v", statusCode, jobs, err)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+func TestUnixSocketApiUrl(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "relay.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Error listening on unix socket: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cloudguardian-api/v1/hosts/ping/host1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client := NewHTTPClient("unix://"+socket+":/cloudguardian-api/v1/", "abcdefghijklmnop")
+	if statusCode, err := client.Ping(context.Background(), "host1", Heartbeat{}); err != nil || statusCode != http.StatusOK {
+		t.Errorf("Ping() = %d, %v", statusCode, err)
+	}
+}
+
+func TestSubmitPackagesStreamsLargeInventories(t *testing.T) {
+	defer SetSigningKey("", "")
+	SetSigningKey("abcdefghijklmnop", "signingsecret")
+
+	var lines []string
+	var contentType, bodyHash, schemaVersion string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		schemaVersion = r.Header.Get("x-schema-version")
+		body, _ := io.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+		bodyHash = hex.EncodeToString(hash[:])
+		if r.Header.Get("x-content-sha256") != bodyHash {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		lines = strings.Split(strings.TrimSpace(string(body)), "\n")
+	}))
+	defer server.Close()
+
+	originalThreshold := StreamingThreshold
+	StreamingThreshold = 2
+	defer func() { StreamingThreshold = originalThreshold }()
+
+	client := NewHTTPClient(server.URL+"/", "abcdefghijklmnop")
+	packages := []map[string]string{{"name": "bash"}, {"name": "curl"}, {"name": "vim"}}
+	if statusCode, err := client.SubmitPackages(context.Background(), "host1", packages); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("SubmitPackages() = %d, %v", statusCode, err)
+	}
+	if contentType != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %s", contentType)
+	}
+	if len(lines) != 3 || lines[1] != `{"name":"curl"}` {
+		t.Errorf("Unexpected NDJSON lines: %q", lines)
+	}
+	if schemaVersion != strconv.Itoa(PackagesSchemaVersion) {
+		t.Errorf("Expected schema version header %d, got %q", PackagesSchemaVersion, schemaVersion)
+	}
+}
+
+func TestPayloadsHaveSchemaVersion(t *testing.T) {
+	payloads := map[string]map[string]any{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads[r.URL.Path] = payload
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/", "abcdefghijklmnop")
+	client.Register(context.Background(), "host1", map[string]string{"environment": "prod"})
+	client.Ping(context.Background(), "host1", Heartbeat{})
+	client.SubmitMonitoring(context.Background(), "host1", Monitoring{Uptime: 42})
+	client.SubmitSystemInfo(context.Background(), "host1", SystemInfo{OsName: "Debian"})
+	client.SubmitPackages(context.Background(), "host1", []map[string]string{{"name": "bash"}})
+	client.SubmitUpdates(context.Background(), "host1", false, []map[string]string{}, nil)
+	client.UpdateJob(context.Background(), "job1", "finished", "")
+
+	expected := map[string]float64{
+		"/hosts/register/host1":   RegisterSchemaVersion,
+		"/hosts/ping/host1":       PingSchemaVersion,
+		"/hosts/monitoring/host1": MonitoringSchemaVersion,
+		"/hosts/osinfo/host1":     SystemInfoSchemaVersion,
+		"/hosts/packages/host1":   PackagesSchemaVersion,
+		"/hosts/updates/host1":    UpdatesSchemaVersion,
+		"/jobs/job1":              JobUpdateSchemaVersion,
+	}
+	for path, version := range expected {
+		if payloads[path]["schema_version"] != version {
+			t.Errorf("Expected schema_version %v in the payload of %s, got %v", version, path, payloads[path])
+		}
+	}
+	if labels, _ := payloads["/hosts/register/host1"]["labels"].(map[string]any); labels["environment"] != "prod" {
+		t.Errorf("Expected the labels in the registration, got %v", payloads["/hosts/register/host1"])
+	}
+	if payloads["/hosts/monitoring/host1"]["Uptime"] != float64(42) {
+		t.Errorf("Expected the monitoring field names to be unchanged, got %v", payloads["/hosts/monitoring/host1"])
+	}
+}
+
+func TestRegisterReturnsSigningSecret(t *testing.T) {
+	defer SetSigningKey("", "")
+	SetSigningKey("abcdefghijklmnop", "")
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("x-signature")
+		fmt.Fprint(w, `{"code":200,"content":{"signingSecret":"secret1"}}`)
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(server.URL+"/v1/", "abcdefghijklmnop")
+	statusCode, signingSecret, err := client.Register(context.Background(), "host1", nil)
+	if err != nil || statusCode != http.StatusOK || signingSecret != "secret1" {
+		t.Fatalf("Register() = %d, %q, %v", statusCode, signingSecret, err)
+	}
+	if signature != "" {
+		t.Errorf("Expected the registration without a signing secret not to be signed")
+	}
+	SetSigningKey("abcdefghijklmnop", signingSecret)
+	client.Ping(context.Background(), "host1", Heartbeat{})
+	if signature == "" {
+		t.Errorf("Expected the requests after the registration to be signed")
+	}
+}
+
+func TestFailoverToReachableApiUrl(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	defer server.Close()
+
+	// Nothing listens on the socket of the primary API URL
+	unreachable := "unix://" + filepath.Join(t.TempDir(), "missing.sock") + ":/v1/"
+	client := NewHTTPClient(unreachable, "abcdefghijklmnop", server.URL+"/v1/")
+	for i := 0; i < 2; i++ {
+		if statusCode, err := client.Ping(context.Background(), "host1", Heartbeat{}); err != nil || statusCode != http.StatusOK {
+			t.Fatalf("Ping() = %d, %v", statusCode, err)
+		}
+	}
+	if client.ApiUrl() != server.URL+"/v1/" {
+		t.Errorf("Expected the reachable API URL to be remembered, got %s", client.ApiUrl())
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests to the reachable API URL, got %d", requests)
+	}
+}
+
+func TestFailoverOnlyRepeatsIdempotentRequests(t *testing.T) {
+	// The primary API URL accepts the request but never answers it
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer primary.Close()
+	fallbackRequests := 0
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests++
+		fmt.Fprint(w, `{"code":200,"content":[]}`)
+	}))
+	defer fallback.Close()
+
+	client := NewHTTPClient(primary.URL+"/v1/", "abcdefghijklmnop", fallback.URL+"/v1/")
+	if _, err := client.SubmitJobLogs(context.Background(), "job1", []string{"line"}); err == nil {
+		t.Errorf("Expected the submission to fail")
+	}
+	if fallbackRequests != 0 {
+		t.Fatalf("Expected a submission the API may have received not to be sent again")
+	}
+	if statusCode, _, err := client.FetchJobs(context.Background(), "host1", "submitted"); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("Expected the job list to be fetched from the fallback, got %d, %v", statusCode, err)
+	}
+	if fallbackRequests != 1 {
+		t.Errorf("Expected 1 request to the fallback API URL, got %d", fallbackRequests)
+	}
+}
+
+func TestFailbackToPrimaryApiUrl(t *testing.T) {
+	originalInterval := failbackInterval
+	failbackInterval = 0
+	defer func() { failbackInterval = originalInterval }()
+	fallbackRequests := 0
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests++
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	defer fallback.Close()
+
+	socket := filepath.Join(t.TempDir(), "primary.sock")
+	primaryUrl := "unix://" + socket + ":/v1/"
+	client := NewHTTPClient(primaryUrl, "abcdefghijklmnop", fallback.URL+"/v1/")
+	if statusCode, err := client.Ping(context.Background(), "host1", Heartbeat{}); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("Ping() = %d, %v", statusCode, err)
+	}
+	if client.ApiUrl() != fallback.URL+"/v1/" {
+		t.Fatalf("Expected a failover while the primary API URL is unreachable, got %s", client.ApiUrl())
+	}
+
+	// The primary API URL is reachable again
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	primary.Listener = listener
+	primary.Start()
+	defer primary.Close()
+	if statusCode, err := client.Ping(context.Background(), "host1", Heartbeat{}); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("Ping() = %d, %v", statusCode, err)
+	}
+	if client.ApiUrl() != primaryUrl {
+		t.Errorf("Expected the primary API URL to be used again after the failback interval, got %s", client.ApiUrl())
+	}
+	if fallbackRequests != 1 {
+		t.Errorf("Expected 1 request to the fallback API URL, got %d", fallbackRequests)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/hosts/monitoring/host1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	defer server.Close()
+
+	Metrics.Snapshot(true)
+	client := NewHTTPClient(server.URL+"/v1/", "abcdefghijklmnop")
+	client.Ping(context.Background(), "host1", Heartbeat{})
+	client.Register(context.Background(), "host1", map[string]string{"environment": "prod"})
+	client.Ping(context.Background(), "host1", Heartbeat{})
+	client.SubmitMonitoring(context.Background(), "host1", Monitoring{})
+
+	stats := Metrics.Snapshot(true)
+	if ping := stats["ping"]; ping.Requests != 2 || ping.Errors != 0 || ping.LastStatusCode != http.StatusOK {
+		t.Errorf("Unexpected ping stats: %+v", ping)
+	}
+	if monitoring := stats["monitoring"]; monitoring.Requests != 1 || monitoring.ErrorRate != 1 {
+		t.Errorf("Unexpected monitoring stats: %+v", monitoring)
+	}
+	if len(Metrics.Snapshot(false)) != 0 {
+		t.Errorf("Expected the metrics to be reset")
+	}
+}
+
+func TestDataVolume(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	defer server.Close()
+
+	Metrics = NewRequestMetrics()
+	client := NewHTTPClient(server.URL+"/v1/", "abcdefghijklmnop")
+	client.Ping(context.Background(), "host1", Heartbeat{})
+	client.UpdateJob(context.Background(), "job1", "running", "")
+
+	stats := Metrics.Snapshot(true)
+	if ping := stats["ping"]; ping.BytesSent == 0 || ping.BytesReceived == 0 {
+		t.Errorf("Expected the ping bytes to be counted, got %+v", ping)
+	}
+	volumes := Metrics.DataVolume()
+	if len(volumes) != 1 || volumes[0].Date != time.Now().UTC().Format(time.DateOnly) {
+		t.Fatalf("Expected the data volume of today, got %+v", volumes)
+	}
+	today := volumes[0]
+	jobUpdate := today.Endpoints["job_update"]
+	if jobUpdate.BytesSent == 0 || today.BytesSent != today.Endpoints["ping"].BytesSent+jobUpdate.BytesSent {
+		t.Errorf("Expected the bytes sent of the day to be the sum of the endpoints, got %+v", today)
+	}
+
+	// The next day starts with an empty volume and keeps the previous day
+	Metrics.mu.Lock()
+	Metrics.rollDay(time.Now().Add(24 * time.Hour))
+	volumes = []DataVolume{*Metrics.yesterday, Metrics.today}
+	Metrics.mu.Unlock()
+	if volumes[0].BytesSent != today.BytesSent || volumes[1].BytesSent != 0 {
+		t.Errorf("Expected the volume to roll over to the next day, got %+v", volumes)
+	}
+}
+
+func TestEndpointForPath(t *testing.T) {
+	paths := map[string]string{
+		"/v1/hosts/register/host1":       "register",
+		"/v1/hosts/deregister/host1":     "deregister",
+		"/v1/hosts/securitykeys":         "security_keys",
+		"/v1/agent/version":              "agent_version",
+		"/v1/hosts/packages/host1":       "packages",
+		"/v1/hosts/packages/host1/delta": "package_delta",
+		"/v1/jobs/hosts/host1":           "jobs",
+		"/v1/jobs/hosts/host1/wait":      "jobs_wait",
+		"/v1/jobs/job1":                  "job_update",
+		"/v1/jobs/job1/logs":             "job_logs",
+		"/v1/unknown":                    "other",
+	}
+	for path, expected := range paths {
+		if endpoint := endpointForPath(path); endpoint != expected {
+			t.Errorf("endpointForPath(%q) = %q, expected %q", path, endpoint, expected)
+		}
+	}
+}
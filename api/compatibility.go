@@ -0,0 +1,108 @@
+package api
+
+import (
+	"cloud-guardian/cloudguardian_version"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProtocolVersion is the version of the payload schema the agent submits.
+// It is sent with every request, so the API can reject or translate payloads.
+const ProtocolVersion = "1"
+
+var (
+	minimumAgentVersion      string // Minimum agent version announced with the last response, empty if none
+	upgradeRequired          bool   // The last response was 426 Upgrade Required
+	minimumAgentVersionMutex sync.Mutex
+)
+
+// setVersionHeaders adds the agent and protocol version headers to the request
+func setVersionHeaders(req *http.Request) {
+	req.Header.Set("x-agent-version", cloudguardian_version.Version)
+	req.Header.Set("x-agent-protocol-version", ProtocolVersion)
+}
+
+// checkCompatibility records the minimum supported agent version announced by the
+// API with the x-min-agent-version header and whether the API answered with 426
+// Upgrade Required. Every response replaces the state of the previous one, so the
+// agent is compatible again once the API accepts it.
+func checkCompatibility(resp *http.Response) {
+	minimum := resp.Header.Get("x-min-agent-version")
+	required := resp.StatusCode == http.StatusUpgradeRequired
+	minimumAgentVersionMutex.Lock()
+	defer minimumAgentVersionMutex.Unlock()
+	if minimum == minimumAgentVersion && required == upgradeRequired {
+		return
+	}
+	wasIncompatible := isIncompatible()
+	minimumAgentVersion = minimum
+	upgradeRequired = required
+	if incompatible := isIncompatible(); incompatible && !wasIncompatible {
+		if minimum == "" {
+			minimum = "a newer version"
+		}
+		log.Println("WARNING: The API requires agent version", minimum, "or newer, running version is", cloudguardian_version.Version)
+	} else if !incompatible && wasIncompatible {
+		log.Println("The API supports agent version", cloudguardian_version.Version, "again")
+	}
+}
+
+// IsIncompatible reports whether the API rejected the running agent with 426
+// Upgrade Required or announced a minimum agent version that is newer than the
+// running agent.
+//
+// Returns:
+//   - bool: true if the running agent is not supported by the API
+//   - string: The announced minimum version, empty if the API announced none
+func IsIncompatible() (bool, string) {
+	minimumAgentVersionMutex.Lock()
+	defer minimumAgentVersionMutex.Unlock()
+	return isIncompatible(), minimumAgentVersion
+}
+
+// isIncompatible is IsIncompatible with the mutex held
+func isIncompatible() bool {
+	return upgradeRequired || (minimumAgentVersion != "" && IsIncompatibleVersion(cloudguardian_version.Version, minimumAgentVersion))
+}
+
+// IsIncompatibleVersion reports whether version is older than minimum.
+// Development builds and minimum versions without a parsable version are
+// considered compatible.
+func IsIncompatibleVersion(version string, minimum string) bool {
+	current, ok := parseVersion(version)
+	if !ok {
+		return false
+	}
+	required, ok := parseVersion(minimum)
+	if !ok {
+		return false
+	}
+	for i := range required {
+		if current[i] != required[i] {
+			return current[i] < required[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses versions like "v1.2.3" or "v1.2.3-4-gabcdef" into major, minor and patch
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	version = strings.TrimPrefix(version, "v")
+	version, _, _ = strings.Cut(version, "-")
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
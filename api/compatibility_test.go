@@ -0,0 +1,62 @@
+package api
+
+import (
+	"cloud-guardian/cloudguardian_version"
+	"net/http"
+	"testing"
+)
+
+func TestIsIncompatibleVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		minimum  string
+		expected bool
+	}{
+		{"v1.2.3", "1.2.3", false},
+		{"v1.2.3-4-gabcdef", "v1.2.4", true},
+		{"v1.10.0", "v1.9.9", false},
+		{"v0.9", "v1.0.0", true},
+		{"v2.0.0", "v1", false},
+		{"fdev", "v9.9.9", false},
+		{"v1.0.0", "unknown", false},
+		{"v1.0.0", "garbage", false},
+	}
+	for _, tt := range tests {
+		if result := IsIncompatibleVersion(tt.version, tt.minimum); result != tt.expected {
+			t.Errorf("IsIncompatibleVersion(%q, %q) = %v, want %v", tt.version, tt.minimum, result, tt.expected)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	originalVersion := cloudguardian_version.Version
+	cloudguardian_version.Version = "v1.2.0"
+	defer func() {
+		cloudguardian_version.Version = originalVersion
+		checkCompatibility(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}})
+	}()
+	respond := func(statusCode int, minimum string) {
+		header := http.Header{}
+		if minimum != "" {
+			header.Set("x-min-agent-version", minimum)
+		}
+		checkCompatibility(&http.Response{StatusCode: statusCode, Header: header})
+	}
+
+	respond(http.StatusOK, "v1.3.0")
+	if incompatible, minimum := IsIncompatible(); !incompatible || minimum != "v1.3.0" {
+		t.Errorf("Expected the announced minimum version v1.3.0, got %v %q", incompatible, minimum)
+	}
+	respond(http.StatusOK, "")
+	if incompatible, minimum := IsIncompatible(); incompatible || minimum != "" {
+		t.Errorf("Expected a response without a minimum version to clear it, got %v %q", incompatible, minimum)
+	}
+	respond(http.StatusUpgradeRequired, "")
+	if incompatible, minimum := IsIncompatible(); !incompatible || minimum != "" {
+		t.Errorf("Expected 426 without a minimum version to be incompatible without a version, got %v %q", incompatible, minimum)
+	}
+	respond(http.StatusNotFound, "")
+	if incompatible, _ := IsIncompatible(); incompatible {
+		t.Errorf("Expected any other response to clear the 426")
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	cloudguardian_logging "cloud-guardian/logging"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// debugBodies logs request and response headers and bodies at the debug level,
+// they are always logged at the trace level
+var debugBodies atomic.Bool
+
+// SetDebugBodies enables logging the request and response bodies at the debug
+// level. It may be changed while requests are sent, e.g. by a reload.
+func SetDebugBodies(enabled bool) {
+	debugBodies.Store(enabled)
+}
+
+const (
+	maxDebugBodySize = 4096         // Logged bodies are truncated to this size
+	redacted         = "[REDACTED]" // Replacement of secrets in the debug log
+)
+
+// redactedHeaders are never logged with their value
+var redactedHeaders = []string{"x-api-key", "x-signature", "authorization"}
+
+var (
+	redactedSecrets      []string // Secrets replaced in logged bodies, e.g. host security keys
+	redactedSecretsMutex sync.Mutex
+)
+
+// setRedactedSecrets sets the secrets that are replaced in logged bodies
+func setRedactedSecrets(secrets ...string) {
+	redactedSecretsMutex.Lock()
+	defer redactedSecretsMutex.Unlock()
+	redactedSecrets = nil
+	for _, secret := range secrets {
+		if secret != "" {
+			redactedSecrets = append(redactedSecrets, secret)
+		}
+	}
+}
+
+// addRedactedSecrets adds secrets that are replaced in logged bodies
+func addRedactedSecrets(secrets ...string) {
+	redactedSecretsMutex.Lock()
+	defer redactedSecretsMutex.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			redactedSecrets = append(redactedSecrets, secret)
+		}
+	}
+}
+
+// debugTransport logs requests and responses at the debug level, secrets are redacted
+type debugTransport struct {
+	next http.RoundTripper
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cloudguardian_logging.Enabled(cloudguardian_logging.LevelDebug) {
+		return t.next.RoundTrip(req)
+	}
+	apiKey := req.Header.Get("x-api-key")
+	logBodies := debugBodies.Load() || cloudguardian_logging.Enabled(cloudguardian_logging.LevelTrace)
+	if logBodies {
+		log.Printf("API request %s %s\n%s%s", req.Method, req.URL, redactHeaders(req.Header), requestBody(req, apiKey))
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		log.Printf("API %s %s failed after %s: %v", req.Method, req.URL, duration, err)
+		return resp, err
+	}
+	log.Printf("API %s %s -> %d (%s)", req.Method, req.URL, resp.StatusCode, duration)
+	if logBodies {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			// Hand the error to the caller like the original body would have
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{readErr}))
+		}
+		log.Printf("API response %s %s\n%s%s", req.Method, req.URL, redactHeaders(resp.Header), redactBody(req, body, apiKey))
+	}
+	return resp, nil
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// requestBody returns the redacted request body without consuming it.
+// Streamed bodies cannot be read twice and are not logged.
+func requestBody(req *http.Request, apiKey string) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody == nil {
+		return "(streamed body)"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "(body not available)"
+	}
+	defer body.Close()
+	data, _ := io.ReadAll(io.LimitReader(body, maxDebugBodySize+1))
+	return redactBody(req, data, apiKey)
+}
+
+// redactHeaders formats the headers, one per line, with the values of secret headers replaced
+func redactHeaders(header http.Header) string {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	var builder strings.Builder
+	header.Write(&builder)
+	return builder.String()
+}
+
+// redactBody replaces the API key and the host security keys in a body and truncates it.
+// Bodies of the security key endpoint are not logged at all.
+func redactBody(req *http.Request, body []byte, apiKey string) string {
+	if strings.HasSuffix(req.URL.Path, "/securitykeys") {
+		return redacted
+	}
+	text := string(body)
+	truncated := len(text) > maxDebugBodySize
+	if truncated {
+		text = text[:maxDebugBodySize]
+	}
+	redactedSecretsMutex.Lock()
+	secrets := append([]string{apiKey}, redactedSecrets...)
+	redactedSecretsMutex.Unlock()
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	if truncated {
+		text += "... (truncated)"
+	}
+	return text
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"bytes"
+	cloudguardian_logging "cloud-guardian/logging"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDebugTransportRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":200,"message":"ok","key":"hostsecretkey123"}`))
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+	cloudguardian_logging.SetLevel(cloudguardian_logging.LevelTrace)
+	setRedactedSecrets("hostsecretkey123")
+	defer func() {
+		log.SetOutput(os.Stderr)
+		cloudguardian_logging.SetLevel(cloudguardian_logging.LevelInfo)
+		setRedactedSecrets()
+	}()
+	log.SetOutput(&output)
+
+	statusCode, err := PostRequest(context.Background(), server.URL+"/hosts/ping/test", "abcdefgh12345678", map[string]string{"api_key": "abcdefgh12345678"})
+	if err != nil || statusCode != http.StatusOK {
+		t.Fatalf("PostRequest(context.Background(), ) = %d, %v", statusCode, err)
+	}
+	logged := output.String()
+	for _, secret := range []string{"abcdefgh12345678", "hostsecretkey123"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Secret %q was logged:\n%s", secret, logged)
+		}
+	}
+	for _, expected := range []string{"POST " + server.URL + "/hosts/ping/test -> 200", `"message":"ok"`, "X-Api-Key: " + redacted} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("Expected %q in the debug log:\n%s", expected, logged)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	downloadTimeout = 10 * time.Minute // Timeout of the download of an agent binary
+	maxDownloadSize = 256 << 20        // Larger downloads are aborted, agent binaries are much smaller
+)
+
+// DownloadAgent downloads an agent binary, e.g. for an update_agent job. URLs
+// below the API URL are requested with the API key, other URLs, e.g. presigned
+// URLs of an object storage, without it, so the key is not sent to third parties.
+//
+// Parameters:
+//   - url: The URL of the binary
+//   - apiUrl: The base URL of the API
+//   - apiKey: The API key for authentication
+//   - writer: Receives the binary
+//
+// Returns:
+//   - int64: The size of the binary in bytes
+//   - error: An error if the download failed, an *APIError for unexpected status codes
+func DownloadAgent(url string, apiUrl string, apiKey string, writer io.Writer) (int64, error) {
+	client, requestUrl := clientFor(url)
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return 0, err
+	}
+	setVersionHeaders(req)
+	if strings.HasPrefix(url, apiUrl) {
+		req.Header.Set("x-api-key", apiKey)
+		setMaintenanceHeaders(req)
+		signRequest(req, nil)
+	}
+	resp, err := doRequest(client, req)
+	if err != nil {
+		return 0, newTransportError(err)
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, newResponseError(resp, body)
+	}
+	size, err := io.Copy(writer, io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return size, err
+	}
+	if size > maxDownloadSize {
+		return size, fmt.Errorf("the download is larger than %d bytes", maxDownloadSize)
+	}
+	return size, nil
+}
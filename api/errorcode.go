@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// ErrorCode classifies a failure reported by the agent, so automation on the
+// server can branch on the code instead of matching messages.
+type ErrorCode string
+
+const (
+	ErrorCodePmLocked         ErrorCode = "PM_LOCKED"          // The package manager is locked by another process
+	ErrorCodeSignatureInvalid ErrorCode = "SIGNATURE_INVALID"  // The job payload signature could not be verified
+	ErrorCodeTimeout          ErrorCode = "TIMEOUT"            // An operation did not finish in time
+	ErrorCodeDiskFull         ErrorCode = "DISK_FULL"          // No space left on a device
+	ErrorCodePermission       ErrorCode = "PERMISSION_DENIED"  // The agent lacks the privileges for an operation
+	ErrorCodeInvalidJobData   ErrorCode = "INVALID_JOB_DATA"   // The job data could not be parsed or is invalid
+	ErrorCodeUnknownJobType   ErrorCode = "UNKNOWN_JOB_TYPE"   // The agent does not support the job type
+	ErrorCodeJobInterrupted   ErrorCode = "JOB_INTERRUPTED"    // The agent stopped while the job was running
+	ErrorCodeRebootFailed     ErrorCode = "REBOOT_FAILED"      // A reboot could not be initiated or did not happen
+	ErrorCodeCollectorFailed  ErrorCode = "COLLECTOR_FAILED"   // A monitoring collector failed
+	ErrorCodeInvalidApiKey    ErrorCode = "INVALID_API_KEY"    // The API rejected the API key
+	ErrorCodeRateLimited      ErrorCode = "RATE_LIMITED"       // The agent refused the job because of a local job rate limit
+	ErrorCodeRejectedByPolicy ErrorCode = "REJECTED_BY_POLICY" // The job policy of the host denies the job
+	ErrorCodeChecksumMismatch ErrorCode = "CHECKSUM_MISMATCH"  // A download does not match the checksum of the job
+	ErrorCodeCommandFailed    ErrorCode = "COMMAND_FAILED"     // A command failed for another reason
+)
+
+// CollectorError is a failed monitoring collector
+type CollectorError struct {
+	Collector string    `json:"collector"` // Field name of the collector in the monitoring payload
+	Code      ErrorCode `json:"code"`
+	Message   string    `json:"message"`
+}
+
+// errorPatterns map messages of commands to error codes, checked in order
+var errorPatterns = []struct {
+	pattern string
+	code    ErrorCode
+}{
+	{"could not get lock", ErrorCodePmLocked},
+	{"unable to acquire the dpkg frontend lock", ErrorCodePmLocked},
+	{"waiting for process with pid", ErrorCodePmLocked}, // yum and dnf
+	{"no space left on device", ErrorCodeDiskFull},
+	{"permission denied", ErrorCodePermission},
+	{"are you root", ErrorCodePermission},
+	{"operation not permitted", ErrorCodePermission},
+	{"timed out", ErrorCodeTimeout},
+}
+
+// ClassifyError derives the error code of a failed operation from the error and
+// the error output of the command, if any.
+//
+// Parameters:
+//   - err: The error of the operation
+//   - stderr: The error output of the command, empty if no command was run
+//
+// Returns:
+//   - ErrorCode: The error code, ErrorCodeCommandFailed if the failure is not recognized
+func ClassifyError(err error, stderr string) ErrorCode {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		return ErrorCodeTimeout
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorCodeDiskFull
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorCodePermission
+	}
+	message := strings.ToLower(stderr)
+	if err != nil {
+		message += "\n" + strings.ToLower(err.Error())
+	}
+	for _, p := range errorPatterns {
+		if strings.Contains(message, p.pattern) {
+			return p.code
+		}
+	}
+	return ErrorCodeCommandFailed
+}
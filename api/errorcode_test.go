@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err    error
+		stderr string
+		code   ErrorCode
+	}{
+		{errors.New("command failed"), "E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 1234 (apt)", ErrorCodePmLocked},
+		{errors.New("command failed"), "dpkg: error: failed to write status database record about 'libc6' to '/var/lib/dpkg/status': No space left on device", ErrorCodeDiskFull},
+		{fmt.Errorf("run: %w", context.DeadlineExceeded), "", ErrorCodeTimeout},
+		{fmt.Errorf("open: %w", os.ErrPermission), "", ErrorCodePermission},
+		{errors.New("command failed"), "E: Unable to locate package foo", ErrorCodeCommandFailed},
+	}
+	for _, test := range tests {
+		if code := ClassifyError(test.err, test.stderr); code != test.code {
+			t.Errorf("Expected %s for %q, got %s", test.code, test.stderr, code)
+		}
+	}
+}
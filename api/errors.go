@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// requestIdHeaders are the response headers that may contain the request ID assigned by the API or a proxy
+var requestIdHeaders = []string{"x-request-id", "x-amzn-requestid", "x-correlation-id"}
+
+// APIError is returned for failed requests. It carries the HTTP status code, the
+// message of the API and the request ID, so failures can be classified and traced.
+type APIError struct {
+	StatusCode int    // HTTP status code, 0 if no response was received
+	Message    string // Message of the API, or the raw response body
+	RequestID  string // Request ID of the response, if any
+	Err        error  // Underlying transport error, if no response was received
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.StatusCode)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (status code %d, request ID %s)", message, e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("%s (status code %d)", message, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable reports whether the request may succeed when it is retried later.
+// Transport errors, server errors, timeouts and rate limiting are retryable,
+// other client errors need a change of the request or the configuration.
+func (e *APIError) IsRetryable() bool {
+	switch {
+	case e.StatusCode == 0:
+		return true
+	case e.StatusCode >= 500:
+		return true
+	case e.StatusCode == http.StatusRequestTimeout, e.StatusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// newResponseError creates an APIError from an unsuccessful response.
+//
+// Parameters:
+//   - resp: The response of the API
+//   - body: The response body, a JSON object with a "message" field if sent by the API
+//
+// Returns:
+//   - *APIError: The error describing the response
+func newResponseError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	var errorResponse struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Message != "" {
+		apiErr.Message = errorResponse.Message
+	}
+	for _, header := range requestIdHeaders {
+		if requestId := resp.Header.Get(header); requestId != "" {
+			apiErr.RequestID = requestId
+			break
+		}
+	}
+	return apiErr
+}
+
+// newTransportError creates an APIError for a request that did not receive a response.
+func newTransportError(err error) *APIError {
+	return &APIError{Err: err}
+}
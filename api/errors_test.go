@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIErrorIsRetryable(t *testing.T) {
+	tests := map[int]bool{
+		0:                              true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusTooManyRequests:     true,
+		http.StatusRequestTimeout:      true,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusBadRequest:          false,
+	}
+	for statusCode, expected := range tests {
+		if retryable := (&APIError{StatusCode: statusCode}).IsRetryable(); retryable != expected {
+			t.Errorf("IsRetryable() for status code %d = %v, expected %v", statusCode, retryable, expected)
+		}
+	}
+}
+
+func TestRequestReturnsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-request-id", "req-42")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code":400,"message":"invalid payload"}`)
+	}))
+	defer server.Close()
+
+	statusCode, err := PostRequest(context.Background(), server.URL+"/hosts/ping/host1", "abcdefghijklmnop", map[string]any{})
+	var apiErr *APIError
+	if statusCode != http.StatusBadRequest || !errors.As(err, &apiErr) {
+		t.Fatalf("PostRequest(context.Background(), ) = %d, %v", statusCode, err)
+	}
+	if apiErr.Message != "invalid payload" || apiErr.RequestID != "req-42" || apiErr.IsRetryable() {
+		t.Errorf("Unexpected API error: %+v", apiErr)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// JobResult is the structured result of a job. It is sent as a JSON encoded
+// string in the result field of a job, so the API and the agent do not have
+// to parse free text. Results of older agents are plain text.
+type JobResult struct {
+	ExitCode   int               `json:"exit_code"`
+	ErrorCode  ErrorCode         `json:"error_code,omitempty"` // Classification of the failure, empty if the job succeeded
+	Message    string            `json:"message,omitempty"`    // Human readable summary
+	Stdout     string            `json:"stdout,omitempty"`
+	Stderr     string            `json:"stderr,omitempty"`
+	StartedAt  string            `json:"started_at,omitempty"`  // RFC 3339
+	FinishedAt string            `json:"finished_at,omitempty"` // RFC 3339, empty while the job is running
+	Metadata   map[string]string `json:"metadata,omitempty"`    // Job type specific fields, e.g. the uptime before a reboot
+	Rollout    *RolloutResult    `json:"rollout,omitempty"`     // Rollout of the job with its outcome, only in final results
+	Output     *JobOutput        `json:"output,omitempty"`      // Output appended since the last update, only in running results
+}
+
+// JobOutput is the output a running job appended since its last status update.
+// The offsets are the positions of the chunks in the whole output of the job, so
+// the API can append the chunks in order and detect dropped output. The final
+// result carries the whole output in Stdout and Stderr.
+type JobOutput struct {
+	Sequence     int    `json:"sequence"`         // Counts the output updates of the job, starting with 1
+	Stdout       string `json:"stdout,omitempty"` // Standard output appended since the last update
+	StdoutOffset int64  `json:"stdout_offset"`    // Position of Stdout in the standard output of the job
+	Stderr       string `json:"stderr,omitempty"` // Standard error output appended since the last update
+	StderrOffset int64  `json:"stderr_offset"`    // Position of Stderr in the standard error output of the job
+}
+
+// Rollout identifies the batch of a staged rollout a job belongs to, e.g. the canary
+// batch of an update. The API sends it with the job and the agent echoes it with the
+// final result, so the API can decide on the next wave with the outcome of the hosts.
+type Rollout struct {
+	Id     string `json:"id"`
+	Batch  int    `json:"batch"`
+	Canary bool   `json:"canary,omitempty"`
+}
+
+// RolloutResult is the rollout of a job together with the outcome of the job
+type RolloutResult struct {
+	Rollout
+	DurationMs int64 `json:"duration_ms"` // Time from the start to the end of the job
+	Success    bool  `json:"success"`     // The job completed, or was simulated in dry-run mode
+}
+
+// String encodes the result as JSON for the result field of a job.
+func (r JobResult) String() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r.Message
+	}
+	return string(data)
+}
+
+// ParseJobResult decodes a structured job result.
+//
+// Parameters:
+//   - result: The result field of a job
+//
+// Returns:
+//   - JobResult: The decoded result
+//   - bool: false if the result is a plain text result of an older agent
+func ParseJobResult(result string) (JobResult, bool) {
+	var jobResult JobResult
+	if !strings.HasPrefix(strings.TrimSpace(result), "{") {
+		return jobResult, false
+	}
+	if err := json.Unmarshal([]byte(result), &jobResult); err != nil {
+		return JobResult{}, false
+	}
+	return jobResult, true
+}
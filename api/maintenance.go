@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Headers of the maintenance mode, they are sent with every request while the
+// host is in maintenance mode, so the API suppresses the alerts of all payloads
+// and keeps recording their data
+const (
+	maintenanceHeader      = "x-maintenance"       // "true" while the host is in maintenance mode
+	maintenanceUntilHeader = "x-maintenance-until" // End of the maintenance mode, RFC 3339, missing if it has no end
+)
+
+var (
+	maintenance      bool
+	maintenanceUntil string
+	maintenanceMutex sync.Mutex
+)
+
+// SetMaintenance sets the maintenance mode announced with every request.
+//
+// Parameters:
+//   - enabled: true while the host is in maintenance mode
+//   - until: The end of the maintenance mode, RFC 3339, empty if it has no end
+func SetMaintenance(enabled bool, until string) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	maintenance, maintenanceUntil = enabled, until
+	if !enabled {
+		maintenanceUntil = ""
+	}
+}
+
+// setMaintenanceHeaders adds the maintenance headers to the request while the
+// host is in maintenance mode
+func setMaintenanceHeaders(req *http.Request) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	if !maintenance {
+		return
+	}
+	req.Header.Set(maintenanceHeader, "true")
+	if maintenanceUntil != "" {
+		req.Header.Set(maintenanceUntilHeader, maintenanceUntil)
+	}
+}
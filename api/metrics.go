@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// endpointCounters are the raw counters of an endpoint
+type endpointCounters struct {
+	requests     int64
+	errors       int64
+	totalLatency time.Duration
+	maxLatency   time.Duration
+	lastStatus   int
+	transfer     EndpointVolume
+}
+
+// EndpointStats are the request statistics of an API endpoint
+type EndpointStats struct {
+	Requests       int64   `json:"requests"`
+	Errors         int64   `json:"errors"`     // Transport errors and error status codes
+	ErrorRate      float64 `json:"error_rate"` // Errors per request, between 0 and 1
+	AvgLatencyMs   int64   `json:"avg_latency_ms"`
+	MaxLatencyMs   int64   `json:"max_latency_ms"`
+	LastStatusCode int     `json:"last_status_code"` // 0 if no response was received
+	BytesSent      int64   `json:"bytes_sent"`       // Request lines, headers and bodies
+	BytesReceived  int64   `json:"bytes_received"`   // Status lines, headers and bodies
+}
+
+// EndpointVolume is the data sent to and received from an API endpoint
+type EndpointVolume struct {
+	BytesSent     int64 `json:"bytes_sent"`
+	BytesReceived int64 `json:"bytes_received"`
+}
+
+// DataVolume is the data sent to and received from the API on a day, so customers
+// on metered links can see how much bandwidth the agent uses
+type DataVolume struct {
+	Date          string                    `json:"date"` // UTC day, YYYY-MM-DD
+	BytesSent     int64                     `json:"bytes_sent"`
+	BytesReceived int64                     `json:"bytes_received"`
+	Endpoints     map[string]EndpointVolume `json:"endpoints"`
+}
+
+// add adds transferred bytes to the day and the endpoint
+func (v *DataVolume) add(endpoint string, sent int64, received int64) {
+	v.BytesSent += sent
+	v.BytesReceived += received
+	volume := v.Endpoints[endpoint]
+	volume.BytesSent += sent
+	volume.BytesReceived += received
+	v.Endpoints[endpoint] = volume
+}
+
+// RequestMetrics tracks the request count, latency and errors of each API endpoint,
+// so hosts with a degraded connection to the API can be spotted.
+type RequestMetrics struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointCounters
+	today     DataVolume  // Data volume of the current UTC day
+	yesterday *DataVolume // Data volume of the previous day, nil if nothing was transferred
+}
+
+// Metrics contains the request metrics of all requests sent by HTTPClient
+var Metrics = NewRequestMetrics()
+
+// NewRequestMetrics creates empty request metrics
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{endpoints: map[string]*endpointCounters{}}
+}
+
+// counters returns the counters of an endpoint, m.mu must be held
+func (m *RequestMetrics) counters(endpoint string) *endpointCounters {
+	counters, ok := m.endpoints[endpoint]
+	if !ok {
+		counters = &endpointCounters{}
+		m.endpoints[endpoint] = counters
+	}
+	return counters
+}
+
+// Record adds the result of a request to the endpoint metrics.
+// Expected "not found" answers, e.g. when a host has no jobs, are not errors.
+func (m *RequestMetrics) Record(endpoint string, latency time.Duration, statusCode int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters := m.counters(endpoint)
+	counters.requests++
+	counters.totalLatency += latency
+	counters.maxLatency = max(counters.maxLatency, latency)
+	counters.lastStatus = statusCode
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 0 {
+		counters.lastStatus = 0 // No response was received
+	}
+	if counters.lastStatus == 0 || (statusCode >= 400 && statusCode != http.StatusNotFound) {
+		counters.errors++
+	}
+}
+
+// RecordTransfer adds bytes sent to or received from an endpoint to the endpoint
+// metrics and the data volume of the day.
+func (m *RequestMetrics) RecordTransfer(endpoint string, sent int64, received int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters := m.counters(endpoint)
+	counters.transfer.BytesSent += sent
+	counters.transfer.BytesReceived += received
+	m.rollDay(time.Now())
+	m.today.add(endpoint, sent, received)
+}
+
+// rollDay starts a new data volume when the UTC day changed, m.mu must be held
+func (m *RequestMetrics) rollDay(now time.Time) {
+	date := now.UTC().Format(time.DateOnly)
+	if m.today.Date == date {
+		return
+	}
+	m.yesterday = nil
+	if m.today.Endpoints != nil && m.today.Date == now.UTC().AddDate(0, 0, -1).Format(time.DateOnly) {
+		yesterday := m.today
+		m.yesterday = &yesterday
+	}
+	m.today = DataVolume{Date: date, Endpoints: map[string]EndpointVolume{}}
+}
+
+// DataVolume returns the data volume of the previous and the current UTC day, the
+// previous day is left out if nothing was transferred on it.
+//
+// Returns:
+//   - []DataVolume: The data volume by day, oldest first
+func (m *RequestMetrics) DataVolume() []DataVolume {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollDay(time.Now())
+	volumes := []DataVolume{}
+	for _, volume := range []*DataVolume{m.yesterday, &m.today} {
+		if volume == nil {
+			continue
+		}
+		endpoints := make(map[string]EndpointVolume, len(volume.Endpoints))
+		for endpoint, transfer := range volume.Endpoints {
+			endpoints[endpoint] = transfer
+		}
+		copied := *volume
+		copied.Endpoints = endpoints
+		volumes = append(volumes, copied)
+	}
+	return volumes
+}
+
+// Snapshot returns the statistics of all endpoints.
+//
+// Parameters:
+//   - reset: Clear the counters, so the next snapshot only covers new requests
+//
+// Returns:
+//   - map[string]EndpointStats: The statistics by endpoint
+func (m *RequestMetrics) Snapshot(reset bool) map[string]EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := map[string]EndpointStats{}
+	for endpoint, counters := range m.endpoints {
+		endpointStats := EndpointStats{
+			Requests:       counters.requests,
+			Errors:         counters.errors,
+			MaxLatencyMs:   counters.maxLatency.Milliseconds(),
+			LastStatusCode: counters.lastStatus,
+			BytesSent:      counters.transfer.BytesSent,
+			BytesReceived:  counters.transfer.BytesReceived,
+		}
+		if counters.requests > 0 { // Bytes of a request may be counted before the request is recorded
+			endpointStats.ErrorRate = float64(counters.errors) / float64(counters.requests)
+			endpointStats.AvgLatencyMs = (counters.totalLatency / time.Duration(counters.requests)).Milliseconds()
+		}
+		stats[endpoint] = endpointStats
+	}
+	if reset {
+		m.endpoints = map[string]*endpointCounters{}
+	}
+	return stats
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// StreamingThreshold is the number of records from which uploads are streamed as NDJSON
+// instead of being sent as a single JSON document
+var StreamingThreshold = 5000
+
+// PostNDJSONRequest streams the records as newline delimited JSON to the specified
+// URL, so the request body is never held in memory as a whole. The records are
+// encoded twice when signing is enabled: once to compute the body hash for the
+// signature and once while sending.
+//
+// Parameters:
+//   - ctx: The context of the request, with the span of the calling task
+//   - url: The URL to send the records to
+//   - apiKey: The API key for authentication
+//   - schemaVersion: The schema version of the payload, sent in the x-schema-version header
+//   - records: The records, each one is written as a single line
+//
+// Returns:
+//   - int: The HTTP status code of the response
+//   - error: An *APIError if the status code is not 200
+func PostNDJSONRequest(ctx context.Context, url string, apiKey string, schemaVersion int, records []map[string]string) (int, error) {
+	client, url := clientFor(url)
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	bodyReader, bodyWriter := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bodyReader)
+	if err != nil {
+		log.Println("Error creating request:", err.Error())
+		return 500, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(schemaVersionHeader, strconv.Itoa(schemaVersion))
+	req.Header.Set("x-api-key", apiKey)
+	setVersionHeaders(req)
+	setMaintenanceHeaders(req)
+	if signs(req) {
+		hash := sha256.New()
+		if err := writeNDJSON(hash, records); err != nil {
+			return 500, err
+		}
+		signRequestWithHash(req, hex.EncodeToString(hash.Sum(nil)))
+	}
+
+	span := startRequestSpan(req)
+	go func() {
+		bodyWriter.CloseWithError(writeNDJSON(bodyWriter, records))
+	}()
+	resp, err := doRequest(client, req)
+	bodyReader.Close() // Stops the writer if the request failed before the body was read
+	if err != nil {
+		endRequestSpan(span, 0, err)
+		Breaker.Record(0, err)
+		log.Println("Error sending request:", err.Error())
+		return 500, newTransportError(err)
+	}
+	Breaker.Record(resp.StatusCode, nil)
+	checkCompatibility(resp)
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := newResponseError(resp, body)
+		endRequestSpan(span, resp.StatusCode, apiErr)
+		return resp.StatusCode, apiErr
+	}
+	endRequestSpan(span, resp.StatusCode, nil)
+	return resp.StatusCode, nil
+}
+
+// writeNDJSON encodes each record as a single JSON line.
+func writeNDJSON(w io.Writer, records []map[string]string) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
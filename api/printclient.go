@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// errLocalMode is returned by the PrintClient for requests that need the API
+var errLocalMode = &APIError{StatusCode: http.StatusNotFound, Err: fmt.Errorf("not available in local mode")}
+
+// PrintClient implements Client by writing the payloads as JSON instead of sending
+// them, so users can inspect the data before enrolling a host. Every submission is
+// written as an object with the endpoint, the request path and the payload.
+// Large package inventories are written as one JSON document, not as NDJSON.
+type PrintClient struct {
+	Writer io.Writer
+	mu     sync.Mutex
+}
+
+// NewPrintClient creates a PrintClient that writes to writer
+func NewPrintClient(writer io.Writer) *PrintClient {
+	return &PrintClient{Writer: writer}
+}
+
+// print writes a payload, it always succeeds with 200 so the tasks do not retry
+func (c *PrintClient) print(endpoint string, path string, payload any) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	encoder := json.NewEncoder(c.Writer)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(map[string]any{
+		"endpoint": endpoint,
+		"path":     path,
+		"payload":  payload,
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+func (c *PrintClient) Register(ctx context.Context, hostname string, labels map[string]string) (int, string, error) {
+	statusCode, err := c.print("register", "hosts/register/"+hostname, registerPayload(labels))
+	return statusCode, "", err
+}
+
+func (c *PrintClient) Deregister(ctx context.Context, hostname string) (int, error) {
+	return errLocalMode.StatusCode, errLocalMode
+}
+
+func (c *PrintClient) FetchSecurityKeys(ctx context.Context) (int, []string, error) {
+	return errLocalMode.StatusCode, nil, errLocalMode
+}
+
+func (c *PrintClient) Ping(ctx context.Context, hostname string, heartbeat Heartbeat) (int, error) {
+	heartbeat.SchemaVersion = PingSchemaVersion
+	return c.print("ping", "hosts/ping/"+hostname, heartbeat)
+}
+
+func (c *PrintClient) SubmitMonitoring(ctx context.Context, hostname string, data Monitoring) (int, error) {
+	data.SchemaVersion = MonitoringSchemaVersion
+	return c.print("monitoring", "hosts/monitoring/"+hostname, data)
+}
+
+func (c *PrintClient) SubmitSystemInfo(ctx context.Context, hostname string, data SystemInfo) (int, error) {
+	data.SchemaVersion = SystemInfoSchemaVersion
+	return c.print("system_info", "hosts/osinfo/"+hostname, data)
+}
+
+func (c *PrintClient) SubmitPackages(ctx context.Context, hostname string, packages []map[string]string) (int, error) {
+	return c.print("packages", "hosts/packages/"+hostname, Packages{SchemaVersion: PackagesSchemaVersion, Packages: packages})
+}
+
+func (c *PrintClient) SubmitPackageDelta(ctx context.Context, hostname string, delta map[string]any) (int, error) {
+	return c.print("package_delta", "hosts/packages/"+hostname+"/delta", withSchemaVersion(PackageDeltaSchemaVersion, delta))
+}
+
+func (c *PrintClient) SubmitUpdates(ctx context.Context, hostname string, security bool, updates []map[string]string, size *UpdateSize) (int, error) {
+	return c.print("updates", fmt.Sprintf("hosts/updates/%s?security=%t", hostname, security), updatesPayload(updates, size))
+}
+
+func (c *PrintClient) SubmitServiceFiles(ctx context.Context, hostname string, data map[string]any) (int, error) {
+	return c.print("service_files", "hosts/servicefiles/"+hostname, withSchemaVersion(ServiceFilesSchemaVersion, data))
+}
+
+func (c *PrintClient) FetchJobs(ctx context.Context, hostname string, status string) (int, []HostJob, error) {
+	return errLocalMode.StatusCode, nil, errLocalMode
+}
+
+func (c *PrintClient) WaitForJobs(ctx context.Context, hostname string, timeout int) (int, []HostJob, error) {
+	return errLocalMode.StatusCode, nil, errLocalMode
+}
+
+func (c *PrintClient) UpdateJob(ctx context.Context, jobId string, status string, result string) (int, error) {
+	return errLocalMode.StatusCode, errLocalMode
+}
+
+func (c *PrintClient) SubmitJobLogs(ctx context.Context, jobId string, lines []string) (int, error) {
+	return errLocalMode.StatusCode, errLocalMode
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// printedPayload is an entry written by the PrintClient
+type printedPayload struct {
+	Endpoint string         `json:"endpoint"`
+	Path     string         `json:"path"`
+	Payload  map[string]any `json:"payload"`
+}
+
+func TestPrintClient(t *testing.T) {
+	var output bytes.Buffer
+	client := NewPrintClient(&output)
+
+	if statusCode, err := client.SubmitMonitoring(context.Background(), "host1", Monitoring{Uptime: 42}); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("SubmitMonitoring() = %d, %v", statusCode, err)
+	}
+	if _, err := client.SubmitUpdates(context.Background(), "host1", true, []map[string]string{{"name": "openssl"}}, nil); err != nil {
+		t.Fatalf("SubmitUpdates() error: %v", err)
+	}
+
+	decoder := json.NewDecoder(&output)
+	var printed []printedPayload
+	for {
+		var entry printedPayload
+		if err := decoder.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Invalid JSON output: %v", err)
+		}
+		printed = append(printed, entry)
+	}
+	if len(printed) != 2 {
+		t.Fatalf("Expected 2 payloads, got %d", len(printed))
+	}
+	if printed[0].Endpoint != "monitoring" || printed[0].Path != "hosts/monitoring/host1" {
+		t.Errorf("Unexpected monitoring entry: %+v", printed[0])
+	}
+	if printed[0].Payload["Uptime"] != float64(42) || printed[0].Payload["schema_version"] != float64(MonitoringSchemaVersion) {
+		t.Errorf("Expected the monitoring payload with its schema version, got %v", printed[0].Payload)
+	}
+	if printed[1].Path != "hosts/updates/host1?security=true" {
+		t.Errorf("Unexpected updates path: %s", printed[1].Path)
+	}
+
+	var apiErr *APIError
+	if _, _, err := client.FetchJobs(context.Background(), "host1", "pending"); !errors.As(err, &apiErr) {
+		t.Errorf("Expected an APIError for jobs in local mode, got %v", err)
+	}
+}
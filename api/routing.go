@@ -0,0 +1,129 @@
+package api
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// RoutingClient sends submissions to the client of the tenant they are routed to
+// and all other requests to the default client. The host is registered with the
+// default API and every tenant, so each of them knows the host.
+type RoutingClient struct {
+	Default Client            // Client of api_url
+	Routes  map[string]Client // Clients of the tenants by route, see cloudguardian_config.TenantRoutes
+	Tenants map[string]Client // Clients of the tenants by name
+}
+
+// NewClient creates the API client of a configuration. Submissions routed to
+// tenants are sent with the API URL and key of the tenant.
+//
+// Parameters:
+//   - config: The configuration
+//
+// Returns:
+//   - Client: An *HTTPClient, or a *RoutingClient if tenants are configured
+func NewClient(config *cloudguardian_config.CloudGuardianConfig) Client {
+	defaultClient := NewHTTPClient(config.ApiUrl, config.ApiKey, config.FallbackApiUrls()...)
+	if len(config.Tenants) == 0 {
+		return defaultClient
+	}
+	client := &RoutingClient{Default: defaultClient, Routes: map[string]Client{}, Tenants: map[string]Client{}}
+	for _, tenant := range config.Tenants {
+		apiUrl := tenant.ApiUrl
+		if !strings.HasSuffix(apiUrl, "/") {
+			apiUrl += "/"
+		}
+		addRedactedSecrets(tenant.ApiKey)
+		tenantClient := NewHTTPClient(apiUrl, tenant.ApiKey)
+		client.Tenants[tenant.Name] = tenantClient
+		for _, route := range tenant.Routes {
+			client.Routes[route] = tenantClient
+		}
+	}
+	return client
+}
+
+// route returns the client of a route
+func (c *RoutingClient) route(route string) Client {
+	if client, ok := c.Routes[route]; ok {
+		return client
+	}
+	return c.Default
+}
+
+// Register registers the host with the default API and every tenant. The result of
+// the default API is returned, tenant failures are logged and retried with the next
+// registration, e.g. when a tenant answers a submission with 404. The signing
+// secret is the one of the default API, requests to tenants are not signed.
+func (c *RoutingClient) Register(ctx context.Context, hostname string, labels map[string]string) (int, string, error) {
+	statusCode, signingSecret, err := c.Default.Register(ctx, hostname, labels)
+	for name, tenant := range c.Tenants {
+		if tenantStatus, _, tenantErr := tenant.Register(ctx, hostname, labels); tenantErr != nil || tenantStatus != http.StatusOK {
+			log.Println("Error registering the host with tenant", name, "- Status code:", tenantStatus, "Error:", tenantErr)
+		}
+	}
+	return statusCode, signingSecret, err
+}
+
+// Deregister removes the host from the default API and every tenant. The result of
+// the default API is returned, tenant failures are logged.
+func (c *RoutingClient) Deregister(ctx context.Context, hostname string) (int, error) {
+	statusCode, err := c.Default.Deregister(ctx, hostname)
+	for name, tenant := range c.Tenants {
+		if tenantStatus, tenantErr := tenant.Deregister(ctx, hostname); tenantErr != nil || tenantStatus != http.StatusOK {
+			log.Println("Error deregistering the host from tenant", name, "- Status code:", tenantStatus, "Error:", tenantErr)
+		}
+	}
+	return statusCode, err
+}
+
+func (c *RoutingClient) FetchSecurityKeys(ctx context.Context) (int, []string, error) {
+	return c.Default.FetchSecurityKeys(ctx)
+}
+
+func (c *RoutingClient) Ping(ctx context.Context, hostname string, heartbeat Heartbeat) (int, error) {
+	return c.route("ping").Ping(ctx, hostname, heartbeat)
+}
+
+func (c *RoutingClient) SubmitMonitoring(ctx context.Context, hostname string, data Monitoring) (int, error) {
+	return c.route("monitoring").SubmitMonitoring(ctx, hostname, data)
+}
+
+func (c *RoutingClient) SubmitSystemInfo(ctx context.Context, hostname string, data SystemInfo) (int, error) {
+	return c.route("system_info").SubmitSystemInfo(ctx, hostname, data)
+}
+
+func (c *RoutingClient) SubmitPackages(ctx context.Context, hostname string, packages []map[string]string) (int, error) {
+	return c.route("packages").SubmitPackages(ctx, hostname, packages)
+}
+
+func (c *RoutingClient) SubmitPackageDelta(ctx context.Context, hostname string, delta map[string]any) (int, error) {
+	return c.route("packages").SubmitPackageDelta(ctx, hostname, delta)
+}
+
+func (c *RoutingClient) SubmitUpdates(ctx context.Context, hostname string, security bool, updates []map[string]string, size *UpdateSize) (int, error) {
+	return c.route("updates").SubmitUpdates(ctx, hostname, security, updates, size)
+}
+
+func (c *RoutingClient) SubmitServiceFiles(ctx context.Context, hostname string, data map[string]any) (int, error) {
+	return c.route("service_files").SubmitServiceFiles(ctx, hostname, data)
+}
+
+func (c *RoutingClient) FetchJobs(ctx context.Context, hostname string, status string) (int, []HostJob, error) {
+	return c.Default.FetchJobs(ctx, hostname, status)
+}
+
+func (c *RoutingClient) WaitForJobs(ctx context.Context, hostname string, timeout int) (int, []HostJob, error) {
+	return c.Default.WaitForJobs(ctx, hostname, timeout)
+}
+
+func (c *RoutingClient) UpdateJob(ctx context.Context, jobId string, status string, result string) (int, error) {
+	return c.Default.UpdateJob(ctx, jobId, status, result)
+}
+
+func (c *RoutingClient) SubmitJobLogs(ctx context.Context, jobId string, lines []string) (int, error) {
+	return c.Default.SubmitJobLogs(ctx, jobId, lines)
+}
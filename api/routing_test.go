@@ -0,0 +1,84 @@
+package api
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// recordingServer is an API server that records the paths of the requests it receives
+func recordingServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, `{"code":200}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, paths...)
+	}
+}
+
+func TestRoutingClient(t *testing.T) {
+	msp, mspPaths := recordingServer(t)
+	customer, customerPaths := recordingServer(t)
+	config := cloudguardian_config.DefaultConfig()
+	config.ApiUrl = msp.URL + "/v1/"
+	config.ApiKey = "abcdefghijklmnop"
+	config.Tenants = []cloudguardian_config.Tenant{
+		{Name: "customer", ApiUrl: customer.URL + "/v1", ApiKey: "ponmlkjihgfedcba", Routes: []string{"packages", "updates"}},
+	}
+
+	client := NewClient(config)
+	client.Register(context.Background(), "host1", nil)
+	client.SubmitMonitoring(context.Background(), "host1", Monitoring{})
+	client.SubmitUpdates(context.Background(), "host1", false, []map[string]string{}, nil)
+	client.SubmitPackageDelta(context.Background(), "host1", map[string]any{})
+	client.UpdateJob(context.Background(), "job1", "running", "")
+
+	expectedMsp := []string{"/v1/hosts/register/host1", "/v1/hosts/monitoring/host1", "/v1/jobs/job1"}
+	if paths := mspPaths(); !reflect.DeepEqual(paths, expectedMsp) {
+		t.Errorf("Expected the default API to receive %v, got %v", expectedMsp, paths)
+	}
+	expectedCustomer := []string{"/v1/hosts/register/host1", "/v1/hosts/updates/host1", "/v1/hosts/packages/host1/delta"}
+	if paths := customerPaths(); !reflect.DeepEqual(paths, expectedCustomer) {
+		t.Errorf("Expected the tenant to receive %v, got %v", expectedCustomer, paths)
+	}
+
+	config.Tenants = nil
+	if _, ok := NewClient(config).(*HTTPClient); !ok {
+		t.Error("Expected an HTTPClient without tenants")
+	}
+}
+
+func TestRoutingClientDeregister(t *testing.T) {
+	msp, mspPaths := recordingServer(t)
+	customer, customerPaths := recordingServer(t)
+	config := cloudguardian_config.DefaultConfig()
+	config.ApiUrl = msp.URL + "/v1/"
+	config.ApiKey = "abcdefghijklmnop"
+	config.Tenants = []cloudguardian_config.Tenant{
+		{Name: "customer", ApiUrl: customer.URL + "/v1", ApiKey: "ponmlkjihgfedcba", Routes: []string{"packages"}},
+	}
+
+	if statusCode, err := NewClient(config).Deregister(context.Background(), "host1"); err != nil || statusCode != http.StatusOK {
+		t.Fatalf("Expected the host to be deregistered, got %d %v", statusCode, err)
+	}
+	expected := []string{"/v1/hosts/deregister/host1"}
+	if paths := mspPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected the default API to receive %v, got %v", expected, paths)
+	}
+	if paths := customerPaths(); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected the tenant to receive %v, got %v", expected, paths)
+	}
+}
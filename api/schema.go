@@ -0,0 +1,171 @@
+package api
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	linux_df "cloud-guardian/linux/df"
+	linux_dmi "cloud-guardian/linux/dmi"
+	linux_ip "cloud-guardian/linux/ip"
+	linux_kmodules "cloud-guardian/linux/kmodules"
+	linux_loggedinusers "cloud-guardian/linux/loggedinusers"
+	linux_lsblk "cloud-guardian/linux/lsblk"
+	linux_mdstat "cloud-guardian/linux/mdstat"
+	linux_needrestart "cloud-guardian/linux/needrestart"
+	linux_pmhealth "cloud-guardian/linux/pmhealth"
+	linux_power "cloud-guardian/linux/power"
+	linux_quota "cloud-guardian/linux/quota"
+	linux_remotemgmt "cloud-guardian/linux/remotemgmt"
+	linux_timeinfo "cloud-guardian/linux/timeinfo"
+	linux_top "cloud-guardian/linux/top"
+)
+
+// Schema versions of the submitted payloads. The version of a payload is increased
+// when a field is renamed, removed or changes its meaning, so the API can tell the
+// payloads of older agents apart and keep accepting them. Adding a field does not
+// require a new version.
+const (
+	RegisterSchemaVersion     = 1
+	PingSchemaVersion         = 1
+	MonitoringSchemaVersion   = 1
+	SystemInfoSchemaVersion   = 1
+	PackagesSchemaVersion     = 1
+	PackageDeltaSchemaVersion = 1
+	UpdatesSchemaVersion      = 1
+	ServiceFilesSchemaVersion = 1
+	JobUpdateSchemaVersion    = 1
+	JobLogsSchemaVersion      = 1
+)
+
+const (
+	schemaVersionField  = "schema_version"   // Field with the schema version in JSON payloads
+	schemaVersionHeader = "x-schema-version" // Header with the schema version of streamed payloads
+)
+
+// Heartbeat is the current version of the ping payload
+type Heartbeat = HeartbeatV1
+
+// HeartbeatV1 is version 1 of the ping payload
+type HeartbeatV1 struct {
+	SchemaVersion  int                         `json:"schema_version"`
+	Degraded       bool                        `json:"degraded"`                  // The agent backs off because of persistent API failures
+	DegradedReason string                      `json:"degraded_reason,omitempty"` // Why the agent is degraded
+	DegradedCode   ErrorCode                   `json:"degraded_code,omitempty"`   // Error code of the degraded state
+	DegradedSince  string                      `json:"degraded_since,omitempty"`  // Start of the degraded state, RFC 3339
+	Paused         bool                        `json:"paused"`                    // Jobs and submissions are paused by an operator, see the pause command
+	PausedReason   string                      `json:"paused_reason,omitempty"`   // Why the agent is paused
+	Maintenance    *MaintenanceMode            `json:"maintenance,omitempty"`     // The host is in maintenance mode, alerts are suppressed
+	Config         cloudguardian_config.Source `json:"config"`                    // The loaded configuration file
+	DataVolume     []DataVolume                `json:"data_volume"`               // Bytes sent to and received from the API by day
+}
+
+// Monitoring is the current version of the monitoring payload
+type Monitoring = MonitoringV1
+
+// MonitoringV1 is version 1 of the monitoring payload. The field names are part
+// of the schema and must not change within a version.
+type MonitoringV1 struct {
+	SchemaVersion      int                                 `json:"schema_version"`
+	Uptime             int64                               `json:"Uptime"`
+	LoadAverage        linux_top.LoadAverage               `json:"LoadAverage"`
+	LoggedInUsers      []linux_loggedinusers.LoggedInUser  `json:"LoggedInUsers"`
+	CpuUsage           linux_top.CpuUsage                  `json:"CpuUsage"`
+	CpuInfo            linux_top.CpuInfo                   `json:"CpuInfo"`
+	Memory             linux_top.MemoryUsage               `json:"Memory"`
+	Tasks              linux_top.TaskStats                 `json:"Tasks"`
+	DiskFree           []linux_df.Df                       `json:"DiskFree"`
+	NetworkInterfaces  []linux_ip.Interface                `json:"NetworkInterfaces"`
+	Routes             []linux_ip.Route                    `json:"Routes"`
+	Egress             linux_ip.EgressIdentity             `json:"Egress"`
+	BlockDevices       []*linux_lsblk.BlockDevice          `json:"BlockDevices"`
+	MdStat             linux_mdstat.MdStat                 `json:"MdStat"`
+	NeedRestart        linux_needrestart.NeedRestart       `json:"NeedRestart"`
+	Suggestions        []linux_needrestart.SuggestedAction `json:"Suggestions"`
+	CycleTimestamp     string                              `json:"CycleTimestamp"`    // Start of the monitoring cycle, RFC 3339
+	CaptureTimestamps  map[string]string                   `json:"CaptureTimestamps"` // Capture time of each collector by field name, RFC 3339
+	ApiMetrics         map[string]EndpointStats            `json:"ApiMetrics"`        // Requests since the last monitoring submission
+	PackageManager     linux_pmhealth.Health               `json:"PackageManager"`
+	Power              linux_power.Power                   `json:"Power"`              // AC, battery and UPS state
+	Quotas             linux_quota.Quotas                  `json:"Quotas"`             // User, group and project quota usage
+	CollectorErrors    []CollectorError                    `json:"CollectorErrors"`    // Collectors that failed without failing the submission
+	DisabledCollectors []string                            `json:"DisabledCollectors"` // Collectors disabled in the configuration, their fields are empty
+	SkippedCollectors  []string                            `json:"SkippedCollectors"`  // Collectors whose own interval did not elapse, their fields are empty
+	FallbackCollectors []string                            `json:"FallbackCollectors"` // Collectors that use a native implementation because their command is missing
+}
+
+// SystemInfo is the current version of the system information payload
+type SystemInfo = SystemInfoV1
+
+// SystemInfoV1 is version 1 of the system information payload
+type SystemInfoV1 struct {
+	SchemaVersion       int                               `json:"schema_version"`
+	OsName              string                            `json:"os_name"`
+	OsVersionId         string                            `json:"os_version_id"`
+	IsContainer         bool                              `json:"is_container"`
+	AgentVersion        string                            `json:"agent_version"`
+	AgentRunningAsRoot  bool                              `json:"agent_running_as_root"`
+	AcceptedPublicKeys  []string                          `json:"accepted_public_keys"`
+	Timezone            string                            `json:"timezone"`
+	Locale              string                            `json:"locale"`
+	NtpService          string                            `json:"ntp_service"`
+	NtpServers          []string                          `json:"ntp_servers"`
+	NtpSources          []linux_timeinfo.NtpSource        `json:"ntp_sources"`
+	Tags                map[string]string                 `json:"tags"`
+	Labels              map[string]string                 `json:"labels,omitempty"` // Labels from the configuration
+	SoftRebootSupported bool                              `json:"soft_reboot_supported"`
+	Hardware            linux_dmi.ChassisInfo             `json:"hardware"`
+	RemoteManagement    linux_remotemgmt.RemoteManagement `json:"remote_management"` // BMC and Wake-on-LAN facts
+	LastUpdates         map[string]LastUpdate             `json:"last_updates"`      // Last successful update job by package manager, e.g. "apt"
+	OrphanedPackages    []map[string]string               `json:"orphaned_packages"` // Installed packages not available from any configured repository, null if unknown
+	KernelModules       linux_kmodules.KernelModules      `json:"kernel_modules"`    // Loaded and DKMS modules with their taint flags
+}
+
+// MaintenanceMode is the maintenance mode of a host during planned work. The
+// API keeps recording the data of the host and suppresses its alerts.
+type MaintenanceMode struct {
+	Since  string `json:"since"`            // Start of the maintenance mode, RFC 3339
+	Until  string `json:"until,omitempty"`  // End of the maintenance mode, RFC 3339, empty if it has no end
+	Reason string `json:"reason,omitempty"` // Why the host is in maintenance mode, e.g. a change number
+	JobId  string `json:"job_id,omitempty"` // The maintenance_mode job that started it, empty if it was started locally
+}
+
+// LastUpdate is the last update job that the agent applied successfully with a
+// package manager. It is kept by the agent, so it is known when the job history
+// of the API was pruned.
+type LastUpdate struct {
+	JobId      string   `json:"job_id"`
+	FinishedAt string   `json:"finished_at"` // RFC 3339
+	Packages   []string `json:"packages"`    // The updated packages, ["all"] for all packages
+}
+
+// Packages is the current version of the installed packages payload
+type Packages = PackagesV1
+
+// PackagesV1 is version 1 of the installed packages payload. Streamed inventories
+// send the packages as NDJSON and the schema version in the x-schema-version header.
+type PackagesV1 struct {
+	SchemaVersion int                 `json:"schema_version"`
+	Packages      []map[string]string `json:"packages"`
+}
+
+// UpdateSize is the estimated size of installing the pending updates, it is sent
+// with the updates payload
+type UpdateSize struct {
+	DownloadBytes  int64 `json:"download_size"`  // Bytes to download
+	InstalledBytes int64 `json:"installed_size"` // Installed size in bytes, negative if disk space is freed
+}
+
+// withSchemaVersion returns a copy of a map payload with the schema version field set.
+//
+// Parameters:
+//   - version: The schema version of the payload
+//   - data: The payload
+//
+// Returns:
+//   - map[string]any: The payload with the schema version
+func withSchemaVersion(version int, data map[string]any) map[string]any {
+	versioned := make(map[string]any, len(data)+1)
+	for key, value := range data {
+		versioned[key] = value
+	}
+	versioned[schemaVersionField] = version
+	return versioned
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// transferEndpoints map request paths to the endpoint names of the request metrics.
+// The more specific paths come first.
+var transferEndpoints = []struct {
+	path     *regexp.Regexp
+	endpoint string
+}{
+	{regexp.MustCompile(`/hosts/register/[^/]+$`), "register"},
+	{regexp.MustCompile(`/hosts/deregister/[^/]+$`), "deregister"},
+	{regexp.MustCompile(`/hosts/securitykeys$`), "security_keys"},
+	{regexp.MustCompile(`/agent/version$`), "agent_version"},
+	{regexp.MustCompile(`/hosts/ping/[^/]+$`), "ping"},
+	{regexp.MustCompile(`/hosts/monitoring/[^/]+$`), "monitoring"},
+	{regexp.MustCompile(`/hosts/osinfo/[^/]+$`), "system_info"},
+	{regexp.MustCompile(`/hosts/packages/[^/]+/delta$`), "package_delta"},
+	{regexp.MustCompile(`/hosts/packages/[^/]+$`), "packages"},
+	{regexp.MustCompile(`/hosts/updates/[^/]+$`), "updates"},
+	{regexp.MustCompile(`/hosts/servicefiles/[^/]+$`), "service_files"},
+	{regexp.MustCompile(`/jobs/hosts/[^/]+/wait$`), "jobs_wait"},
+	{regexp.MustCompile(`/jobs/hosts/[^/]+$`), "jobs"},
+	{regexp.MustCompile(`/jobs/[^/]+/logs$`), "job_logs"},
+	{regexp.MustCompile(`/jobs/[^/]+$`), "job_update"},
+}
+
+// endpointForPath returns the endpoint name of a request path, "other" if it is unknown
+func endpointForPath(path string) string {
+	for _, transfer := range transferEndpoints {
+		if transfer.path.MatchString(path) {
+			return transfer.endpoint
+		}
+	}
+	return "other"
+}
+
+// transferTransport counts the bytes sent to and received from the API by endpoint.
+// Request lines, headers and bodies are counted, TLS and TCP overhead is not.
+type transferTransport struct {
+	next http.RoundTripper
+}
+
+func (t *transferTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointForPath(req.URL.Path)
+	Metrics.RecordTransfer(endpoint, int64(len(req.Method)+len(req.URL.RequestURI())+headerSize(req.Header)), 0)
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingReadCloser{ReadCloser: req.Body, count: func(n int64) { Metrics.RecordTransfer(endpoint, n, 0) }}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	Metrics.RecordTransfer(endpoint, 0, int64(len(resp.Status)+headerSize(resp.Header)))
+	resp.Body = &countingReadCloser{ReadCloser: resp.Body, count: func(n int64) { Metrics.RecordTransfer(endpoint, 0, n) }}
+	return resp, nil
+}
+
+// headerSize returns the size of the headers on the wire, without compression
+func headerSize(header http.Header) int {
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(value) + 4 // ": " and CRLF
+		}
+	}
+	return size
+}
+
+// countingReadCloser reports the number of bytes read from a body
+type countingReadCloser struct {
+	io.ReadCloser
+	count func(n int64)
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.count(int64(n))
+	}
+	return n, err
+}
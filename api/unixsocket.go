@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixScheme is the prefix of API URLs that point to a local unix domain socket.
+// The socket path and the HTTP path are separated by a colon, for example
+// "unix:///run/cloud-guardian-relay.sock:/cloudguardian-api/v1/".
+const unixScheme = "unix://"
+
+var (
+	unixClients      = map[string]*http.Client{} // HTTP clients by socket path
+	unixClientsMutex sync.Mutex
+)
+
+// splitUnixUrl splits a unix:// URL into the socket path and an equivalent
+// http:// URL with the same REST path.
+//
+// Returns:
+//   - string: The HTTP URL to send the request to
+//   - string: The socket path, empty if the URL is not a unix:// URL
+func splitUnixUrl(rawUrl string) (string, string) {
+	if !strings.HasPrefix(rawUrl, unixScheme) {
+		return rawUrl, ""
+	}
+	socket, path, found := strings.Cut(strings.TrimPrefix(rawUrl, unixScheme), ":")
+	if !found || !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	// The host is only used for the Host header, the connection goes to the socket
+	return "http://localhost" + path, socket
+}
+
+// clientFor returns the HTTP client and URL for a request. unix:// URLs are sent
+// through a client that dials the socket, all other URLs use the shared client.
+func clientFor(rawUrl string) (*http.Client, string) {
+	httpUrl, socket := splitUnixUrl(rawUrl)
+	if socket == "" {
+		return httpClient, rawUrl
+	}
+	unixClientsMutex.Lock()
+	defer unixClientsMutex.Unlock()
+	client, ok := unixClients[socket]
+	if !ok {
+		dialer := &net.Dialer{Timeout: 30 * time.Second}
+		client = &http.Client{
+			Transport: &transferTransport{next: &debugTransport{next: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+				MaxIdleConns:    maxIdleConns,
+				IdleConnTimeout: idleConnTimeout,
+			}}},
+		}
+		unixClients[socket] = client
+	}
+	return client, httpUrl
+}
+
+// IsUnixUrl reports whether the API URL points to a unix domain socket
+func IsUnixUrl(apiUrl string) bool {
+	return strings.HasPrefix(apiUrl, unixScheme)
+}
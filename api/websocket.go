@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the handshake key, see RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC11B41"
+
+// WebSocket opcodes of the frames the agent sends
+const (
+	websocketText  = 0x1
+	websocketClose = 0x8
+)
+
+// WebSocket is a client connection that only sends text messages, e.g. the lines
+// of a stream_logs job. Messages from the server are not read.
+type WebSocket struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+// DialWebSocket opens a WebSocket connection. The API key is not sent, the URL
+// has to carry its own credentials, e.g. a token of the troubleshooting session.
+//
+// Parameters:
+//   - rawUrl: The ws:// or wss:// URL
+//
+// Returns:
+//   - *WebSocket: The connection
+//   - error: An error if the URL is invalid or the handshake fails
+func DialWebSocket(rawUrl string) (*WebSocket, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported WebSocket scheme %q, use ws or wss", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := websocketHandshake(conn, u); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocket{conn: conn}, nil
+}
+
+// websocketHandshake upgrades an HTTP connection to a WebSocket connection
+func websocketHandshake(conn net.Conn, u *url.URL) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req, err := http.NewRequest("GET", (&url.URL{Scheme: "http", Host: u.Host, Path: u.Path, RawQuery: u.RawQuery}).String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	setVersionHeaders(req)
+	setMaintenanceHeaders(req)
+
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("WebSocket handshake failed with status %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return fmt.Errorf("WebSocket handshake failed, invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value the server answers a key with
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WriteText sends a text message
+func (ws *WebSocket) WriteText(data []byte) error {
+	return ws.writeFrame(websocketText, data)
+}
+
+// Close sends a close frame and closes the connection
+func (ws *WebSocket) Close() error {
+	ws.writeFrame(websocketClose, nil)
+	return ws.conn.Close()
+}
+
+// writeFrame sends a single masked frame, clients have to mask every frame
+func (ws *WebSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	frame := []byte{0x80 | opcode} // FIN, no fragmentation
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 0x80|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	ws.conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	_, err := ws.conn.Write(frame)
+	return err
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readFrame reads a masked client frame and returns its opcode and payload
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("Error reading frame header: %v", err)
+	}
+	if header[1]&0x80 == 0 {
+		t.Fatal("Expected a masked frame")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		io.ReadFull(reader, extended)
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		io.ReadFull(reader, extended)
+		length = binary.BigEndian.Uint64(extended)
+	}
+	mask := make([]byte, 4)
+	io.ReadFull(reader, mask)
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("Error reading frame payload: %v", err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0] & 0x0F, payload
+}
+
+func TestWebSocket(t *testing.T) {
+	messages := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "session1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+		for {
+			opcode, payload := readFrame(t, rw.Reader)
+			if opcode == websocketClose {
+				close(messages)
+				return
+			}
+			messages <- string(payload)
+		}
+	}))
+	defer server.Close()
+	wsUrl := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	if _, err := DialWebSocket(wsUrl + "/logs"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected the handshake to fail without the token, got %v", err)
+	}
+	ws, err := DialWebSocket(wsUrl + "/logs?token=session1")
+	if err != nil {
+		t.Fatalf("DialWebSocket() error: %v", err)
+	}
+	long := strings.Repeat("x", 300)
+	ws.WriteText([]byte("line 1"))
+	ws.WriteText([]byte(long))
+	ws.Close()
+
+	received := []string{}
+	for message := range messages {
+		received = append(received, message)
+	}
+	if len(received) != 2 || received[0] != "line 1" || received[1] != long {
+		t.Errorf("Unexpected messages: %q", received)
+	}
+}
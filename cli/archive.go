@@ -0,0 +1,41 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// runArchive runs the tasks once and writes the payloads to a signed archive
+// instead of submitting them, e.g. on air-gapped hosts. The archive is
+// transferred and imported out-of-band, jobs are not processed.
+//
+// Parameters:
+//   - hostname: The normalized hostname
+//   - path: The archive file
+//
+// Returns:
+//   - int: The exit code, 0 if the archive was written without task failures
+func runArchive(hostname string, path string) int {
+	tasks.SetConfig(config)
+	manifest, err := tasks.RunArchive(hostname, path)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			fmt.Println("Error: Permission denied writing the archive", path)
+			return exitPermissionDenied
+		}
+		fmt.Println("Error writing the archive:", err.Error())
+		return exitFailure
+	}
+	fmt.Printf("%d payloads written to %s, signed with the %s\n", len(manifest.Files), path, signedWithName(manifest.SignedWith))
+	return tasksExitCode(tasks.RecordedFailures())
+}
+
+// signedWithName describes the key an archive was signed with
+func signedWithName(signedWith string) string {
+	if signedWith == "host_security_key" {
+		return "host security key"
+	}
+	return "API key, no host security key is configured"
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runBench runs each collector several times and prints the min, avg and max
+// duration and the allocations per run, e.g. to find hosts where the process
+// or block device scan is pathologically slow.
+//
+// Parameters:
+//   - args: The arguments after "bench"
+//
+// Returns:
+//   - int: The exit code, 0 if every collector ran, 7 if a collector failed
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := flags.Int("runs", 10, "How often each collector runs")
+	only := flags.String("collectors", "", "Comma separated collectors to run, all by default: "+strings.Join(tasks.BenchCollectorNames(), ", "))
+	flags.Parse(args)
+	if *runs < 1 || flags.NArg() > 0 {
+		fmt.Println("Usage: cloud-guardian bench [--runs <n>] [--collectors <name,...>]")
+		return exitConfigInvalid
+	}
+	names := tasks.BenchCollectorNames()
+	if *only != "" {
+		names = strings.Split(*only, ",")
+		for _, name := range names {
+			if !slices.Contains(tasks.BenchCollectorNames(), name) {
+				fmt.Println("Error: unknown collector", name+", known collectors are", strings.Join(tasks.BenchCollectorNames(), ", "))
+				return exitConfigInvalid
+			}
+		}
+	}
+
+	tasks.SetConfig(config)
+	failed := []tasks.BenchResult{}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Collector\tRuns\tMin\tAvg\tMax\tAllocs/run\tBytes/run\tErrors\t")
+	for _, name := range names {
+		result := tasks.Bench(name, tasks.BenchCollectors[name], *runs)
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\t%d\t%d\t%d\t\n", result.Collector, result.Runs,
+			roundDuration(result.Min), roundDuration(result.Avg), roundDuration(result.Max), result.AllocsPerOp, result.BytesPerOp, result.Errors)
+		if result.Errors > 0 {
+			failed = append(failed, result)
+		}
+	}
+	writer.Flush()
+	for _, result := range failed {
+		fmt.Println("Error of", result.Collector+":", result.LastError.Error())
+	}
+	if len(failed) > 0 {
+		return exitPartialFailure
+	}
+	return exitValid
+}
+
+// roundDuration rounds a duration for display, to microseconds below a second
+func roundDuration(duration time.Duration) time.Duration {
+	if duration < time.Second {
+		return duration.Round(time.Microsecond)
+	}
+	return duration.Round(time.Millisecond)
+}
@@ -4,21 +4,34 @@ import (
 	api "cloud-guardian/api"
 	"cloud-guardian/cloudguardian_config"
 	"cloud-guardian/cloudguardian_version"
+	linux_environment "cloud-guardian/linux/environment"
+	linux_hostname "cloud-guardian/linux/hostname"
 	linux_installer "cloud-guardian/linux/installer"
+	linux_instance "cloud-guardian/linux/instance"
+	linux_debian_apt "cloud-guardian/linux_debian/apt"
+	cloudguardian_logging "cloud-guardian/logging"
 	tasks "cloud-guardian/tasks"
-	"encoding/json"
+	cloudguardian_tracing "cloud-guardian/tracing"
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"regexp"
+	"runtime"
 	"strings"
+	"syscall"
 )
 
 const apiKeyLength = 16 // Length of the API key, used for validation
 
 var config *cloudguardian_config.CloudGuardianConfig // Configuration for the Cloud Gardian client
+var client api.Client                                // Client for the Cloud Guardian API
+var environment []linux_environment.Setting          // Effective proxy and TLS variables
 
 func IsValidApiKey(apiKey string) bool {
 	// A valid API key is 16 characters long and contains only alphanumeric characters in lowercase
@@ -30,133 +43,357 @@ func IsValidApiKey(apiKey string) bool {
 }
 
 func Start() {
+	// Lines below the log level are dropped, the level is known after the configuration is loaded
+	cloudguardian_logging.Install(os.Stderr)
+
+	// The proxy of a shell and of the service must be the same, before any request
+	environment = linux_environment.Apply()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "selftest":
+			os.Exit(runSelftest(os.Args[2:]))
+		case "verify-job":
+			os.Exit(runVerifyJob(os.Args[2:]))
+		case "logs":
+			os.Exit(runLogs(os.Args[2:]))
+		case "pause":
+			os.Exit(runPause(os.Args[2:]))
+		case "resume":
+			os.Exit(runResume(os.Args[2:]))
+		case "maintenance":
+			os.Exit(runMaintenance(os.Args[2:]))
+		case "rollback-agent":
+			// Hidden, run by the timer that restores the previous binary after a failed agent update
+			os.Exit(runRollbackAgent())
+		case "--simulate":
+			// Hidden, generates the data of virtual hosts for load tests of a test API
+			os.Exit(runSimulate(os.Args[2:]))
+		}
+	}
+
 	// Define command-line flags
 	var (
 		versionFlag   = flag.Bool("version", false, "Display version information")
-		debugFlag     = flag.Bool("debug", false, "Enable debug mode")
+		checkFlag     = flag.Bool("check-update", false, "With --version, ask the API for the latest agent version")
+		debugFlag     = flag.Bool("debug", false, "Enable debug mode, the same as -v")
+		verboseFlag   = flag.Bool("v", false, "Log at the debug level, e.g. every API request")
+		traceFlag     = flag.Bool("vv", false, "Log at the trace level, e.g. also the API request and response bodies")
+		logLevelFlag  = flag.String("log-level", "", "Log level: "+strings.Join(cloudguardian_logging.LevelNames(), ", ")+", info by default")
 		apiUrlFlag    = flag.String("api-url", "", "API URL to submit updates")
 		apiKeyFlag    = flag.String("api-key", "", "API key for authentication (required)")
 		oneShotFlag   = flag.Bool("one-shot", false, "Run in oneshot mode (process updates and exit)")
+		outputFlag    = flag.String("output", "", "With --one-shot, write the payloads to a signed archive file instead of submitting them, e.g. on air-gapped hosts")
 		installFlag   = flag.Bool("install", false, "Install the client as a system service (also registers the client)")
 		updateFlag    = flag.Bool("update", false, "Update the client to the latest version (if available)")
 		uninstallFlag = flag.Bool("uninstall", false, "Uninstall the client service (if installed)")
 		registerFlag  = flag.Bool("register", false, "Register the client with the API (register without installing as a service)")
+		longPollFlag  = flag.Bool("long-poll", false, "Wait for new jobs with a long-poll request for near-instant job delivery")
+		encryptFlag   = flag.Bool("encrypt-api-key", false, "Store the API key encrypted with a key bound to this machine when installing")
+		validateFlag  = flag.Bool("validate-config", false, "Validate the configuration and authenticate against the API, then exit (0 valid, 2 invalid configuration, 3 API unreachable, 4 authentication failed)")
+		taskFlag      = flag.String("task", "", "Run a single task once and exit: jobs, monitoring, packages, ping, servicefiles, systeminfo or updates (also: run <task>)")
+		localFlag     = flag.Bool("local", false, "Run the collectors once and print the payloads as JSON instead of submitting them, no API key is needed")
+		stdoutFlag    = flag.Bool("stdout", false, "Same as --local")
+		dryRunFlag    = flag.Bool("dry-run", false, "Report update, reboot, command, script, swap and update_agent jobs as simulated instead of executing them")
 	)
 
 	var err error
 
-	config, err = cloudguardian_config.FindAndLoadConfig()
-	if err != nil {
-		if err.Error() == cloudguardian_config.ErrConfigNotFound.Error() {
-			// If the config file is not found, we will use the default configuration
-			config = cloudguardian_config.DefaultConfig()
-		} else {
-			// If there is an error loading the configuration, we will print the error and use the default configuration
-			log.Fatal(err.Error())
-		}
-	}
+	// An invalid configuration is reported after parsing the flags, --validate-config reports it itself
+	var configErr error
+	config, configErr = loadConfig()
 
 	// Parse the command-line flags
 	flag.Parse()
 	programName := path.Base(os.Args[0])
+	if _, err := cloudguardian_logging.ParseLevel(*logLevelFlag); *logLevelFlag != "" && err != nil {
+		fatal(exitConfigInvalid, "Error: ", err.Error())
+	}
 
 	l := len("cloud-guardian-ez-")
 	// If programName is in the format cloud-guardian-ez-<apikey>, we can extract the API key
+	var extractedApiKey string
 	if strings.HasPrefix(programName, "cloud-guardian-ez") && len(programName) == l+apiKeyLength {
-		extractedApiKey := programName[l : l+apiKeyLength] // Extract the API key from the program name
 		// Check with regex if the API key is valid. A valid API key is 32 characters long and contains only alphanumeric characters in lowercase:
-		if IsValidApiKey(extractedApiKey) {
+		if IsValidApiKey(programName[l : l+apiKeyLength]) {
+			extractedApiKey = programName[l : l+apiKeyLength] // Extract the API key from the program name
+			log.Println("API key extracted from program name:", extractedApiKey)
+		}
+	}
+
+	// applyOverrides applies the API key from the program name and the command-line
+	// flags, which take precedence over the configuration file and the environment
+	applyOverrides := func(config *cloudguardian_config.CloudGuardianConfig) {
+		if extractedApiKey != "" {
 			config.ApiKey = extractedApiKey
-			log.Println("API key extracted from program name:", config.ApiKey)
+		}
+		if *debugFlag || *verboseFlag {
+			config.Debug = true
+			config.LogLevel = cloudguardian_logging.LevelDebug.String()
+		}
+		if *traceFlag {
+			config.LogLevel = cloudguardian_logging.LevelTrace.String()
+		}
+		if *logLevelFlag != "" {
+			config.LogLevel = *logLevelFlag
+		}
+		if *longPollFlag {
+			config.LongPoll = true
+		}
+		if *encryptFlag {
+			config.EncryptApiKey = true
+		}
+		if *dryRunFlag {
+			config.DryRun = true
+		}
+		if *apiKeyFlag != "" {
+			config.ApiKey = *apiKeyFlag
+		}
+		if *apiUrlFlag != "" {
+			// Override the default API URL if provided
+			apiUrl := *apiUrlFlag
+			if !strings.HasSuffix(apiUrl, "/") {
+				// Ensure the API URL ends with a slash
+				apiUrl += "/"
+			}
+			config.ApiUrl = apiUrl
+			config.ApiUrls = nil // The flag replaces a list of API URLs from the configuration
 		}
 	}
 
+	if *validateFlag {
+		os.Exit(validateConfig(config, configErr, applyOverrides))
+	}
+	if args := flag.Args(); len(args) == 1 && args[0] == "doctor" {
+		os.Exit(runDoctor(config, configErr, applyOverrides))
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "completion" {
+		if len(args) != 2 {
+			os.Exit(printCompletion(""))
+		}
+		os.Exit(printCompletion(args[1]))
+	}
+	if configErr != nil {
+		fatal(exitConfigInvalid, configErr.Error())
+	}
+
 	if *uninstallFlag {
 		// Uninstall the client service
 		log.Println("Uninstalling client service...")
 		if err := linux_installer.Uninstall(); err != nil {
-			if os.IsPermission(err) {
-				log.Fatal("Error: You need to run this command with root privileges to uninstall the client service.")
+			if errors.Is(err, os.ErrPermission) {
+				fatal(exitPermissionDenied, "Error: You need to run this command with root privileges to uninstall the client service.")
 			}
-			log.Fatal("Error uninstalling client service:", err.Error())
+			fatal(installerExitCode(err), "Error uninstalling client service: ", err.Error())
 		}
 		log.Println("Client service uninstalled successfully.")
 		return
 	}
 
 	if *versionFlag {
-		printVersion()
-		return
+		applyOverrides(config)
+		os.Exit(printVersion(*checkFlag))
 	}
 
-	if *debugFlag {
-		// Enable debug mode
-		log.Println("Debug mode enabled")
-		config.Debug = true
+	applyOverrides(config)
+	cloudguardian_logging.SetLevel(config.EffectiveLogLevel())
+	if args := flag.Args(); len(args) == 2 && args[0] == "config" && args[1] == "dump" {
+		// The effective configuration, to debug which file, variable or flag set a value
+		dump, err := config.Dump()
+		if err != nil {
+			fatal(exitFailure, "Error encoding the configuration: ", err.Error())
+		}
+		fmt.Println(string(dump))
+		return
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "keys" {
+		os.Exit(runKeys(args[1:]))
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "bench" {
+		os.Exit(runBench(args[1:]))
+	}
+	if level := cloudguardian_logging.CurrentLevel(); level != cloudguardian_logging.LevelInfo {
+		log.Println("Log level:", level)
 	}
 
-	if *apiKeyFlag != "" {
-		// Set the API key if provided
-		config.ApiKey = *apiKeyFlag
-	} else if config.ApiKey == "" {
-		log.Fatal("Error: API key is required. Use --api-key to set it.")
+	if *localFlag || *stdoutFlag {
+		// Show the data that would be sent, before the host is enrolled
+		hostname, err := normalizedHostname(config)
+		if err != nil {
+			fatal(exitHostCheckFailed, "Error getting hostname: ", err.Error())
+		}
+		tasks.SetConfig(config)
+		tasks.RunLocal(hostname, os.Stdout)
 		return
 	}
 
-	if *apiUrlFlag != "" {
-		// Override the default API URL if provided
-		apiUrl := *apiUrlFlag
-		if !strings.HasSuffix(apiUrl, "/") {
-			// Ensure the API URL ends with a slash
-			apiUrl += "/"
-		}
-		config.ApiUrl = apiUrl
+	if config.ApiKey == "" {
+		fatal(exitConfigInvalid, "Error: API key is required. Use --api-key to set it.")
 	}
 
-	hostname, err := os.Hostname()
+	api.SetDebugBodies(config.DebugBodies)
+	api.SetSigningKey(config.ApiKey, config.SigningSecret)
+	client = api.NewClient(config)
+
+	// The hostname is normalized once, so every API request uses the same name
+	hostname, err := normalizedHostname(config)
 	if err != nil {
-		log.Println("Error getting hostname:", err.Error())
-		return
+		fatal(exitHostCheckFailed, "Error getting hostname: ", err.Error())
+	}
+	cloudguardian_tracing.Configure(config.OtlpEndpoint, hostname)
+	for _, setting := range environment {
+		if setting.Source != linux_environment.SourceProcess {
+			log.Println("Using", setting.Name+"="+setting.Value, "from", setting.Source)
+		}
+	}
+
+	if *outputFlag != "" {
+		if !*oneShotFlag {
+			fatal(exitConfigInvalid, "Error: --output requires --one-shot")
+		}
+		os.Exit(runArchive(hostname, *outputFlag))
 	}
 
 	if *installFlag {
 		// Install the client as a system service
-		InstallService(hostname)
-		return
+		os.Exit(InstallService(hostname))
 	}
 
 	if *updateFlag {
 		// Update the client to the latest version
-		UpdateService()
-		return
+		os.Exit(UpdateService())
 	}
 
 	if *registerFlag {
 		// Register the client with the API
-		registerClient(hostname)
-		return
+		os.Exit(registerClient(hostname))
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "deregister" {
+		os.Exit(runDeregister(hostname, args[1:]))
+	}
+	if len(config.AptDpkgOptions) > 0 {
+		linux_debian_apt.SetDpkgOptions(config.AptDpkgOptions)
+	}
+	if args := flag.Args(); len(args) == 2 && args[0] == "run" {
+		os.Exit(runTask(hostname, args[1]))
+	}
+	if *taskFlag != "" {
+		os.Exit(runTask(hostname, *taskFlag))
+	}
+	os.Exit(runAgent(hostname, *oneShotFlag, applyOverrides))
+}
+
+// runAgent processes the tasks and jobs, until the agent is stopped or once in
+// one-shot mode.
+//
+// Parameters:
+//   - hostname: The normalized hostname
+//   - oneShot: Process the tasks once and exit
+//   - applyOverrides: Applies the command-line flags to a reloaded configuration
+//
+// Returns:
+//   - int: The exit code of a one-shot run, see tasksExitCode
+func runAgent(hostname string, oneShot bool, applyOverrides func(*cloudguardian_config.CloudGuardianConfig)) int {
+	// Only one agent may process tasks and jobs at a time
+	lock, err := linux_instance.Acquire()
+	if errors.Is(err, linux_instance.ErrAlreadyRunning) {
+		if !oneShot {
+			log.Println("Error: Another cloud-guardian agent is already running. Stop it first, e.g. with 'systemctl stop cloud-guardian', or use --one-shot to trigger it.")
+			return exitAlreadyRunning
+		}
+		if err := linux_instance.Trigger(); err != nil {
+			log.Println("Error: Another cloud-guardian agent is already running and could not be triggered:", err.Error())
+			return exitAlreadyRunning
+		}
+		log.Println("Another cloud-guardian agent is already running, it was triggered to process its tasks and jobs now.")
+		return exitValid
 	}
-	tasks.Config = config // Set the configuration for the tasks package
-	tasks.ProcessTasks(hostname, *oneShotFlag)
+	if err != nil {
+		log.Println("Warning: Could not check for other running agents:", err.Error())
+	} else {
+		defer lock.Release()
+		tasks.Triggers = lock.Triggers()
+	}
+
+	tasks.SetConfig(config) // Set the configuration for the tasks package
+	tasks.SetClient(client)
+	tasks.Environment = environment
+	if !oneShot {
+		tasks.Reloads = reloadOnSighup(applyOverrides)
+	}
+	tasks.ProcessTasks(hostname, oneShot)
+	return tasksExitCode(tasks.RecordedFailures())
 }
 
-type SecurityKeyApiResponse struct {
-	Code    int                 `json:"code"`
-	Content map[string][]string `json:"content"`
-	Message string              `json:"message"`
+// loadConfig loads the configuration file, or the default configuration if there
+// is none, and applies the environment variables.
+//
+// Returns:
+//   - *cloudguardian_config.CloudGuardianConfig: The configuration
+//   - error: An error if the configuration file or the environment is invalid
+func loadConfig() (*cloudguardian_config.CloudGuardianConfig, error) {
+	config, err := cloudguardian_config.FindAndLoadConfig()
+	if errors.Is(err, cloudguardian_config.ErrConfigNotFound) {
+		// If the config file is not found, we will use the default configuration
+		config = cloudguardian_config.DefaultConfig()
+	} else if err != nil {
+		return nil, err
+	}
+	if err := config.ApplyEnvironment(); err != nil {
+		return nil, fmt.Errorf("invalid environment configuration: %w", err)
+	}
+	if config.Source.Path != "" {
+		log.Println("Using configuration file:", config.Source.Path, "modified", config.Source.ModifiedAt)
+	}
+	if config.Source.MigratedFrom != 0 {
+		log.Printf("Configuration uses config_version %d, it is migrated to version %d when it is saved\n", config.Source.MigratedFrom, cloudguardian_config.ConfigVersion)
+	}
+	return config, nil
+}
+
+// reloadOnSighup rereads the configuration on SIGHUP and hands it to the task loop.
+// An invalid configuration is logged and the current configuration is kept.
+//
+// Parameters:
+//   - applyOverrides: Applies the command-line flags to a reloaded configuration
+//
+// Returns:
+//   - <-chan *cloudguardian_config.CloudGuardianConfig: The reloaded configurations
+func reloadOnSighup(applyOverrides func(*cloudguardian_config.CloudGuardianConfig)) <-chan *cloudguardian_config.CloudGuardianConfig {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	reloads := make(chan *cloudguardian_config.CloudGuardianConfig)
+	go func() {
+		for range signals {
+			log.Println("Received SIGHUP, reloading configuration...")
+			newConfig, err := loadConfig()
+			if err == nil {
+				applyOverrides(newConfig)
+				if newConfig.ApiKey == "" {
+					err = fmt.Errorf("API key is required")
+				}
+			}
+			if err != nil {
+				log.Println("Error reloading configuration, keeping the current configuration:", err.Error())
+				continue
+			}
+			reloads <- newConfig
+		}
+	}()
+	return reloads
 }
 
 func fetchHostSecurityKeys() {
 	// Fetch the security key from the API and update the configuration file
 	log.Println("Fetching security key from API...")
-	statusCode, responseBody, err := api.GetRequest(config.ApiUrl+"hosts/securitykeys", config.ApiKey)
-	if err != nil {
-		log.Println(parseErrorResponse(err))
+	statusCode, hostSecurityKeys, err := client.FetchSecurityKeys(context.Background())
+	if statusCode == http.StatusNotFound {
+		log.Println("Security key not found")
 		return
 	}
 
-	if statusCode == http.StatusNotFound {
-		log.Println("Security key not found")
+	if err != nil {
+		log.Println(parseErrorResponse(err))
 		return
 	}
 
@@ -165,16 +402,12 @@ func fetchHostSecurityKeys() {
 		return
 	}
 
-	var response SecurityKeyApiResponse
-	if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
-		log.Println("Error parsing response body:", err.Error())
-		return
-	}
-	config.HostSecurityKeys = response.Content["hostSecurityKeys"] // Save the security keys to the configuration
+	config.HostSecurityKeys = hostSecurityKeys // Save the security keys to the configuration
+	api.SetSigningKey(config.ApiKey, config.SigningSecret)
 }
 
-func InstallService(hostname string) {
-	// Install the client as a system service
+func InstallService(hostname string) int {
+	// Install the client as a system service and return the exit code
 	log.Println("Installing client as a system service...")
 
 	fetchHostSecurityKeys()
@@ -183,71 +416,87 @@ func InstallService(hostname string) {
 
 	if err := linux_installer.Install(); err != nil {
 		// check if error is os.ErrPermission, which indicates that the user does not have root privileges
-		if os.IsPermission(err) {
+		if errors.Is(err, os.ErrPermission) {
 			log.Println("Error: You need to run this command with root privileges to install the client as a system service.")
-			return
+		} else if errors.Is(err, linux_installer.ErrReadOnlyFilesystem) {
+			log.Println("Error: The client can not be installed, no writable location was found. Nothing was changed:", err.Error())
+		} else {
+			log.Println("Error installing client as a system service:", err.Error())
 		}
-		log.Println("Error installing client as a system service:", err.Error())
-		return
+		return installerExitCode(err)
 	}
 
 	log.Println("Client installed as a system service")
 
 	// Register the client with the API after installing as a service
-	registerClient(hostname)
+	return registerClient(hostname)
 }
 
-func UpdateService() {
+func UpdateService() int {
+	// Update the installed client and return the exit code
 
 	linux_installer.Config = config // Set the configuration for the installer
 	if err := linux_installer.Update(); err != nil {
 		// check if error is os.ErrPermission, which indicates that the user does not have root privileges
-		if os.IsPermission(err) {
+		if errors.Is(err, os.ErrPermission) {
 			log.Println("Error: You need to run this command with root privileges to update the client service.")
-			return
+		} else if errors.Is(err, linux_installer.ErrReadOnlyFilesystem) {
+			log.Println("Error: The client can not be updated, no writable location was found. Nothing was changed:", err.Error())
+		} else if errors.Is(err, linux_installer.ErrNotInstalled) {
+			log.Println("Error: The client service can not be updated, please install it first:", err.Error())
+		} else {
+			log.Println("Error updating client service:", err.Error())
 		}
-		log.Println("Error updating client service:", err.Error())
-		return
+		return installerExitCode(err)
 	}
 	log.Println("Client service updated successfully")
+	return exitValid
 }
 
 func parseErrorResponse(err error) string {
-	// The error might be a JSON response with an error message, in that case we try to parse it
-	var errorResponse map[string]interface{}
-	if jsonErr := json.Unmarshal([]byte(err.Error()), &errorResponse); jsonErr == nil {
-		if message, ok := errorResponse["message"].(string); ok {
-			return message
-		}
+	// API errors carry the message of the API, other errors are returned as they are
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.Err == nil && apiErr.Message != "" {
+		return apiErr.Message
 	}
-	// If we couldn't parse the error, return the error string
 	return err.Error()
 }
 
-func registerClient(hostname string) {
-	// Register the client with the API
+func registerClient(hostname string) int {
+	// Register the client with the API and return the exit code
 	log.Println("Registering client with hostname:", hostname)
 
-	statusCode, err := api.PostRequest(config.ApiUrl+"hosts/register/"+hostname, config.ApiKey, map[string]any{})
-	if err != nil {
-		log.Println(parseErrorResponse(err))
-		return
+	statusCode, signingSecret, err := client.Register(context.Background(), hostname, config.Labels)
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusNotFound {
+		handleAPIError("Error registering client", statusCode) // Exits with the exit code of the status
 	}
-	if statusCode != http.StatusOK {
-		handleAPIError("Error registering client", statusCode)
-		return
+	if err != nil || statusCode != http.StatusOK {
+		if err != nil {
+			log.Println(parseErrorResponse(err))
+		} else {
+			handleAPIError("Error registering client", statusCode)
+		}
+		if statusCode >= 400 && statusCode < 500 {
+			return exitConfigInvalid // E.g. invalid labels
+		}
+		return exitApiUnreachable
+	}
+	if err := tasks.UseSigningSecret(config, signingSecret); err != nil {
+		log.Println("Error saving the signing secret, register the client again:", err.Error())
+		return exitConfigInvalid
 	}
 	log.Println("Client registered successfully with hostname:", hostname)
+	return exitValid
 }
 
 func handleAPIError(errorMsg string, statusCode int) {
 	// Handle API errors by printing the error message and status code
 	// 4xx are user errors, we log them and then quit because the user needs to fix something
 	if statusCode == 404 {
-		log.Fatal("API URL is incorrect: ", config.ApiUrl)
+		fatal(exitConfigInvalid, "API URL is incorrect: ", config.ApiUrl)
 	}
 	if statusCode == 401 {
-		log.Fatal("Invalid API key. Please check your API key in the configuration file or command line arguments.")
+		fatal(exitAuthenticationFail, "Invalid API key. Please check your API key in the configuration file or command line arguments.")
 	}
 	if statusCode >= 400 && statusCode < 500 {
 		log.Println(errorMsg, "(Client error) - Status code:", statusCode)
@@ -259,7 +508,51 @@ func handleAPIError(errorMsg string, statusCode int) {
 	}
 }
 
-func printVersion() {
-	// Print version information
-	log.Println("Version:", cloudguardian_version.Version)
+// printVersion prints the version and the build metadata of the agent, and with
+// checkUpdate whether a newer version is available from the API.
+//
+// Parameters:
+//   - checkUpdate: Ask the API for the latest agent version
+//
+// Returns:
+//   - int: The exit code, exitApiUnreachable if the latest version could not be checked
+func printVersion(checkUpdate bool) int {
+	commit, buildDate := cloudguardian_version.Build()
+	fmt.Println("Version:   ", cloudguardian_version.Version)
+	fmt.Println("Commit:    ", commit)
+	fmt.Println("Build date:", buildDate)
+	fmt.Println("Go version:", runtime.Version())
+	fmt.Println("Platform:  ", runtime.GOOS+"/"+runtime.GOARCH)
+	if !checkUpdate {
+		return exitValid
+	}
+
+	if config.ApiKey == "" {
+		fmt.Println("Latest:     unknown, an API key is required to check for updates")
+		return exitConfigInvalid
+	}
+	api.SetSigningKey(config.ApiKey, config.SigningSecret)
+	latest, err := api.LatestAgentVersion(context.Background(), config.ApiUrl, config.ApiKey)
+	if err != nil {
+		fmt.Println("Latest:     unknown,", parseErrorResponse(err))
+		return exitApiUnreachable
+	}
+	if api.IsIncompatibleVersion(cloudguardian_version.Version, latest) {
+		fmt.Println("Latest:    ", latest, "- this agent is outdated, update it with --update")
+	} else {
+		fmt.Println("Latest:    ", latest, "- this agent is up to date")
+	}
+	return exitValid
+}
+
+// normalizedHostname returns the hostname reported to the API according to the
+// hostname policy of the configuration.
+func normalizedHostname(config *cloudguardian_config.CloudGuardianConfig) (string, error) {
+	return linux_hostname.GetHostname(linux_hostname.Policy{
+		Override:  config.Hostname,
+		Domain:    config.HostnameDomain,
+		Prefix:    config.HostnamePrefix,
+		Suffix:    config.HostnameSuffix,
+		Lowercase: config.HostnameLower,
+	})
 }
@@ -0,0 +1,185 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// completionCommand is a subcommand offered by the shell completion
+type completionCommand struct {
+	name        string
+	description string
+	args        []string // Completions of the first argument, e.g. the task names of "run"
+	flags       []string // Flags of subcommands with their own flag set
+}
+
+// completionCommands returns the subcommands of the agent
+func completionCommands() []completionCommand {
+	return []completionCommand{
+		{name: "run", description: "Run a single task once and exit", args: tasks.TaskNames()},
+		{name: "doctor", description: "Check the configuration, the API and the host"},
+		{name: "config", description: "Print the effective configuration", args: []string{"dump"}},
+		{name: "deregister", description: "Remove the host from the API", flags: []string{"wipe"}},
+		{name: "keys", description: "Manage the host security keys", args: []string{"list", "add", "remove", "fetch"}},
+		{name: "selftest", description: "Run a smoke test against an API", flags: []string{"against", "api-key", "hosts"}},
+		{name: "verify-job", description: "Verify the signature of a job payload", flags: []string{"payload", "signature", "key"}},
+		{name: "pause", description: "Pause the jobs and submissions of the agent", flags: []string{"for", "reason"}},
+		{name: "resume", description: "Resume a paused agent"},
+		{name: "maintenance", description: "Start, end or show the maintenance mode", args: []string{"on", "off", "status"}, flags: []string{"for", "reason"}},
+		{name: "bench", description: "Measure the duration and allocations of the collectors", flags: []string{"runs", "collectors"}},
+		{name: "logs", description: "Print the recent output of the agent", flags: []string{"follow", "lines", "level", "file"}},
+		{name: "completion", description: "Print the shell completion script", args: []string{"bash", "zsh", "fish"}},
+	}
+}
+
+// completionFlag is a global flag offered by the shell completion
+type completionFlag struct {
+	name        string
+	description string
+	takesValue  bool
+}
+
+// completionFlags returns the global flags of the agent, sorted by name
+func completionFlags() []completionFlag {
+	flags := []completionFlag{}
+	flag.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{name: f.Name, description: f.Usage, takesValue: !ok || !boolFlag.IsBoolFlag()})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// printCompletion prints the completion script of a shell, e.g. for
+// "cloud-guardian completion bash > /etc/bash_completion.d/cloud-guardian".
+//
+// Parameters:
+//   - shell: bash, zsh or fish
+//
+// Returns:
+//   - int: The exit code, 0 on success
+func printCompletion(shell string) int {
+	switch shell {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		writeZshCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	default:
+		fmt.Println("Usage: cloud-guardian completion bash|zsh|fish")
+		return exitConfigInvalid
+	}
+	return exitValid
+}
+
+// writeBashCompletion writes a completion function for bash
+func writeBashCompletion(w io.Writer) {
+	names, flags := []string{}, []string{}
+	for _, command := range completionCommands() {
+		names = append(names, command.name)
+	}
+	for _, f := range completionFlags() {
+		flags = append(flags, "--"+f.name)
+	}
+	fmt.Fprintln(w, "# bash completion for cloud-guardian")
+	fmt.Fprintln(w, "_cloud_guardian() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `	case "$prev" in`)
+	for _, command := range completionCommands() {
+		words := append(command.args, prefixed("--", command.flags)...)
+		if len(words) > 0 {
+			fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", command.name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(flags, " "))
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _cloud_guardian cloud-guardian")
+}
+
+// writeZshCompletion writes a completion function for zsh, it can be installed in a
+// directory of $fpath as _cloud-guardian
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintln(w, "#compdef cloud-guardian")
+	fmt.Fprintln(w, "_cloud_guardian() {")
+	fmt.Fprintln(w, "\tlocal -a items")
+	fmt.Fprintln(w, "\tcase $words[CURRENT-1] in")
+	for _, command := range completionCommands() {
+		words := append(command.args, prefixed("--", command.flags)...)
+		if len(words) > 0 {
+			fmt.Fprintf(w, "\t%s) compadd -- %s; return ;;\n", command.name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ $PREFIX == -* ]]; then")
+	fmt.Fprint(w, "\t\titems=(")
+	for _, f := range completionFlags() {
+		fmt.Fprintf(w, "\n\t\t\t%s", zshQuote("--"+f.name+":"+f.description))
+	}
+	fmt.Fprintln(w, "\n\t\t)")
+	fmt.Fprintln(w, "\t\t_describe 'flag' items")
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprint(w, "\t\titems=(")
+	for _, command := range completionCommands() {
+		fmt.Fprintf(w, "\n\t\t\t%s", zshQuote(command.name+":"+command.description))
+	}
+	fmt.Fprintln(w, "\n\t\t)")
+	fmt.Fprintln(w, "\t\t_describe 'command' items")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "compdef _cloud_guardian cloud-guardian")
+}
+
+// writeFishCompletion writes the completions for fish
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for cloud-guardian")
+	fmt.Fprintln(w, "complete -c cloud-guardian -f")
+	for _, command := range completionCommands() {
+		fmt.Fprintf(w, "complete -c cloud-guardian -n __fish_use_subcommand -a %s -d %s\n", command.name, fishQuote(command.description))
+		condition := fishQuote("__fish_seen_subcommand_from " + command.name)
+		if len(command.args) > 0 {
+			fmt.Fprintf(w, "complete -c cloud-guardian -n %s -a %s\n", condition, fishQuote(strings.Join(command.args, " ")))
+		}
+		for _, name := range command.flags {
+			fmt.Fprintf(w, "complete -c cloud-guardian -n %s -l %s -r\n", condition, name)
+		}
+	}
+	for _, f := range completionFlags() {
+		required := ""
+		if f.takesValue {
+			required = " -r"
+		}
+		fmt.Fprintf(w, "complete -c cloud-guardian -l %s%s -d %s\n", f.name, required, fishQuote(f.description))
+	}
+}
+
+// prefixed returns the values with a prefix
+func prefixed(prefix string, values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = prefix + value
+	}
+	return result
+}
+
+// zshQuote quotes a value for zsh, colons in the name of a _describe item are escaped
+func zshQuote(value string) string {
+	name, description, _ := strings.Cut(value, ":")
+	value = strings.ReplaceAll(name, ":", `\:`) + ":" + description
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes a value for fish
+func fishQuote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
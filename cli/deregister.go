@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	linux_instance "cloud-guardian/linux/instance"
+	tasks "cloud-guardian/tasks"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// runDeregister removes the host from the API, e.g. before the machine is
+// decommissioned. The agent must not run, it would register the host again.
+// With --wipe the state files and the host security keys are removed as well.
+//
+// Parameters:
+//   - hostname: The normalized hostname of the agent
+//   - args: The arguments after "deregister"
+//
+// Returns:
+//   - int: The exit code, 0 if the host was deregistered
+func runDeregister(hostname string, args []string) int {
+	flags := flag.NewFlagSet("deregister", flag.ExitOnError)
+	wipe := flags.Bool("wipe", false, "Also remove the state files and the host security keys of the agent")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		fmt.Println("Usage: cloud-guardian deregister [--wipe]")
+		return exitConfigInvalid
+	}
+
+	// Without the lock it is unknown whether a running agent registers the host again
+	lock, err := linux_instance.Acquire()
+	switch {
+	case errors.Is(err, linux_instance.ErrAlreadyRunning):
+		fmt.Println("The agent is running and would register the host again. Stop it first, e.g. with 'systemctl stop cloud-guardian', or uninstall it with --uninstall.")
+		return exitAlreadyRunning
+	case errors.Is(err, os.ErrPermission):
+		fmt.Println("Error: You need to run this command with root privileges to deregister the host.")
+		return exitPermissionDenied
+	case err != nil:
+		fmt.Println("Error checking whether the agent is running:", err.Error())
+		return exitFailure
+	}
+	defer lock.Release()
+
+	statusCode, err := client.Deregister(context.Background(), hostname)
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		fmt.Println("Error deregistering the host: the API rejected the API key")
+		return exitAuthenticationFail
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		fmt.Println("The host", hostname, "is not registered")
+	case err != nil:
+		fmt.Println("Error deregistering the host:", parseErrorResponse(err))
+		return exitApiUnreachable
+	case statusCode != http.StatusOK:
+		fmt.Println("Error deregistering the host, status code", statusCode)
+		return exitApiUnreachable
+	default:
+		fmt.Println("Host", hostname, "deregistered")
+	}
+
+	if !*wipe {
+		return exitValid
+	}
+	if err := tasks.WipeState(); err != nil {
+		fmt.Println("Error removing the state files:", err.Error())
+		return exitFailure
+	}
+	if config.Source.Path != "" && len(config.HostSecurityKeys) > 0 {
+		if err := cloudguardian_config.SaveHostSecurityKeys(config.Source.Path, nil); err != nil {
+			fmt.Println("Error removing the host security keys:", err.Error())
+			return exitConfigInvalid
+		}
+	}
+	if config.Source.Path != "" && config.SigningSecret != "" {
+		if err := cloudguardian_config.SaveSigningSecret(config.Source.Path, ""); err != nil {
+			fmt.Println("Error removing the signing secret:", err.Error())
+			return exitConfigInvalid
+		}
+	}
+	fmt.Println("Removed the state files, the host security keys and the signing secret")
+	return exitValid
+}
@@ -0,0 +1,186 @@
+package cli
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"cloud-guardian/linux"
+	linux_container "cloud-guardian/linux/container"
+	pm "cloud-guardian/linux/packagemanager"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxClockSkew is the largest difference to the clock of the API the doctor accepts,
+// the API rejects signed requests with older timestamps
+const maxClockSkew = 5 * time.Minute
+
+// Results of a doctor check
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN" // The agent works with limitations
+	checkFail = "FAIL"
+	checkSkip = "SKIP" // The check depends on a failed check
+)
+
+// doctorCheck is the result of one check of the doctor
+type doctorCheck struct {
+	name     string
+	status   string
+	detail   string
+	exitCode int // Exit code of a failed check
+}
+
+// runDoctor checks the configuration, the API and the host and prints a pass/fail
+// report, e.g. when an agent does not report after the installation. Nothing is
+// registered or changed.
+//
+// Parameters:
+//   - config: The loaded configuration, nil if loading failed
+//   - loadErr: The error of loading the configuration
+//   - applyOverrides: Applies the command-line flags to the configuration
+//
+// Returns:
+//   - int: The exit code of the first failed check, exitValid if no check failed
+func runDoctor(config *cloudguardian_config.CloudGuardianConfig, loadErr error, applyOverrides func(*cloudguardian_config.CloudGuardianConfig)) int {
+	checks := []doctorCheck{}
+	if loadErr == nil {
+		applyOverrides(config)
+	}
+	configCheck := doctorConfig(config, loadErr)
+	checks = append(checks, configCheck)
+	if configCheck.status == checkPass {
+		checks = append(checks, doctorApi(config), doctorClock(config))
+	} else {
+		checks = append(checks,
+			doctorCheck{name: "api", status: checkSkip, detail: "the configuration is invalid"},
+			doctorCheck{name: "clock", status: checkSkip, detail: "the configuration is invalid"})
+	}
+	packageManager := doctorPackageManager()
+	checks = append(checks, packageManager, doctorBinaries(packageManager.detail), doctorRoot(), doctorContainer(), doctorProxy())
+
+	exitCode := exitValid
+	for _, check := range checks {
+		fmt.Printf("%-4s  %-16s %s\n", check.status, check.name, check.detail)
+		if check.status == checkFail && exitCode == exitValid {
+			exitCode = check.exitCode
+		}
+	}
+	if exitCode != exitValid {
+		fmt.Println("Some checks failed")
+	} else {
+		fmt.Println("All checks passed")
+	}
+	return exitCode
+}
+
+// doctorConfig checks that the configuration is valid and has an API key
+func doctorConfig(config *cloudguardian_config.CloudGuardianConfig, loadErr error) doctorCheck {
+	check := doctorCheck{name: "config", exitCode: exitConfigInvalid}
+	if loadErr == nil {
+		loadErr = config.Validate()
+	}
+	switch {
+	case loadErr != nil:
+		check.status, check.detail = checkFail, loadErr.Error()
+	case config.ApiKey == "":
+		check.status, check.detail = checkFail, "no API key is configured"
+	case config.Source.Path == "":
+		check.status, check.detail = checkPass, "no configuration file, using the defaults and the environment"
+	default:
+		check.status, check.detail = checkPass, config.Source.Path
+	}
+	return check
+}
+
+// doctorApi checks that the API is reachable and accepts the API key
+func doctorApi(config *cloudguardian_config.CloudGuardianConfig) doctorCheck {
+	exitCode, message := authenticate(config)
+	if exitCode != exitValid {
+		return doctorCheck{name: "api", status: checkFail, detail: message, exitCode: exitCode}
+	}
+	return doctorCheck{name: "api", status: checkPass, detail: config.ApiUrl + ", " + message}
+}
+
+// doctorClock compares the clock of the host with the clock of the API
+func doctorClock(config *cloudguardian_config.CloudGuardianConfig) doctorCheck {
+	skew, err := api.ClockSkew(config.ApiUrl)
+	if err != nil {
+		return doctorCheck{name: "clock", status: checkSkip, detail: "could not compare with the API: " + err.Error()}
+	}
+	detail := fmt.Sprintf("%s difference to the API", skew.Abs())
+	if skew.Abs() > maxClockSkew {
+		return doctorCheck{name: "clock", status: checkFail, detail: detail + ", signed requests are rejected, check NTP", exitCode: exitHostCheckFailed}
+	}
+	return doctorCheck{name: "clock", status: checkPass, detail: detail}
+}
+
+// doctorPackageManager checks that a supported package manager is installed. The
+// detail of a passed check is the name of the package manager.
+func doctorPackageManager() doctorCheck {
+	packageManager, err := pm.DetectPackageManager()
+	if err != nil {
+		return doctorCheck{name: "package manager", status: checkFail, detail: err.Error(), exitCode: exitHostCheckFailed}
+	}
+	switch packageManager.(type) {
+	case *pm.Dnf:
+		return doctorCheck{name: "package manager", status: checkPass, detail: "dnf"}
+	default:
+		return doctorCheck{name: "package manager", status: checkPass, detail: "apt"}
+	}
+}
+
+// doctorBinaries checks that the commands of the collectors and the package manager
+// are available. Missing df and who are warnings, native collectors replace them.
+func doctorBinaries(packageManager string) doctorCheck {
+	required := map[string][]string{"apt": {"apt-get", "dpkg-query"}, "dnf": {"dnf", "rpm"}}[packageManager]
+	var missingRequired, missingOptional []string
+	for _, name := range required {
+		if !linux.CommandAvailable(name) {
+			missingRequired = append(missingRequired, name)
+		}
+	}
+	for _, name := range []string{"df", "who"} {
+		if !linux.CommandAvailable(name) {
+			missingOptional = append(missingOptional, name)
+		}
+	}
+	switch {
+	case len(missingRequired) > 0:
+		return doctorCheck{name: "binaries", status: checkFail, detail: "missing " + strings.Join(append(missingRequired, missingOptional...), ", "), exitCode: exitHostCheckFailed}
+	case len(missingOptional) > 0:
+		return doctorCheck{name: "binaries", status: checkWarn, detail: "missing " + strings.Join(missingOptional, ", ") + ", the native collectors are used"}
+	}
+	return doctorCheck{name: "binaries", status: checkPass, detail: strings.Join(append([]string{"df", "who"}, required...), ", ")}
+}
+
+// doctorRoot checks that the agent runs as root, jobs change the host
+func doctorRoot() doctorCheck {
+	if os.Geteuid() != 0 {
+		return doctorCheck{name: "root", status: checkWarn, detail: "not running as root, update, reboot and swap jobs will fail"}
+	}
+	return doctorCheck{name: "root", status: checkPass, detail: "running as root"}
+}
+
+// doctorProxy reports the effective proxy and TLS variables and where they are set,
+// a proxy that only works in a shell is a common reason for an agent not reporting
+func doctorProxy() doctorCheck {
+	if len(environment) == 0 {
+		return doctorCheck{name: "proxy", status: checkPass, detail: "no proxy or TLS variables are set"}
+	}
+	settings := make([]string, len(environment))
+	for i, setting := range environment {
+		settings[i] = setting.Name + "=" + setting.Value + " (" + setting.Source + ")"
+	}
+	return doctorCheck{name: "proxy", status: checkPass, detail: strings.Join(settings, ", ")}
+}
+
+// doctorContainer reports whether the agent runs in a container, reboots and
+// updates then affect the container and not the host
+func doctorContainer() doctorCheck {
+	if linux_container.IsRunningInContainer() {
+		return doctorCheck{name: "container", status: checkWarn, detail: "running in a container, jobs affect the container and not the host"}
+	}
+	return doctorCheck{name: "container", status: checkPass, detail: "not running in a container"}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	linux_installer "cloud-guardian/linux/installer"
+	tasks "cloud-guardian/tasks"
+	"errors"
+	"log"
+	"os"
+)
+
+// Exit codes of the agent and its commands, so automation and provisioning
+// pipelines can tell the failures apart. They are documented in the README.
+const (
+	exitValid              = 0 // Success, e.g. the configuration is valid and the API accepted the API key
+	exitFailure            = 1 // An unexpected error, e.g. a failing systemctl command
+	exitConfigInvalid      = 2 // The configuration file, the environment or the flags are invalid
+	exitApiUnreachable     = 3 // The API could not be reached or returned an error
+	exitAuthenticationFail = 4 // The API rejected the API key
+	exitHostCheckFailed    = 5 // A check of the host failed, see doctor
+	exitPermissionDenied   = 6 // The command needs root privileges
+	exitPartialFailure     = 7 // Some tasks of a one-shot run or a single task failed
+	exitAlreadyRunning     = 8 // Another agent is running and could not be triggered
+)
+
+// fatal logs a message like log.Fatal, but exits with the given exit code.
+//
+// Parameters:
+//   - exitCode: The exit code, one of the exit* constants
+//   - v: The message, formatted like log.Print
+func fatal(exitCode int, v ...any) {
+	log.Print(v...)
+	os.Exit(exitCode)
+}
+
+// installerExitCode returns the exit code of an error of the installer
+func installerExitCode(err error) int {
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return exitPermissionDenied
+	case errors.Is(err, linux_installer.ErrReadOnlyFilesystem):
+		return exitHostCheckFailed
+	case errors.Is(err, linux_installer.ErrNotInstalled):
+		return exitConfigInvalid
+	}
+	return exitFailure
+}
+
+// tasksExitCode returns the exit code of a one-shot run or a single task from
+// the failures recorded by the tasks.
+//
+// Parameters:
+//   - failures: The recorded failures, see tasks.RecordedFailures
+//
+// Returns:
+//   - int: exitAuthenticationFail if the API rejected the API key,
+//     exitApiUnreachable if only retryable requests failed, exitPartialFailure
+//     for other failures and exitValid without failures
+func tasksExitCode(failures tasks.Failures) int {
+	switch {
+	case failures.Unauthorized:
+		return exitAuthenticationFail
+	case failures.Count > 0 && failures.Count == failures.Unreachable:
+		return exitApiUnreachable
+	case failures.Count > 0:
+		return exitPartialFailure
+	}
+	return exitValid
+}
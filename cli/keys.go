@@ -0,0 +1,86 @@
+package cli
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// runKeys manages the host security keys of the configuration file:
+// "keys list", "keys add <key>", "keys remove <key>" and "keys fetch".
+//
+// Parameters:
+//   - args: The arguments after "keys"
+//
+// Returns:
+//   - int: The exit code, 0 on success
+func runKeys(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("Usage: cloud-guardian keys list|add <key>|remove <key>|fetch")
+		return exitConfigInvalid
+	}
+	keys := slices.Clone(config.HostSecurityKeys)
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		for _, key := range keys {
+			fmt.Println(key)
+		}
+		return exitValid
+	case args[0] == "add" && len(args) == 2:
+		key := strings.TrimSpace(args[1])
+		if _, err := hex.DecodeString(key); err != nil || key == "" {
+			fmt.Println("Invalid key, a host security key is hex encoded")
+			return exitConfigInvalid
+		}
+		if slices.Contains(keys, key) {
+			fmt.Println("The key is already configured")
+			return exitValid
+		}
+		keys = append(keys, key)
+	case args[0] == "remove" && len(args) == 2:
+		index := slices.Index(keys, strings.TrimSpace(args[1]))
+		if index < 0 {
+			fmt.Println("The key is not configured")
+			return exitConfigInvalid
+		}
+		keys = slices.Delete(keys, index, index+1)
+	case args[0] == "fetch" && len(args) == 1:
+		if config.ApiKey == "" {
+			fmt.Println("An API key is required to fetch the keys")
+			return exitConfigInvalid
+		}
+		api.SetSigningKey(config.ApiKey, config.SigningSecret)
+		statusCode, fetched, err := api.NewHTTPClient(config.ApiUrl, config.ApiKey, config.FallbackApiUrls()...).FetchSecurityKeys(context.Background())
+		switch {
+		case statusCode == http.StatusNotFound:
+			fetched = nil // No keys are configured for the account
+		case err != nil:
+			fmt.Println("Error fetching the keys:", parseErrorResponse(err))
+			return exitApiUnreachable
+		case statusCode != http.StatusOK:
+			fmt.Println("Error fetching the keys, status code", statusCode)
+			return exitApiUnreachable
+		}
+		keys = fetched
+	default:
+		fmt.Println("Usage: cloud-guardian keys list|add <key>|remove <key>|fetch")
+		return exitConfigInvalid
+	}
+
+	if config.Source.Path == "" {
+		fmt.Println("No configuration file found, install the agent first")
+		return exitConfigInvalid
+	}
+	if err := cloudguardian_config.SaveHostSecurityKeys(config.Source.Path, keys); err != nil {
+		fmt.Println("Error saving the keys:", err.Error())
+		return exitConfigInvalid
+	}
+	fmt.Println(len(keys), "host security keys saved to", config.Source.Path)
+	fmt.Println("Reload a running agent to use them, e.g. with 'systemctl reload cloud-guardian'")
+	return exitValid
+}
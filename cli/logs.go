@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"bufio"
+	"cloud-guardian/linux"
+	linux_installer "cloud-guardian/linux/installer"
+	cloudguardian_logging "cloud-guardian/logging"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// defaultLogFile is read by the logs command when the agent does not run under
+// systemd, e.g. when its output is redirected by cron or another init system
+const defaultLogFile = "/var/log/cloud-guardian.log"
+
+// runLogs prints the recent output of the agent, from the journal of the service
+// when systemd runs and from a log file otherwise, so the unit name and the log
+// location need not be known.
+//
+// Parameters:
+//   - args: The arguments after "logs"
+//
+// Returns:
+//   - int: The exit code, 0 on success
+func runLogs(args []string) int {
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	follow := flags.Bool("follow", false, "Keep printing new lines")
+	lines := flags.Int("lines", 50, "Number of recent lines to read")
+	level := flags.String("level", "info", "Only print lines of at least this level: info, warn or error")
+	file := flags.String("file", "", "Read this log file instead of the journal, defaults to "+defaultLogFile+" without systemd")
+	flags.Parse(args)
+
+	// The agent writes plain lines that are classified by their wording
+	minLevel, err := cloudguardian_logging.ParseLevel(*level)
+	if err != nil || minLevel > cloudguardian_logging.LevelInfo || *lines < 0 || flags.NArg() > 0 {
+		fmt.Println("Usage: cloud-guardian logs [--follow] [--lines <n>] [--level info|warn|error] [--file <path>]")
+		return exitConfigInvalid
+	}
+
+	var command *exec.Cmd
+	if _, err := os.Stat("/run/systemd/system"); err == nil && *file == "" && linux.CommandAvailable("journalctl") {
+		command = exec.Command("journalctl", "--unit="+linux_installer.ServiceName, "--lines="+strconv.Itoa(*lines), "--output=short-iso", "--no-pager")
+	} else {
+		path := *file
+		if path == "" {
+			path = defaultLogFile
+		}
+		if _, err := os.Stat(path); err != nil {
+			fmt.Println("Error reading the agent log:", err.Error())
+			if *file == "" {
+				fmt.Println("Without systemd the output of the agent has to be redirected to", defaultLogFile, "or a file given with --file")
+			}
+			return exitHostCheckFailed
+		}
+		command = exec.Command("tail", "--lines="+strconv.Itoa(*lines), path)
+	}
+	if *follow {
+		command.Args = append(command.Args, "--follow")
+	}
+	command.Stderr = os.Stderr
+
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		fmt.Println("Error reading the agent log:", err.Error())
+		return exitHostCheckFailed
+	}
+	if err := command.Start(); err != nil {
+		fmt.Println("Error reading the agent log:", err.Error())
+		return exitHostCheckFailed
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if cloudguardian_logging.LineLevel(scanner.Text()) <= minLevel {
+			fmt.Println(scanner.Text())
+		}
+	}
+	if err := command.Wait(); err != nil {
+		fmt.Println("Error reading the agent log:", err.Error())
+		return exitHostCheckFailed
+	}
+	return exitValid
+}
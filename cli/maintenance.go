@@ -0,0 +1,92 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runMaintenance starts, ends or shows the maintenance mode of the host, e.g.
+// "maintenance on --for 2h". The API keeps recording the data of a host in
+// maintenance mode and suppresses its alerts. The running agent follows the
+// maintenance mode in its next task cycle.
+//
+// Parameters:
+//   - args: The arguments after "maintenance"
+//
+// Returns:
+//   - int: The exit code, 0 on success
+func runMaintenance(args []string) int {
+	usage := "Usage: cloud-guardian maintenance on [--for <duration>] [--reason <text>] | off | status"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return exitConfigInvalid
+	}
+
+	switch args[0] {
+	case "on":
+		flags := flag.NewFlagSet("maintenance on", flag.ExitOnError)
+		duration := flags.Duration("for", 0, "End the maintenance mode after this duration, e.g. 2h, it lasts until 'maintenance off' by default")
+		reason := flags.String("reason", "", "Why the host is in maintenance mode, reported with the ping, e.g. a change number")
+		flags.Parse(args[1:])
+		if *duration < 0 || flags.NArg() > 0 {
+			fmt.Println(usage)
+			return exitConfigInvalid
+		}
+		mode, err := tasks.StartMaintenance(*reason, *duration, "")
+		if err != nil {
+			return maintenanceError("starting", err)
+		}
+		if mode.Until != "" {
+			fmt.Println("Maintenance mode on until", mode.Until+", alerts of this host are suppressed")
+		} else {
+			fmt.Println("Maintenance mode on until 'cloud-guardian maintenance off', alerts of this host are suppressed")
+		}
+	case "off":
+		if len(args) > 1 {
+			fmt.Println(usage)
+			return exitConfigInvalid
+		}
+		active, err := tasks.EndMaintenance()
+		if err != nil {
+			return maintenanceError("ending", err)
+		}
+		if !active {
+			fmt.Println("The host is not in maintenance mode")
+			return exitValid
+		}
+		fmt.Println("Maintenance mode off")
+	case "status":
+		mode, active := tasks.Maintenance()
+		if !active {
+			fmt.Println("The host is not in maintenance mode")
+			return exitValid
+		}
+		fmt.Println("Maintenance mode on since", mode.Since)
+		if mode.Until != "" {
+			fmt.Println("Until: ", mode.Until)
+		}
+		if mode.Reason != "" {
+			fmt.Println("Reason:", mode.Reason)
+		}
+		if mode.JobId != "" {
+			fmt.Println("Job:   ", mode.JobId)
+		}
+	default:
+		fmt.Println(usage)
+		return exitConfigInvalid
+	}
+	return exitValid
+}
+
+// maintenanceError prints an error of the maintenance command and returns its exit code
+func maintenanceError(action string, err error) int {
+	if errors.Is(err, os.ErrPermission) {
+		fmt.Println("Error: You need to run this command with root privileges to change the maintenance mode.")
+		return exitPermissionDenied
+	}
+	fmt.Println("Error "+action+" the maintenance mode:", err.Error())
+	return exitHostCheckFailed
+}
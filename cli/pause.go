@@ -0,0 +1,75 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runPause pauses the job execution and the submissions of the agent, e.g.
+// during incident response, without stopping or uninstalling the service. The
+// running agent follows the pause in its next task cycle.
+//
+// Parameters:
+//   - args: The arguments after "pause"
+//
+// Returns:
+//   - int: The exit code, 0 if the agent was paused
+func runPause(args []string) int {
+	flags := flag.NewFlagSet("pause", flag.ExitOnError)
+	duration := flags.Duration("for", 0, "Resume automatically after this duration, e.g. 2h, pauses until resume by default")
+	reason := flags.String("reason", "", "Why the agent is paused, reported with the ping, e.g. an incident number")
+	flags.Parse(args)
+	if *duration < 0 || flags.NArg() > 0 {
+		fmt.Println("Usage: cloud-guardian pause [--for <duration>] [--reason <text>]")
+		return exitConfigInvalid
+	}
+
+	state, err := tasks.Pause(*reason, *duration)
+	if err != nil {
+		if os.IsPermission(err) {
+			fmt.Println("Error: You need to run this command with root privileges to pause the agent.")
+			return exitPermissionDenied
+		}
+		fmt.Println("Error pausing the agent:", err.Error())
+		return exitHostCheckFailed
+	}
+	if state.Until != "" {
+		fmt.Println("Agent paused until", state.Until+", jobs and submissions are skipped")
+	} else {
+		fmt.Println("Agent paused until 'cloud-guardian resume', jobs and submissions are skipped")
+	}
+	return exitValid
+}
+
+// runResume removes a pause of the agent.
+//
+// Parameters:
+//   - args: The arguments after "resume"
+//
+// Returns:
+//   - int: The exit code, 0 if the agent is not paused anymore
+func runResume(args []string) int {
+	if len(args) > 0 {
+		fmt.Println("Usage: cloud-guardian resume")
+		return exitConfigInvalid
+	}
+	state, paused := tasks.Paused()
+	resumed, err := tasks.Resume()
+	if err != nil {
+		if os.IsPermission(err) {
+			fmt.Println("Error: You need to run this command with root privileges to resume the agent.")
+			return exitPermissionDenied
+		}
+		fmt.Println("Error resuming the agent:", err.Error())
+		return exitHostCheckFailed
+	}
+	if !resumed || !paused {
+		fmt.Println("The agent is not paused")
+		return exitValid
+	}
+	fmt.Println("Agent resumed, it was paused for", time.Since(state.Since).Round(time.Second))
+	return exitValid
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	tasks "cloud-guardian/tasks"
+	"fmt"
+)
+
+// runRollbackAgent restores the previous agent binary if an updated agent did not
+// start its new version in time. It is hidden, the timer started before the
+// restart of an update_agent job runs it, see tasks.RollbackAgentUpdate.
+//
+// Returns:
+//   - int: The exit code, 0 if nothing had to be restored or the previous binary runs again
+func runRollbackAgent() int {
+	restored, err := tasks.RollbackAgentUpdate()
+	if err != nil {
+		fmt.Println("Error restoring the previous agent:", err.Error())
+		return exitFailure
+	}
+	if !restored {
+		fmt.Println("The updated agent started, nothing to restore")
+	}
+	return exitValid
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	api "cloud-guardian/api"
+	linux_top "cloud-guardian/linux/top"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// selftestStep is the result of one step of the selftest for one host
+type selftestStep struct {
+	name     string
+	err      error
+	duration time.Duration
+}
+
+// runSelftest runs the register, ping, monitoring and job lifecycle against an API
+// with temporary hostnames, so platform teams can validate server upgrades with
+// the code path of the real client. The hosts run in parallel.
+//
+// Parameters:
+//   - args: The arguments after "selftest"
+//
+// Returns:
+//   - int: The exit code, 0 if all steps succeeded for all hosts
+func runSelftest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	against := flags.String("against", "", "API URL to test, e.g. a staging API (required)")
+	apiKey := flags.String("api-key", os.Getenv("CLOUD_GUARDIAN_API_KEY"), "API key for authentication")
+	hosts := flags.Int("hosts", 1, "Number of temporary hosts that run the selftest in parallel")
+	flags.Parse(args)
+
+	if *against == "" || *apiKey == "" {
+		fmt.Println("Usage: cloud-guardian selftest --against <url> [--api-key <key>] [--hosts <n>]")
+		return exitConfigInvalid
+	}
+	apiUrl := *against
+	if !strings.HasSuffix(apiUrl, "/") {
+		apiUrl += "/"
+	}
+	api.SetSigningKey(*apiKey, "")
+	client := api.NewHTTPClient(apiUrl, *apiKey)
+
+	runId := make([]byte, 4)
+	rand.Read(runId)
+
+	results := make([][]selftestStep, *hosts)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = selftestHost(client, fmt.Sprintf("cg-selftest-%s-%d", hex.EncodeToString(runId), i+1))
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, steps := range results {
+		for _, step := range steps {
+			status := "ok"
+			if step.err != nil {
+				status = "FAILED: " + step.err.Error()
+				failed++
+			}
+			fmt.Printf("host %d  %-12s %8s  %s\n", i+1, step.name, step.duration.Round(time.Millisecond), status)
+		}
+	}
+	if failed > 0 {
+		fmt.Println(failed, "steps failed")
+		return exitApiUnreachable
+	}
+	fmt.Println("All steps succeeded")
+	return exitValid
+}
+
+// selftestHost runs the selftest steps for one temporary host. A failed step ends
+// the selftest of the host, the following steps depend on it.
+func selftestHost(client api.Client, hostname string) []selftestStep {
+	steps := []selftestStep{}
+	run := func(name string, step func() error) bool {
+		start := time.Now()
+		err := step()
+		steps = append(steps, selftestStep{name: name, err: err, duration: time.Since(start)})
+		return err == nil
+	}
+
+	_ = run("register", func() error {
+		statusCode, _, err := client.Register(context.Background(), hostname, map[string]string{"selftest": "true"})
+		return expectStatus(statusCode, err)
+	}) && run("ping", func() error {
+		return expectStatus(client.Ping(context.Background(), hostname, api.Heartbeat{}))
+	}) && run("monitoring", func() error {
+		uptime, _ := linux_top.GetUptime()
+		return expectStatus(client.SubmitMonitoring(context.Background(), hostname, api.Monitoring{
+			Uptime:         uptime,
+			LoadAverage:    linux_top.GetLoad(),
+			Memory:         linux_top.GetMemory(),
+			CycleTimestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		}))
+	}) && run("jobs", func() error {
+		return selftestJobs(client, hostname)
+	})
+	return steps
+}
+
+// selftestJobs fetches the submitted jobs of the temporary host and reports them
+// as running and completed. A new host has no jobs, then an update of an unknown
+// job must be rejected with 404.
+func selftestJobs(client api.Client, hostname string) error {
+	statusCode, jobs, err := client.FetchJobs(context.Background(), hostname, "submitted")
+	if statusCode != http.StatusNotFound {
+		if err := expectStatus(statusCode, err); err != nil {
+			return err
+		}
+	}
+	if len(jobs) == 0 {
+		statusCode, _ := client.UpdateJob(context.Background(), "cg-selftest-unknown-job", "running", "")
+		if statusCode != http.StatusNotFound {
+			return fmt.Errorf("expected status code 404 for an unknown job, got %d", statusCode)
+		}
+		return nil
+	}
+	for _, job := range jobs {
+		if err := expectStatus(client.UpdateJob(context.Background(), job.JobId, "running", "")); err != nil {
+			return err
+		}
+		if err := expectStatus(client.UpdateJob(context.Background(), job.JobId, "completed", "selftest")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expectStatus(statusCode int, err error) error {
+	if err != nil {
+		return errors.New(parseErrorResponse(err))
+	}
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", statusCode)
+	}
+	return nil
+}
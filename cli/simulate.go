@@ -0,0 +1,270 @@
+package cli
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_version"
+	linux_df "cloud-guardian/linux/df"
+	linux_top "cloud-guardian/linux/top"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// simulatedOs are the operating systems of the virtual hosts
+var simulatedOs = []struct{ name, versionId, repo string }{
+	{"Ubuntu", "24.04", "noble-updates"},
+	{"Ubuntu", "22.04", "jammy-updates"},
+	{"Debian GNU/Linux", "12", "bookworm"},
+	{"Rocky Linux", "9.4", "baseos"},
+	{"AlmaLinux", "8.10", "appstream"},
+}
+
+// simulatedPackages are the packages every virtual host has installed
+var simulatedPackages = []string{
+	"bash", "coreutils", "curl", "dbus", "e2fsprogs", "gzip", "iproute2", "kmod", "less", "libc6",
+	"libssl3", "logrotate", "nginx", "openssh-server", "openssl", "procps", "python3", "rsyslog",
+	"sudo", "systemd", "tar", "tzdata", "util-linux", "vim", "wget", "zlib1g",
+}
+
+// simulatedHost is a virtual host of the simulation with its slowly changing state
+type simulatedHost struct {
+	hostname string
+	random   *rand.Rand
+	os       int
+	cores    int
+	memory   float64 // Total memory in KB
+	disk     float64 // Size of the root filesystem in KB
+	used     float64 // Used space of the root filesystem in KB
+	uptime   int64
+	load     float64
+	updates  []map[string]string
+}
+
+// simulationStats counts the submissions of the simulation by step
+type simulationStats struct {
+	mu       sync.Mutex
+	requests map[string]int
+	failures map[string]int
+}
+
+// record counts a submission, a failure is a transport error or a status other than 200
+func (s *simulationStats) record(step string, statusCode int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[step]++
+	if err != nil || statusCode != http.StatusOK {
+		s.failures[step]++
+	}
+}
+
+// runSimulate submits plausible monitoring, package, update and job data for virtual
+// hosts to a test API, so the server can be load-tested and demoed without
+// provisioning machines. The mode is hidden, it is neither in the usage nor in the
+// shell completion. The same seed generates the same hosts.
+//
+// Parameters:
+//   - args: The arguments after "--simulate"
+//
+// Returns:
+//   - int: The exit code, 0 if all submissions succeeded
+func runSimulate(args []string) int {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	against := flags.String("against", "", "API URL of a test API (required)")
+	apiKey := flags.String("api-key", os.Getenv("CLOUD_GUARDIAN_API_KEY"), "API key for authentication")
+	hosts := flags.Int("hosts", 10, "Number of virtual hosts")
+	prefix := flags.String("prefix", "cg-sim", "Prefix of the virtual hostnames")
+	interval := flags.Duration("interval", time.Minute, "Time between the cycles of a host")
+	cycles := flags.Int("cycles", 0, "Cycles of each host, 0 runs until interrupted")
+	seed := flags.Int64("seed", 1, "Seed of the generated data")
+	flags.Parse(args)
+
+	if *against == "" || *apiKey == "" || *hosts < 1 || *interval <= 0 {
+		fmt.Println("Usage: cloud-guardian --simulate --against <url> [--api-key <key>] [--hosts <n>] [--interval <duration>] [--cycles <n>] [--seed <n>]")
+		return exitConfigInvalid
+	}
+	apiUrl := *against
+	if !strings.HasSuffix(apiUrl, "/") {
+		apiUrl += "/"
+	}
+	api.SetSigningKey(*apiKey, "")
+	client := api.NewHTTPClient(apiUrl, *apiKey)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stats := &simulationStats{requests: map[string]int{}, failures: map[string]int{}}
+	fmt.Println("Simulating", *hosts, "hosts against", apiUrl)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *hosts; i++ {
+		host := newSimulatedHost(fmt.Sprintf("%s-%04d", *prefix, i+1), *seed+int64(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Spread the hosts over the interval like real agents started at different times
+			select {
+			case <-time.After(time.Duration(host.random.Int63n(int64(*interval)))):
+			case <-ctx.Done():
+				return
+			}
+			host.run(ctx, client, stats, *interval, *cycles)
+		}()
+	}
+	wg.Wait()
+
+	steps := make([]string, 0, len(stats.requests))
+	failed := 0
+	for step := range stats.requests {
+		steps = append(steps, step)
+		failed += stats.failures[step]
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		fmt.Printf("%-12s %8d requests %8d failed\n", step, stats.requests[step], stats.failures[step])
+	}
+	if failed > 0 {
+		return exitApiUnreachable
+	}
+	return exitValid
+}
+
+// newSimulatedHost generates a virtual host, the seed determines its profile
+func newSimulatedHost(hostname string, seed int64) *simulatedHost {
+	random := rand.New(rand.NewSource(seed))
+	host := &simulatedHost{
+		hostname: hostname,
+		random:   random,
+		os:       random.Intn(len(simulatedOs)),
+		cores:    []int{1, 2, 4, 8, 16}[random.Intn(5)],
+		disk:     float64([]int{20, 40, 80, 160}[random.Intn(4)]) * 1024 * 1024,
+		uptime:   random.Int63n(90 * 24 * 3600),
+	}
+	host.memory = float64(host.cores) * 2 * 1024 * 1024
+	host.used = host.disk * (0.2 + random.Float64()*0.5)
+	host.load = float64(host.cores) * random.Float64() * 0.5
+	for _, name := range simulatedPackages {
+		if random.Intn(4) == 0 {
+			host.updates = append(host.updates, map[string]string{"name": name, "version": host.version(name, 1), "repo": simulatedOs[host.os].repo})
+		}
+	}
+	return host
+}
+
+// version returns a plausible version of a package, newer for a higher release
+func (host *simulatedHost) version(name string, release int) string {
+	return fmt.Sprintf("%d.%d.%d-%d", len(name)%5+1, len(name)%13, host.os+2, release+1)
+}
+
+// run submits the data of the host every interval, the inventory in the first cycle
+func (host *simulatedHost) run(ctx context.Context, client api.Client, stats *simulationStats, interval time.Duration, cycles int) {
+	for cycle := 0; cycles == 0 || cycle < cycles; cycle++ {
+		if cycle == 0 {
+			statusCode, _, err := client.Register(context.Background(), host.hostname, map[string]string{"simulated": "true"})
+			stats.record("register", statusCode, err)
+			statusCode, err = client.SubmitSystemInfo(context.Background(), host.hostname, host.systemInfo())
+			stats.record("systeminfo", statusCode, err)
+			statusCode, err = client.SubmitPackages(context.Background(), host.hostname, host.packages())
+			stats.record("packages", statusCode, err)
+			statusCode, err = client.SubmitUpdates(context.Background(), host.hostname, false, host.updates, &api.UpdateSize{DownloadBytes: int64(len(host.updates)) * 850_000})
+			stats.record("updates", statusCode, err)
+		}
+		statusCode, err := client.Ping(context.Background(), host.hostname, api.Heartbeat{})
+		stats.record("ping", statusCode, err)
+		statusCode, err = client.SubmitMonitoring(context.Background(), host.hostname, host.monitoring(interval))
+		stats.record("monitoring", statusCode, err)
+		host.processJobs(client, stats)
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// systemInfo returns the system information of the host
+func (host *simulatedHost) systemInfo() api.SystemInfo {
+	return api.SystemInfo{
+		OsName:             simulatedOs[host.os].name,
+		OsVersionId:        simulatedOs[host.os].versionId,
+		AgentVersion:       cloudguardian_version.Version,
+		AgentRunningAsRoot: true,
+		Timezone:           "UTC",
+		Locale:             "C.UTF-8",
+		NtpService:         "chrony",
+		Tags:               map[string]string{},
+		Labels:             map[string]string{"simulated": "true"},
+	}
+}
+
+// packages returns the installed packages of the host
+func (host *simulatedHost) packages() []map[string]string {
+	packages := []map[string]string{}
+	for _, name := range simulatedPackages {
+		packages = append(packages, map[string]string{"name": name, "version": host.version(name, 0), "repo": simulatedOs[host.os].repo})
+	}
+	return packages
+}
+
+// monitoring advances the state of the host by an interval and returns its monitoring
+func (host *simulatedHost) monitoring(interval time.Duration) api.Monitoring {
+	random := host.random
+	host.uptime += int64(interval.Seconds())
+	host.load = max(0, host.load+(random.Float64()-0.5)*float64(host.cores)*0.2)
+	host.used = min(host.disk*0.98, host.used+host.disk*random.Float64()*0.001)
+	busy := min(100, host.load/float64(host.cores)*100)
+	used := host.memory * (0.3 + random.Float64()*0.4)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	return api.Monitoring{
+		Uptime:      host.uptime,
+		LoadAverage: linux_top.LoadAverage{OneMinute: host.load, FiveMinutes: host.load * 0.9, FifteenMinutes: host.load * 0.8},
+		CpuUsage:    linux_top.CpuUsage{User: busy * 0.7, System: busy * 0.25, IOWait: busy * 0.05, Idle: 100 - busy},
+		CpuInfo:     linux_top.CpuInfo{ModelName: "Simulated CPU", Cores: host.cores, Threads: host.cores, Mhz: 2400},
+		Memory:      linux_top.MemoryUsage{Total: host.memory, Used: used, Free: host.memory - used, Available: host.memory - used},
+		Tasks:       linux_top.TaskStats{Total: 100 + host.cores*10, Running: 1 + random.Intn(host.cores), Sleeping: 99 + host.cores*10},
+		DiskFree: []linux_df.Df{
+			{Source: "/dev/vda1", FSType: "ext4", Size: host.disk, Used: host.used, Avail: host.disk - host.used, Target: "/"},
+		},
+		CycleTimestamp:     now,
+		CaptureTimestamps:  map[string]string{"Uptime": now},
+		CollectorErrors:    []api.CollectorError{},
+		DisabledCollectors: []string{},
+		SkippedCollectors:  []string{},
+		FallbackCollectors: []string{},
+	}
+}
+
+// processJobs reports the submitted jobs of the host as running and then as completed,
+// one in ten fails. Nothing is executed.
+func (host *simulatedHost) processJobs(client api.Client, stats *simulationStats) {
+	statusCode, jobs, err := client.FetchJobs(context.Background(), host.hostname, "submitted")
+	if statusCode == http.StatusNotFound {
+		statusCode, err = http.StatusOK, nil // No jobs
+	}
+	stats.record("jobs", statusCode, err)
+	for _, job := range jobs {
+		startedAt := time.Now().UTC().Format(time.RFC3339)
+		statusCode, err := client.UpdateJob(context.Background(), job.JobId, "running", api.JobResult{StartedAt: startedAt}.String())
+		stats.record("job_update", statusCode, err)
+		result := api.JobResult{StartedAt: startedAt, FinishedAt: time.Now().UTC().Format(time.RFC3339), Metadata: map[string]string{"simulated": "true"}}
+		status := "completed"
+		if host.random.Intn(10) == 0 {
+			status, result.ExitCode, result.ErrorCode, result.Message = "failed", 1, api.ErrorCodeCommandFailed, "simulated failure"
+		} else {
+			result.Message = "simulated " + job.JobType + " job"
+		}
+		if job.JobType == "update" && status == "completed" {
+			host.updates = nil
+		}
+		statusCode, err = client.UpdateJob(context.Background(), job.JobId, status, result.String())
+		stats.record("job_update", statusCode, err)
+	}
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	linux_instance "cloud-guardian/linux/instance"
+	"cloud-guardian/tasks"
+	"errors"
+	"log"
+	"slices"
+)
+
+// runTask runs a single task once and exits, e.g. to debug a failing collector
+// without waiting for the scheduler. Collector tasks may run next to the agent
+// service, the jobs task needs the instance lock so jobs are not processed twice.
+//
+// Parameters:
+//   - hostname: The normalized hostname
+//   - name: The name of the task, see tasks.Tasks
+//
+// Returns:
+//   - int: The exit code, 0 if the task ran without failures, see tasksExitCode
+func runTask(hostname string, name string) int {
+	if !slices.Contains(tasks.TaskNames(), name) {
+		log.Println("Error: unknown task", name+", known tasks are", tasks.TaskNames())
+		return exitConfigInvalid
+	}
+	if name == "jobs" {
+		lock, err := linux_instance.Acquire()
+		if errors.Is(err, linux_instance.ErrAlreadyRunning) {
+			log.Println("Error: Another cloud-guardian agent is already running and processes the jobs. Use --one-shot to trigger it.")
+			return exitAlreadyRunning
+		}
+		if err != nil {
+			log.Println("Warning: Could not check for other running agents:", err.Error())
+		} else {
+			defer lock.Release()
+		}
+	}
+	tasks.SetConfig(config)
+	tasks.SetClient(client)
+	if err := tasks.RunTask(hostname, name); err != nil {
+		log.Println("Error:", err.Error())
+		return exitConfigInvalid
+	}
+	return tasksExitCode(tasks.RecordedFailures())
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// validateConfig checks the configuration and authenticates against the API
+// without registering the host or changing any state.
+//
+// Parameters:
+//   - config: The loaded configuration, nil if loading failed
+//   - loadErr: The error of loading the configuration
+//   - applyOverrides: Applies the command-line flags to the configuration
+//
+// Returns:
+//   - int: The exit code
+func validateConfig(config *cloudguardian_config.CloudGuardianConfig, loadErr error, applyOverrides func(*cloudguardian_config.CloudGuardianConfig)) int {
+	if loadErr != nil {
+		fmt.Println("Configuration invalid:", loadErr.Error())
+		return exitConfigInvalid
+	}
+	applyOverrides(config)
+	if err := config.Validate(); err != nil {
+		fmt.Println("Configuration invalid:", err.Error())
+		return exitConfigInvalid
+	}
+	if config.ApiKey == "" {
+		fmt.Println("Configuration invalid: no API key is configured")
+		return exitConfigInvalid
+	}
+	if config.Source.Path != "" {
+		fmt.Println("Configuration file:", config.Source.Path)
+	} else {
+		fmt.Println("Configuration file: none, using the defaults and the environment")
+	}
+	fmt.Println("API URL:", config.ApiUrl)
+
+	exitCode, message := authenticate(config)
+	if exitCode == exitValid {
+		message = "Configuration valid, " + message
+	}
+	fmt.Println(message)
+	return exitCode
+}
+
+// authenticate checks the API key against the API without side effects.
+//
+// Parameters:
+//   - config: The validated configuration
+//
+// Returns:
+//   - int: The exit code, exitValid if the API accepted the API key
+//   - string: The result for the user
+func authenticate(config *cloudguardian_config.CloudGuardianConfig) (int, string) {
+	// Fetching the security keys authenticates the API key without side effects
+	api.SetSigningKey(config.ApiKey, config.SigningSecret)
+	statusCode, _, err := api.NewHTTPClient(config.ApiUrl, config.ApiKey, config.FallbackApiUrls()...).FetchSecurityKeys(context.Background())
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return exitAuthenticationFail, "Authentication failed: the API rejected the API key"
+	case statusCode == http.StatusOK || statusCode == http.StatusNotFound: // No security keys are configured
+		return exitValid, "authenticated against the API"
+	case err != nil:
+		return exitApiUnreachable, "API unreachable: " + parseErrorResponse(err)
+	default:
+		return exitApiUnreachable, fmt.Sprint("API unreachable: unexpected status code ", statusCode)
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	cloudguardian_crypto "cloud-guardian/crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// verifyJobPayload is a job as sent by the API, with the hostname the job is for
+type verifyJobPayload struct {
+	CreatedAt string `json:"createdAt"`
+	Hostname  string `json:"hostname"`
+	JobType   string `json:"jobType"`
+	JobData   string `json:"jobData"`
+	Signature string `json:"signature"`
+}
+
+// runVerifyJob verifies the signature of a job without a live host. It builds the
+// signed message like processNewJobs and prints it with its hash, so signature
+// mismatches caused by field ordering or escaping can be found.
+//
+// Parameters:
+//   - args: The arguments after "verify-job"
+//
+// Returns:
+//   - int: The exit code, 0 if the signature is valid and 1 if it is invalid
+func runVerifyJob(args []string) int {
+	flags := flag.NewFlagSet("verify-job", flag.ExitOnError)
+	payloadFile := flags.String("payload", "", "JSON file with the createdAt, hostname, jobType and jobData of the job (required)")
+	signature := flags.String("signature", "", "Hex encoded signature or a file containing it, defaults to the signature field of the payload")
+	key := flags.String("key", "", "Hex encoded host security key (public key) or a file containing it (required)")
+	flags.Parse(args)
+
+	if *payloadFile == "" || *key == "" {
+		fmt.Println("Usage: cloud-guardian verify-job --payload <file> --key <key> [--signature <signature>]")
+		return exitConfigInvalid
+	}
+	data, err := os.ReadFile(*payloadFile)
+	if err != nil {
+		fmt.Println("Error reading the payload:", err.Error())
+		return exitConfigInvalid
+	}
+	var payload verifyJobPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		fmt.Println("Error decoding the payload:", err.Error())
+		return exitConfigInvalid
+	}
+	if *signature == "" {
+		*signature = payload.Signature
+	}
+
+	message := cloudguardian_crypto.JobMessage(payload.CreatedAt, payload.Hostname, payload.JobType, payload.JobData)
+	hash := sha256.Sum256([]byte(message))
+	fmt.Println("Signed message:", message)
+	fmt.Println("SHA-256:       ", hex.EncodeToString(hash[:]))
+
+	valid, err := cloudguardian_crypto.ValidatePayload(valueOrFile(*key), message, valueOrFile(*signature))
+	if err != nil {
+		fmt.Println("Signature invalid:", err.Error())
+		return exitFailure
+	}
+	if !valid {
+		fmt.Println("Signature invalid: it does not match the message and the key")
+		return exitFailure
+	}
+	fmt.Println("Signature valid")
+	return exitValid
+}
+
+// valueOrFile returns the trimmed content of the file if value names a readable
+// file, the value itself otherwise.
+func valueOrFile(value string) string {
+	if data, err := os.ReadFile(value); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return strings.TrimSpace(value)
+}
@@ -1,48 +1,362 @@
 package cloudguardian_config
 
 import (
+	cloudguardian_logging "cloud-guardian/logging"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// StateDir is the writable directory for agent state. It is also the fallback
+// location of the configuration file on systems with a read-only /etc.
+const StateDir = "/var/lib/cloud-guardian"
+
 type CloudGuardianConfig struct {
-	ApiUrl           string   `json:"api_url"`                      // URL of the Cloud Gardian API
-	ApiKey           string   `json:"api_key"`                      // API key for authentication
-	HostSecurityKeys []string `json:"host_security_keys,omitempty"` // Optional host security key
-	Debug            bool     `json:"debug"`                        // Debug mode flag
+	Version               int                     `json:"config_version"`                    // Version of the file format, see ConfigVersion
+	ApiUrl                string                  `json:"api_url"`                           // URL of the Cloud Gardian API
+	ApiUrls               []string                `json:"-"`                                 // All API URLs in order of preference, if api_url is a list
+	ApiKey                string                  `json:"api_key"`                           // API key for authentication
+	ApiKeyFile            string                  `json:"api_key_file,omitempty"`            // File with the API key, replaces api_key, e.g. a systemd credential
+	EncryptApiKey         bool                    `json:"-"`                                 // Save the api_key encrypted with a key bound to the machine ID
+	HostSecurityKeys      []string                `json:"host_security_keys,omitempty"`      // Optional host security key
+	HostSecurityKeyFile   string                  `json:"host_security_key_file,omitempty"`  // File with one host security key per line, replaces host_security_keys
+	SigningSecret         string                  `json:"signing_secret,omitempty"`          // Issued by the API at registration, the requests of the agent are signed with a key derived from it
+	Debug                 bool                    `json:"debug"`                             // Debug mode flag, the same as log_level debug
+	LogLevel              string                  `json:"log_level,omitempty"`               // error, warn, info, debug or trace, info by default
+	DebugBodies           bool                    `json:"debug_bodies,omitempty"`            // Log API request and response bodies in debug mode, secrets are redacted
+	LongPoll              bool                    `json:"long_poll"`                         // Wait for new jobs with a long-poll request
+	DryRun                bool                    `json:"dry_run,omitempty"`                 // Update, reboot, command, script, swap and update_agent jobs are reported as simulated instead of executed
+	FactTags              map[string]string       `json:"fact_tags,omitempty"`               // Tags computed from host facts, e.g. {"datacenter": "file:/etc/datacenter"}
+	AptDpkgOptions        []string                `json:"apt_dpkg_options,omitempty"`        // Dpkg::Options passed to apt, e.g. ["--force-confdef", "--force-confold"]
+	WatchedServices       []string                `json:"watched_services,omitempty"`        // Services whose unit files are checked for drift
+	WatchedFiles          []string                `json:"watched_files,omitempty"`           // Critical files checked for immutable attributes and owner changes
+	RebootMethod          string                  `json:"reboot_method,omitempty"`           // auto, systemctl, reboot, kexec or logind
+	OtlpEndpoint          string                  `json:"otlp_endpoint,omitempty"`           // OTLP/HTTP receiver for traces, e.g. http://localhost:4318, tracing is disabled if empty
+	HostnameDomain        string                  `json:"hostname_domain,omitempty"`         // keep, strip or fqdn: how the domain of the reported hostname is normalized
+	HostnameLower         bool                    `json:"hostname_lowercase,omitempty"`      // Report the hostname in lowercase
+	Hostname              string                  `json:"hostname,omitempty"`                // Custom host identifier reported instead of the system hostname
+	HostnamePrefix        string                  `json:"hostname_prefix,omitempty"`         // Prepended to the reported hostname, e.g. "fra1-"
+	HostnameSuffix        string                  `json:"hostname_suffix,omitempty"`         // Appended to the reported hostname, e.g. "-fra1"
+	DisableAutoReregister bool                    `json:"disable_auto_reregister,omitempty"` // Do not register the host again when the API deleted it
+	AutoUpdate            bool                    `json:"auto_update,omitempty"`             // Install the latest agent release when the API no longer supports the running version
+	MonitoringInterval    int                     `json:"monitoring_interval,omitempty"`     // Minutes between pings and monitoring submissions
+	JobPollInterval       int                     `json:"job_poll_interval,omitempty"`       // Minutes between job polls, also the fallback with long_poll
+	ServiceFilesInterval  int                     `json:"service_files_interval,omitempty"`  // Minutes between service file drift checks
+	InventoryInterval     int                     `json:"inventory_interval,omitempty"`      // Minutes between system info, update and package submissions
+	Labels                map[string]string       `json:"labels,omitempty"`                  // Labels sent with the registration and system info, e.g. {"environment": "prod", "team": "db"}
+	StatusListen          string                  `json:"status_listen,omitempty"`           // Loopback address of the read-only status page, e.g. 127.0.0.1:9273, disabled if empty
+	PrometheusTextfileDir string                  `json:"prometheus_textfile_dir,omitempty"` // Textfile collector directory of node_exporter, the key metrics of each cycle are written there, disabled if empty
+	Collectors            map[string]bool         `json:"collectors,omitempty"`              // Monitoring collectors by name, e.g. {"lsblk": false}, all are enabled by default
+	CollectorIntervals    map[string]int          `json:"collector_intervals,omitempty"`     // Minutes between runs by collector, e.g. {"df": 1}, others run every monitoring_interval
+	MaintenanceWindows    []MaintenanceWindow     `json:"maintenance_windows,omitempty"`     // Update, reboot, command, script and swap jobs are deferred outside of these windows
+	JobRateLimits         map[string]JobRateLimit `json:"job_rate_limits,omitempty"`         // Local limits by job type, e.g. {"reboot": {"max": 1, "period_minutes": 360}}
+	JobPolicy             JobPolicy               `json:"job_policy"`                        // Job types and commands the host executes, all if empty
+	ScriptInterpreter     string                  `json:"script_interpreter,omitempty"`      // Absolute path of the interpreter of script jobs, /bin/bash by default
+	ScriptTimeout         int                     `json:"script_timeout,omitempty"`          // Seconds a script job may run before it is killed, 3600 by default
+	CommandTimeout        int                     `json:"command_timeout,omitempty"`         // Seconds a command job may run before it is killed, 3600 by default
+	JobWorkers            int                     `json:"job_workers,omitempty"`             // Jobs that run at the same time, 4 by default, 1 runs them one after another
+	Tenants               []Tenant                `json:"tenants,omitempty"`                 // Accounts that receive some submissions instead of api_url, e.g. for managed-service providers
+	Source                Source                  `json:"-"`                                 // Where the configuration was loaded from
+}
+
+// Source describes the configuration file the configuration was loaded from, so
+// support can see when an agent runs with a stale or unexpected configuration.
+type Source struct {
+	Location     string   `json:"location"`                // cwd, user, system, state, drop-in, or default if no file was found
+	Path         string   `json:"path,omitempty"`          // Path of the configuration file
+	ModifiedAt   string   `json:"modified_at,omitempty"`   // Latest modification time of the files, RFC 3339
+	Checksum     string   `json:"checksum,omitempty"`      // SHA-256 of the content of all files
+	DropIns      []string `json:"drop_ins,omitempty"`      // Drop-in fragments merged over the file, in order
+	MigratedFrom int      `json:"migrated_from,omitempty"` // Oldest config_version of the files if they were migrated, rewritten on save
+	Environment  bool     `json:"environment"`             // CLOUD_GUARDIAN_* variables override the file
+}
+
+// labelPattern matches valid label keys, e.g. "environment" or "example.com/team"
+var labelPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._/-]{0,62}$`)
+
+const maxLabelValueLength = 255 // Maximum length of a label value
+
+// JobRateLimit limits how many jobs of a type the agent starts in a period
+type JobRateLimit struct {
+	Max           int `json:"max"`            // Maximum number of jobs started in the period
+	PeriodMinutes int `json:"period_minutes"` // Length of the sliding period in minutes
 }
 
+// Collectors are the names of the monitoring collectors that can be disabled
+var Collectors = []string{"loggedinusers", "df", "ip", "egress", "top", "lsblk", "mdstat", "needrestart", "pmhealth", "power", "quota"}
+
+// Default task intervals in minutes
+const (
+	DefaultMonitoringInterval   = 5
+	DefaultJobPollInterval      = 5
+	DefaultServiceFilesInterval = 60
+	DefaultInventoryInterval    = 1440
+)
+
+// Minimum task intervals in minutes, shorter intervals would overload the host or the API
+const (
+	MinMonitoringInterval   = 1
+	MinJobPollInterval      = 1
+	MinServiceFilesInterval = 5
+	MinInventoryInterval    = 60
+)
+
+// MaxCollectorInterval is the longest interval of a collector in minutes
+const MaxCollectorInterval = 1440
+
+// Script and command jobs run with this interpreter and these timeouts in seconds
+// unless configured or set by the job
+const (
+	DefaultScriptInterpreter = "/bin/bash"
+	DefaultScriptTimeout     = 3600
+	DefaultCommandTimeout    = 3600
+	MaxJobTimeout            = 86400
+)
+
+// Jobs run in the background with this many workers unless configured
+const (
+	DefaultJobWorkers = 4
+	MaxJobWorkers     = 32
+)
+
 // DefaultConfig returns a default configuration for Cloud Gardian.
 func DefaultConfig() *CloudGuardianConfig {
 	return &CloudGuardianConfig{
-		ApiUrl: "https://api.cloud-guardian.net/cloudguardian-api/v1/",
-		ApiKey: "",
-		Debug:  false,
+		Version: ConfigVersion,
+		ApiUrl:  "https://api.cloud-guardian.net/cloudguardian-api/v1/",
+		ApiKey:  "",
+		Debug:   false,
+
+		MonitoringInterval:   DefaultMonitoringInterval,
+		JobPollInterval:      DefaultJobPollInterval,
+		ServiceFilesInterval: DefaultServiceFilesInterval,
+		InventoryInterval:    DefaultInventoryInterval,
+
+		Source: Source{Location: "default"},
 	}
 }
 
-// Validate checks if the configuration is valid.
-func (config *CloudGuardianConfig) Validate() error {
-	if config.ApiUrl == "" {
+// UnmarshalJSON decodes the configuration. The api_url may be a single URL or a
+// list of URLs in order of preference, the first one is used as ApiUrl.
+func (config *CloudGuardianConfig) UnmarshalJSON(data []byte) error {
+	type plainConfig CloudGuardianConfig
+	aux := struct {
+		*plainConfig
+		ApiUrl json.RawMessage `json:"api_url"`
+	}{plainConfig: (*plainConfig)(config)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.ApiUrl) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(aux.ApiUrl, &config.ApiUrl); err == nil {
+		config.ApiUrls = nil
+		return nil
+	}
+	var apiUrls []string
+	if err := json.Unmarshal(aux.ApiUrl, &apiUrls); err != nil {
+		return fmt.Errorf("api_url must be a URL or a list of URLs")
+	}
+	if len(apiUrls) == 0 {
+		return fmt.Errorf("api_url cannot be an empty list")
+	}
+	config.ApiUrl = apiUrls[0]
+	config.ApiUrls = apiUrls
+	return nil
+}
+
+// FallbackApiUrls returns the API URLs that are used when ApiUrl is unreachable.
+func (config *CloudGuardianConfig) FallbackApiUrls() []string {
+	if len(config.ApiUrls) < 2 {
+		return nil
+	}
+	return config.ApiUrls[1:]
+}
+
+// validateApiUrl checks if a single API URL is valid.
+func validateApiUrl(apiUrl string) error {
+	if apiUrl == "" {
 		return fmt.Errorf("api_url cannot be empty")
 	}
-	if !strings.HasSuffix(config.ApiUrl, "/") {
+	if !strings.HasSuffix(apiUrl, "/") {
 		return fmt.Errorf("api_url must end with a /")
 	}
-	if !strings.HasPrefix(config.ApiUrl, "http://") && !strings.HasPrefix(config.ApiUrl, "https://") {
-		return fmt.Errorf("api_url must start with http:// or https://")
+	if !strings.HasPrefix(apiUrl, "http://") && !strings.HasPrefix(apiUrl, "https://") && !strings.HasPrefix(apiUrl, "unix://") {
+		return fmt.Errorf("api_url must start with http://, https:// or unix://")
+	}
+	return nil
+}
+
+// CollectorEnabled reports whether a monitoring collector is enabled, collectors
+// are enabled unless the collectors section disables them.
+//
+// Parameters:
+//   - name: The name of the collector, e.g. "lsblk"
+//
+// Returns:
+//   - bool: false if the collector is disabled
+func (config *CloudGuardianConfig) CollectorEnabled(name string) bool {
+	enabled, ok := config.Collectors[name]
+	return !ok || enabled
+}
+
+// CollectorInterval returns the minutes between runs of a monitoring collector,
+// collectors without an interval of their own run every monitoring interval.
+//
+// Parameters:
+//   - name: The name of the collector, e.g. "df"
+//
+// Returns:
+//   - int: The interval in minutes
+func (config *CloudGuardianConfig) CollectorInterval(name string) int {
+	if interval, ok := config.CollectorIntervals[name]; ok {
+		return interval
+	}
+	return config.MonitoringInterval
+}
+
+// validateLoopback checks that an address only listens on the loopback interface,
+// the status page is not authenticated.
+//
+// Parameters:
+//   - address: The listen address, e.g. 127.0.0.1:9273 or [::1]:9273
+//
+// Returns:
+//   - error: An error if the address is malformed or not a loopback address
+func validateLoopback(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("must be a host and port, e.g. 127.0.0.1:9273")
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("must be a loopback address, e.g. 127.0.0.1:9273")
+	}
+	return nil
+}
+
+// Validate checks if the configuration is valid.
+func (config *CloudGuardianConfig) Validate() error {
+	if err := validateApiUrl(config.ApiUrl); err != nil {
+		return err
+	}
+	for _, apiUrl := range config.FallbackApiUrls() {
+		if err := validateApiUrl(apiUrl); err != nil {
+			return err
+		}
 	}
 	if config.ApiKey != "" && len(config.ApiKey) != 16 {
 		return fmt.Errorf("api_key must be exactly 16 characters long")
 	}
+	if config.LogLevel != "" {
+		if _, err := cloudguardian_logging.ParseLevel(config.LogLevel); err != nil {
+			return fmt.Errorf("log_level: %w", err)
+		}
+	}
+	switch config.RebootMethod {
+	case "", "auto", "systemctl", "reboot", "kexec", "logind":
+	default:
+		return fmt.Errorf("reboot_method must be one of auto, systemctl, reboot, kexec or logind")
+	}
+	switch config.HostnameDomain {
+	case "", "keep", "strip", "fqdn":
+	default:
+		return fmt.Errorf("hostname_domain must be one of keep, strip or fqdn")
+	}
+	for key, value := range config.Labels {
+		if !labelPattern.MatchString(key) {
+			return fmt.Errorf("label %q must start with a letter and contain only letters, digits, '.', '_', '-' or '/'", key)
+		}
+		if len(value) > maxLabelValueLength {
+			return fmt.Errorf("value of label %q must be at most %d characters long", key, maxLabelValueLength)
+		}
+	}
+	for name := range config.Collectors {
+		if !slices.Contains(Collectors, name) {
+			return fmt.Errorf("unknown collector %q, known collectors are %s", name, strings.Join(Collectors, ", "))
+		}
+	}
+	for name, interval := range config.CollectorIntervals {
+		if !slices.Contains(Collectors, name) {
+			return fmt.Errorf("collector_intervals: unknown collector %q, known collectors are %s", name, strings.Join(Collectors, ", "))
+		}
+		if interval < MinMonitoringInterval || interval > MaxCollectorInterval {
+			return fmt.Errorf("collector_intervals: interval of %s must be between %d and %d minutes", name, MinMonitoringInterval, MaxCollectorInterval)
+		}
+	}
+	for jobType, limit := range config.JobRateLimits {
+		if limit.Max < 0 || limit.PeriodMinutes < 1 {
+			return fmt.Errorf("job rate limit of %s needs a max of at least 0 and a period_minutes of at least 1", jobType)
+		}
+	}
+	if err := validateTenants(config.Tenants); err != nil {
+		return err
+	}
+	if err := config.JobPolicy.validate(); err != nil {
+		return fmt.Errorf("job_policy: %w", err)
+	}
+	for i, window := range config.MaintenanceWindows {
+		if err := window.validate(); err != nil {
+			return fmt.Errorf("maintenance window %d: %w", i+1, err)
+		}
+	}
+	if config.StatusListen != "" {
+		if err := validateLoopback(config.StatusListen); err != nil {
+			return fmt.Errorf("status_listen %w", err)
+		}
+	}
+	for _, path := range config.WatchedFiles {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("watched_files must be absolute paths, got %q", path)
+		}
+	}
+	if config.PrometheusTextfileDir != "" && !filepath.IsAbs(config.PrometheusTextfileDir) {
+		return fmt.Errorf("prometheus_textfile_dir must be an absolute path")
+	}
+	if config.ScriptInterpreter != "" && !filepath.IsAbs(config.ScriptInterpreter) {
+		return fmt.Errorf("script_interpreter must be an absolute path")
+	}
+	if config.ScriptTimeout < 0 || config.ScriptTimeout > MaxJobTimeout {
+		return fmt.Errorf("script_timeout must be 0 (default) or between 1 and %d seconds", MaxJobTimeout)
+	}
+	if config.CommandTimeout < 0 || config.CommandTimeout > MaxJobTimeout {
+		return fmt.Errorf("command_timeout must be 0 (default) or between 1 and %d seconds", MaxJobTimeout)
+	}
+	if config.JobWorkers < 0 || config.JobWorkers > MaxJobWorkers {
+		return fmt.Errorf("job_workers must be 0 (default) or between 1 and %d", MaxJobWorkers)
+	}
+	for _, interval := range []struct {
+		name    string
+		value   int
+		minimum int
+	}{
+		{"monitoring_interval", config.MonitoringInterval, MinMonitoringInterval},
+		{"job_poll_interval", config.JobPollInterval, MinJobPollInterval},
+		{"service_files_interval", config.ServiceFilesInterval, MinServiceFilesInterval},
+		{"inventory_interval", config.InventoryInterval, MinInventoryInterval},
+	} {
+		if interval.value < interval.minimum {
+			return fmt.Errorf("%s must be at least %d minutes", interval.name, interval.minimum)
+		}
+	}
 	return nil
 }
 
-// LoadConfig loads configuration from a JSON file.
-// It reads the file, unmarshals the JSON, and validates the configuration.
+// LoadConfig loads configuration from a JSON file and merges the drop-in
+// fragments from DropInDir over it, see dropInFiles.
+// It reads the files, unmarshals the JSON, and validates the configuration.
 //
 // Parameters:
 //   - filename: The path to the configuration file
@@ -51,19 +365,69 @@ func (config *CloudGuardianConfig) Validate() error {
 //   - *CloudGuardianConfig: The loaded configuration
 //   - error: Any error that occurred during loading or validation
 func LoadConfig(filename string) (*CloudGuardianConfig, error) {
+	return loadConfigFiles(filename, dropInFiles())
+}
+
+// loadConfigFiles loads the configuration from a base file and fragments merged
+// over it in order. Fields of a fragment replace the fields of the files before it,
+// maps like labels and fact_tags are merged by key.
+//
+// Parameters:
+//   - filename: The path to the base configuration file, empty if there is none
+//   - fragments: The paths of the drop-in fragments in merge order
+//
+// Returns:
+//   - *CloudGuardianConfig: The loaded configuration
+//   - error: Any error that occurred during loading or validation
+func loadConfigFiles(filename string, fragments []string) (*CloudGuardianConfig, error) {
 	config := DefaultConfig()
-	// Load config from json file:
-	jsonData, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+	config.Source = Source{Location: "file", Path: filename, DropIns: fragments}
+	checksum := sha256.New()
+	var modifiedAt time.Time
+
+	files := fragments
+	if filename != "" {
+		files = append([]string{filename}, fragments...)
+	} else {
+		config.Source.Location = "drop-in"
 	}
-	err = json.Unmarshal(jsonData, config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	for _, file := range files {
+		if err := checkPermissions(file); err != nil {
+			return nil, fmt.Errorf("insecure config file: %w", err)
+		}
+		// Load config from json file:
+		jsonData, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		checksum.Write(jsonData)
+		migrated, version, err := migrateConfig(jsonData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config %s: %w", file, err)
+		}
+		if version < ConfigVersion && (config.Source.MigratedFrom == 0 || version < config.Source.MigratedFrom) {
+			config.Source.MigratedFrom = version
+		}
+		if err := json.Unmarshal(migrated, config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config %s: %w", file, err)
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modifiedAt) {
+			modifiedAt = info.ModTime()
+		}
+	}
+	if err := config.ReadSecretFiles(); err != nil {
+		return nil, err
 	}
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
+	config.Source.Checksum = fmt.Sprintf("%x", checksum.Sum(nil))
+	if !modifiedAt.IsZero() {
+		config.Source.ModifiedAt = modifiedAt.UTC().Format(time.RFC3339)
+	}
+	if path, err := filepath.Abs(filename); err == nil && filename != "" {
+		config.Source.Path = path
+	}
 	// Ensure the API URL ends with a slash
 	if !strings.HasSuffix(config.ApiUrl, "/") {
 		config.ApiUrl += "/"
@@ -71,6 +435,126 @@ func LoadConfig(filename string) (*CloudGuardianConfig, error) {
 	return config, nil
 }
 
+// EnvPrefix is the prefix of the environment variables that override the configuration
+const EnvPrefix = "CLOUD_GUARDIAN_"
+
+// ApplyEnvironment overrides the configuration with the CLOUD_GUARDIAN_* environment
+// variables, so the agent can run in containers and CI without a configuration file.
+// Command-line flags are applied after it, the precedence is:
+// flags > environment > configuration file > defaults.
+//
+// Supported variables:
+//   - CLOUD_GUARDIAN_API_KEY: The API key
+//   - CLOUD_GUARDIAN_API_KEY_FILE, CLOUD_GUARDIAN_HOST_SECURITY_KEY_FILE: Files with the secrets, see ReadSecretFiles
+//   - CLOUD_GUARDIAN_API_URL: The API URL, or a comma-separated list of URLs in order of preference
+//   - CLOUD_GUARDIAN_HOST_SECURITY_KEYS: Comma-separated host security keys
+//   - CLOUD_GUARDIAN_LABELS: Comma-separated labels, e.g. environment=prod,team=db
+//   - CLOUD_GUARDIAN_DEBUG, CLOUD_GUARDIAN_DEBUG_BODIES, CLOUD_GUARDIAN_LONG_POLL, CLOUD_GUARDIAN_DRY_RUN: true or false
+//   - CLOUD_GUARDIAN_LOG_LEVEL: error, warn, info, debug or trace
+//   - CLOUD_GUARDIAN_HOSTNAME_DOMAIN: keep, strip or fqdn
+//   - CLOUD_GUARDIAN_HOSTNAME: Custom host identifier
+//   - CLOUD_GUARDIAN_HOSTNAME_LOWERCASE: true or false
+//   - CLOUD_GUARDIAN_REBOOT_METHOD: auto, systemctl, reboot, kexec or logind
+//   - CLOUD_GUARDIAN_OTLP_ENDPOINT: The OTLP/HTTP receiver for traces
+//
+// Returns:
+//   - error: An error if a variable has an invalid value or the result is not a valid configuration
+func (config *CloudGuardianConfig) ApplyEnvironment() error {
+	for _, variable := range os.Environ() {
+		if strings.HasPrefix(variable, EnvPrefix) {
+			config.Source.Environment = true
+			break
+		}
+	}
+	if apiKeyFile, ok := os.LookupEnv(EnvPrefix + "API_KEY_FILE"); ok {
+		config.ApiKeyFile = apiKeyFile
+	}
+	if keyFile, ok := os.LookupEnv(EnvPrefix + "HOST_SECURITY_KEY_FILE"); ok {
+		config.HostSecurityKeyFile = keyFile
+	}
+	if err := config.ReadSecretFiles(); err != nil {
+		return err
+	}
+	if apiKey, ok := os.LookupEnv(EnvPrefix + "API_KEY"); ok {
+		config.ApiKey = apiKey
+		config.ApiKeyFile = "" // The variable takes precedence over a file from the configuration
+	}
+	if apiUrl, ok := os.LookupEnv(EnvPrefix + "API_URL"); ok {
+		apiUrls := splitList(apiUrl)
+		for i := range apiUrls {
+			if !strings.HasSuffix(apiUrls[i], "/") {
+				apiUrls[i] += "/"
+			}
+		}
+		if len(apiUrls) == 0 {
+			return fmt.Errorf("%sAPI_URL cannot be empty", EnvPrefix)
+		}
+		config.ApiUrl = apiUrls[0]
+		config.ApiUrls = nil
+		if len(apiUrls) > 1 {
+			config.ApiUrls = apiUrls
+		}
+	}
+	if labels, ok := os.LookupEnv(EnvPrefix + "LABELS"); ok {
+		config.Labels = map[string]string{}
+		for _, label := range splitList(labels) {
+			key, value, found := strings.Cut(label, "=")
+			if !found {
+				return fmt.Errorf("%sLABELS must be a comma-separated list of key=value pairs", EnvPrefix)
+			}
+			config.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if keys, ok := os.LookupEnv(EnvPrefix + "HOST_SECURITY_KEYS"); ok {
+		config.HostSecurityKeys = splitList(keys)
+		config.HostSecurityKeyFile = ""
+	}
+	for name, flag := range map[string]*bool{
+		"DEBUG":              &config.Debug,
+		"DEBUG_BODIES":       &config.DebugBodies,
+		"LONG_POLL":          &config.LongPoll,
+		"DRY_RUN":            &config.DryRun,
+		"HOSTNAME_LOWERCASE": &config.HostnameLower,
+	} {
+		value, ok := os.LookupEnv(EnvPrefix + name)
+		if !ok || value == "" {
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s%s must be true or false", EnvPrefix, name)
+		}
+		*flag = enabled
+	}
+	if logLevel, ok := os.LookupEnv(EnvPrefix + "LOG_LEVEL"); ok {
+		config.LogLevel = logLevel
+	}
+	if method, ok := os.LookupEnv(EnvPrefix + "REBOOT_METHOD"); ok {
+		config.RebootMethod = method
+	}
+	if endpoint, ok := os.LookupEnv(EnvPrefix + "OTLP_ENDPOINT"); ok {
+		config.OtlpEndpoint = endpoint
+	}
+	if domain, ok := os.LookupEnv(EnvPrefix + "HOSTNAME_DOMAIN"); ok {
+		config.HostnameDomain = domain
+	}
+	if hostname, ok := os.LookupEnv(EnvPrefix + "HOSTNAME"); ok {
+		config.Hostname = hostname
+	}
+	return config.Validate()
+}
+
+// splitList splits a comma-separated list and drops empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Save saves the configuration to a JSON file.
 // It validates the configuration before saving and only includes non-default values.
 //
@@ -88,28 +572,182 @@ func (config *CloudGuardianConfig) Save(filename string) error {
 	defaultApiUrl := DefaultConfig().ApiUrl
 
 	configFileContent := map[string]any{
-		"api_key": config.ApiKey,
+		"config_version": ConfigVersion,
+	}
+
+	// Secrets read from files are not written to the configuration file
+	if config.ApiKeyFile != "" {
+		configFileContent["api_key_file"] = config.ApiKeyFile
+	} else if config.EncryptApiKey && config.ApiKey != "" {
+		encrypted, err := encryptApiKey(config.ApiKey)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt api_key: %w", err)
+		}
+		configFileContent["api_key"] = encrypted
+	} else {
+		configFileContent["api_key"] = config.ApiKey
 	}
 
-	if config.ApiUrl != defaultApiUrl {
+	if len(config.FallbackApiUrls()) > 0 {
+		configFileContent["api_url"] = config.ApiUrls
+	} else if config.ApiUrl != defaultApiUrl {
 		configFileContent["api_url"] = config.ApiUrl
 	}
 
-	if len(config.HostSecurityKeys) > 0 {
+	if config.HostSecurityKeyFile != "" {
+		configFileContent["host_security_key_file"] = config.HostSecurityKeyFile
+	} else if len(config.HostSecurityKeys) > 0 {
 		configFileContent["host_security_keys"] = config.HostSecurityKeys
 	}
 
+	if config.SigningSecret != "" {
+		configFileContent["signing_secret"] = config.SigningSecret
+	}
+
 	if config.Debug {
 		configFileContent["debug"] = true
 	}
 
+	if config.DebugBodies {
+		configFileContent["debug_bodies"] = true
+	}
+
+	if config.LogLevel != "" {
+		configFileContent["log_level"] = config.LogLevel
+	}
+
+	if config.LongPoll {
+		configFileContent["long_poll"] = true
+	}
+
+	if config.DryRun {
+		configFileContent["dry_run"] = true
+	}
+
+	if len(config.FactTags) > 0 {
+		configFileContent["fact_tags"] = config.FactTags
+	}
+
+	if len(config.AptDpkgOptions) > 0 {
+		configFileContent["apt_dpkg_options"] = config.AptDpkgOptions
+	}
+
+	if len(config.WatchedServices) > 0 {
+		configFileContent["watched_services"] = config.WatchedServices
+	}
+
+	if len(config.WatchedFiles) > 0 {
+		configFileContent["watched_files"] = config.WatchedFiles
+	}
+
+	if config.RebootMethod != "" {
+		configFileContent["reboot_method"] = config.RebootMethod
+	}
+
+	if config.OtlpEndpoint != "" {
+		configFileContent["otlp_endpoint"] = config.OtlpEndpoint
+	}
+
+	if config.HostnameDomain != "" {
+		configFileContent["hostname_domain"] = config.HostnameDomain
+	}
+
+	if config.HostnameLower {
+		configFileContent["hostname_lowercase"] = true
+	}
+
+	if config.Hostname != "" {
+		configFileContent["hostname"] = config.Hostname
+	}
+
+	if config.HostnamePrefix != "" {
+		configFileContent["hostname_prefix"] = config.HostnamePrefix
+	}
+
+	if config.HostnameSuffix != "" {
+		configFileContent["hostname_suffix"] = config.HostnameSuffix
+	}
+
+	if config.DisableAutoReregister {
+		configFileContent["disable_auto_reregister"] = true
+	}
+
+	if config.AutoUpdate {
+		configFileContent["auto_update"] = true
+	}
+
+	if len(config.Labels) > 0 {
+		configFileContent["labels"] = config.Labels
+	}
+
+	if config.StatusListen != "" {
+		configFileContent["status_listen"] = config.StatusListen
+	}
+	if config.PrometheusTextfileDir != "" {
+		configFileContent["prometheus_textfile_dir"] = config.PrometheusTextfileDir
+	}
+
+	if len(config.Collectors) > 0 {
+		configFileContent["collectors"] = config.Collectors
+	}
+	if len(config.CollectorIntervals) > 0 {
+		configFileContent["collector_intervals"] = config.CollectorIntervals
+	}
+
+	if len(config.MaintenanceWindows) > 0 {
+		configFileContent["maintenance_windows"] = config.MaintenanceWindows
+	}
+
+	if len(config.JobRateLimits) > 0 {
+		configFileContent["job_rate_limits"] = config.JobRateLimits
+	}
+
+	if len(config.Tenants) > 0 {
+		configFileContent["tenants"] = config.Tenants
+	}
+
+	if !config.JobPolicy.isEmpty() {
+		configFileContent["job_policy"] = config.JobPolicy
+	}
+	if config.ScriptInterpreter != "" {
+		configFileContent["script_interpreter"] = config.ScriptInterpreter
+	}
+	if config.ScriptTimeout != 0 {
+		configFileContent["script_timeout"] = config.ScriptTimeout
+	}
+	if config.CommandTimeout != 0 {
+		configFileContent["command_timeout"] = config.CommandTimeout
+	}
+	if config.JobWorkers != 0 {
+		configFileContent["job_workers"] = config.JobWorkers
+	}
+
+	if config.MonitoringInterval != DefaultMonitoringInterval {
+		configFileContent["monitoring_interval"] = config.MonitoringInterval
+	}
+
+	if config.JobPollInterval != DefaultJobPollInterval {
+		configFileContent["job_poll_interval"] = config.JobPollInterval
+	}
+
+	if config.ServiceFilesInterval != DefaultServiceFilesInterval {
+		configFileContent["service_files_interval"] = config.ServiceFilesInterval
+	}
+
+	if config.InventoryInterval != DefaultInventoryInterval {
+		configFileContent["inventory_interval"] = config.InventoryInterval
+	}
+
 	jsonData, err := json.MarshalIndent(configFileContent, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
-	if err := os.WriteFile(filename, jsonData, 0644); err != nil {
+	if err := writeFileAtomic(filename, jsonData); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	if err := FixPermissions(filename); err != nil {
+		return fmt.Errorf("failed to restrict config file permissions: %w", err)
+	}
 	return nil
 }
 
@@ -144,12 +782,15 @@ func FindAndLoadConfig() (*CloudGuardianConfig, error) {
 	// 1. Current directory
 	// 2. ~/.config/cloud-guardian.json
 	// 3. /etc/cloud-guardian.json
-	locations := []string{
-		"cloud-guardian.json",                              // Current directory
-		os.Getenv("HOME") + "/.config/cloud-guardian.json", // User config
-		"/etc/cloud-guardian.json",                         // System-wide config
+	// 4. /var/lib/cloud-guardian/cloud-guardian.json
+	locations := []struct{ name, path string }{
+		{"cwd", "cloud-guardian.json"},                               // Current directory
+		{"user", os.Getenv("HOME") + "/.config/cloud-guardian.json"}, // User config
+		{"system", "/etc/cloud-guardian.json"},                       // System-wide config
+		{"state", StateDir + "/cloud-guardian.json"},                 // System-wide config on a read-only /etc
 	}
-	for _, loc := range locations {
+	for _, location := range locations {
+		loc := location.path
 		if _, err := os.Stat(loc); err == nil {
 			config, err := LoadConfig(loc)
 			if err != nil {
@@ -159,8 +800,36 @@ func FindAndLoadConfig() (*CloudGuardianConfig, error) {
 					Err:      err,
 				}
 			}
+			config.Source.Location = location.name
 			return config, nil
 		}
 	}
+	// Configuration management may provide the whole configuration as fragments
+	if fragments := dropInFiles(); len(fragments) > 0 {
+		config, err := loadConfigFiles("", fragments)
+		if err != nil {
+			return nil, &InvalidConfigError{
+				Msg:      "Failed to load config",
+				Location: DropInDir,
+				Err:      err,
+			}
+		}
+		return config, nil
+	}
 	return nil, ErrConfigNotFound
 }
+
+// EffectiveLogLevel returns the verbosity of the agent: the log_level, debug if
+// only the debug flag is set and info by default.
+//
+// Returns:
+//   - cloudguardian_logging.Level: The log level
+func (config *CloudGuardianConfig) EffectiveLogLevel() cloudguardian_logging.Level {
+	if level, err := cloudguardian_logging.ParseLevel(config.LogLevel); err == nil {
+		return level
+	}
+	if config.Debug {
+		return cloudguardian_logging.LevelDebug
+	}
+	return cloudguardian_logging.LevelInfo
+}
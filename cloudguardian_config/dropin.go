@@ -0,0 +1,24 @@
+package cloudguardian_config
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// DropInDir contains the configuration fragments merged over the configuration file,
+// so configuration management tools can manage keys, tags and settings as separate files
+var DropInDir = "/etc/cloud-guardian.d"
+
+// dropInFiles returns the *.json fragments of DropInDir in lexical order, e.g.
+// 10-keys.json before 50-labels.json.
+//
+// Returns:
+//   - []string: The paths of the fragments, nil if there are none
+func dropInFiles() []string {
+	fragments, err := filepath.Glob(filepath.Join(DropInDir, "*.json"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(fragments)
+	return fragments
+}
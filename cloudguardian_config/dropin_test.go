@@ -0,0 +1,41 @@
+package cloudguardian_config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigDropIns(t *testing.T) {
+	dir := t.TempDir()
+	DropInDir = filepath.Join(dir, "cloud-guardian.d")
+	defer func() { DropInDir = "/etc/cloud-guardian.d" }()
+	if err := os.Mkdir(DropInDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "cloud-guardian.json"):         `{"api_key": "abcdef0123456789", "labels": {"team": "db"}}`,
+		filepath.Join(DropInDir, "50-labels.json"):        `{"labels": {"environment": "staging"}, "debug": true}`,
+		filepath.Join(DropInDir, "90-production.json"):    `{"labels": {"environment": "prod"}}`,
+		filepath.Join(DropInDir, "10-keys.json.disabled"): `{"api_key": "invalid"}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := LoadConfig(filepath.Join(dir, "cloud-guardian.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ApiKey != "abcdef0123456789" || !config.Debug {
+		t.Errorf("Expected the fragments to be merged over the file, got %+v", config)
+	}
+	if config.Labels["team"] != "db" || config.Labels["environment"] != "prod" {
+		t.Errorf("Expected the labels to be merged in lexical order, got %v", config.Labels)
+	}
+	if len(config.Source.DropIns) != 2 {
+		t.Errorf("Expected 2 drop-ins in the source, got %v", config.Source.DropIns)
+	}
+}
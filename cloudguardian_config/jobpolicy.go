@@ -0,0 +1,118 @@
+package cloudguardian_config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// JobPolicy restricts the jobs the host executes, e.g. to allow updates and
+// reboots but no commands. Jobs that the policy denies are rejected.
+type JobPolicy struct {
+	AllowedJobTypes    []string `json:"allowed_job_types,omitempty"`    // Only these job types run, all if empty
+	DeniedJobTypes     []string `json:"denied_job_types,omitempty"`     // These job types never run, even if allowed
+	CommandAllowlist   []string `json:"command_allowlist,omitempty"`    // Regular expressions, a command job runs only if one matches the whole command, script jobs are denied
+	LogStreamAllowlist []string `json:"log_stream_allowlist,omitempty"` // Glob patterns of the journald units and files stream_logs jobs may tail, none if empty
+}
+
+// isEmpty reports whether the policy allows all jobs
+func (policy JobPolicy) isEmpty() bool {
+	return len(policy.AllowedJobTypes) == 0 && len(policy.DeniedJobTypes) == 0 && len(policy.CommandAllowlist) == 0 && len(policy.LogStreamAllowlist) == 0
+}
+
+// validate checks that the command allowlist contains valid regular expressions
+// and the log stream allowlist valid glob patterns.
+func (policy JobPolicy) validate() error {
+	for _, pattern := range policy.CommandAllowlist {
+		if _, err := compileCommandPattern(pattern); err != nil {
+			return fmt.Errorf("invalid command_allowlist pattern %q: %w", pattern, err)
+		}
+	}
+	for _, pattern := range policy.LogStreamAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid log_stream_allowlist pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// compileCommandPattern compiles a command allowlist pattern, which has to match the whole command
+func compileCommandPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// Check checks a job against the policy. A command allowlist also denies all
+// script jobs, a script can run any command and cannot be matched against it.
+//
+// Parameters:
+//   - jobType: The type of the job, e.g. "command"
+//   - jobData: The data of the job, the command of command jobs
+//
+// Returns:
+//   - error: The reason if the policy denies the job, nil if it may run
+func (policy JobPolicy) Check(jobType, jobData string) error {
+	if slices.Contains(policy.DeniedJobTypes, jobType) {
+		return fmt.Errorf("job type %s is denied", jobType)
+	}
+	if len(policy.AllowedJobTypes) > 0 && !slices.Contains(policy.AllowedJobTypes, jobType) {
+		return fmt.Errorf("job type %s is not allowed", jobType)
+	}
+	if jobType == "command" && len(policy.CommandAllowlist) > 0 {
+		for _, pattern := range policy.CommandAllowlist {
+			if re, err := compileCommandPattern(pattern); err == nil && re.MatchString(jobData) {
+				return nil
+			}
+		}
+		return fmt.Errorf("command does not match the command allowlist")
+	}
+	if jobType == "script" && len(policy.CommandAllowlist) > 0 {
+		return fmt.Errorf("script jobs are denied by the command allowlist")
+	}
+	return nil
+}
+
+// AllowsLogSource reports whether a stream_logs job may tail a log source. Unlike
+// the other fields, an empty allowlist allows nothing, logs are only streamed from
+// sources the host allows explicitly.
+//
+// Parameters:
+//   - source: A journald unit, e.g. "nginx.service", or an absolute file path
+//
+// Returns:
+//   - bool: true if a pattern of the log stream allowlist matches the source
+func (policy JobPolicy) AllowsLogSource(source string) bool {
+	_, allowed := policy.ResolveLogSource(source)
+	return allowed
+}
+
+// ResolveLogSource resolves the symlinks of a log file and checks the file that is
+// actually read against the log stream allowlist, so a symlink in an allowed
+// directory cannot point to another file. Files that do not exist are not allowed.
+// Units that contain the glob characters of journalctl are not allowed either.
+//
+// Parameters:
+//   - source: A journald unit, e.g. "nginx.service", or an absolute file path
+//
+// Returns:
+//   - string: The unit, or the file path without symlinks
+//   - bool: true if a pattern of the log stream allowlist matches the source
+func (policy JobPolicy) ResolveLogSource(source string) (string, bool) {
+	if strings.HasPrefix(source, "/") {
+		resolved, err := filepath.EvalSymlinks(path.Clean(source)) // Also no way around the patterns with ".."
+		if err != nil {
+			return source, false
+		}
+		source = resolved
+	} else if strings.ContainsAny(source, "*?[") {
+		return source, false
+	}
+	for _, pattern := range policy.LogStreamAllowlist {
+		if matched, err := path.Match(pattern, source); err == nil && matched {
+			return source, true
+		}
+	}
+	return source, false
+}
@@ -0,0 +1,94 @@
+package cloudguardian_config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJobPolicy(t *testing.T) {
+	policy := JobPolicy{
+		AllowedJobTypes:  []string{"update", "reboot", "command"},
+		DeniedJobTypes:   []string{"reboot"},
+		CommandAllowlist: []string{`systemctl restart (nginx|php-fpm)`},
+	}
+	tests := []struct {
+		jobType, jobData string
+		allowed          bool
+	}{
+		{"update", "", true},
+		{"reboot", "", false},
+		{"script", "", false},
+		{"command", "systemctl restart nginx", true},
+		{"command", "systemctl restart nginx; rm -rf /", false},
+		{"command", "rm -rf /", false},
+	}
+	for _, test := range tests {
+		if err := policy.Check(test.jobType, test.jobData); (err == nil) != test.allowed {
+			t.Errorf("Expected %s %q to be allowed: %v, got %v", test.jobType, test.jobData, test.allowed, err)
+		}
+	}
+
+	// Scripts can run any command, the command allowlist denies them
+	policy = JobPolicy{CommandAllowlist: []string{`systemctl restart nginx`}}
+	if err := policy.Check("script", "systemctl restart nginx"); err == nil {
+		t.Errorf("Expected a script job to be denied by the command allowlist")
+	}
+	if err := (JobPolicy{}).Check("script", "rm -rf /tmp/cache"); err != nil {
+		t.Errorf("Expected a script job to be allowed without a command allowlist, got %v", err)
+	}
+
+	config := DefaultConfig()
+	config.JobPolicy.CommandAllowlist = []string{"("}
+	if err := config.Validate(); err == nil {
+		t.Errorf("Expected an invalid command pattern to be invalid")
+	}
+}
+
+func TestJobPolicyAllowsLogSource(t *testing.T) {
+	if (JobPolicy{}).AllowsLogSource("nginx.service") {
+		t.Errorf("Expected an empty log stream allowlist to allow nothing")
+	}
+	policy := JobPolicy{LogStreamAllowlist: []string{"nginx.service", "php*-fpm.service", "/var/log/nginx/*.log"}}
+	tests := []struct {
+		source  string
+		allowed bool
+	}{
+		{"nginx.service", true},
+		{"php8.2-fpm.service", true},
+		{"sshd.service", false},
+		{"php*-fpm.service", false},
+		{"nginx.servic[e]", false},
+	}
+	for _, test := range tests {
+		if allowed := policy.AllowsLogSource(test.source); allowed != test.allowed {
+			t.Errorf("AllowsLogSource(%q) = %v, want %v", test.source, allowed, test.allowed)
+		}
+	}
+
+	// Files are matched after their symlinks are resolved
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	os.MkdirAll(filepath.Join(dir, "nginx", "archive"), 0755)
+	for _, file := range []string{"nginx/error.log", "nginx/archive/error.log", "auth.log"} {
+		os.WriteFile(filepath.Join(dir, file), []byte("x"), 0644)
+	}
+	os.Symlink(filepath.Join(dir, "auth.log"), filepath.Join(dir, "nginx", "link.log"))
+	policy = JobPolicy{LogStreamAllowlist: []string{dir + "/nginx/*.log"}}
+	for source, allowed := range map[string]bool{
+		dir + "/nginx/error.log":         true,
+		dir + "/nginx/../auth.log":       false,
+		dir + "/nginx/archive/error.log": false,
+		dir + "/nginx/link.log":          false,
+		dir + "/nginx/missing.log":       false,
+	} {
+		if policy.AllowsLogSource(source) != allowed {
+			t.Errorf("AllowsLogSource(%q) = %v, want %v", source, !allowed, allowed)
+		}
+	}
+
+	config := DefaultConfig()
+	config.JobPolicy.LogStreamAllowlist = []string{"["}
+	if err := config.Validate(); err == nil {
+		t.Errorf("Expected an invalid log stream pattern to be invalid")
+	}
+}
@@ -0,0 +1,126 @@
+package cloudguardian_config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a recurring time range in which disruptive jobs may run,
+// e.g. {"days": ["sat", "sun"], "start": "02:00", "end": "05:00"}. A window whose
+// end is before its start ends on the next day.
+type MaintenanceWindow struct {
+	Days     []string `json:"days,omitempty"`     // mon, tue, wed, thu, fri, sat or sun, every day if empty
+	Start    string   `json:"start"`              // Start time, HH:MM
+	End      string   `json:"end"`                // End time, HH:MM
+	Timezone string   `json:"timezone,omitempty"` // IANA timezone of the times, e.g. Europe/Berlin, local time if empty
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// validate checks the days, times and timezone of the window.
+func (w MaintenanceWindow) validate() error {
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q, use mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	for _, value := range []string{w.Start, w.End} {
+		if _, err := time.Parse("15:04", value); err != nil {
+			return fmt.Errorf("invalid time %q, use HH:MM", value)
+		}
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("start and end must differ")
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", w.Timezone)
+	}
+	return nil
+}
+
+// location returns the timezone of the window, the local time if it has none.
+// time.LoadLocation would return UTC for an empty name.
+func (w MaintenanceWindow) location() *time.Location {
+	if w.Timezone == "" {
+		return time.Local
+	}
+	location, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return time.Local // Rejected by validate
+	}
+	return location
+}
+
+// occurrence returns the start and end of the window starting on the given day.
+// The second value is false if the window does not start on that day.
+func (w MaintenanceWindow) occurrence(day time.Time) (time.Time, time.Time, bool) {
+	if len(w.Days) > 0 {
+		matches := false
+		for _, name := range w.Days {
+			matches = matches || weekdays[strings.ToLower(name)] == day.Weekday()
+		}
+		if !matches {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	start, _ := time.Parse("15:04", w.Start)
+	end, _ := time.Parse("15:04", w.End)
+	startAt := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, day.Location())
+	endAt := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, day.Location())
+	if !endAt.After(startAt) {
+		endAt = endAt.AddDate(0, 0, 1) // The window ends on the next day
+	}
+	return startAt, endAt, true
+}
+
+// InMaintenanceWindow reports whether disruptive jobs may run at the given time.
+// Without maintenance windows jobs may run at any time.
+//
+// Parameters:
+//   - now: The time to check
+//
+// Returns:
+//   - bool: true if the time is inside a maintenance window or none is configured
+func (config *CloudGuardianConfig) InMaintenanceWindow(now time.Time) bool {
+	if len(config.MaintenanceWindows) == 0 {
+		return true
+	}
+	for _, window := range config.MaintenanceWindows {
+		local := now.In(window.location())
+		// A window that started yesterday may still be open
+		for _, day := range []time.Time{local.AddDate(0, 0, -1), local} {
+			if start, end, ok := window.occurrence(day); ok && !local.Before(start) && local.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextMaintenanceWindow returns the start of the next maintenance window after the given time.
+//
+// Parameters:
+//   - now: The time to start from
+//
+// Returns:
+//   - time.Time: The start of the next window, the zero time if no window is configured
+func (config *CloudGuardianConfig) NextMaintenanceWindow(now time.Time) time.Time {
+	var next time.Time
+	for _, window := range config.MaintenanceWindows {
+		local := now.In(window.location())
+		for i := 0; i <= 7; i++ {
+			start, _, ok := window.occurrence(local.AddDate(0, 0, i))
+			if ok && start.After(now) {
+				if next.IsZero() || start.Before(next) {
+					next = start
+				}
+				break
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,56 @@
+package cloudguardian_config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	config := DefaultConfig()
+	config.MaintenanceWindows = []MaintenanceWindow{
+		{Days: []string{"sat"}, Start: "22:00", End: "02:00", Timezone: "UTC"},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	saturday := time.Date(2026, 10, 17, 21, 0, 0, 0, time.UTC)
+	tests := map[time.Time]bool{
+		saturday:                    false,
+		saturday.Add(time.Hour):     true, // 22:00
+		saturday.Add(4 * time.Hour): true, // 01:00 on Sunday, the window started on Saturday
+		saturday.Add(5 * time.Hour): false,
+	}
+	for now, expected := range tests {
+		if inWindow := config.InMaintenanceWindow(now); inWindow != expected {
+			t.Errorf("Expected %v to be in the window: %v, got %v", now, expected, inWindow)
+		}
+	}
+	if next := config.NextMaintenanceWindow(saturday.Add(5 * time.Hour)); !next.Equal(saturday.AddDate(0, 0, 7).Add(time.Hour)) {
+		t.Errorf("Expected the next window on the following Saturday, got %v", next)
+	}
+
+	config.MaintenanceWindows[0].Days = []string{"someday"}
+	if err := config.Validate(); err == nil {
+		t.Errorf("Expected an unknown day to be invalid")
+	}
+}
+
+func TestMaintenanceWindowLocalTime(t *testing.T) {
+	originalLocal := time.Local
+	defer func() { time.Local = originalLocal }()
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+
+	config := DefaultConfig()
+	config.MaintenanceWindows = []MaintenanceWindow{{Start: "02:00", End: "03:00"}}
+	// 02:30 local time is 16:30 UTC on the previous day
+	if !config.InMaintenanceWindow(time.Date(2026, 10, 16, 16, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected a window without a timezone to use the local time")
+	}
+	if config.InMaintenanceWindow(time.Date(2026, 10, 17, 2, 30, 0, 0, time.UTC)) {
+		t.Errorf("Expected a window without a timezone not to use UTC")
+	}
+	if next := config.NextMaintenanceWindow(time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2026, 10, 17, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next window at 02:00 local time, got %v", next)
+	}
+}
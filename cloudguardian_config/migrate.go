@@ -0,0 +1,100 @@
+package cloudguardian_config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// ConfigVersion is the version of the configuration file format written by Save.
+// Files without a config_version field are version 1.
+const ConfigVersion = 2
+
+// migrations upgrade the fields of a configuration file by one version, the
+// migration at index i upgrades version i+1 to version i+2.
+var migrations = []func(fields map[string]json.RawMessage) error{
+	migrateHostSecurityKey,
+}
+
+// migrateFields upgrades the fields of a configuration file to ConfigVersion, so
+// files written by older agents keep loading. The config_version field is set to
+// ConfigVersion.
+//
+// Parameters:
+//   - fields: The top-level fields of the configuration file, modified in place
+//
+// Returns:
+//   - int: The version of the file before the migration
+//   - error: An error if the file is newer than the agent or cannot be migrated
+func migrateFields(fields map[string]json.RawMessage) (int, error) {
+	version := 1
+	if raw, ok := fields["config_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 1 {
+			return 0, fmt.Errorf("config_version must be a positive number")
+		}
+	}
+	if version > ConfigVersion {
+		return version, fmt.Errorf("config_version %d is newer than the supported version %d, update the agent", version, ConfigVersion)
+	}
+	for from := version; from < ConfigVersion; from++ {
+		if err := migrations[from-1](fields); err != nil {
+			return version, fmt.Errorf("failed to migrate config from version %d: %w", from, err)
+		}
+	}
+	fields["config_version"] = json.RawMessage(fmt.Sprint(ConfigVersion))
+	return version, nil
+}
+
+// migrateConfig upgrades the content of a configuration file to ConfigVersion.
+//
+// Parameters:
+//   - data: The content of the configuration file
+//
+// Returns:
+//   - []byte: The migrated content
+//   - int: The version of the file before the migration
+//   - error: An error if the file is not valid JSON, newer than the agent or cannot be migrated
+func migrateConfig(data []byte) ([]byte, int, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, 0, err
+	}
+	version, err := migrateFields(fields)
+	if err != nil {
+		return nil, version, err
+	}
+	if version == ConfigVersion {
+		return data, version, nil
+	}
+	migrated, err := json.Marshal(fields)
+	return migrated, version, err
+}
+
+// migrateHostSecurityKey replaces the single host_security_key string of version 1
+// with the host_security_keys list. The key is added to the list if both are set.
+func migrateHostSecurityKey(fields map[string]json.RawMessage) error {
+	raw, ok := fields["host_security_key"]
+	if !ok {
+		return nil
+	}
+	delete(fields, "host_security_key")
+	var key string
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return fmt.Errorf("host_security_key must be a string")
+	}
+	var keys []string
+	if existing, ok := fields["host_security_keys"]; ok {
+		if err := json.Unmarshal(existing, &keys); err != nil {
+			return fmt.Errorf("host_security_keys must be a list of strings")
+		}
+	}
+	if key == "" || slices.Contains(keys, key) {
+		return nil
+	}
+	encoded, err := json.Marshal(append([]string{key}, keys...))
+	if err != nil {
+		return err
+	}
+	fields["host_security_keys"] = encoded
+	return nil
+}
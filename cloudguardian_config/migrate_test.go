@@ -0,0 +1,81 @@
+package cloudguardian_config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testVersion1Config = `{
+  "api_key": "abcdef0123456789",
+  "host_security_key": "0xabc"
+}`
+
+func TestLoadConfigMigratesVersion1(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(testVersion1Config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfigFiles(filename, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFiles() error: %v", err)
+	}
+	if !slices.Equal(config.HostSecurityKeys, []string{"0xabc"}) {
+		t.Errorf("Expected the migrated host security key, got %v", config.HostSecurityKeys)
+	}
+	if config.Version != ConfigVersion || config.Source.MigratedFrom != 1 {
+		t.Errorf("Expected version %d migrated from 1, got %d from %d", ConfigVersion, config.Version, config.Source.MigratedFrom)
+	}
+
+	if err := config.Save(filename); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["host_security_key"]; ok {
+		t.Error("Expected host_security_key to be rewritten")
+	}
+	if fields["config_version"] != float64(ConfigVersion) {
+		t.Errorf("Expected config_version %d, got %v", ConfigVersion, fields["config_version"])
+	}
+	config, err = loadConfigFiles(filename, nil)
+	if err != nil {
+		t.Fatalf("loadConfigFiles() error: %v", err)
+	}
+	if config.Source.MigratedFrom != 0 {
+		t.Errorf("Expected no migration of a saved config, got %d", config.Source.MigratedFrom)
+	}
+}
+
+func TestMigrateHostSecurityKeyMerges(t *testing.T) {
+	migrated, _, err := migrateConfig([]byte(`{"host_security_key": "0xabc", "host_security_keys": ["0xdef", "0xabc"]}`))
+	if err != nil {
+		t.Fatalf("migrateConfig() error: %v", err)
+	}
+	var config struct {
+		HostSecurityKeys []string `json:"host_security_keys"`
+	}
+	if err := json.Unmarshal(migrated, &config); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.HostSecurityKeys, []string{"0xdef", "0xabc"}) {
+		t.Errorf("Expected the keys without duplicates, got %v", config.HostSecurityKeys)
+	}
+}
+
+func TestMigrateConfigRefusesNewerVersion(t *testing.T) {
+	if _, _, err := migrateConfig([]byte(`{"config_version": 99}`)); err == nil {
+		t.Error("Expected an error for a newer config_version")
+	}
+	if _, _, err := migrateConfig([]byte(`{"config_version": "two"}`)); err == nil {
+		t.Error("Expected an error for an invalid config_version")
+	}
+}
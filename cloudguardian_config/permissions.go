@@ -0,0 +1,103 @@
+package cloudguardian_config
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// configFileMode is the mode of the configuration file, it contains the API key
+const configFileMode fs.FileMode = 0600
+
+// checkPermissions checks the ownership and permissions of a configuration file.
+// A file that other users can write is refused, since they could point the agent
+// to another API and run jobs as root. A file that other users can read, or that
+// is owned by another user than root or the agent, is logged as a warning.
+//
+// Parameters:
+//   - filename: The path to the configuration file
+//
+// Returns:
+//   - error: An error if other users can write the file
+func checkPermissions(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil // Reading the file reports the error
+	}
+	return checkFileInfo(filename, info, os.Geteuid())
+}
+
+func checkFileInfo(filename string, info fs.FileInfo, euid int) error {
+	mode := info.Mode().Perm()
+	if mode&0022 != 0 {
+		return fmt.Errorf("%s is writable by other users (mode %04o), run 'chmod 600 %s'", filename, mode, filename)
+	}
+	if mode&0044 != 0 {
+		log.Printf("Warning: %s contains the API key and is readable by other users (mode %04o), run 'chmod 600 %s'\n", filename, mode, filename)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Uid != 0 && int(stat.Uid) != euid {
+		log.Printf("Warning: %s is owned by uid %d, expected root or the agent user\n", filename, stat.Uid)
+	}
+	return nil
+}
+
+// FixPermissions restricts an existing configuration file to mode 0600 and, when
+// running as root, to the root user.
+//
+// Parameters:
+//   - filename: The path to the configuration file
+//
+// Returns:
+//   - error: An error if the mode or owner cannot be changed
+func FixPermissions(filename string) error {
+	if err := os.Chmod(filename, configFileMode); err != nil {
+		return err
+	}
+	if os.Geteuid() == 0 {
+		return os.Chown(filename, 0, 0)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces a configuration file with new content, see WriteFileAtomic
+func writeFileAtomic(filename string, data []byte) error {
+	return WriteFileAtomic(filename, data, configFileMode)
+}
+
+// WriteFileAtomic replaces a file with new content, so an interrupted write never
+// leaves a truncated configuration or state file behind. The content is written
+// to a temporary file in the same directory, which is renamed over the file.
+//
+// Parameters:
+//   - filename: The path of the file
+//   - data: The new content
+//   - mode: The permissions of the file
+//
+// Returns:
+//   - error: An error if the file cannot be written
+func WriteFileAtomic(filename string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails after a successful rename
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
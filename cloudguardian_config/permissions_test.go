@@ -0,0 +1,34 @@
+package cloudguardian_config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigFilePermissions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cloud-guardian.json")
+	if err := os.WriteFile(filename, []byte(`{"api_key": ""}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filename, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filename); err == nil {
+		t.Errorf("Expected a world-writable config file to be refused")
+	}
+
+	if err := DefaultConfig().Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != configFileMode {
+		t.Errorf("Expected mode %04o after saving, got %04o", configFileMode, info.Mode().Perm())
+	}
+	if _, err := LoadConfig(filename); err != nil {
+		t.Errorf("Expected the saved config file to load: %v", err)
+	}
+}
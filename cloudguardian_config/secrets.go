@@ -0,0 +1,291 @@
+package cloudguardian_config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// credentialsDirectoryEnv is set by systemd for services with LoadCredential= or SetCredential=
+const credentialsDirectoryEnv = "CREDENTIALS_DIRECTORY"
+
+// ReadSecretFiles decrypts an encrypted api_key and reads the API key from
+// api_key_file and the host security keys from host_security_key_file, if configured. The secrets then do not need to be
+// stored in the configuration file. Relative paths are resolved against the
+// systemd credentials directory, so credentials passed with LoadCredential= can
+// be referenced by their name.
+//
+// Returns:
+//   - error: An error if the api_key cannot be decrypted or a configured secret file cannot be read
+func (config *CloudGuardianConfig) ReadSecretFiles() error {
+	if strings.HasPrefix(config.ApiKey, encryptedApiKeyPrefix) {
+		apiKey, err := decryptApiKey(config.ApiKey)
+		if err != nil {
+			return err
+		}
+		config.ApiKey = apiKey
+		config.EncryptApiKey = true
+	}
+	if config.ApiKeyFile != "" {
+		lines, err := readSecretFile(config.ApiKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read api_key_file: %w", err)
+		}
+		config.ApiKey = lines[0]
+	}
+	if config.HostSecurityKeyFile != "" {
+		lines, err := readSecretFile(config.HostSecurityKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read host_security_key_file: %w", err)
+		}
+		config.HostSecurityKeys = lines
+	}
+	return nil
+}
+
+// resolveSecretPath resolves a relative secret path against the systemd credentials
+// directory. Without a credentials directory the path is used as it is.
+func resolveSecretPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if dir := os.Getenv(credentialsDirectoryEnv); dir != "" {
+		return filepath.Join(dir, path)
+	}
+	return path
+}
+
+// readSecretFile reads the non-empty lines of a secret file, lines starting with # are ignored.
+//
+// Parameters:
+//   - path: The path of the secret file
+//
+// Returns:
+//   - []string: The secrets, at least one
+//   - error: An error if the file cannot be read or contains no secret
+func readSecretFile(path string) ([]string, error) {
+	data, err := os.ReadFile(resolveSecretPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%s contains no secret", path)
+	}
+	return lines, nil
+}
+
+// encryptedApiKeyPrefix marks an api_key that is encrypted with the machine key
+const encryptedApiKeyPrefix = "enc:v1:"
+
+// MachineIdPath contains the default path to the machine ID the API key encryption is bound to
+var MachineIdPath = "/etc/machine-id"
+
+// machineKey derives the key for the API key encryption from the machine ID, so an
+// encrypted API key cannot be decrypted on another host.
+func machineKey() ([]byte, error) {
+	data, err := os.ReadFile(MachineIdPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine ID: %w", err)
+	}
+	machineId := strings.TrimSpace(string(data))
+	if machineId == "" {
+		return nil, fmt.Errorf("machine ID %s is empty", MachineIdPath)
+	}
+	return hkdf.Key(sha256.New, []byte(machineId), nil, "cloud-guardian api key", 32)
+}
+
+// newMachineCipher returns the AES-GCM cipher keyed with the machine key.
+func newMachineCipher() (cipher.AEAD, error) {
+	key, err := machineKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptApiKey encrypts the API key with the machine key.
+//
+// Parameters:
+//   - apiKey: The plain API key
+//
+// Returns:
+//   - string: The encrypted API key with the enc:v1: prefix
+//   - error: An error if the machine ID is not available
+func encryptApiKey(apiKey string) (string, error) {
+	aead, err := newMachineCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(apiKey), nil)
+	return encryptedApiKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptApiKey decrypts an API key encrypted with encryptApiKey.
+//
+// Parameters:
+//   - value: The encrypted API key with the enc:v1: prefix
+//
+// Returns:
+//   - string: The plain API key
+//   - error: An error if the value is malformed or was encrypted on another host
+func decryptApiKey(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedApiKeyPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted api_key: %w", err)
+	}
+	aead, err := newMachineCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted api_key")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt api_key, the configuration was encrypted on another host")
+	}
+	return string(plain), nil
+}
+
+// maskSecret hides a secret except for its last 4 characters, so a key can be recognized
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
+
+// Dump returns the effective configuration as JSON with the API key and the host
+// security keys masked, including the API URLs and where the configuration was
+// loaded from.
+//
+// Returns:
+//   - []byte: The indented JSON of the configuration
+//   - error: An error if the configuration cannot be encoded
+func (config *CloudGuardianConfig) Dump() ([]byte, error) {
+	redacted := *config
+	redacted.ApiKey = maskSecret(config.ApiKey)
+	redacted.SigningSecret = maskSecret(config.SigningSecret)
+	redacted.HostSecurityKeys = make([]string, len(config.HostSecurityKeys))
+	for i, key := range config.HostSecurityKeys {
+		redacted.HostSecurityKeys[i] = maskSecret(key)
+	}
+	redacted.Tenants = make([]Tenant, len(config.Tenants))
+	for i, tenant := range config.Tenants {
+		tenant.ApiKey = maskSecret(tenant.ApiKey)
+		redacted.Tenants[i] = tenant
+	}
+	type plainConfig CloudGuardianConfig
+	return json.MarshalIndent(struct {
+		plainConfig
+		ApiUrls       []string `json:"api_urls,omitempty"`
+		EncryptApiKey bool     `json:"encrypt_api_key"`
+		Source        Source   `json:"source"`
+	}{plainConfig(redacted), config.ApiUrls, config.EncryptApiKey, config.Source}, "", "  ")
+}
+
+// SaveHostSecurityKeys replaces the host security keys in a configuration file.
+// The other fields of the file are kept as they are, values from drop-ins, the
+// environment or flags are not written to the file.
+//
+// Parameters:
+//   - filename: The path to the configuration file
+//   - keys: The host security keys
+//
+// Returns:
+//   - error: An error if the file cannot be read or written
+func SaveHostSecurityKeys(filename string, keys []string) error {
+	return saveConfigField(filename, "host_security_keys", keys, len(keys) > 0, func(fields map[string]json.RawMessage) error {
+		if _, ok := fields["host_security_key_file"]; ok {
+			return fmt.Errorf("the host security keys are read from host_security_key_file, edit that file instead")
+		}
+		return nil
+	})
+}
+
+// SaveSigningSecret replaces the signing secret in a configuration file, e.g.
+// after the API issued a new one at registration. The other fields of the file
+// are kept as they are.
+//
+// Parameters:
+//   - filename: The path to the configuration file
+//   - secret: The signing secret, removed from the file if empty
+//
+// Returns:
+//   - error: An error if the file cannot be read or written
+func SaveSigningSecret(filename string, secret string) error {
+	return saveConfigField(filename, "signing_secret", secret, secret != "", nil)
+}
+
+// saveConfigField sets or removes a single field of a configuration file and
+// writes the file atomically with the permissions of a configuration file.
+//
+// Parameters:
+//   - filename: The path to the configuration file
+//   - name: The name of the field, e.g. signing_secret
+//   - value: The value of the field
+//   - set: false to remove the field
+//   - check: Rejects the change based on the other fields, may be nil
+//
+// Returns:
+//   - error: An error if the file cannot be read or written or check rejects the change
+func saveConfigField(filename string, name string, value any, set bool, check func(fields map[string]json.RawMessage) error) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if check != nil {
+		if err := check(fields); err != nil {
+			return err
+		}
+	}
+	if _, err := migrateFields(fields); err != nil {
+		return err
+	}
+	if set {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fields[name] = encoded
+	} else {
+		delete(fields, name)
+	}
+	data, err = json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := writeFileAtomic(filename, data); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return FixPermissions(filename)
+}
@@ -0,0 +1,109 @@
+package cloudguardian_config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedApiKey(t *testing.T) {
+	dir := t.TempDir()
+	MachineIdPath = filepath.Join(dir, "machine-id")
+	defer func() { MachineIdPath = "/etc/machine-id" }()
+	if err := os.WriteFile(MachineIdPath, []byte("4c4c4544004b4e10804bb4c04f423532\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.ApiKey = "abcdef0123456789"
+	config.EncryptApiKey = true
+	filename := filepath.Join(dir, "config.json")
+	if err := config.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(filename)
+	if strings.Contains(string(content), config.ApiKey) || !strings.Contains(string(content), encryptedApiKeyPrefix) {
+		t.Fatalf("Expected the API key to be saved encrypted, got %s", content)
+	}
+
+	loaded, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ApiKey != config.ApiKey || !loaded.EncryptApiKey {
+		t.Errorf("Expected the decrypted API key, got %q", loaded.ApiKey)
+	}
+	if loaded.Source.Path != filename || len(loaded.Source.Checksum) != 64 || loaded.Source.ModifiedAt == "" {
+		t.Errorf("Unexpected configuration source: %+v", loaded.Source)
+	}
+
+	// A copy of the configuration is useless on another host
+	if err := os.WriteFile(MachineIdPath, []byte("0a1b2c3d4e5f60718293a4b5c6d7e8f9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(filename); err == nil {
+		t.Errorf("Expected the API key not to decrypt with another machine ID")
+	}
+}
+
+func TestDump(t *testing.T) {
+	config := DefaultConfig()
+	config.ApiKey = "abcdef0123456789"
+	config.HostSecurityKeys = []string{"0x1234567890abcdef1234567890abcdef12345678"}
+	data, err := config.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(data)
+	if strings.Contains(dump, config.ApiKey) || strings.Contains(dump, config.HostSecurityKeys[0]) {
+		t.Errorf("Expected the secrets to be masked, got %s", dump)
+	}
+	if !strings.Contains(dump, `"api_key": "****6789"`) || !strings.Contains(dump, `"location": "default"`) {
+		t.Errorf("Expected the masked API key and the source, got %s", dump)
+	}
+}
+
+func TestSaveHostSecurityKeys(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cloud-guardian.json")
+	if err := os.WriteFile(filename, []byte(`{"api_key": "abcdef0123456789", "labels": {"team": "db"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveHostSecurityKeys(filename, []string{"02a1b2", "03c4d5"}); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.HostSecurityKeys) != 2 || config.Labels["team"] != "db" {
+		t.Errorf("Expected the keys to be saved and the other fields to be kept, got %+v", config)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(filename))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind, got %d files", len(entries))
+	}
+}
+
+func TestSaveSigningSecret(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cloud-guardian.json")
+	if err := os.WriteFile(filename, []byte(`{"api_key": "abcdef0123456789"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSigningSecret(filename, "s3cr3t-signing-secret"); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(filename)
+	if err != nil || config.SigningSecret != "s3cr3t-signing-secret" || config.ApiKey != "abcdef0123456789" {
+		t.Fatalf("Expected the signing secret to be saved, got %+v: %v", config, err)
+	}
+	if dump, _ := config.Dump(); strings.Contains(string(dump), "s3cr3t-signing-secret") {
+		t.Errorf("Expected the signing secret to be masked, got %s", dump)
+	}
+	if err := SaveSigningSecret(filename, ""); err != nil {
+		t.Fatal(err)
+	}
+	if config, _ := LoadConfig(filename); config.SigningSecret != "" {
+		t.Errorf("Expected the signing secret to be removed, got %s", config.SigningSecret)
+	}
+}
@@ -0,0 +1,65 @@
+package cloudguardian_config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TenantRoutes are the submissions that can be routed to a tenant. Registration,
+// jobs and host security keys always use the API of api_url.
+var TenantRoutes = []string{"ping", "monitoring", "system_info", "packages", "updates", "service_files"}
+
+// Tenant is another Cloud Guardian account that receives some submissions of the
+// host, e.g. a managed-service provider reports the monitoring to its own account
+// and the package inventory and updates to the account of the customer.
+type Tenant struct {
+	Name   string   `json:"name"`    // Name of the tenant, used in logs
+	ApiUrl string   `json:"api_url"` // URL of the API of the tenant
+	ApiKey string   `json:"api_key"` // API key of the tenant
+	Routes []string `json:"routes"`  // Submissions sent to the tenant instead of api_url, see TenantRoutes
+}
+
+// validate checks the tenant configuration
+func (tenant Tenant) validate() error {
+	if tenant.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := validateApiUrl(tenant.ApiUrl); err != nil {
+		return err
+	}
+	if len(tenant.ApiKey) != 16 {
+		return fmt.Errorf("api_key must be exactly 16 characters long")
+	}
+	if len(tenant.Routes) == 0 {
+		return fmt.Errorf("routes must not be empty")
+	}
+	for _, route := range tenant.Routes {
+		if !slices.Contains(TenantRoutes, route) {
+			return fmt.Errorf("unknown route %q, known routes are %s", route, strings.Join(TenantRoutes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateTenants checks the tenants and that every submission is routed to one tenant at most
+func validateTenants(tenants []Tenant) error {
+	routed := map[string]string{}
+	names := map[string]bool{}
+	for _, tenant := range tenants {
+		if err := tenant.validate(); err != nil {
+			return fmt.Errorf("tenant %q: %w", tenant.Name, err)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("tenant %q is configured more than once", tenant.Name)
+		}
+		names[tenant.Name] = true
+		for _, route := range tenant.Routes {
+			if other, ok := routed[route]; ok {
+				return fmt.Errorf("route %q is used by the tenants %q and %q", route, other, tenant.Name)
+			}
+			routed[route] = tenant.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package cloudguardian_config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTenants(t *testing.T) {
+	customer := Tenant{Name: "customer", ApiUrl: "https://api.example.com/v1/", ApiKey: "abcdef0123456789", Routes: []string{"packages", "updates"}}
+	if err := validateTenants([]Tenant{customer}); err != nil {
+		t.Errorf("Expected a valid tenant, got %v", err)
+	}
+
+	tests := map[string][]Tenant{
+		"name is required":         {{ApiUrl: customer.ApiUrl, ApiKey: customer.ApiKey, Routes: customer.Routes}},
+		"api_key must be exactly":  {{Name: "customer", ApiUrl: customer.ApiUrl, ApiKey: "short", Routes: customer.Routes}},
+		"routes must not be empty": {{Name: "customer", ApiUrl: customer.ApiUrl, ApiKey: customer.ApiKey}},
+		"unknown route":            {{Name: "customer", ApiUrl: customer.ApiUrl, ApiKey: customer.ApiKey, Routes: []string{"jobs"}}},
+		"more than once":           {customer, {Name: "customer", ApiUrl: customer.ApiUrl, ApiKey: customer.ApiKey, Routes: []string{"ping"}}},
+		"is used by the tenants":   {customer, {Name: "other", ApiUrl: customer.ApiUrl, ApiKey: customer.ApiKey, Routes: []string{"updates"}}},
+	}
+	for expected, tenants := range tests {
+		err := validateTenants(tenants)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, err)
+		}
+	}
+}
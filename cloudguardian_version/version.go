@@ -1,3 +1,38 @@
 package cloudguardian_version
 
+import "runtime/debug"
+
 var Version = "fdev" // Default version, can be overridden at build time with -ldflags "-X main.version=x.x.x"
+
+// Build metadata, set at build time with -ldflags like the version
+var (
+	Commit    = "" // Git commit of the build
+	BuildDate = "" // Build time, RFC 3339
+)
+
+// Build returns the commit and the build date of the agent. Builds without the
+// ldflags, e.g. with go build, use the VCS information stamped by the Go toolchain.
+//
+// Returns:
+//   - string: The git commit, "unknown" if it is not known
+//   - string: The build date or the commit date, "unknown" if it is not known
+func Build() (string, string) {
+	commit, date := Commit, BuildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && commit == "":
+				commit = setting.Value
+			case setting.Key == "vcs.time" && date == "":
+				date = setting.Value
+			}
+		}
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return commit, date
+}
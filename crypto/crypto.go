@@ -1,11 +1,19 @@
 package cloudguardian_crypto
 
 import (
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// JobMessage builds the canonical message whose signature is sent with a job.
+// The fields are concatenated in this order without escaping, the API must build
+// the same message byte for byte.
+func JobMessage(createdAt, hostname, jobType, jobData string) string {
+	return `{"createdAt":"` + createdAt + `","hostname":"` + hostname + `","jobType":"` + jobType + `","jobData":"` + jobData + `"}`
+}
+
 func ValidatePayload(publicKey, payload, signature string) (bool, error) {
 	// Decode the public key from hex
 	publicKeyBytes, err := hex.DecodeString(publicKey)
@@ -27,3 +35,28 @@ func ValidatePayload(publicKey, payload, signature string) (bool, error) {
 
 	return valid, nil
 }
+
+// Purposes of the keys derived by DeriveHmacKey, a key signs only one kind of data
+const (
+	HmacPurposeRequest = "request" // Signs the requests of the agent
+	HmacPurposeArchive = "archive" // Signs the manifest of an offline archive
+)
+
+// DeriveHmacKey derives a signing key from the signing secret the API issued to
+// the host at registration. The secret is only sent once, with the registration
+// response, so the API can derive the same key to verify a signature while a
+// captured request does not reveal it.
+func DeriveHmacKey(signingSecret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// SignRequest computes the hex encoded HMAC-SHA256 signature of a request.
+// The signed message is the method, path, timestamp and SHA-256 body hash
+// separated by newlines.
+func SignRequest(key []byte, method, path, timestamp, bodyHash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + bodyHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
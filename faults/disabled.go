@@ -0,0 +1,6 @@
+//go:build !faultinjection
+
+package cloudguardian_faults
+
+// Enabled is false in release builds, the faults are never injected
+const Enabled = false
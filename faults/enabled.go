@@ -0,0 +1,6 @@
+//go:build faultinjection
+
+package cloudguardian_faults
+
+// Enabled is true in builds with the faultinjection tag
+const Enabled = true
@@ -0,0 +1,185 @@
+// Package cloudguardian_faults injects failures into the agent, so the retries, the circuit
+// breaker, the degraded mode and the state files can be tested realistically in
+// CI and staging. The faults are only compiled into builds with the
+// faultinjection tag and are configured with the CLOUD_GUARDIAN_FAULTS
+// variable, e.g. "drop_api_calls=3,delay_collectors=2s,corrupt_state=2":
+//
+//	go build -tags faultinjection
+//
+// Release builds ignore the variable.
+package cloudguardian_faults
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvVar configures the faults of a build with the faultinjection tag
+const EnvVar = "CLOUD_GUARDIAN_FAULTS"
+
+// ErrDroppedApiCall is returned for an API call dropped by drop_api_calls
+var ErrDroppedApiCall = errors.New("API call dropped by fault injection")
+
+// Faults are the injected failures, a zero value injects none
+type Faults struct {
+	DropApiCalls    int           // Every Nth API call fails like an unreachable API
+	DelayCollectors time.Duration // Every collector is delayed by the duration
+	CorruptState    int           // Every Nth write of a state file is truncated
+}
+
+var (
+	mutex      sync.Mutex
+	loadOnce   sync.Once
+	configured Faults
+	apiCalls   int
+	writes     int
+)
+
+// Parse parses a fault specification of comma-separated name=value pairs.
+//
+// Parameters:
+//   - spec: The specification, e.g. "drop_api_calls=3,delay_collectors=2s"
+//
+// Returns:
+//   - Faults: The parsed faults
+//   - error: An error if a fault is unknown or its value is invalid
+func Parse(spec string) (Faults, error) {
+	var faults Faults
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			return Faults{}, fmt.Errorf("fault %q has no value", name)
+		}
+		var err error
+		switch name {
+		case "drop_api_calls":
+			faults.DropApiCalls, err = parseEvery(value)
+		case "delay_collectors":
+			faults.DelayCollectors, err = time.ParseDuration(value)
+			if err == nil && faults.DelayCollectors < 0 {
+				err = fmt.Errorf("negative duration")
+			}
+		case "corrupt_state":
+			faults.CorruptState, err = parseEvery(value)
+		default:
+			return Faults{}, fmt.Errorf("unknown fault %q", name)
+		}
+		if err != nil {
+			return Faults{}, fmt.Errorf("invalid value of fault %s: %w", name, err)
+		}
+	}
+	return faults, nil
+}
+
+// parseEvery parses the N of a fault injected every Nth time
+func parseEvery(value string) (int, error) {
+	every, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if every < 1 {
+		return 0, fmt.Errorf("%d is not positive", every)
+	}
+	return every, nil
+}
+
+// Set replaces the faults and resets their counters, e.g. in tests.
+//
+// Parameters:
+//   - faults: The faults to inject
+func Set(faults Faults) {
+	loadOnce.Do(func() {}) // The variable must not override the faults later
+	mutex.Lock()
+	defer mutex.Unlock()
+	configured, apiCalls, writes = faults, 0, 0
+}
+
+// current returns the faults, they are read from the variable on first use
+func current() Faults {
+	loadOnce.Do(func() {
+		spec := os.Getenv(EnvVar)
+		if spec == "" {
+			return
+		}
+		faults, err := Parse(spec)
+		if err != nil {
+			log.Println("Error parsing", EnvVar+", no faults are injected:", err.Error())
+			return
+		}
+		log.Printf("Fault injection enabled: %+v\n", faults)
+		configured = faults
+	})
+	mutex.Lock()
+	defer mutex.Unlock()
+	return configured
+}
+
+// DropApiCall returns ErrDroppedApiCall for every Nth API call with drop_api_calls.
+//
+// Parameters:
+//   - path: The path of the request, logged for a dropped call
+//
+// Returns:
+//   - error: ErrDroppedApiCall if the call is dropped, nil otherwise
+func DropApiCall(path string) error {
+	if !Enabled || current().DropApiCalls == 0 {
+		return nil
+	}
+	mutex.Lock()
+	apiCalls++
+	drop := apiCalls%configured.DropApiCalls == 0
+	mutex.Unlock()
+	if !drop {
+		return nil
+	}
+	log.Println("Fault injection: dropping API call to", path)
+	return ErrDroppedApiCall
+}
+
+// DelayCollector delays a collector with delay_collectors.
+//
+// Parameters:
+//   - name: The name of the collector
+func DelayCollector(name string) {
+	if !Enabled {
+		return
+	}
+	if delay := current().DelayCollectors; delay > 0 {
+		log.Println("Fault injection: delaying collector", name, "by", delay)
+		time.Sleep(delay)
+	}
+}
+
+// CorruptState truncates every Nth state file written with corrupt_state, so
+// the file is no valid JSON when it is read again.
+//
+// Parameters:
+//   - path: The path of the state file, logged for a corrupted write
+//   - data: The content to write
+//
+// Returns:
+//   - []byte: The content, truncated if the write is corrupted
+func CorruptState(path string, data []byte) []byte {
+	if !Enabled || current().CorruptState == 0 {
+		return data
+	}
+	mutex.Lock()
+	writes++
+	corrupt := writes%configured.CorruptState == 0
+	mutex.Unlock()
+	if !corrupt {
+		return data
+	}
+	log.Println("Fault injection: corrupting state file", path)
+	return data[:len(data)/2]
+}
@@ -0,0 +1,51 @@
+package cloudguardian_faults
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	faults, err := Parse("drop_api_calls=3, delay_collectors=2s,corrupt_state=2")
+	if err != nil {
+		t.Fatalf("Expected the faults to be parsed, got %v", err)
+	}
+	expected := Faults{DropApiCalls: 3, DelayCollectors: 2 * time.Second, CorruptState: 2}
+	if faults != expected {
+		t.Errorf("Expected %+v, got %+v", expected, faults)
+	}
+	if faults, err := Parse(""); err != nil || faults != (Faults{}) {
+		t.Errorf("Expected no faults for an empty specification, got %+v %v", faults, err)
+	}
+	for _, spec := range []string{"drop_api_calls", "drop_api_calls=0", "delay_collectors=-1s", "corrupt_state=x", "crash=1"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected %q to be invalid", spec)
+		}
+	}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	defer Set(Faults{})
+	Set(Faults{DropApiCalls: 2, CorruptState: 3})
+	dropped := 0
+	for i := 0; i < 6; i++ {
+		if DropApiCall("/ping") != nil {
+			dropped++
+		}
+	}
+	corrupted := 0
+	for i := 0; i < 6; i++ {
+		if len(CorruptState("jobs.json", []byte(`{"job1":{}}`))) != len(`{"job1":{}}`) {
+			corrupted++
+		}
+	}
+	if !Enabled {
+		if dropped != 0 || corrupted != 0 {
+			t.Errorf("Expected no faults without the faultinjection tag, got %d dropped calls and %d corrupted writes", dropped, corrupted)
+		}
+		return
+	}
+	if dropped != 3 || corrupted != 2 {
+		t.Errorf("Expected 3 dropped calls and 2 corrupted writes, got %d and %d", dropped, corrupted)
+	}
+}
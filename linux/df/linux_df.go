@@ -1,12 +1,21 @@
 package linux_df
 
 import (
-	"fmt"
+	"cloud-guardian/linux"
+	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
+// MountsPath is the mount table read by GetDfNative
+var MountsPath = "/proc/self/mounts"
+
+// fileSystemTypes are the local filesystems reported by GetDf and GetDfNative
+var fileSystemTypes = []string{"ext3", "ext4", "xfs", "vfat"}
+
 type Df struct {
 	Source string
 	FSType string
@@ -23,7 +32,6 @@ type Df struct {
 //   - []Df: A slice of Df structs containing disk usage information
 //   - error: Any error that occurred during the retrieval process
 func GetDf() ([]Df, error) {
-	fileSystemTypes := []string{"ext3", "ext4", "xfs", "vfat"}
 	var typeFlags []string
 	for _, fsType := range fileSystemTypes {
 		typeFlags = append(typeFlags, "--type="+fsType)
@@ -32,14 +40,60 @@ func GetDf() ([]Df, error) {
 	args = append(args, "--output=source,fstype,size,used,avail,target")
 	command := exec.Command("df", args...)
 
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
+	}
+
+	return parseDfOutput(out), nil
+}
+
+// GetDfNative retrieves disk usage information for local filesystems with statfs.
+// It is the native fallback of GetDf for hosts without 'df'.
+//
+// Returns:
+//   - []Df: A slice of Df structs containing disk usage information
+//   - error: Any error that occurred while reading the mount table
+func GetDfNative() ([]Df, error) {
+	data, err := os.ReadFile(MountsPath)
+	if err != nil {
+		return nil, err
+	}
+	var dfList []Df
+	for _, mount := range parseMounts(string(data)) {
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mount.Target, &stat); err != nil {
+			continue // Skip mounts that disappeared or are not accessible, like df
+		}
+		blockSize := float64(stat.Bsize)
+		mount.Size = float64(stat.Blocks) * blockSize / 1024
+		mount.Used = float64(stat.Blocks-stat.Bfree) * blockSize / 1024
+		mount.Avail = float64(stat.Bavail) * blockSize / 1024
+		dfList = append(dfList, mount)
 	}
+	return dfList, nil
+}
 
-	return parseDfOutput(out.String()), nil
+// parseMounts parses a mount table like /proc/self/mounts. Only the local filesystems
+// reported by df are returned, a device mounted more than once is reported once.
+//
+// Parameters:
+//   - output: The content of the mount table
+//
+// Returns:
+//   - []Df: The mounts with Source, FSType and Target set
+func parseMounts(output string) []Df {
+	var mounts []Df
+	seen := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !slices.Contains(fileSystemTypes, fields[2]) || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		mounts = append(mounts, Df{Source: fields[0], FSType: fields[2], Target: linux.UnescapeMountPath(fields[1])})
+	}
+	return mounts
 }
 
 // parseDfOutput parses the output from the 'df' command.
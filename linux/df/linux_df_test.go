@@ -68,6 +68,22 @@ var testCases = []testCase{
 			},
 		},
 	},
+	{
+		// Localized header, the agent runs df with the C locale but the parser must not depend on it
+		testCase: `Dateisystem       Typ  1K-Blöcke  Benutzt Verfügbar Eingehängt auf
+/dev/sda1         ext4  20509264 11335696   8109000 /
+`,
+		expectedResult: []Df{
+			{
+				Source: "/dev/sda1",
+				FSType: "ext4",
+				Size:   20509264,
+				Used:   11335696,
+				Avail:  8109000,
+				Target: "/",
+			},
+		},
+	},
 }
 
 func TestParseDfOutput(t *testing.T) {
@@ -80,3 +96,24 @@ func TestParseDfOutput(t *testing.T) {
 		})
 	}
 }
+
+const testMounts = `proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/mapper/ubuntu--vg-ubuntu--lv / ext4 rw,relatime 0 0
+tmpfs /run tmpfs rw,nosuid,nodev,noexec,relatime,size=401464k,mode=755 0 0
+/dev/sda2 /boot ext4 rw,relatime 0 0
+/dev/sda1 /boot/efi vfat rw,relatime,fmask=0077,dmask=0077 0 0
+/dev/sdb1 /srv/backup\040disk xfs rw,relatime 0 0
+/dev/sda2 /var/lib/bind-mount ext4 rw,relatime 0 0
+`
+
+func TestParseMounts(t *testing.T) {
+	expected := []Df{
+		{Source: "/dev/mapper/ubuntu--vg-ubuntu--lv", FSType: "ext4", Target: "/"},
+		{Source: "/dev/sda2", FSType: "ext4", Target: "/boot"},
+		{Source: "/dev/sda1", FSType: "vfat", Target: "/boot/efi"},
+		{Source: "/dev/sdb1", FSType: "xfs", Target: "/srv/backup disk"},
+	}
+	if result := parseMounts(testMounts); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
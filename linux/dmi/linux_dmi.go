@@ -0,0 +1,126 @@
+// Package linux_dmi reads chassis and asset information from the DMI (SMBIOS) tables,
+// so a failing host can be located physically without a separate CMDB lookup.
+package linux_dmi
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SysfsPath contains the default path to the DMI attributes exported by the kernel
+var SysfsPath = "/sys/class/dmi/id"
+
+// chassisTypes maps the SMBIOS chassis type codes to their names
+var chassisTypes = map[int]string{
+	1: "Other", 2: "Unknown", 3: "Desktop", 4: "Low Profile Desktop", 5: "Pizza Box",
+	6: "Mini Tower", 7: "Tower", 8: "Portable", 9: "Laptop", 10: "Notebook",
+	11: "Hand Held", 12: "Docking Station", 13: "All in One", 14: "Sub Notebook",
+	15: "Space-saving", 16: "Lunch Box", 17: "Main Server Chassis", 18: "Expansion Chassis",
+	19: "Sub Chassis", 20: "Bus Expansion Chassis", 21: "Peripheral Chassis", 22: "RAID Chassis",
+	23: "Rack Mount Chassis", 24: "Sealed-case PC", 25: "Multi-system Chassis",
+	26: "Compact PCI", 27: "Advanced TCA", 28: "Blade", 29: "Blade Enclosure",
+	30: "Tablet", 31: "Convertible", 32: "Detachable", 33: "IoT Gateway",
+	34: "Embedded PC", 35: "Mini PC", 36: "Stick PC",
+}
+
+// placeholderValues are vendor defaults for fields that were never populated
+var placeholderValues = []string{
+	"default string", "to be filled by o.e.m.", "not specified", "not applicable",
+	"none", "n/a", "no asset tag", "no asset information", "asset-1234567890", "0",
+}
+
+type ChassisInfo struct {
+	SystemVendor      string `json:"system_vendor,omitempty"`
+	ProductName       string `json:"product_name,omitempty"`
+	ChassisType       string `json:"chassis_type,omitempty"`
+	ChassisVendor     string `json:"chassis_vendor,omitempty"`
+	ChassisAssetTag   string `json:"chassis_asset_tag,omitempty"`
+	BoardAssetTag     string `json:"board_asset_tag,omitempty"`
+	LocationInChassis string `json:"location_in_chassis,omitempty"` // Rack or slot position of the board, e.g. "Slot 4"
+	RackHeight        string `json:"rack_height,omitempty"`         // Height of the chassis in rack units, e.g. "2 U"
+}
+
+// GetChassisInfo reads the chassis information from sysfs. The rack and slot
+// information is only available through dmidecode, which requires root privileges.
+// Fields that are not populated or contain vendor placeholders are left empty.
+//
+// Returns:
+//   - ChassisInfo: The chassis information
+func GetChassisInfo() ChassisInfo {
+	info := ChassisInfo{
+		SystemVendor:    readAttribute("sys_vendor"),
+		ProductName:     readAttribute("product_name"),
+		ChassisType:     parseChassisType(readAttribute("chassis_type")),
+		ChassisVendor:   readAttribute("chassis_vendor"),
+		ChassisAssetTag: readAttribute("chassis_asset_tag"),
+		BoardAssetTag:   readAttribute("board_asset_tag"),
+	}
+	if output, err := exec.Command("dmidecode", "--type", "baseboard", "--type", "chassis").Output(); err == nil {
+		fields := parseDmidecode(string(output))
+		info.LocationInChassis = fields["Location In Chassis"]
+		info.RackHeight = fields["Height"]
+	}
+	return info
+}
+
+func readAttribute(name string) string {
+	data, err := os.ReadFile(filepath.Join(SysfsPath, name))
+	if err != nil {
+		return ""
+	}
+	return cleanValue(string(data))
+}
+
+// cleanValue trims a DMI value and discards vendor placeholders.
+func cleanValue(value string) string {
+	value = strings.TrimSpace(value)
+	for _, placeholder := range placeholderValues {
+		if strings.EqualFold(value, placeholder) {
+			return ""
+		}
+	}
+	return value
+}
+
+// parseChassisType converts an SMBIOS chassis type code to its name.
+//
+// Parameters:
+//   - code: The chassis type code as read from sysfs, e.g. "23"
+//
+// Returns:
+//   - string: The chassis type name, or an empty string if unknown
+func parseChassisType(code string) string {
+	number, err := strconv.Atoi(code)
+	if err != nil {
+		return ""
+	}
+	return chassisTypes[number]
+}
+
+// parseDmidecode parses the "Key: Value" lines of the dmidecode output.
+// Placeholder values are skipped, the first populated value of a key wins.
+//
+// Parameters:
+//   - output: The output of dmidecode
+//
+// Returns:
+//   - map[string]string: The populated fields by key
+func parseDmidecode(output string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		if value = cleanValue(value); value == "" || value == "Unspecified" {
+			continue
+		}
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
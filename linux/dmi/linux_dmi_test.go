@@ -0,0 +1,74 @@
+package linux_dmi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDmidecode = `# dmidecode 3.4
+Getting SMBIOS data from sysfs.
+SMBIOS 3.2.0 present.
+
+Handle 0x0200, DMI type 2, 15 bytes
+Base Board Information
+	Manufacturer: Dell Inc.
+	Product Name: 0JP31P
+	Asset Tag: Not Specified
+	Features:
+		Board is a hosting board
+		Board is replaceable
+	Location In Chassis: Slot 4
+	Type: Motherboard
+
+Handle 0x0300, DMI type 3, 22 bytes
+Chassis Information
+	Manufacturer: Dell Inc.
+	Type: Rack Mount Chassis
+	Asset Tag: RACK-A12
+	Height: 2 U
+	Number Of Power Cords: Unspecified
+`
+
+func TestParseDmidecode(t *testing.T) {
+	fields := parseDmidecode(testDmidecode)
+	expected := map[string]string{
+		"Location In Chassis": "Slot 4",
+		"Height":              "2 U",
+		"Asset Tag":           "RACK-A12",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, fields[key])
+		}
+	}
+	if _, ok := fields["Number Of Power Cords"]; ok {
+		t.Errorf("Expected unspecified values to be skipped")
+	}
+}
+
+func TestGetChassisInfo(t *testing.T) {
+	SysfsPath = t.TempDir()
+	defer func() { SysfsPath = "/sys/class/dmi/id" }()
+	for name, value := range map[string]string{
+		"chassis_type":      "23\n",
+		"chassis_asset_tag": "RACK-A12\n",
+		"board_asset_tag":   "Default string\n",
+		"sys_vendor":        "Dell Inc.\n",
+	} {
+		if err := os.WriteFile(filepath.Join(SysfsPath, name), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info := GetChassisInfo()
+	if info.ChassisType != "Rack Mount Chassis" {
+		t.Errorf("Expected chassis type Rack Mount Chassis, got %q", info.ChassisType)
+	}
+	if info.ChassisAssetTag != "RACK-A12" || info.SystemVendor != "Dell Inc." {
+		t.Errorf("Unexpected chassis info: %+v", info)
+	}
+	if info.BoardAssetTag != "" {
+		t.Errorf("Expected placeholder asset tag to be dropped, got %q", info.BoardAssetTag)
+	}
+}
@@ -0,0 +1,175 @@
+package linux_environment
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	// EnvironmentPath contains the system-wide environment of pam_env
+	EnvironmentPath = "/etc/environment"
+	// DropInPattern matches the drop-ins of the agent service
+	DropInPattern = "/etc/systemd/system/cloud-guardian.service.d/*.conf"
+)
+
+// Variables are the proxy and TLS variables the agent reads, the lowercase proxy
+// variables are used by curl and most other tools as well
+var Variables = []string{
+	"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "NO_PROXY", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+}
+
+// SourceProcess is the source of variables set in the environment of the agent
+const SourceProcess = "process"
+
+// Setting is the effective value of a proxy or TLS variable
+type Setting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`  // The value, with the password of proxy URLs masked
+	Source string `json:"source"` // "process", or the file the value was read from
+}
+
+// Apply sets the proxy and TLS variables from the systemd drop-ins of the agent
+// service and /etc/environment, if they are not set in the environment of the agent.
+// The agent then uses the same proxy in a shell as it does as a service. Variables
+// of the process take precedence over the drop-ins, the drop-ins over /etc/environment.
+// Apply must be called before the first HTTP request, the proxy is read only once.
+//
+// Returns:
+//   - []Setting: The effective settings, sorted like Variables
+func Apply() []Setting {
+	files := map[string]string{}
+	sources := map[string]string{}
+	if content, err := os.ReadFile(EnvironmentPath); err == nil {
+		for name, value := range parseEnvironmentFile(string(content)) {
+			files[name], sources[name] = value, EnvironmentPath
+		}
+	}
+	dropIns, _ := filepath.Glob(DropInPattern)
+	sort.Strings(dropIns) // systemd applies the drop-ins in lexical order, later ones win
+	for _, dropIn := range dropIns {
+		content, err := os.ReadFile(dropIn)
+		if err != nil {
+			continue
+		}
+		for name, value := range parseDropIn(string(content)) {
+			files[name], sources[name] = value, dropIn
+		}
+	}
+
+	settings := []Setting{}
+	for _, name := range Variables {
+		if value, ok := os.LookupEnv(name); ok {
+			settings = append(settings, Setting{Name: name, Value: maskProxyPassword(value), Source: SourceProcess})
+			continue
+		}
+		value, ok := files[name]
+		if !ok {
+			continue
+		}
+		os.Setenv(name, value)
+		settings = append(settings, Setting{Name: name, Value: maskProxyPassword(value), Source: sources[name]})
+	}
+	return settings
+}
+
+// parseEnvironmentFile parses the KEY=VALUE lines of /etc/environment, values may be quoted
+func parseEnvironmentFile(content string) map[string]string {
+	variables := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		variables[strings.TrimSpace(name)] = unquote(strings.TrimSpace(value))
+	}
+	return variables
+}
+
+// parseDropIn parses the Environment= lines of the [Service] section of a systemd
+// unit or drop-in, e.g. Environment="HTTPS_PROXY=http://proxy:3128" NO_PROXY=localhost.
+// An empty Environment= resets the variables of the earlier lines.
+func parseDropIn(content string) map[string]string {
+	variables := map[string]string{}
+	section := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section != "[Service]" || strings.TrimSpace(key) != "Environment" {
+			continue
+		}
+		assignments := splitQuoted(strings.TrimSpace(value))
+		if len(assignments) == 0 {
+			variables = map[string]string{}
+		}
+		for _, assignment := range assignments {
+			if name, value, found := strings.Cut(assignment, "="); found {
+				variables[name] = value
+			}
+		}
+	}
+	return variables
+}
+
+// splitQuoted splits a value at spaces outside of double or single quotes and removes the quotes
+func splitQuoted(value string) []string {
+	words := []string{}
+	var word strings.Builder
+	var quote rune
+	inWord := false
+	for _, r := range value {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// unquote removes matching double or single quotes around a value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// maskProxyPassword replaces the password of a proxy URL, so the settings can be shown
+func maskProxyPassword(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
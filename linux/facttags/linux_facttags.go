@@ -0,0 +1,97 @@
+// Package linux_facttags computes host tags from locally known facts, so hosts
+// can be grouped by the API even when no explicit tags are configured.
+package linux_facttags
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// CloudInitInstanceDataPath contains the default path to the cloud-init instance data
+var CloudInitInstanceDataPath = "/run/cloud-init/instance-data.json"
+
+// DefaultMapping is used when no fact tags are configured.
+// Tags whose fact is not available on the host are omitted.
+var DefaultMapping = map[string]string{
+	"os":           "os_id",
+	"cloud":        "cloud_name",
+	"cloud_region": "cloud_region",
+}
+
+// Resolve computes the tags from a mapping of tag names to fact sources.
+// A source is either the name of a fact (e.g. "os_id"), "file:<path>" to read
+// the tag value from a file, or "env:<name>" to read it from an environment variable.
+// Tags with an empty value are omitted.
+//
+// Parameters:
+//   - mapping: Tag names mapped to their fact source, DefaultMapping is used if empty
+//   - facts: Facts collected by the agent, e.g. os_id or os_version_id
+//
+// Returns:
+//   - map[string]string: The resolved tags
+func Resolve(mapping map[string]string, facts map[string]string) map[string]string {
+	if len(mapping) == 0 {
+		mapping = DefaultMapping
+	}
+
+	var cloudFacts map[string]string
+	tags := map[string]string{}
+	for tag, source := range mapping {
+		var value string
+		switch {
+		case strings.HasPrefix(source, "file:"):
+			if data, err := os.ReadFile(strings.TrimPrefix(source, "file:")); err == nil {
+				value = strings.TrimSpace(string(data))
+			}
+		case strings.HasPrefix(source, "env:"):
+			value = os.Getenv(strings.TrimPrefix(source, "env:"))
+		case strings.HasPrefix(source, "cloud_"):
+			if cloudFacts == nil {
+				cloudFacts = getCloudFacts()
+			}
+			value = cloudFacts[source]
+		default:
+			value = facts[source]
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			tags[tag] = value
+		}
+	}
+	return tags
+}
+
+// getCloudFacts reads the cloud facts from the cloud-init instance data.
+func getCloudFacts() map[string]string {
+	data, err := os.ReadFile(CloudInitInstanceDataPath)
+	if err != nil {
+		return map[string]string{}
+	}
+	return parseCloudInitInstanceData(data)
+}
+
+// parseCloudInitInstanceData extracts the cloud name, region and availability zone
+// from the cloud-init instance data.
+//
+// Parameters:
+//   - data: The content of instance-data.json
+//
+// Returns:
+//   - map[string]string: The cloud facts
+func parseCloudInitInstanceData(data []byte) map[string]string {
+	var instanceData struct {
+		V1 struct {
+			CloudName        string `json:"cloud_name"`
+			Region           string `json:"region"`
+			AvailabilityZone string `json:"availability_zone"`
+		} `json:"v1"`
+	}
+	if err := json.Unmarshal(data, &instanceData); err != nil {
+		return map[string]string{}
+	}
+	return map[string]string{
+		"cloud_name":              instanceData.V1.CloudName,
+		"cloud_region":            instanceData.V1.Region,
+		"cloud_availability_zone": instanceData.V1.AvailabilityZone,
+	}
+}
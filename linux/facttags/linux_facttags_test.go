@@ -0,0 +1,60 @@
+package linux_facttags
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testInstanceData = `{
+  "v1": {
+    "availability_zone": "eu-central-1a",
+    "cloud_name": "aws",
+    "instance_id": "i-0123456789abcdef0",
+    "region": "eu-central-1"
+  }
+}`
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	CloudInitInstanceDataPath = filepath.Join(dir, "instance-data.json")
+	defer func() { CloudInitInstanceDataPath = "/run/cloud-init/instance-data.json" }()
+	os.WriteFile(CloudInitInstanceDataPath, []byte(testInstanceData), 0644)
+
+	datacenterFile := filepath.Join(dir, "datacenter")
+	os.WriteFile(datacenterFile, []byte("ams3\n"), 0644)
+	t.Setenv("CG_TEST_RACK", "r12")
+
+	facts := map[string]string{"os_id": "rocky"}
+	mapping := map[string]string{
+		"os":         "os_id",
+		"datacenter": "file:" + datacenterFile,
+		"rack":       "env:CG_TEST_RACK",
+		"region":     "cloud_region",
+		"zone":       "cloud_availability_zone",
+		"missing":    "file:" + filepath.Join(dir, "does-not-exist"),
+	}
+	expected := map[string]string{
+		"os":         "rocky",
+		"datacenter": "ams3",
+		"rack":       "r12",
+		"region":     "eu-central-1",
+		"zone":       "eu-central-1a",
+	}
+	result := Resolve(mapping, facts)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestResolveDefaultMapping(t *testing.T) {
+	CloudInitInstanceDataPath = filepath.Join(t.TempDir(), "missing.json")
+	defer func() { CloudInitInstanceDataPath = "/run/cloud-init/instance-data.json" }()
+
+	expected := map[string]string{"os": "ubuntu"}
+	result := Resolve(nil, map[string]string{"os_id": "ubuntu"})
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -0,0 +1,159 @@
+// Package linux_fileattrs reports the immutable and append-only attributes, the owner and
+// the mode of critical files, so tampering that hides from hash based checks, e.g.
+// a "chattr +i /etc/passwd" by an attacker or a non-root owner, is caught.
+package linux_fileattrs
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// DefaultPaths is the allowlist of critical files used when none is configured
+var DefaultPaths = []string{
+	"/etc/crontab",
+	"/etc/group",
+	"/etc/gshadow",
+	"/etc/hosts",
+	"/etc/ld.so.preload",
+	"/etc/pam.d/sshd",
+	"/etc/passwd",
+	"/etc/resolv.conf",
+	"/etc/shadow",
+	"/etc/ssh/sshd_config",
+	"/etc/sudoers",
+	"/root/.ssh/authorized_keys",
+}
+
+// Inode flags of FS_IOC_GETFLAGS, as shown by lsattr with "i" and "a"
+const (
+	flagImmutable  = 0x10
+	flagAppendOnly = 0x20
+)
+
+// getFlagsRequest is FS_IOC_GETFLAGS, _IOR('f', 1, long), the size of long depends on the architecture
+var getFlagsRequest = 0x80006601 | unsafe.Sizeof(uintptr(0))<<16
+
+// getFlags reads the inode flags of a file, it can be mocked in tests
+var getFlags = func(path string) (int32, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var flags int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), getFlagsRequest, uintptr(unsafe.Pointer(&flags))); errno != 0 {
+		return 0, errno
+	}
+	return flags, nil
+}
+
+type File struct {
+	Path            string `json:"path"`
+	Uid             uint32 `json:"uid"`
+	Gid             uint32 `json:"gid"`
+	Mode            string `json:"mode"`             // Permission bits in octal, e.g. "0640"
+	Immutable       bool   `json:"immutable"`        // chattr +i, the file cannot be changed, not even by root
+	AppendOnly      bool   `json:"append_only"`      // chattr +a, the file can only be appended to
+	UnexpectedOwner bool   `json:"unexpected_owner"` // Critical files are owned by root
+	Error           string `json:"error,omitempty"`  // The attributes could not be read, e.g. on filesystems without inode flags
+}
+
+type Change struct {
+	Path   string `json:"path"`
+	Change string `json:"change"` // "added", "removed", "owner", "mode" or "attributes"
+	Detail string `json:"detail"` // The previous and the current value, e.g. "0:0 -> 1000:1000"
+}
+
+// ScanFiles reads the attributes, the owner and the mode of the given files. Files
+// that do not exist are skipped.
+//
+// Parameters:
+//   - paths: Absolute paths of the files, DefaultPaths is used if empty
+//
+// Returns:
+//   - []File: The files, sorted by path
+func ScanFiles(paths []string) []File {
+	if len(paths) == 0 {
+		paths = DefaultPaths
+	}
+	files := []File{}
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		file := File{Path: path, Mode: fmt.Sprintf("%04o", info.Mode().Perm())}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			file.Uid, file.Gid = stat.Uid, stat.Gid
+			file.UnexpectedOwner = stat.Uid != 0
+		}
+		// Symlinks have no inode flags of their own
+		if info.Mode().IsRegular() || info.IsDir() {
+			if flags, err := getFlags(path); err == nil {
+				file.Immutable = flags&flagImmutable != 0
+				file.AppendOnly = flags&flagAppendOnly != 0
+			} else {
+				file.Error = err.Error()
+			}
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// CompareFiles returns the changes between two scans.
+//
+// Parameters:
+//   - previous: The files of the previous scan
+//   - current: The files of the current scan
+//
+// Returns:
+//   - []Change: The added and removed files and the changed owners, modes and attributes, sorted by path
+func CompareFiles(previous, current []File) []Change {
+	previousByPath := map[string]File{}
+	for _, file := range previous {
+		previousByPath[file.Path] = file
+	}
+	changes := []Change{}
+	for _, file := range current {
+		old, ok := previousByPath[file.Path]
+		delete(previousByPath, file.Path)
+		if !ok {
+			changes = append(changes, Change{Path: file.Path, Change: "added"})
+			continue
+		}
+		if old.Uid != file.Uid || old.Gid != file.Gid {
+			changes = append(changes, Change{Path: file.Path, Change: "owner", Detail: fmt.Sprintf("%d:%d -> %d:%d", old.Uid, old.Gid, file.Uid, file.Gid)})
+		}
+		if old.Mode != file.Mode {
+			changes = append(changes, Change{Path: file.Path, Change: "mode", Detail: old.Mode + " -> " + file.Mode})
+		}
+		if old.Immutable != file.Immutable || old.AppendOnly != file.AppendOnly {
+			changes = append(changes, Change{Path: file.Path, Change: "attributes", Detail: attributes(old) + " -> " + attributes(file)})
+		}
+	}
+	for _, file := range previousByPath {
+		changes = append(changes, Change{Path: file.Path, Change: "removed"})
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// attributes formats the attributes of a file like lsattr, e.g. "ia", "-" if none is set
+func attributes(file File) string {
+	result := ""
+	if file.Immutable {
+		result += "i"
+	}
+	if file.AppendOnly {
+		result += "a"
+	}
+	if result == "" {
+		return "-"
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package linux_fileattrs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestScanFiles(t *testing.T) {
+	dir := t.TempDir()
+	passwd := filepath.Join(dir, "passwd")
+	sudoers := filepath.Join(dir, "sudoers")
+	os.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/bash\n"), 0644)
+	os.WriteFile(sudoers, []byte("root ALL=(ALL) ALL\n"), 0440)
+	os.Chmod(sudoers, 0440)
+
+	originalGetFlags := getFlags
+	defer func() { getFlags = originalGetFlags }()
+	getFlags = func(path string) (int32, error) {
+		if path == passwd {
+			return flagImmutable | 0x80000, nil // Extents flag, as set by ext4
+		}
+		return 0, syscall.ENOTTY
+	}
+
+	files := ScanFiles([]string{sudoers, filepath.Join(dir, "missing"), passwd})
+	if len(files) != 2 || files[0].Path != passwd || files[1].Path != sudoers {
+		t.Fatalf("Expected the existing files sorted by path, got %+v", files)
+	}
+	if !files[0].Immutable || files[0].AppendOnly || files[0].Mode != "0644" {
+		t.Errorf("Expected an immutable file, got %+v", files[0])
+	}
+	if files[1].Mode != "0440" || files[1].Error == "" {
+		t.Errorf("Expected the mode and an error for a filesystem without inode flags, got %+v", files[1])
+	}
+	if files[0].UnexpectedOwner != (os.Getuid() != 0) {
+		t.Errorf("Expected only files not owned by root to have an unexpected owner, got %+v", files[0])
+	}
+}
+
+func TestCompareFiles(t *testing.T) {
+	previous := []File{
+		{Path: "/etc/hosts", Mode: "0644"},
+		{Path: "/etc/passwd", Mode: "0644"},
+		{Path: "/etc/shadow", Mode: "0640", Gid: 42},
+	}
+	current := []File{
+		{Path: "/etc/passwd", Mode: "0666", Immutable: true},
+		{Path: "/etc/shadow", Mode: "0640", Uid: 1000, Gid: 1000},
+		{Path: "/etc/sudoers", Mode: "0440"},
+	}
+	expected := []Change{
+		{Path: "/etc/hosts", Change: "removed"},
+		{Path: "/etc/passwd", Change: "mode", Detail: "0644 -> 0666"},
+		{Path: "/etc/passwd", Change: "attributes", Detail: "- -> i"},
+		{Path: "/etc/shadow", Change: "owner", Detail: "0:42 -> 1000:1000"},
+		{Path: "/etc/sudoers", Change: "added"},
+	}
+	if changes := CompareFiles(previous, current); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
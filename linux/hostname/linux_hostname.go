@@ -0,0 +1,128 @@
+// Package linux_hostname determines the hostname the agent reports to the API. Tools
+// report short names or FQDNs with varying case, a normalization policy makes
+// the reported name stable, so a host is not registered twice.
+package linux_hostname
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Domain policies
+const (
+	DomainKeep  = "keep"  // Use the hostname as configured on the host
+	DomainStrip = "strip" // Remove the domain, e.g. web1.example.com -> web1
+	DomainFqdn  = "fqdn"  // Prefer the FQDN from the resolver, e.g. web1 -> web1.example.com
+)
+
+// Policy describes how the hostname is normalized
+type Policy struct {
+	Override  string // Custom host identifier that replaces the system hostname, the domain policy is not applied to it
+	Domain    string // DomainKeep, DomainStrip or DomainFqdn, empty is DomainKeep
+	Prefix    string // Prepended to the hostname, e.g. "fra1-"
+	Suffix    string // Appended to the hostname, e.g. "-fra1"
+	Lowercase bool   // Convert the hostname to lowercase
+}
+
+// validHostname matches host identifiers that can be used in API paths
+var validHostname = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,252}$`)
+
+// lookupFqdn is the resolver lookup of the FQDN, replaceable in tests
+var lookupFqdn = resolveFqdn
+
+// GetHostname returns the hostname of the host, or the override of the policy,
+// normalized with the policy.
+//
+// Parameters:
+//   - policy: The normalization policy
+//
+// Returns:
+//   - string: The normalized hostname
+//   - error: An error if the hostname cannot be determined
+func GetHostname(policy Policy) (string, error) {
+	if policy.Override != "" {
+		return Normalize("", policy)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return Normalize(hostname, policy)
+}
+
+// Normalize applies the policy to a hostname: the override replaces the hostname,
+// the domain policy is applied unless there is an override, then the prefix and
+// suffix are added and the case is converted. If the
+// FQDN cannot be resolved, the hostname is used as it is.
+//
+// Parameters:
+//   - hostname: The hostname to normalize
+//   - policy: The normalization policy
+//
+// Returns:
+//   - string: The normalized hostname
+//   - error: An error if the policy or the resulting hostname is invalid
+func Normalize(hostname string, policy Policy) (string, error) {
+	domain := policy.Domain
+	if policy.Override != "" {
+		hostname, domain = policy.Override, DomainKeep
+	}
+	hostname = strings.TrimSuffix(strings.TrimSpace(hostname), ".")
+	if hostname == "" {
+		return "", fmt.Errorf("hostname is empty")
+	}
+	switch domain {
+	case "", DomainKeep:
+	case DomainStrip:
+		hostname, _, _ = strings.Cut(hostname, ".")
+	case DomainFqdn:
+		if fqdn := lookupFqdn(hostname); fqdn != "" {
+			hostname = fqdn
+		}
+	default:
+		return "", fmt.Errorf("invalid hostname domain policy %q", policy.Domain)
+	}
+	hostname = policy.Prefix + hostname + policy.Suffix
+	if policy.Lowercase {
+		hostname = strings.ToLower(hostname)
+	}
+	if !validHostname.MatchString(hostname) {
+		return "", fmt.Errorf("invalid hostname %q, only letters, digits, '.', '_' and '-' are allowed", hostname)
+	}
+	return hostname, nil
+}
+
+// resolveFqdn looks up the FQDN of a hostname like "hostname -f": the canonical
+// name from the resolver, or the first reverse name of its addresses that
+// extends the short name.
+//
+// Returns:
+//   - string: The FQDN, empty if it cannot be resolved
+func resolveFqdn(hostname string) string {
+	if cname, err := net.LookupCNAME(hostname); err == nil {
+		if cname = strings.TrimSuffix(cname, "."); strings.Contains(cname, ".") {
+			return cname
+		}
+	}
+	short, _, _ := strings.Cut(hostname, ".")
+	addrs, err := net.LookupHost(hostname)
+	if err != nil {
+		return ""
+	}
+	for _, addr := range addrs {
+		names, err := net.LookupAddr(addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSuffix(name, ".")
+			if strings.Contains(name, ".") && strings.EqualFold(strings.Split(name, ".")[0], short) {
+				return name
+			}
+		}
+	}
+	return ""
+}
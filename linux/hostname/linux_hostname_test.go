@@ -0,0 +1,45 @@
+package linux_hostname
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	lookupFqdn = func(hostname string) string {
+		if hostname == "Web1" {
+			return "Web1.Example.com"
+		}
+		return ""
+	}
+	defer func() { lookupFqdn = resolveFqdn }()
+
+	tests := []struct {
+		hostname string
+		policy   Policy
+		expected string
+	}{
+		{"Web1.Example.com", Policy{}, "Web1.Example.com"},
+		{"Web1.Example.com.", Policy{Lowercase: true}, "web1.example.com"},
+		{"Web1.Example.com", Policy{Domain: DomainStrip}, "Web1"},
+		{"Web1.Example.com", Policy{Domain: DomainStrip, Lowercase: true}, "web1"},
+		{"Web1", Policy{Domain: DomainFqdn, Lowercase: true}, "web1.example.com"},
+		{"db1", Policy{Domain: DomainFqdn}, "db1"}, // Not resolvable
+		{"web1.example.com", Policy{Domain: DomainStrip, Prefix: "fra1-"}, "fra1-web1"},
+		{"web1", Policy{Suffix: ".fra1", Lowercase: true}, "web1.fra1"},
+		{"Web1", Policy{Override: "Custom-ID", Domain: DomainFqdn}, "Custom-ID"},
+	}
+	for _, test := range tests {
+		hostname, err := Normalize(test.hostname, test.policy)
+		if err != nil || hostname != test.expected {
+			t.Errorf("Normalize(%q, %+v) = %q, %v, expected %q", test.hostname, test.policy, hostname, err, test.expected)
+		}
+	}
+
+	if _, err := Normalize("web1", Policy{Domain: "invalid"}); err == nil {
+		t.Errorf("Expected an error for an invalid policy")
+	}
+	if _, err := Normalize(" ", Policy{}); err == nil {
+		t.Errorf("Expected an error for an empty hostname")
+	}
+	if _, err := Normalize("web1", Policy{Prefix: "a/b"}); err == nil {
+		t.Errorf("Expected an error for a hostname that can not be used in API paths")
+	}
+}
@@ -3,23 +3,101 @@ package linux_installer
 import (
 	cgconfig "cloud-guardian/cloudguardian_config"
 	linux "cloud-guardian/linux"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
 const (
-	targetPath         = "/usr/bin/cloud-guardian"
-	serviceName        = "cloud-guardian.service"
-	serviceFilePath    = "/etc/systemd/system/" + serviceName
+	binaryName         = "cloud-guardian"
+	ServiceName        = "cloud-guardian.service" // systemd unit of the agent
+	serviceFilePath    = "/etc/systemd/system/" + ServiceName
 	serviceDescription = "Cloud Gardian Client Service"
-	configFilePath     = "/etc/cloud-guardian.json"
+	configFileName     = "cloud-guardian.json"
 )
 
+var (
+	// binaryDirs are the candidate directories for the binary, in order of preference.
+	// On image-based systems /usr is read-only, so the later directories are used.
+	binaryDirs = []string{"/usr/bin", "/usr/local/bin", "/opt/cloud-guardian/bin"}
+	// configDirs are the candidate directories for the configuration file, in order of preference
+	configDirs = []string{"/etc", cgconfig.StateDir}
+)
+
+// ErrReadOnlyFilesystem is returned when no writable location is available for a file
+var ErrReadOnlyFilesystem = errors.New("read-only filesystem")
+
+// ErrNotInstalled is returned by Update when the service is not installed
+var ErrNotInstalled = errors.New("the service is not installed")
+
 var Config *cgconfig.CloudGuardianConfig
 
+// installPaths contains the resolved locations of the installed files
+type installPaths struct {
+	binary string
+	config string
+}
+
+// resolveInstallPaths determines where the binary and configuration are installed.
+// An existing installation is kept in place, otherwise the first writable directory
+// is used. All paths are resolved before anything is changed, so a read-only
+// filesystem is detected before the service is stopped.
+//
+// Returns:
+//   - installPaths: The resolved paths
+//   - error: ErrReadOnlyFilesystem if no writable location is available
+func resolveInstallPaths() (installPaths, error) {
+	binary, err := resolvePath(binaryDirs, binaryName)
+	if err != nil {
+		return installPaths{}, err
+	}
+	config, err := resolvePath(configDirs, configFileName)
+	if err != nil {
+		return installPaths{}, err
+	}
+	if !linux.IsWritableDir(filepath.Dir(serviceFilePath)) {
+		return installPaths{}, fmt.Errorf("%w: can not write the systemd service to %s", ErrReadOnlyFilesystem, filepath.Dir(serviceFilePath))
+	}
+	return installPaths{binary: binary, config: config}, nil
+}
+
+// resolvePath returns the existing, writable location of a file, or the first
+// directory in which the file can be created.
+func resolvePath(dirs []string, name string) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil && linux.IsWritableDir(dir) {
+			return path, nil
+		}
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			continue
+		}
+		if linux.IsWritableDir(dir) {
+			return filepath.Join(dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("%w: none of %s is writable for %s", ErrReadOnlyFilesystem, strings.Join(dirs, ", "), name)
+}
+
+// findInstalled returns the existing locations of a file in the candidate directories
+func findInstalled(dirs []string, name string) []string {
+	var paths []string
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 // copyFile copies a file from source to destination with the specified file mode.
 // It handles the opening, copying, and setting permissions of the destination file.
 //
@@ -47,14 +125,15 @@ func copyFile(src, dst string, filemode os.FileMode) error {
 	return err
 }
 
-func execCommand(name string, args ...string) {
+func execCommand(name string, args ...string) error {
 	cmd := exec.Command(name, args...)
 	if err := cmd.Run(); err != nil {
-		log.Fatalf("Failed to run command: %s %v\nError: %v\n", name, args, err)
+		return fmt.Errorf("failed to run command %s %v: %w", name, args, err)
 	}
+	return nil
 }
 
-func createSystemdService() error {
+func createSystemdService(targetPath string) error {
 	serviceFileContent := `[Unit]
 Description=` + serviceDescription + `
 ConditionFileIsExecutable=` + targetPath + `
@@ -62,6 +141,7 @@ After=network.target
 
 [Service]
 ExecStart=` + targetPath + `
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
 RestartSec=120
 
@@ -69,7 +149,7 @@ RestartSec=120
 WantedBy=multi-user.target
 `
 	if err := os.WriteFile(serviceFilePath, []byte(serviceFileContent), 0644); err != nil {
-		log.Fatalf("Error writing service file: %v\n", err)
+		return fmt.Errorf("error writing service file: %w", err)
 	}
 	log.Printf("Installed systemd service at %s\n", serviceFilePath)
 	return nil
@@ -80,39 +160,36 @@ func EnableAndStartService() error {
 		return os.ErrPermission // User does not have root privileges
 	}
 
-	// Reload systemd to ensure it recognizes the new service file
-	execCommand("systemctl", "daemon-reexec")
-	execCommand("systemctl", "daemon-reload")
-
-	// Enable the service
-	execCommand("systemctl", "enable", serviceName)
-
-	// Start the service
-	execCommand("systemctl", "start", serviceName)
-
+	// Reload systemd to ensure it recognizes the new service file, then enable
+	// and start the service
+	for _, args := range [][]string{{"daemon-reexec"}, {"daemon-reload"}, {"enable", ServiceName}, {"start", ServiceName}} {
+		if err := execCommand("systemctl", args...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func IsServiceRunning() bool {
-	command := exec.Command("systemctl", "is-active", serviceName)
+func IsServiceRunning() (bool, error) {
+	command := exec.Command("systemctl", "is-active", ServiceName)
 	var out strings.Builder
 	command.Stdout = &out
 	err := command.Run()
 	if err != nil {
 		// Check if service is inactive by examining output
 		if string(out.String()) == "inactive\n" {
-			return false
+			return false, nil
 		}
 		if string(out.String()) == "failed\n" {
-			return false
+			return false, nil
 		}
-		log.Fatalf("Failed to check service status: %v\n", err)
+		return false, fmt.Errorf("failed to check service status: %w", err)
 	}
-	return true // Service is active
+	return true, nil // Service is active
 }
 
-func IsServiceEnabled() bool {
-	command := exec.Command("systemctl", "is-enabled", serviceName)
+func IsServiceEnabled() (bool, error) {
+	command := exec.Command("systemctl", "is-enabled", ServiceName)
 	var stdout strings.Builder
 	var stderr strings.Builder
 	command.Stdout = &stdout
@@ -120,14 +197,14 @@ func IsServiceEnabled() bool {
 	err := command.Run()
 	if err != nil {
 		if strings.Contains(stdout.String(), "disabled") || strings.Contains(stdout.String(), "not-found") {
-			return false // Service is not enabled or does not exist
+			return false, nil // Service is not enabled or does not exist
 		}
 		if strings.Contains(stderr.String(), "Failed to get unit file state for") && strings.Contains(stderr.String(), "No such file or directory") {
-			return false // Service does not exist
+			return false, nil // Service does not exist
 		}
-		log.Fatalf("Failed to check service enabled status: %v\n", err)
+		return false, fmt.Errorf("failed to check service enabled status: %w", err)
 	}
-	return true // Service is enabled
+	return true, nil // Service is enabled
 }
 
 func DisableAndStopService() error {
@@ -136,15 +213,24 @@ func DisableAndStopService() error {
 	}
 
 	// Stop the service
-	if IsServiceRunning() {
-		execCommand("systemctl", "stop", serviceName)
+	running, err := IsServiceRunning()
+	if err != nil {
+		return err
 	}
-
-	// // Disable the service
-	if IsServiceEnabled() {
-		execCommand("systemctl", "disable", serviceName)
+	if running {
+		if err := execCommand("systemctl", "stop", ServiceName); err != nil {
+			return err
+		}
 	}
 
+	// Disable the service
+	enabled, err := IsServiceEnabled()
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return execCommand("systemctl", "disable", ServiceName)
+	}
 	return nil
 }
 
@@ -155,39 +241,62 @@ func Update() error {
 
 	// Check if service is installed
 	if _, err := os.Stat(serviceFilePath); os.IsNotExist(err) {
-		log.Fatalf("Service file does not exist at %s. Please install the service first.\n", serviceFilePath)
+		return fmt.Errorf("%w, the service file %s does not exist", ErrNotInstalled, serviceFilePath)
 	}
 
 	// Check if config file exists
-	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-		log.Fatalf("Configuration file does not exist at %s. Please install the service first.\n", configFilePath)
+	configPaths := findInstalled(configDirs, configFileName)
+	if len(configPaths) == 0 {
+		return fmt.Errorf("%w, the configuration file does not exist in %s", ErrNotInstalled, strings.Join(configDirs, " or "))
+	}
+	// Configuration files of older versions were readable by all users
+	for _, path := range configPaths {
+		if err := cgconfig.FixPermissions(path); err != nil {
+			log.Printf("Warning: Could not restrict the permissions of %s: %v\n", path, err)
+		}
 	}
 
 	// Check if service is active
-	if !IsServiceEnabled() {
-		log.Fatalf("Service is not enabled. Please install and enable the service first.\n")
+	enabled, err := IsServiceEnabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return fmt.Errorf("%w, the service is not enabled", ErrNotInstalled)
+	}
+
+	// Resolve the target before stopping the service, so a read-only filesystem
+	// does not leave the service stopped
+	targetPath, err := resolvePath(binaryDirs, binaryName)
+	if err != nil {
+		return err
 	}
 
 	selfPath, err := os.Executable()
 	if err != nil {
-		log.Fatalf("Error getting executable path: %v\n", err)
+		return fmt.Errorf("error getting executable path: %w", err)
 	}
 
 	if selfPath == targetPath {
-		log.Fatalf("I can not update myself while running from the target path: %s\n", targetPath)
+		return fmt.Errorf("can not update the binary while running from the target path %s", targetPath)
 	}
 
 	if err := DisableAndStopService(); err != nil {
-		log.Fatalf("Error disabling and stopping service: %v\n", err)
+		return fmt.Errorf("error disabling and stopping service: %w", err)
 	}
 
-	// Copy binary to /usr/bin
+	// Copy binary to the target path
 	if err := copyFile(selfPath, targetPath, 0755); err != nil {
-		log.Fatalf("Error copying binary: %v\n", err)
+		return fmt.Errorf("error copying binary: %w", err)
+	}
+
+	// The binary may have moved to a fallback location
+	if err := createSystemdService(targetPath); err != nil {
+		return fmt.Errorf("error creating systemd service: %w", err)
 	}
 
 	if err := EnableAndStartService(); err != nil {
-		log.Fatalf("Error enabling and starting service: %v\n", err)
+		return fmt.Errorf("error enabling and starting service: %w", err)
 	}
 
 	log.Println("Client updated successfully.")
@@ -199,32 +308,44 @@ func Install() error {
 		return os.ErrPermission // User does not have root privileges
 	}
 
+	// Resolve all paths before changing anything on the system
+	paths, err := resolveInstallPaths()
+	if err != nil {
+		return err
+	}
+	if paths.binary != filepath.Join(binaryDirs[0], binaryName) {
+		log.Println("Installing binary to fallback location", paths.binary)
+	}
+	if paths.config != filepath.Join(configDirs[0], configFileName) {
+		log.Println("Installing configuration to fallback location", paths.config)
+	}
+
 	selfPath, err := os.Executable()
 	if err != nil {
-		log.Fatalf("Error getting executable path: %v\n", err)
+		return fmt.Errorf("error getting executable path: %w", err)
 	}
 
 	if err := DisableAndStopService(); err != nil {
-		log.Fatalf("Error disabling and stopping service: %v\n", err)
+		return fmt.Errorf("error disabling and stopping service: %w", err)
 	}
 
-	// Copy binary to /usr/bin
-	if err := copyFile(selfPath, targetPath, 0755); err != nil {
-		log.Fatalf("Error copying binary: %v\n", err)
+	// Copy binary to the target path
+	if err := copyFile(selfPath, paths.binary, 0755); err != nil {
+		return fmt.Errorf("error copying binary: %w", err)
 	}
 
 	// Create a systemd service file
-	if err := createSystemdService(); err != nil {
-		log.Fatalf("Error creating systemd service: %v\n", err)
+	if err := createSystemdService(paths.binary); err != nil {
+		return fmt.Errorf("error creating systemd service: %w", err)
 	}
 
 	// Create the configuration file
-	if err := Config.Save(configFilePath); err != nil {
-		log.Fatalf("Error creating config file: %v\n", err)
+	if err := Config.Save(paths.config); err != nil {
+		return fmt.Errorf("error creating config file: %w", err)
 	}
 
 	if err := EnableAndStartService(); err != nil {
-		log.Fatalf("Error enabling and starting service: %v\n", err)
+		return fmt.Errorf("error enabling and starting service: %w", err)
 	}
 
 	return nil
@@ -237,27 +358,24 @@ func Uninstall() error {
 
 	// Stop and disable the service
 	if err := DisableAndStopService(); err != nil {
-		log.Fatalf("Error disabling and stopping service: %v\n", err)
+		return fmt.Errorf("error disabling and stopping service: %w", err)
 	}
 
 	// Remove the service file
 	if _, err := os.Stat(serviceFilePath); !os.IsNotExist(err) {
 		if err := os.Remove(serviceFilePath); err != nil {
-			log.Fatalf("Error removing service file: %v\n", err)
+			return fmt.Errorf("error removing service file: %w", err)
 		}
 	}
 
-	// Remove the binary
-	if _, err := os.Stat(targetPath); !os.IsNotExist(err) {
-		if err := os.Remove(targetPath); err != nil {
-			log.Fatalf("Error removing binary: %v\n", err)
+	// Remove the binary and configuration file from all candidate locations
+	for _, path := range append(findInstalled(binaryDirs, binaryName), findInstalled(configDirs, configFileName)...) {
+		if !linux.IsWritableDir(filepath.Dir(path)) {
+			log.Printf("Skipping %s, it is on a read-only filesystem\n", path)
+			continue
 		}
-	}
-
-	// Remove the configuration file
-	if _, err := os.Stat(configFilePath); !os.IsNotExist(err) {
-		if err := os.Remove(configFilePath); err != nil {
-			log.Fatalf("Error removing config file: %v\n", err)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error removing %s: %w", path, err)
 		}
 	}
 
@@ -0,0 +1,30 @@
+package linux_installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	preferred := t.TempDir()
+	fallback := t.TempDir()
+	dirs := []string{preferred, fallback}
+
+	// Without an existing installation the first writable directory is used
+	path, err := resolvePath(dirs, binaryName)
+	if err != nil || path != filepath.Join(preferred, binaryName) {
+		t.Errorf("resolvePath() = %s, %v, want %s", path, err, filepath.Join(preferred, binaryName))
+	}
+
+	// An existing installation in a fallback location is kept in place
+	os.WriteFile(filepath.Join(fallback, binaryName), []byte{}, 0755)
+	path, err = resolvePath(dirs, binaryName)
+	if err != nil || path != filepath.Join(fallback, binaryName) {
+		t.Errorf("resolvePath() = %s, %v, want %s", path, err, filepath.Join(fallback, binaryName))
+	}
+
+	if installed := findInstalled(dirs, binaryName); len(installed) != 1 {
+		t.Errorf("Expected 1 installed file, got %v", installed)
+	}
+}
@@ -0,0 +1,190 @@
+// Package linux_instance makes sure only one agent processes tasks and jobs at a time.
+// The running agent holds an flock on a file in a runtime directory only the agent
+// user can write to, so no other user can take the lock first. The kernel releases
+// the lock when the process exits, so a stale lock file does not block the next agent.
+// Other invocations of the same user can connect to a unix socket in the directory to
+// trigger an immediate task cycle of the running agent.
+package linux_instance
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RuntimeDir holds the lock file and the trigger socket of the running agent
+var RuntimeDir = "/run/cloud-guardian"
+
+// trustedUid is the user whose trigger requests are accepted, the agent user
+var trustedUid = os.Geteuid()
+
+const (
+	lockFileName   = "agent.lock"
+	socketFileName = "agent.sock"
+	triggerCommand = "trigger"
+	triggerTimeout = 5 * time.Second
+)
+
+// ErrAlreadyRunning is returned by Acquire when another agent holds the lock
+var ErrAlreadyRunning = errors.New("another cloud-guardian agent is already running")
+
+// Lock is held by the running agent until the process exits or Release is called.
+type Lock struct {
+	file       *os.File
+	listener   net.Listener
+	triggers   chan struct{}
+	trustedUid int // See trustedUid
+}
+
+// Acquire takes the instance lock and starts accepting trigger requests.
+//
+// Returns:
+//   - *Lock: The lock, held until Release is called or the process exits
+//   - error: ErrAlreadyRunning if another agent holds the lock, an error if the
+//     runtime directory is not private to the agent user
+func Acquire() (*Lock, error) {
+	if err := prepareRuntimeDir(); err != nil {
+		return nil, fmt.Errorf("failed to acquire instance lock: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(RuntimeDir, lockFileName), os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire instance lock: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrAlreadyRunning
+		}
+		return nil, fmt.Errorf("failed to acquire instance lock: %w", err)
+	}
+
+	// The lock is held, a socket left behind by a killed agent can be replaced
+	socketPath := filepath.Join(RuntimeDir, socketFileName)
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		file.Close()
+		return nil, fmt.Errorf("failed to remove the stale trigger socket: %w", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to listen for triggers: %w", err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(true)
+	lock := &Lock{file: file, listener: listener, triggers: make(chan struct{}, 1), trustedUid: trustedUid}
+	go lock.serve()
+	return lock, nil
+}
+
+// prepareRuntimeDir creates the runtime directory and checks that only the agent
+// user can write to it, otherwise another user could replace the lock or socket
+func prepareRuntimeDir() error {
+	if err := os.MkdirAll(RuntimeDir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Lstat(RuntimeDir)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !info.IsDir() || !ok || int(stat.Uid) != os.Geteuid() || info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%s must be a directory owned by UID %d and writable only by it", RuntimeDir, os.Geteuid())
+	}
+	return nil
+}
+
+// Triggers returns a channel that receives a value when another invocation
+// requests an immediate task cycle.
+func (l *Lock) Triggers() <-chan struct{} {
+	return l.triggers
+}
+
+// Release gives up the instance lock.
+func (l *Lock) Release() {
+	l.listener.Close()
+	l.file.Close()
+}
+
+func (l *Lock) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return // The lock was released
+		}
+		go l.handle(conn)
+	}
+}
+
+// handle answers a single trigger request. Pending triggers are merged, so a
+// burst of requests results in a single task cycle. Requests of other users than
+// the agent user are rejected.
+func (l *Lock) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(triggerTimeout))
+	if uid, err := peerUid(conn); err != nil || uid != l.trustedUid {
+		fmt.Fprintln(conn, "permission denied")
+		return
+	}
+	command, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || strings.TrimSpace(command) != triggerCommand {
+		fmt.Fprintln(conn, "unknown command")
+		return
+	}
+	select {
+	case l.triggers <- struct{}{}:
+	default: // A task cycle is already pending
+	}
+	fmt.Fprintln(conn, "ok")
+}
+
+// peerUid returns the UID of the process on the other end of a unix socket
+func peerUid(conn net.Conn) (int, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return -1, fmt.Errorf("not a unix socket")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return -1, err
+	}
+	if credErr != nil {
+		return -1, credErr
+	}
+	return int(cred.Uid), nil
+}
+
+// Trigger asks the running agent to process its tasks and jobs immediately.
+//
+// Returns:
+//   - error: Any error that occurred while contacting the running agent
+func Trigger() error {
+	conn, err := net.DialTimeout("unix", filepath.Join(RuntimeDir, socketFileName), triggerTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to contact the running agent: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(triggerTimeout))
+	if _, err := fmt.Fprintln(conn, triggerCommand); err != nil {
+		return fmt.Errorf("failed to contact the running agent: %w", err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no reply from the running agent: %w", err)
+	}
+	if strings.TrimSpace(reply) != "ok" {
+		return fmt.Errorf("the running agent rejected the trigger: %s", strings.TrimSpace(reply))
+	}
+	return nil
+}
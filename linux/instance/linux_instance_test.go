@@ -0,0 +1,70 @@
+package linux_instance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireAndTrigger(t *testing.T) {
+	RuntimeDir = filepath.Join(t.TempDir(), "run")
+
+	lock, err := Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+
+	if _, err := Acquire(); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Expected ErrAlreadyRunning for a second instance, got %v", err)
+	}
+
+	if err := Trigger(); err != nil {
+		t.Fatalf("Trigger() error: %v", err)
+	}
+	select {
+	case <-lock.Triggers():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a trigger to be received")
+	}
+
+	lock.Release()
+
+	// Other users may not trigger the agent
+	trustedUid = os.Geteuid() + 1
+	defer func() { trustedUid = os.Geteuid() }()
+	lock, err = Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	defer lock.Release()
+	if err := Trigger(); err == nil {
+		t.Errorf("Expected a trigger of another user to be rejected")
+	}
+}
+
+func TestAcquireRejectsSharedRuntimeDir(t *testing.T) {
+	RuntimeDir = filepath.Join(t.TempDir(), "run")
+	if err := os.Mkdir(RuntimeDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(RuntimeDir, 0777) // Not reduced by the umask
+	if _, err := Acquire(); err == nil || errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Expected a world-writable runtime directory to be rejected, got %v", err)
+	}
+}
+
+func TestAcquireAfterRelease(t *testing.T) {
+	RuntimeDir = filepath.Join(t.TempDir(), "run")
+	lock, err := Acquire()
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	lock.Release()
+	lock, err = Acquire()
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after Release, got %v", err)
+	}
+	lock.Release()
+}
@@ -1,17 +1,20 @@
 package linux_ip
 
 import (
-	"bufio"
+	"cloud-guardian/linux"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 )
 
-type routeEntry struct {
+// Route is an IPv4 route from /proc/net/route
+type Route struct {
 	Destination  net.IP
 	DestStr      string // CIDR notation or "default"
 	PrefixLength int
@@ -38,16 +41,103 @@ type Interface struct {
 	IPAddresses  []Addr
 }
 
-func GetRoutes() ([]routeEntry, error) {
-	var routes []routeEntry
+type EgressIdentity struct {
+	SourceIP  string // Local address used to reach the API
+	Interface string // Interface that owns the source address
+}
 
+// GetEgressIdentity determines the local source address and interface used to reach
+// the given host. A UDP socket is connected to the host, which makes the kernel select
+// a route and source address without sending any packets.
+//
+// Parameters:
+//   - apiUrl: The URL of the API, e.g. "https://api.example.com/v1/"
+//
+// Returns:
+//   - EgressIdentity: The source address and egress interface
+//   - error: Any error that occurred while resolving the route
+func GetEgressIdentity(apiUrl string) (EgressIdentity, error) {
+	if strings.HasPrefix(apiUrl, "unix://") {
+		return EgressIdentity{}, nil // The API is reached through a local socket
+	}
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return EgressIdentity{}, fmt.Errorf("invalid API URL: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return EgressIdentity{}, fmt.Errorf("error resolving route to %s: %w", u.Hostname(), err)
+	}
+	defer conn.Close()
+
+	sourceIP := conn.LocalAddr().(*net.UDPAddr).IP
+	identity := EgressIdentity{SourceIP: sourceIP.String()}
+
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return identity, nil
+	}
+	for _, ifi := range ifs {
+		addrs, _ := ifi.Addrs()
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(sourceIP) {
+				identity.Interface = ifi.Name
+				return identity, nil
+			}
+		}
+	}
+	return identity, nil
+}
+
+func GetRoutes() ([]Route, error) {
 	file, err := os.Open("/proc/net/route")
 	if err != nil {
 		return nil, fmt.Errorf("error opening /proc/net/route: %w", err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	routes, err := parseRoutes(file)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range routes {
+		// Try to guess src from iface
+		ifi, err := net.InterfaceByName(routes[i].Iface)
+		if err == nil {
+			addrs, _ := ifi.Addrs()
+			for _, a := range addrs {
+				ip, _, _ := net.ParseCIDR(a.String())
+				if ip.To4() != nil {
+					routes[i].Src = ip
+					break
+				}
+			}
+		}
+	}
+	return routes, nil
+}
+
+// parseRoutes parses the content of /proc/net/route. Lines with missing fields or
+// invalid addresses are skipped.
+//
+// Parameters:
+//   - r: The content of /proc/net/route, starting with the header line
+//
+// Returns:
+//   - []Route: The routes, without source addresses
+//   - error: An error if the content is empty or cannot be read
+func parseRoutes(r io.Reader) ([]Route, error) {
+	var routes []Route
+
+	scanner := linux.NewProcScanner(r)
 	// skip header
 	if !scanner.Scan() {
 		return nil, fmt.Errorf("No data in /proc/net/route")
@@ -65,11 +155,14 @@ func GetRoutes() ([]routeEntry, error) {
 
 		maskHex := fields[7]
 		mask := parseHexIP(maskHex)
+		if dest == nil || gw == nil || mask == nil {
+			continue
+		}
 		ipMask := net.IPv4Mask(mask[12], mask[13], mask[14], mask[15])
 
 		metric, _ := strconv.Atoi(fields[6])
 
-		entry := routeEntry{
+		entry := Route{
 			Destination: dest,
 			// PrefixLength: mask.Mask.Size(),
 			Gateway: gw,
@@ -85,18 +178,6 @@ func GetRoutes() ([]routeEntry, error) {
 			entry.Scope = ""
 		}
 
-		// Try to guess src from iface
-		ifi, err := net.InterfaceByName(iface)
-		if err == nil {
-			addrs, _ := ifi.Addrs()
-			for _, a := range addrs {
-				ip, _, _ := net.ParseCIDR(a.String())
-				if ip.To4() != nil {
-					entry.Src = ip
-					break
-				}
-			}
-		}
 		dstStr := ""
 		if entry.Destination.Equal(net.IPv4(0, 0, 0, 0)) && net.IP(ipMask).Equal(net.IPv4(0, 0, 0, 0)) {
 			dstStr = "default"
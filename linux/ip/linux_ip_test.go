@@ -0,0 +1,59 @@
+package linux_ip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetEgressIdentityLoopback(t *testing.T) {
+	identity, err := GetEgressIdentity("http://127.0.0.1:8080/cloudguardian-api/v1/")
+	if err != nil {
+		t.Fatalf("GetEgressIdentity() error = %v", err)
+	}
+	if identity.SourceIP != "127.0.0.1" {
+		t.Errorf("Expected source IP 127.0.0.1, got %s", identity.SourceIP)
+	}
+	if identity.Interface == "" {
+		t.Errorf("Expected the loopback interface to be found")
+	}
+}
+
+func TestParseHexIP(t *testing.T) {
+	if ip := parseHexIP("0102A8C0"); ip.String() != "192.168.2.1" {
+		t.Errorf("Expected 192.168.2.1, got %s", ip)
+	}
+	if ip := parseHexIP("invalid"); ip != nil {
+		t.Errorf("Expected nil for invalid input, got %s", ip)
+	}
+}
+
+const testRoute = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0102A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0002A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+eth1	XYZ	00000000	0001	0	0	100	00FFFFFF	0	0	0
+eth2	0002A8C0
+`
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := parseRoutes(strings.NewReader(testRoute))
+	if err != nil {
+		t.Fatalf("parseRoutes() error = %v", err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d: %+v", len(routes), routes)
+	}
+	if routes[0].DestStr != "default" || routes[0].Gateway.String() != "192.168.2.1" || routes[0].Metric != 100 {
+		t.Errorf("Unexpected default route: %+v", routes[0])
+	}
+	if _, err := parseRoutes(strings.NewReader("")); err == nil {
+		t.Errorf("Expected an error for empty content")
+	}
+}
+
+func FuzzParseRoutes(f *testing.F) {
+	f.Add(testRoute)
+	f.Add("header\na b c d e f g h i j k\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		parseRoutes(strings.NewReader(content))
+	})
+}
@@ -0,0 +1,209 @@
+// Package linux_kmodules inventories the loaded kernel modules and the modules managed
+// by DKMS. Out-of-tree, unsigned and proprietary modules are the usual culprits
+// when a kernel update breaks a host, so they are flagged before patching.
+package linux_kmodules
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud-guardian/linux"
+)
+
+// ModulesPath contains the default path to the loaded modules
+var ModulesPath = "/proc/modules"
+
+// TaintedPath contains the default path to the taint flags of the kernel
+var TaintedPath = "/proc/sys/kernel/tainted"
+
+// SysfsPath contains the default path to the modules exported by the kernel
+var SysfsPath = "/sys/module"
+
+// commandTimeout limits dkms and modinfo
+const commandTimeout = 10 * time.Second
+
+// taintFlags are the names of the bits of /proc/sys/kernel/tainted, see the
+// kernel documentation admin-guide/tainted-kernels
+var taintFlags = []string{
+	"proprietary_module", "forced_module", "unsafe_smp", "forced_rmmod", "machine_check", "bad_page",
+	"user", "die", "overridden_acpi_table", "warn", "staging_driver", "firmware_workaround",
+	"oot_module", "unsigned_module", "soft_lockup", "livepatch", "aux", "randstruct", "test",
+}
+
+type Module struct {
+	Name        string   `json:"name"`
+	Size        int64    `json:"size"`
+	UsedBy      []string `json:"used_by,omitempty"`
+	Taints      string   `json:"taints,omitempty"` // Taint letters of /proc/modules, e.g. "POE"
+	OutOfTree   bool     `json:"out_of_tree"`
+	Unsigned    bool     `json:"unsigned"`
+	Proprietary bool     `json:"proprietary"`
+	Version     string   `json:"version,omitempty"`  // The version of the module, if it declares one
+	Filename    string   `json:"filename,omitempty"` // The module file, only looked up for tainting modules
+	Dkms        bool     `json:"dkms"`               // The module is built by DKMS
+}
+
+type DkmsModule struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Kernel  string `json:"kernel,omitempty"` // Empty if the module is only added or built
+	Arch    string `json:"arch,omitempty"`
+	Status  string `json:"status"` // e.g. "installed", "built" or "added"
+}
+
+type KernelModules struct {
+	Tainted    int64        `json:"tainted"`     // The value of /proc/sys/kernel/tainted
+	TaintFlags []string     `json:"taint_flags"` // The names of the set taint bits, e.g. "oot_module"
+	Modules    []Module     `json:"modules"`
+	Dkms       []DkmsModule `json:"dkms"`
+}
+
+// GetKernelModules collects the loaded kernel modules, the taint flags of the
+// kernel and the DKMS modules. DKMS modules require the dkms command.
+//
+// Returns:
+//   - KernelModules: The kernel module inventory
+func GetKernelModules() KernelModules {
+	result := KernelModules{TaintFlags: []string{}, Modules: []Module{}, Dkms: []DkmsModule{}}
+	if data, err := os.ReadFile(TaintedPath); err == nil {
+		result.Tainted, _ = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		result.TaintFlags = parseTainted(result.Tainted)
+	}
+	if output, err := runWithTimeout("dkms", "status"); err == nil {
+		result.Dkms = parseDkmsStatus(output)
+	}
+	data, err := os.ReadFile(ModulesPath)
+	if err != nil {
+		return result
+	}
+	dkmsNames := map[string]bool{}
+	for _, module := range result.Dkms {
+		dkmsNames[strings.ReplaceAll(module.Name, "-", "_")] = true
+	}
+	for _, module := range parseModules(string(data)) {
+		module.Version = readAttribute(module.Name, "version")
+		if module.Taints != "" {
+			if filename, err := runWithTimeout("modinfo", "-n", module.Name); err == nil {
+				module.Filename = strings.TrimSpace(filename)
+			}
+		}
+		module.Dkms = dkmsNames[module.Name] || strings.Contains(module.Filename, "/dkms/")
+		result.Modules = append(result.Modules, module)
+	}
+	return result
+}
+
+// parseModules parses the content of /proc/modules, e.g.
+// "nvidia 56823808 123 nvidia_modeset,nvidia_uvm, Live 0xffffffffc0a00000 (POE)".
+// Malformed lines are skipped.
+//
+// Parameters:
+//   - content: The content of /proc/modules
+//
+// Returns:
+//   - []Module: The loaded modules
+func parseModules(content string) []Module {
+	modules := []Module{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		module := Module{Name: fields[0], Size: size}
+		for _, user := range strings.Split(fields[3], ",") {
+			if user != "" && user != "-" {
+				module.UsedBy = append(module.UsedBy, user)
+			}
+		}
+		if len(fields) > 6 && strings.HasPrefix(fields[6], "(") {
+			module.Taints = strings.Trim(fields[6], "()")
+		}
+		module.Proprietary = strings.Contains(module.Taints, "P")
+		module.OutOfTree = strings.Contains(module.Taints, "O")
+		module.Unsigned = strings.Contains(module.Taints, "E")
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// parseTainted returns the names of the set bits of /proc/sys/kernel/tainted.
+// Unknown bits are named by their number, e.g. "bit_20".
+//
+// Parameters:
+//   - tainted: The value of /proc/sys/kernel/tainted
+//
+// Returns:
+//   - []string: The names of the set taint bits
+func parseTainted(tainted int64) []string {
+	flags := []string{}
+	for bit := 0; bit < 63; bit++ {
+		if tainted&(1<<bit) == 0 {
+			continue
+		}
+		if bit < len(taintFlags) {
+			flags = append(flags, taintFlags[bit])
+		} else {
+			flags = append(flags, "bit_"+strconv.Itoa(bit))
+		}
+	}
+	return flags
+}
+
+// parseDkmsStatus parses the output of 'dkms status'. Both the current format
+// "nvidia/535.104.05, 6.2.0-33-generic, x86_64: installed" and the format of
+// older versions "nvidia, 535.104.05, 6.2.0-33-generic, x86_64: installed" are
+// supported. Warnings after the status, e.g. "(WARNING! Diff between built and
+// installed module!)", are ignored.
+//
+// Parameters:
+//   - output: The output of dkms status
+//
+// Returns:
+//   - []DkmsModule: The DKMS modules, one per kernel they are built or installed for
+func parseDkmsStatus(output string) []DkmsModule {
+	modules := []DkmsModule{}
+	for _, line := range strings.Split(output, "\n") {
+		description, status, found := strings.Cut(line, ": ")
+		if !found {
+			continue
+		}
+		fields := strings.Split(description, ", ")
+		if name, version, found := strings.Cut(fields[0], "/"); found {
+			fields = append([]string{name, version}, fields[1:]...)
+		}
+		if len(fields) < 2 {
+			continue
+		}
+		module := DkmsModule{Name: fields[0], Version: fields[1], Status: strings.Fields(status + " ")[0]}
+		if len(fields) >= 4 {
+			module.Kernel = fields[2]
+			module.Arch = fields[3]
+		}
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+func readAttribute(module, name string) string {
+	data, err := os.ReadFile(filepath.Join(SysfsPath, module, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func runWithTimeout(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	stdout, _, err := linux.RunCommand(exec.CommandContext(ctx, name, args...))
+	return stdout, err
+}
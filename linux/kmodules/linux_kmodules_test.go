@@ -0,0 +1,59 @@
+package linux_kmodules
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testModules = `nvidia_uvm 1523712 0 - Live 0xffffffffc2a00000 (POE)
+nvidia 56823808 123 nvidia_uvm,nvidia_modeset, Live 0xffffffffc0a00000 (POE)
+ext4 1114112 2 - Live 0xffffffffc0570000
+vboxdrv 696320 0 - Loading 0xffffffffc04a0000 (OE)
+invalid line
+`
+
+const testDkmsStatus = `nvidia/535.104.05, 6.2.0-33-generic, x86_64: installed
+virtualbox, 6.1.38, 5.15.0-84-generic, x86_64: installed (WARNING! Diff between built and installed module!)
+zfs/2.1.5: added
+`
+
+func TestParseModules(t *testing.T) {
+	modules := parseModules(testModules)
+	if len(modules) != 4 {
+		t.Fatalf("Expected 4 modules, got %d: %+v", len(modules), modules)
+	}
+	nvidia := modules[1]
+	if nvidia.Name != "nvidia" || nvidia.Size != 56823808 || !nvidia.Proprietary || !nvidia.OutOfTree || !nvidia.Unsigned {
+		t.Errorf("Unexpected nvidia module: %+v", nvidia)
+	}
+	if !reflect.DeepEqual(nvidia.UsedBy, []string{"nvidia_uvm", "nvidia_modeset"}) {
+		t.Errorf("Unexpected users of nvidia: %v", nvidia.UsedBy)
+	}
+	if ext4 := modules[2]; ext4.Taints != "" || ext4.OutOfTree || ext4.UsedBy != nil {
+		t.Errorf("Expected ext4 to be an untainted in-tree module, got %+v", ext4)
+	}
+	if vbox := modules[3]; vbox.Proprietary || !vbox.OutOfTree || !vbox.Unsigned {
+		t.Errorf("Unexpected vboxdrv module: %+v", vbox)
+	}
+}
+
+func TestParseTainted(t *testing.T) {
+	expected := []string{"proprietary_module", "oot_module", "unsigned_module", "bit_20"}
+	if flags := parseTainted(1 | 1<<12 | 1<<13 | 1<<20); !reflect.DeepEqual(flags, expected) {
+		t.Errorf("Expected %v, got %v", expected, flags)
+	}
+	if flags := parseTainted(0); len(flags) != 0 {
+		t.Errorf("Expected no taint flags, got %v", flags)
+	}
+}
+
+func TestParseDkmsStatus(t *testing.T) {
+	expected := []DkmsModule{
+		{Name: "nvidia", Version: "535.104.05", Kernel: "6.2.0-33-generic", Arch: "x86_64", Status: "installed"},
+		{Name: "virtualbox", Version: "6.1.38", Kernel: "5.15.0-84-generic", Arch: "x86_64", Status: "installed"},
+		{Name: "zfs", Version: "2.1.5", Status: "added"},
+	}
+	if modules := parseDkmsStatus(testDkmsStatus); !reflect.DeepEqual(modules, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, modules)
+	}
+}
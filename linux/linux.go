@@ -1,10 +1,14 @@
 package linux
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
 )
 
 // HasRootPrivileges checks if the current process is running with root privileges.
@@ -17,8 +21,23 @@ func HasRootPrivileges() bool {
 	return os.Geteuid() == 0
 }
 
+// IsWritableDir checks if files can be created in the given directory.
+// It returns false for directories on read-only filesystems, e.g. /usr on
+// image-based systems, and for directories the process has no write access to.
+//
+// Parameters:
+//   - dir: The directory to check
+//
+// Returns:
+//   - bool: true if the directory is writable, false otherwise
+func IsWritableDir(dir string) bool {
+	const wOK = 2 // W_OK from unistd.h
+	return syscall.Access(dir, wOK) == nil
+}
+
 // RunCommand executes a given command and captures both stdout and stderr.
 // It returns the standard output, standard error, and any error that occurred during execution.
+// The command runs with the C locale, so its output can be parsed on non-English hosts.
 //
 // Parameters:
 //   - command: The exec.Cmd to execute
@@ -28,13 +47,154 @@ func HasRootPrivileges() bool {
 //   - string: Standard error output from the command
 //   - error: Any error that occurred during execution
 func RunCommand(command *exec.Cmd) (string, string, error) {
+	return RunCommandLive(command, LiveOutput{})
+}
+
+// LiveOutput receives the output of a command while it runs, e.g. to report the
+// progress of a long job. Nil writers are ignored. The writers are called from
+// different goroutines.
+type LiveOutput struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// RunCommandLive executes a command like RunCommand and copies its output to live
+// while it runs.
+//
+// Parameters:
+//   - command: The exec.Cmd to execute
+//   - live: Receives the output while the command runs
+//
+// Returns:
+//   - string: Standard output from the command
+//   - string: Standard error output from the command
+//   - error: Any error that occurred during execution
+func RunCommandLive(command *exec.Cmd, live LiveOutput) (string, string, error) {
 	var stdout strings.Builder
 	var stderr strings.Builder
 	command.Stdout = &stdout
 	command.Stderr = &stderr // Capture stderr as well
+	if live.Stdout != nil {
+		command.Stdout = io.MultiWriter(&stdout, live.Stdout)
+	}
+	if live.Stderr != nil {
+		command.Stderr = io.MultiWriter(&stderr, live.Stderr)
+	}
+	command.Env = cLocaleEnv(command.Env)
 	err := command.Run()
 	if err != nil {
 		return stdout.String(), stderr.String(), fmt.Errorf("command failed: %s", stderr.String())
 	}
 	return stdout.String(), stderr.String(), nil
 }
+
+// CommandAvailable checks if a command can be found in the PATH. Minimal images
+// may lack coreutils like who or df, collectors then fall back to native implementations.
+//
+// Parameters:
+//   - name: The name of the command
+//
+// Returns:
+//   - bool: true if the command is available, false otherwise
+func CommandAvailable(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// cLocaleEnv replaces the locale variables of a command environment with the C locale.
+// A nil environment is the environment of the agent, like for exec.Cmd.
+//
+// Parameters:
+//   - env: The environment of the command
+//
+// Returns:
+//   - []string: The environment with LC_ALL and LANG set to C
+func cLocaleEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	result := make([]string, 0, len(env)+2)
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		if name == "LANG" || name == "LANGUAGE" || strings.HasPrefix(name, "LC_") {
+			continue
+		}
+		result = append(result, variable)
+	}
+	return append(result, "LC_ALL=C", "LANG=C")
+}
+
+const (
+	MaxProcFileSize = 16 << 20 // Upper bound of data read from a /proc or /sys file
+	maxProcLineSize = 1 << 20  // Upper bound of a single line, longer lines end the scan
+)
+
+// NewProcScanner returns a line scanner for /proc and /sys files. It reads at most
+// MaxProcFileSize bytes and supports long lines, so huge or corrupted files cannot
+// exhaust the memory of the agent. A nil reader yields no lines.
+//
+// Parameters:
+//   - reader: The content to scan, e.g. an opened /proc file
+//
+// Returns:
+//   - *bufio.Scanner: The line scanner
+func NewProcScanner(reader io.Reader) *bufio.Scanner {
+	if reader == nil {
+		reader = strings.NewReader("")
+	}
+	scanner := bufio.NewScanner(io.LimitReader(reader, MaxProcFileSize))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxProcLineSize)
+	return scanner
+}
+
+// ParseSize parses a human readable size as printed by package managers, e.g.
+// "12.3 MB" (apt, powers of 1000), "12 M" (dnf, powers of 1024) or "12 MiB" (dnf5).
+// Thousands separators are ignored.
+//
+// Parameters:
+//   - value: The size with an optional unit
+//
+// Returns:
+//   - int64: The size in bytes
+//   - error: An error if the size or the unit is unknown
+func ParseSize(value string) (int64, error) {
+	value = strings.ReplaceAll(strings.TrimSpace(value), ",", "")
+	end := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	number, unit := value, ""
+	if end >= 0 {
+		number, unit = value[:end], strings.TrimSpace(value[end:])
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	multipliers := map[string]float64{
+		"": 1, "B": 1,
+		"k": 1 << 10, "K": 1 << 10, "KiB": 1 << 10, "kB": 1e3,
+		"M": 1 << 20, "MiB": 1 << 20, "MB": 1e6,
+		"G": 1 << 30, "GiB": 1 << 30, "GB": 1e9,
+		"T": 1 << 40, "TiB": 1 << 40, "TB": 1e12,
+	}
+	multiplier, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit in %q", value)
+	}
+	return int64(size * multiplier), nil
+}
+
+// UnescapeMountPath decodes the octal escapes of spaces, tabs and backslashes in mount paths of
+// /proc/self/mounts
+func UnescapeMountPath(path string) string {
+	var result strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(path[i])
+	}
+	return result.String()
+}
@@ -0,0 +1,54 @@
+package linux
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCLocaleEnv(t *testing.T) {
+	env := cLocaleEnv([]string{"PATH=/usr/bin", "LANG=de_DE.UTF-8", "LC_TIME=fr_FR.UTF-8", "LANGUAGE=de", "DEBIAN_FRONTEND=noninteractive"})
+	expected := []string{"PATH=/usr/bin", "DEBIAN_FRONTEND=noninteractive", "LC_ALL=C", "LANG=C"}
+	if strings.Join(env, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, env)
+	}
+}
+
+func TestRunCommandUsesCLocale(t *testing.T) {
+	t.Setenv("LANG", "de_DE.UTF-8")
+	t.Setenv("LC_ALL", "de_DE.UTF-8")
+	stdout, _, err := RunCommand(exec.Command("sh", "-c", "echo $LANG $LC_ALL"))
+	if err != nil {
+		t.Fatalf("RunCommand() error: %v", err)
+	}
+	if strings.TrimSpace(stdout) != "C C" {
+		t.Errorf("Expected the C locale, got %q", stdout)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"0 B":      0,
+		"512":      512,
+		"1,024 kB": 1024000,
+		"12.5 MB":  12500000,
+		"2 k":      2048,
+		"1.5 M":    1572864,
+		"3 GiB":    3 << 30,
+		"208 MiB":  208 << 20,
+		" 1 TB ":   1000000000000,
+	}
+	for value, expected := range tests {
+		size, err := ParseSize(value)
+		if err != nil {
+			t.Errorf("ParseSize(%q) error: %v", value, err)
+		} else if size != expected {
+			t.Errorf("ParseSize(%q) = %d, expected %d", value, size, expected)
+		}
+	}
+	for _, value := range []string{"", "MB", "12 parsecs"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("ParseSize(%q) expected an error", value)
+		}
+	}
+}
@@ -1,9 +1,23 @@
 package linux_loggedinusers
 
 import (
-	"fmt"
+	"bytes"
+	"cloud-guardian/linux"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
+)
+
+// UtmpPath is the login records file read by ReadUtmp
+var UtmpPath = "/var/run/utmp"
+
+const (
+	utmpRecordSize  = 384 // sizeof(struct utmp) on Linux
+	utmpUserProcess = 7   // USER_PROCESS, a login session
 )
 
 type LoggedInUser struct {
@@ -21,14 +35,63 @@ type LoggedInUser struct {
 //   - error: Any error that occurred during the retrieval process
 func GetLoggedInUsers() ([]LoggedInUser, error) {
 	command := exec.Command("who")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
+	}
+
+	return parseLoggedInUsers(out), nil
+}
+
+// ReadUtmp retrieves the list of currently logged-in users from the utmp file.
+// It is the native fallback of GetLoggedInUsers for hosts without 'who'.
+// A missing utmp file, e.g. in a container, means no users are logged in.
+//
+// Returns:
+//   - []LoggedInUser: A slice of LoggedInUser structs containing user session information
+//   - error: Any error that occurred while reading the utmp file
+func ReadUtmp() ([]LoggedInUser, error) {
+	data, err := os.ReadFile(UtmpPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []LoggedInUser{}, nil
+	} else if err != nil {
+		return nil, err
 	}
+	return parseUtmp(data), nil
+}
 
-	return parseLoggedInUsers(out.String()), nil
+// parseUtmp parses utmp records. Only user sessions are returned, the login time
+// is formatted like the output of 'who'.
+//
+// Parameters:
+//   - data: The content of the utmp file
+//
+// Returns:
+//   - []LoggedInUser: A slice of parsed LoggedInUser structs
+func parseUtmp(data []byte) []LoggedInUser {
+	users := []LoggedInUser{}
+	for offset := 0; offset+utmpRecordSize <= len(data); offset += utmpRecordSize {
+		record := data[offset : offset+utmpRecordSize]
+		if binary.LittleEndian.Uint16(record[0:2]) != utmpUserProcess {
+			continue // Skip boot, run level and dead process records
+		}
+		loginTime := time.Unix(int64(int32(binary.LittleEndian.Uint32(record[340:344]))), 0)
+		users = append(users, LoggedInUser{
+			Username:  cString(record[44:76]),
+			Terminal:  cString(record[8:40]),
+			LoginTime: loginTime.Format("2006-01-02 15:04"),
+			Host:      cString(record[76:332]),
+		})
+	}
+	return users
+}
+
+// cString returns the NUL-terminated string of a fixed size field
+func cString(field []byte) string {
+	if end := bytes.IndexByte(field, 0); end >= 0 {
+		field = field[:end]
+	}
+	return string(field)
 }
 
 // parseLoggedInUsers parses the output from the 'who' command.
@@ -1,7 +1,12 @@
 package linux_loggedinusers
 
 import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 const testCase = `ewillems pts/0 2023-10-01 10:00 (host1)
@@ -45,3 +50,39 @@ func TestParseLoggedInUsersInvalid(t *testing.T) {
 		t.Errorf("expected 0 users, got %d", len(users))
 	}
 }
+
+// testUtmpRecord builds a utmp record with the given type, user, terminal, host and login time
+func testUtmpRecord(recordType uint16, user, terminal, host string, loginTime int64) []byte {
+	record := make([]byte, utmpRecordSize)
+	binary.LittleEndian.PutUint16(record[0:2], recordType)
+	copy(record[8:40], terminal)
+	copy(record[44:76], user)
+	copy(record[76:332], host)
+	binary.LittleEndian.PutUint32(record[340:344], uint32(loginTime))
+	return record
+}
+
+func TestReadUtmp(t *testing.T) {
+	loginTime := time.Date(2023, 10, 1, 10, 5, 0, 0, time.Local)
+	data := append(testUtmpRecord(2, "reboot", "~", "6.8.0", loginTime.Unix()), testUtmpRecord(utmpUserProcess, "ewillems", "pts/1", "host2", loginTime.Unix())...)
+	data = append(data, testUtmpRecord(8, "", "pts/0", "", loginTime.Unix())...) // Dead process
+	UtmpPath = filepath.Join(t.TempDir(), "utmp")
+	defer func() { UtmpPath = "/var/run/utmp" }()
+	if err := os.WriteFile(UtmpPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := ReadUtmp()
+	if err != nil {
+		t.Fatalf("ReadUtmp() error: %v", err)
+	}
+	expected := []LoggedInUser{{Username: "ewillems", Terminal: "pts/1", LoginTime: "2023-10-01 10:05", Host: "host2"}}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, users)
+	}
+
+	os.Remove(UtmpPath)
+	if users, err := ReadUtmp(); err != nil || len(users) != 0 {
+		t.Errorf("Expected no users without a utmp file, got %+v (%v)", users, err)
+	}
+}
@@ -1,7 +1,8 @@
 package linux_lsblk
 
 import (
-	"bufio"
+	"cloud-guardian/linux"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -122,11 +123,30 @@ func detectType(name, path string) string {
 }
 
 func readMounts() map[string]string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return map[string]string{}
+	}
+	defer f.Close()
+	return parseMountinfo(f)
+}
+
+// parseMountinfo parses /proc/self/mountinfo into mount points by device number
+// ("major:minor"). Malformed lines are skipped.
+//
+// Parameters:
+//   - r: The content of /proc/self/mountinfo
+//
+// Returns:
+//   - map[string]string: The mount point of each device number
+func parseMountinfo(r io.Reader) map[string]string {
 	m := map[string]string{}
-	f, _ := os.Open("/proc/self/mountinfo")
-	sc := bufio.NewScanner(f)
+	sc := linux.NewProcScanner(r)
 	for sc.Scan() {
 		fields := strings.Fields(strings.Split(sc.Text(), " - ")[0])
+		if len(fields) < 5 {
+			continue
+		}
 		m[fields[2]] = fields[4]
 	}
 	return m
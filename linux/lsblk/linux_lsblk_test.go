@@ -0,0 +1,30 @@
+package linux_lsblk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMountinfo = `22 1 253:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg-root rw
+25 22 8:1 / /boot rw,relatime shared:2 - ext4 /dev/sda1 rw
+26 22 0:5 / /dev rw,nosuid shared:3 - devtmpfs devtmpfs rw,size=4096k
+`
+
+func TestParseMountinfo(t *testing.T) {
+	expected := map[string]string{"253:0": "/", "8:1": "/boot", "0:5": "/dev"}
+	if mounts := parseMountinfo(strings.NewReader(testMountinfo)); !reflect.DeepEqual(mounts, expected) {
+		t.Errorf("Expected %v, got %v", expected, mounts)
+	}
+	if mounts := parseMountinfo(strings.NewReader("22 1 253:0\n - ext4\n")); len(mounts) != 0 {
+		t.Errorf("Expected malformed lines to be skipped, got %v", mounts)
+	}
+}
+
+func FuzzParseMountinfo(f *testing.F) {
+	f.Add(testMountinfo)
+	f.Add(" - \n")
+	f.Fuzz(func(t *testing.T, content string) {
+		parseMountinfo(strings.NewReader(content))
+	})
+}
@@ -1,7 +1,8 @@
 package linux_mdstat
 
 import (
-	"bufio"
+	"cloud-guardian/linux"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -47,19 +48,46 @@ type SysBlock struct {
 }
 
 var (
-	devRe  = regexp.MustCompile(`(\w+)\[(\d+)\]`)
-	sizeRe = regexp.MustCompile(`(\d+)\s+blocks.*\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
-	progRe = regexp.MustCompile(`\((recovery|resync|rebuild)=\s*([\d.]+)%.*?speed=([\d]+)K/sec.*?finish=([^)]+)\)`)
+	devRe    = regexp.MustCompile(`(\w+)\[(\d+)\]`)
+	sizeRe   = regexp.MustCompile(`(\d+)\s+blocks.*\[(\d+)/(\d+)\]\s+\[([U_]+)\]`)
+	progRe   = regexp.MustCompile(`(recovery|resync|reshape|check|rebuild)\s*=\s*([\d.]+)%`)
+	speedRe  = regexp.MustCompile(`speed=(\d+)K/sec`)
+	finishRe = regexp.MustCompile(`finish=([^\s)]+)`)
 )
 
 func GetMdStat() (mdstat MdStat) {
 	partitions := parsePartitions()
 
-	f, _ := os.Open("/proc/mdstat")
+	f, err := os.Open("/proc/mdstat")
+	if err != nil {
+		return mdstat
+	}
 	defer f.Close()
-	s := bufio.NewScanner(f)
+	mdstat = parseMdStat(f, partitions)
+
+	// Correlate sysfs
+	for i := range mdstat.Arrays {
+		base := filepath.Join("/sys/block", mdstat.Arrays[i].Name, "md")
+		mdstat.Arrays[i].Sys = &SysBlock{
+			ChunkSize: readFirst(filepath.Join(base, "chunk_size")),
+			Layout:    readFirst(filepath.Join(base, "layout")),
+			Metadata:  readFirst(filepath.Join(base, "metadata_version")),
+		}
+	}
+	return mdstat
+}
+
+// parseMdStat parses the content of /proc/mdstat. Malformed lines are skipped.
+//
+// Parameters:
+//   - r: The content of /proc/mdstat
+//   - partitions: The partition sizes in blocks by device name
+//
+// Returns:
+//   - MdStat: The personalities and arrays
+func parseMdStat(r io.Reader, partitions map[string]uint64) (mdstat MdStat) {
+	s := linux.NewProcScanner(r)
 
-	// var mdstat MdStat
 	var cur *Array
 
 	for s.Scan() {
@@ -79,6 +107,11 @@ func GetMdStat() (mdstat MdStat) {
 
 		if strings.Contains(line, " : ") {
 			f := strings.Fields(line)
+			if len(f) < 4 {
+				// e.g. "unused devices : <none>" or a truncated array line
+				cur = nil
+				continue
+			}
 			cur = &Array{
 				Name:  strings.TrimSuffix(f[0], ":"),
 				State: f[2],
@@ -113,24 +146,16 @@ func GetMdStat() (mdstat MdStat) {
 		}
 
 		if m := progRe.FindStringSubmatch(line); m != nil {
+			// e.g. "[==>....]  recovery = 12.6% (123456/976630464) finish=81.2min speed=175000K/sec"
 			pct, _ := strconv.ParseFloat(m[2], 64)
-			speed, _ := strconv.ParseInt(m[3], 10, 64)
-			mdstat.Arrays[len(mdstat.Arrays)-1].Progress = &Progress{
-				Type:     m[1],
-				Percent:  pct,
-				SpeedKPS: speed,
-				ETA:      strings.TrimSpace(m[4]),
+			progress := &Progress{Type: m[1], Percent: pct}
+			if speed := speedRe.FindStringSubmatch(line); speed != nil {
+				progress.SpeedKPS, _ = strconv.ParseInt(speed[1], 10, 64)
 			}
-		}
-	}
-
-	// Correlate sysfs
-	for i := range mdstat.Arrays {
-		base := filepath.Join("/sys/block", mdstat.Arrays[i].Name, "md")
-		mdstat.Arrays[i].Sys = &SysBlock{
-			ChunkSize: readFirst(filepath.Join(base, "chunk_size")),
-			Layout:    readFirst(filepath.Join(base, "layout")),
-			Metadata:  readFirst(filepath.Join(base, "metadata_version")),
+			if finish := finishRe.FindStringSubmatch(line); finish != nil {
+				progress.ETA = finish[1]
+			}
+			mdstat.Arrays[len(mdstat.Arrays)-1].Progress = progress
 		}
 	}
 	return mdstat
@@ -146,9 +171,12 @@ func readFirst(path string) string {
 
 func parsePartitions() map[string]uint64 {
 	out := map[string]uint64{}
-	f, _ := os.Open("/proc/partitions")
+	f, err := os.Open("/proc/partitions")
+	if err != nil {
+		return out
+	}
 	defer f.Close()
-	s := bufio.NewScanner(f)
+	s := linux.NewProcScanner(f)
 	for s.Scan() {
 		f := strings.Fields(s.Text())
 		if len(f) == 4 {
@@ -0,0 +1,54 @@
+package linux_mdstat
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMdStat = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md0 : active raid1 sdb1[1] sda1[0]
+      976630464 blocks super 1.2 [2/2] [UU]
+      [==>..................]  recovery = 12.6% (123456/976630464) finish=81.2min speed=175000K/sec
+      bitmap: 0/8 pages [0KB], 65536KB chunk
+
+md1 : active raid5 sde[3] sdd[1] sdc[0]
+      1953260544 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+
+unused devices: <none>
+`
+
+func TestParseMdStat(t *testing.T) {
+	mdstat := parseMdStat(strings.NewReader(testMdStat), map[string]uint64{"sda1": 976631472})
+	if len(mdstat.Personalities) != 4 || mdstat.Personalities[0] != "raid1" {
+		t.Errorf("Unexpected personalities: %v", mdstat.Personalities)
+	}
+	if len(mdstat.Arrays) != 2 {
+		t.Fatalf("Expected 2 arrays, got %d", len(mdstat.Arrays))
+	}
+	md0 := mdstat.Arrays[0]
+	if md0.Name != "md0" || md0.Level != "raid1" || md0.Health != "UU" || md0.Blocks != 976630464 || len(md0.Devices) != 2 {
+		t.Errorf("Unexpected md0: %+v", md0)
+	}
+	if md0.Progress == nil || md0.Progress.Type != "recovery" || md0.Progress.SpeedKPS != 175000 || md0.Progress.ETA != "81.2min" {
+		t.Errorf("Unexpected md0 progress: %+v", md0.Progress)
+	}
+	if md1 := mdstat.Arrays[1]; md1.Health != "UU_" || md1.ActiveDisks != 2 {
+		t.Errorf("Unexpected md1: %+v", md1)
+	}
+}
+
+func TestParseMdStatTruncated(t *testing.T) {
+	mdstat := parseMdStat(strings.NewReader("Personalities : [raid1]\nmd0 : active\n      976630464 blocks [2/2] [UU]\n"), nil)
+	if len(mdstat.Arrays) != 0 {
+		t.Errorf("Expected the truncated array line to be skipped, got %+v", mdstat.Arrays)
+	}
+}
+
+func FuzzParseMdStat(f *testing.F) {
+	f.Add(testMdStat)
+	f.Add("md0 : active\n")
+	f.Add(" : \n[UU]\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		parseMdStat(strings.NewReader(content), map[string]uint64{})
+	})
+}
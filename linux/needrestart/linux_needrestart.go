@@ -9,6 +9,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -20,6 +21,16 @@ type NeedRestart struct {
 	Containers     map[string][]string `json:"containers"`
 }
 
+// SuggestedAction is an action derived from the needrestart results that the
+// API can offer as a one-click job.
+type SuggestedAction struct {
+	Action  string `json:"action"`   // "reboot", "restart_service" or "restart_container"
+	Target  string `json:"target"`   // Service or container runtime, empty for reboot
+	Reason  string `json:"reason"`   // Human readable explanation
+	JobType string `json:"job_type"` // Job type that performs the action
+	JobData string `json:"job_data"` // Job data that performs the action
+}
+
 func GetNeedRestart() (needRestart NeedRestart) {
 	flag.Parse()
 
@@ -139,3 +150,53 @@ func buildResult() NeedRestart {
 	}
 	return res
 }
+
+// Suggestions translates needrestart results into suggested actions.
+// A pending kernel update results in a reboot suggestion, services using
+// deleted files result in service restart suggestions.
+//
+// Parameters:
+//   - needRestart: The needrestart results
+//
+// Returns:
+//   - []SuggestedAction: The suggested actions, sorted by target
+func Suggestions(needRestart NeedRestart) []SuggestedAction {
+	suggestions := []SuggestedAction{}
+	if needRestart.RebootRequired {
+		suggestions = append(suggestions, SuggestedAction{
+			Action:  "reboot",
+			Reason:  "a newer kernel is installed than the running kernel",
+			JobType: "reboot",
+		})
+	}
+
+	services := make([]string, 0, len(needRestart.Services))
+	for svc := range needRestart.Services {
+		services = append(services, svc)
+	}
+	sort.Strings(services)
+	for _, svc := range services {
+		suggestions = append(suggestions, SuggestedAction{
+			Action:  "restart_service",
+			Target:  svc,
+			Reason:  fmt.Sprintf("uses %d deleted file(s), e.g. %s", len(needRestart.Services[svc]), needRestart.Services[svc][0]),
+			JobType: "command",
+			JobData: "systemctl restart " + svc + ".service",
+		})
+	}
+
+	containers := make([]string, 0, len(needRestart.Containers))
+	for ctr := range needRestart.Containers {
+		containers = append(containers, ctr)
+	}
+	sort.Strings(containers)
+	for _, ctr := range containers {
+		// Containers are managed by their runtime, so there is no job that restarts them
+		suggestions = append(suggestions, SuggestedAction{
+			Action: "restart_container",
+			Target: ctr,
+			Reason: fmt.Sprintf("%s containers use %d deleted file(s)", ctr, len(needRestart.Containers[ctr])),
+		})
+	}
+	return suggestions
+}
@@ -0,0 +1,33 @@
+package linux_needrestart
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestions(t *testing.T) {
+	needRestart := NeedRestart{
+		RebootRequired: true,
+		Services: map[string][]string{
+			"sshd":  {"/usr/lib64/libcrypto.so.3"},
+			"nginx": {"/usr/lib64/libssl.so.3", "/usr/lib64/libcrypto.so.3"},
+		},
+		Containers: map[string][]string{
+			"docker": {"/usr/lib/libc.so.6"},
+		},
+	}
+	expected := []SuggestedAction{
+		{Action: "reboot", Reason: "a newer kernel is installed than the running kernel", JobType: "reboot"},
+		{Action: "restart_service", Target: "nginx", Reason: "uses 2 deleted file(s), e.g. /usr/lib64/libssl.so.3", JobType: "command", JobData: "systemctl restart nginx.service"},
+		{Action: "restart_service", Target: "sshd", Reason: "uses 1 deleted file(s), e.g. /usr/lib64/libcrypto.so.3", JobType: "command", JobData: "systemctl restart sshd.service"},
+		{Action: "restart_container", Target: "docker", Reason: "docker containers use 1 deleted file(s)"},
+	}
+	result := Suggestions(needRestart)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+
+	if result := Suggestions(NeedRestart{}); len(result) != 0 {
+		t.Errorf("Expected no suggestions, got %+v", result)
+	}
+}
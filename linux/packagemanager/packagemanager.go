@@ -1,6 +1,7 @@
 package linux_packagemanager
 
 import (
+	"cloud-guardian/linux"
 	linux_debian_apt "cloud-guardian/linux_debian/apt"
 	linux_redhat_dnf "cloud-guardian/linux_redhat/dnf"
 	"fmt"
@@ -34,11 +35,13 @@ type Package struct {
 
 // PackageManager interface to abstract package manager operations
 type PackageManager interface {
-	UpdateAllPackages() (string, string, error)
-	UpdatePackages(packages []string) (string, string, error)
+	UpdateAllPackages(live linux.LiveOutput) (string, string, error) // live receives the output while the update runs
+	UpdatePackages(packages []string, live linux.LiveOutput) (string, string, error)
 	InstallPackages(packages []string) (string, string, error)
 	GetInstalledPackages() ([]Package, error)
+	GetOrphanedPackages() ([]Package, error) // Installed packages not available from any configured repository
 	CheckUpdates(updatetype UpdateType) ([]Package, error)
+	EstimateUpdateSize(packages []string) (int64, int64, error) // Download and installed size in bytes
 }
 
 func DetectPackageManager() (PackageManager, error) {
@@ -55,15 +58,32 @@ func DetectPackageManager() (PackageManager, error) {
 	return nil, fmt.Errorf("no supported package manager found")
 }
 
+// Name returns the name of a package manager, e.g. to key state by package manager.
+//
+// Parameters:
+//   - packageManager: A package manager of DetectPackageManager
+//
+// Returns:
+//   - string: "dnf", "apt" or "unknown"
+func Name(packageManager PackageManager) string {
+	switch packageManager.(type) {
+	case *Dnf:
+		return "dnf"
+	case *Apt:
+		return "apt"
+	}
+	return "unknown"
+}
+
 // DNF Manager implementation
 type Dnf struct{}
 
-func (dnf *Dnf) UpdateAllPackages() (string, string, error) {
-	return linux_redhat_dnf.UpdateAllPackages()
+func (dnf *Dnf) UpdateAllPackages(live linux.LiveOutput) (string, string, error) {
+	return linux_redhat_dnf.UpdateAllPackages(live)
 }
 
-func (dnf *Dnf) UpdatePackages(packages []string) (string, string, error) {
-	return linux_redhat_dnf.UpdatePackages(packages)
+func (dnf *Dnf) UpdatePackages(packages []string, live linux.LiveOutput) (string, string, error) {
+	return linux_redhat_dnf.UpdatePackages(packages, live)
 }
 
 func (dnf *Dnf) InstallPackages(packages []string) (string, string, error) {
@@ -87,6 +107,23 @@ func (dnf *Dnf) GetInstalledPackages() ([]Package, error) {
 	return result, nil
 }
 
+func (dnf *Dnf) GetOrphanedPackages() ([]Package, error) {
+	packages, err := linux_redhat_dnf.GetOrphanedPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Package, len(packages))
+	for i, pkg := range packages {
+		result[i] = Package{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Repo:    pkg.Repo,
+		}
+	}
+	return result, nil
+}
+
 func (dnf *Dnf) CheckUpdates(updateType UpdateType) ([]Package, error) {
 	updates, err := linux_redhat_dnf.CheckUpdates(linux_redhat_dnf.UpdateType(updateType))
 	if err != nil {
@@ -105,21 +142,29 @@ func (dnf *Dnf) CheckUpdates(updateType UpdateType) ([]Package, error) {
 	return updatesResult, nil
 }
 
+func (dnf *Dnf) EstimateUpdateSize(packages []string) (int64, int64, error) {
+	return linux_redhat_dnf.EstimateUpdateSize(packages)
+}
+
 // APT Manager implementation
 type Apt struct{}
 
-func (apt *Apt) UpdateAllPackages() (string, string, error) {
-	return linux_debian_apt.UpdateAllPackages()
+func (apt *Apt) UpdateAllPackages(live linux.LiveOutput) (string, string, error) {
+	return linux_debian_apt.UpdateAllPackages(live)
 }
 
-func (apt *Apt) UpdatePackages(packages []string) (string, string, error) {
-	return linux_debian_apt.UpdatePackages(packages)
+func (apt *Apt) UpdatePackages(packages []string, live linux.LiveOutput) (string, string, error) {
+	return linux_debian_apt.UpdatePackages(packages, live)
 }
 
 func (apt *Apt) InstallPackages(packages []string) (string, string, error) {
 	return linux_debian_apt.InstallPackages(packages)
 }
 
+func (apt *Apt) EstimateUpdateSize(packages []string) (int64, int64, error) {
+	return linux_debian_apt.EstimateUpdateSize(packages)
+}
+
 func (apt *Apt) GetInstalledPackages() ([]Package, error) {
 	packages, err := linux_debian_apt.GetInstalledPackages()
 	if err != nil {
@@ -137,6 +182,23 @@ func (apt *Apt) GetInstalledPackages() ([]Package, error) {
 	return result, nil
 }
 
+func (apt *Apt) GetOrphanedPackages() ([]Package, error) {
+	packages, err := linux_debian_apt.GetOrphanedPackages()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Package, len(packages))
+	for i, pkg := range packages {
+		result[i] = Package{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Repo:    pkg.Repo,
+		}
+	}
+	return result, nil
+}
+
 func (apt *Apt) CheckUpdates(updateType UpdateType) ([]Package, error) {
 	linux_debian_apt.AptUpdate() // Ensure apt is updated before checking for updates
 
@@ -0,0 +1,268 @@
+// Package linux_pmhealth detects package manager processes that are defunct or running
+// for a long time, lock files that block the package manager and stale package
+// metadata, so hosts where updates never complete can be diagnosed remotely.
+package linux_pmhealth
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is the kernel clock tick rate (USER_HZ), used by /proc/<pid>/stat
+const clockTicks = 100
+
+// StuckAfterSeconds is the runtime after which a package manager process is reported as stuck
+var StuckAfterSeconds int64 = 3 * 60 * 60
+
+// ProcessNames are the process names (as in /proc/<pid>/comm, at most 15 characters) of package managers
+var ProcessNames = []string{"apt", "apt-get", "aptitude", "dpkg", "unattended-upgr", "dnf", "yum", "rpm", "packagekitd", "dnf-automatic"}
+
+// FcntlLockPaths are lock files that are locked with fcntl while the package manager runs
+var FcntlLockPaths = []string{
+	"/var/lib/dpkg/lock",
+	"/var/lib/dpkg/lock-frontend",
+	"/var/lib/apt/lists/lock",
+	"/var/cache/apt/archives/lock",
+}
+
+// PidLockPaths are lock files that contain the PID of the running package manager
+var PidLockPaths = []string{
+	"/var/run/yum.pid",
+	"/var/cache/dnf/metadata_lock.pid",
+	"/var/lib/dnf/rpmdb_lock.pid",
+	"/var/log/log_lock.pid",
+}
+
+// MetadataPaths are glob patterns of the repository metadata files of apt, dnf, dnf5
+// and yum. Their modification time is the time the repository was last refreshed.
+var MetadataPaths = []string{
+	"/var/lib/apt/lists/*Release",
+	"/var/cache/dnf/*/repodata/repomd.xml",
+	"/var/cache/libdnf5/*/repodata/repomd.xml",
+	"/var/cache/yum/*/*/*/repomd.xml",
+}
+
+// StaleMetadataAfterSeconds is the metadata age after which the metadata is reported as stale
+var StaleMetadataAfterSeconds int64 = 7 * 24 * 60 * 60
+
+// ProcPath contains the default path to the proc filesystem
+var ProcPath = "/proc"
+
+type Process struct {
+	Pid            int    `json:"pid"`
+	Name           string `json:"name"`
+	State          string `json:"state"` // Process state, e.g. "S", "D" or "Z"
+	ElapsedSeconds int64  `json:"elapsed_seconds"`
+	Defunct        bool   `json:"defunct"` // Zombie process that was not reaped by its parent
+	Stuck          bool   `json:"stuck"`   // Running longer than StuckAfterSeconds
+}
+
+type LockFile struct {
+	Path      string `json:"path"`
+	HolderPid int    `json:"holder_pid,omitempty"` // Process holding the lock, 0 if not held
+	Stale     bool   `json:"stale"`                // PID lock file of a process that no longer exists
+}
+
+// Metadata is the age of the repository metadata, so "no updates available" can be
+// told apart from metadata that was not refreshed for weeks, e.g. because of a broken proxy
+type Metadata struct {
+	RefreshedAt       string `json:"refreshed_at,omitempty"`        // Latest refresh of a repository, RFC 3339, empty if unknown
+	OldestRefreshedAt string `json:"oldest_refreshed_at,omitempty"` // Refresh of the repository with the oldest metadata, RFC 3339
+	AgeSeconds        int64  `json:"age_seconds"`                   // Seconds since the latest refresh, -1 if unknown
+	Stale             bool   `json:"stale"`                         // The latest refresh is older than StaleMetadataAfterSeconds
+}
+
+type Health struct {
+	Processes []Process  `json:"processes"`
+	Locks     []LockFile `json:"locks"`
+	Metadata  Metadata   `json:"metadata"`
+	Problems  []string   `json:"problems"` // Human readable descriptions of defunct, stuck and stale entries
+}
+
+// Check collects the package manager processes and lock files.
+//
+// Returns:
+//   - Health: The processes, locks held or stale, and the detected problems
+func Check() Health {
+	health := Health{Processes: []Process{}, Locks: []LockFile{}, Problems: []string{}}
+	uptime := systemUptime()
+
+	stats, _ := filepath.Glob(filepath.Join(ProcPath, "[0-9]*", "stat"))
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // The process exited
+		}
+		process, err := parseProcStat(string(data), uptime)
+		if err != nil || !isPackageManager(process.Name) {
+			continue
+		}
+		health.Processes = append(health.Processes, process)
+		if process.Defunct {
+			health.Problems = append(health.Problems, fmt.Sprintf("%s (pid %d) is defunct", process.Name, process.Pid))
+		} else if process.Stuck {
+			health.Problems = append(health.Problems, fmt.Sprintf("%s (pid %d) is running for %d minutes", process.Name, process.Pid, process.ElapsedSeconds/60))
+		}
+	}
+
+	for _, path := range FcntlLockPaths {
+		if pid := fcntlLockHolder(path); pid > 0 {
+			health.Locks = append(health.Locks, LockFile{Path: path, HolderPid: pid})
+		}
+	}
+	for _, path := range PidLockPaths {
+		lock, ok := checkPidLock(path)
+		if !ok {
+			continue
+		}
+		health.Locks = append(health.Locks, lock)
+		if lock.Stale {
+			health.Problems = append(health.Problems, fmt.Sprintf("stale lock file %s of pid %d", lock.Path, lock.HolderPid))
+		}
+	}
+
+	health.Metadata = checkMetadata(time.Now())
+	if health.Metadata.Stale {
+		health.Problems = append(health.Problems, fmt.Sprintf("package metadata was last refreshed %d days ago", health.Metadata.AgeSeconds/(24*60*60)))
+	}
+	return health
+}
+
+// checkMetadata determines when the repository metadata was refreshed from the
+// modification times of the files matching MetadataPaths.
+//
+// Parameters:
+//   - now: The current time
+//
+// Returns:
+//   - Metadata: The refresh times and the age of the metadata
+func checkMetadata(now time.Time) Metadata {
+	var newest, oldest time.Time
+	for _, pattern := range MetadataPaths {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			modified := info.ModTime()
+			if newest.IsZero() || modified.After(newest) {
+				newest = modified
+			}
+			if oldest.IsZero() || modified.Before(oldest) {
+				oldest = modified
+			}
+		}
+	}
+	if newest.IsZero() {
+		return Metadata{AgeSeconds: -1}
+	}
+	age := max(int64(now.Sub(newest).Seconds()), 0)
+	return Metadata{
+		RefreshedAt:       newest.UTC().Format(time.RFC3339),
+		OldestRefreshedAt: oldest.UTC().Format(time.RFC3339),
+		AgeSeconds:        age,
+		Stale:             age > StaleMetadataAfterSeconds,
+	}
+}
+
+func isPackageManager(name string) bool {
+	for _, processName := range ProcessNames {
+		if name == processName {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProcStat parses /proc/<pid>/stat of a process.
+//
+// Parameters:
+//   - stat: The content of /proc/<pid>/stat
+//   - uptime: The system uptime in seconds, used to compute the process runtime
+//
+// Returns:
+//   - Process: The parsed process
+//   - error: An error if the content has an unexpected format
+func parseProcStat(stat string, uptime int64) (Process, error) {
+	// The process name is in parentheses and may contain spaces and parentheses itself
+	open := strings.Index(stat, "(")
+	close := strings.LastIndex(stat, ")")
+	if open < 0 || close < open {
+		return Process{}, fmt.Errorf("invalid stat format")
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(stat[:open]))
+	if err != nil {
+		return Process{}, fmt.Errorf("invalid pid: %w", err)
+	}
+	fields := strings.Fields(stat[close+1:])
+	if len(fields) < 20 {
+		return Process{}, fmt.Errorf("invalid stat format")
+	}
+	startTicks, err := strconv.ParseInt(fields[19], 10, 64) // Field 22: start time after boot
+	if err != nil {
+		return Process{}, fmt.Errorf("invalid start time: %w", err)
+	}
+	process := Process{
+		Pid:            pid,
+		Name:           stat[open+1 : close],
+		State:          fields[0],
+		ElapsedSeconds: max(uptime-startTicks/clockTicks, 0),
+	}
+	process.Defunct = process.State == "Z"
+	process.Stuck = process.ElapsedSeconds > StuckAfterSeconds
+	return process, nil
+}
+
+// checkPidLock reads a PID lock file and checks whether its process still exists.
+//
+// Returns:
+//   - LockFile: The lock file
+//   - bool: false if the lock file does not exist or is invalid
+func checkPidLock(path string) (LockFile, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return LockFile{}, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return LockFile{}, false
+	}
+	_, err = os.Stat(filepath.Join(ProcPath, strconv.Itoa(pid)))
+	return LockFile{Path: path, HolderPid: pid, Stale: os.IsNotExist(err)}, true
+}
+
+// fcntlLockHolder returns the PID of the process holding a write lock on the file, 0 if it is not locked.
+func fcntlLockHolder(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	if err := syscall.FcntlFlock(file.Fd(), syscall.F_GETLK, &lock); err != nil {
+		return 0
+	}
+	if lock.Type == syscall.F_UNLCK {
+		return 0
+	}
+	return int(lock.Pid)
+}
+
+func systemUptime() int64 {
+	data, err := os.ReadFile(filepath.Join(ProcPath, "uptime"))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	return int64(uptime)
+}
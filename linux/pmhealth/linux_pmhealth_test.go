@@ -0,0 +1,89 @@
+package linux_pmhealth
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testStatUnattendedUpgrade = `812 (unattended-upgr) S 1 812 812 0 -1 4194560 44716 0 160 0 361 71 0 0 20 0 2 0 150000 121389056 24118 18446744073709551615 1 1 0 0 0 0 0 4096 2 0 0 0 17 1 0 0 0 0 0`
+
+const testStatZombie = `4242 (dpkg) Z 812 812 812 0 -1 4227148 0 0 0 0 0 0 0 0 20 0 1 0 1000000 0 0 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0`
+
+func TestParseProcStat(t *testing.T) {
+	process, err := parseProcStat(testStatUnattendedUpgrade, 20000)
+	if err != nil {
+		t.Fatalf("parseProcStat() error: %v", err)
+	}
+	expected := Process{Pid: 812, Name: "unattended-upgr", State: "S", ElapsedSeconds: 18500, Stuck: true}
+	if process != expected {
+		t.Errorf("Expected %+v, got %+v", expected, process)
+	}
+
+	process, err = parseProcStat(testStatZombie, 10100)
+	if err != nil {
+		t.Fatalf("parseProcStat() error: %v", err)
+	}
+	if !process.Defunct || process.Stuck || process.ElapsedSeconds != 100 {
+		t.Errorf("Unexpected zombie process: %+v", process)
+	}
+
+	if _, err := parseProcStat("invalid", 0); err == nil {
+		t.Errorf("Expected an error for invalid stat content")
+	}
+}
+
+func TestCheckPidLock(t *testing.T) {
+	dir := t.TempDir()
+	running := filepath.Join(dir, "running.pid")
+	stale := filepath.Join(dir, "stale.pid")
+	os.WriteFile(running, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	os.WriteFile(stale, []byte("99999999\n"), 0644)
+
+	if lock, ok := checkPidLock(running); !ok || lock.Stale {
+		t.Errorf("Expected a held lock, got %+v", lock)
+	}
+	if lock, ok := checkPidLock(stale); !ok || !lock.Stale {
+		t.Errorf("Expected a stale lock, got %+v", lock)
+	}
+	if _, ok := checkPidLock(filepath.Join(dir, "missing.pid")); ok {
+		t.Errorf("Expected a missing lock file to be skipped")
+	}
+}
+
+func TestCheckMetadata(t *testing.T) {
+	defer func(paths []string) { MetadataPaths = paths }(MetadataPaths)
+	dir := t.TempDir()
+	MetadataPaths = []string{filepath.Join(dir, "*Release")}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if metadata := checkMetadata(now); metadata.AgeSeconds != -1 || metadata.Stale {
+		t.Errorf("Expected unknown metadata without files, got %+v", metadata)
+	}
+
+	files := map[string]time.Time{
+		"deb.debian.org_debian_dists_bookworm_InRelease":         now.Add(-10 * 24 * time.Hour),
+		"security.debian.org_dists_bookworm-security_InRelease":  now.Add(-9 * 24 * time.Hour),
+		"deb.debian.org_debian_dists_bookworm_main_binary-amd64": now, // Not a Release file
+	}
+	for name, modified := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := Metadata{
+		RefreshedAt:       "2024-02-21T12:00:00Z",
+		OldestRefreshedAt: "2024-02-20T12:00:00Z",
+		AgeSeconds:        9 * 24 * 60 * 60,
+		Stale:             true,
+	}
+	if metadata := checkMetadata(now); metadata != expected {
+		t.Errorf("Expected %+v, got %+v", expected, metadata)
+	}
+}
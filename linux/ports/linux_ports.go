@@ -0,0 +1,194 @@
+package linux_ports
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListenState is the state of a listening socket in /proc/net/tcp
+const tcpListenState = "0A"
+
+// ProcNetTcpPaths contains the kernel socket tables that are scanned for listening sockets
+var ProcNetTcpPaths = []string{"/proc/net/tcp", "/proc/net/tcp6"}
+
+type ListeningPort struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Uid     int    `json:"uid"`
+	Inode   string `json:"inode"`
+	Process string `json:"process,omitempty"` // Name of the owning process, if it could be determined
+	Pid     int    `json:"pid,omitempty"`
+}
+
+// GetListeningPorts retrieves all listening TCP sockets from /proc/net/tcp and /proc/net/tcp6
+// and tries to resolve the process that owns each socket.
+//
+// Returns:
+//   - []ListeningPort: A slice of listening sockets
+//   - error: Any error that occurred while reading the socket tables
+func GetListeningPorts() ([]ListeningPort, error) {
+	ports := []ListeningPort{}
+	for _, path := range ProcNetTcpPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // IPv6 may be disabled
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		ports = append(ports, parseProcNetTcp(string(data))...)
+	}
+
+	owners := socketOwners()
+	for i := range ports {
+		if owner, ok := owners[ports[i].Inode]; ok {
+			ports[i].Pid = owner.pid
+			ports[i].Process = owner.name
+		}
+	}
+	return ports, nil
+}
+
+// FindPortOwner returns the listening socket that occupies the given port, if any.
+//
+// Parameters:
+//   - port: The TCP port to look up
+//
+// Returns:
+//   - *ListeningPort: The listening socket using the port, or nil if the port is free
+func FindPortOwner(port int) *ListeningPort {
+	ports, err := GetListeningPorts()
+	if err != nil {
+		return nil
+	}
+	for _, p := range ports {
+		if p.Port == port {
+			return &p
+		}
+	}
+	return nil
+}
+
+// ListenWithFallback binds a TCP listener on the first free port of the given candidates.
+// Ports already used by another service are skipped and the conflict is logged with the
+// owning process, so a local endpoint of the agent never breaks an existing service.
+//
+// Parameters:
+//   - host: The address to bind to, e.g. "127.0.0.1"
+//   - ports: Candidate ports in order of preference
+//
+// Returns:
+//   - net.Listener: The bound listener
+//   - error: An error describing all conflicts if no candidate port could be bound
+func ListenWithFallback(host string, ports []int) (net.Listener, error) {
+	var conflicts []string
+	for _, port := range ports {
+		if owner := FindPortOwner(port); owner != nil {
+			conflicts = append(conflicts, describeConflict(port, owner))
+			log.Println("Port conflict:", conflicts[len(conflicts)-1])
+			continue
+		}
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("port %d: %s", port, err.Error()))
+			log.Println("Port conflict:", conflicts[len(conflicts)-1])
+			continue
+		}
+		return listener, nil
+	}
+	return nil, fmt.Errorf("no free port available: %s", strings.Join(conflicts, "; "))
+}
+
+// describeConflict returns a human readable description of a port conflict.
+func describeConflict(port int, owner *ListeningPort) string {
+	if owner.Process != "" {
+		return fmt.Sprintf("port %d is already used by %s (pid %d)", port, owner.Process, owner.Pid)
+	}
+	return fmt.Sprintf("port %d is already used by uid %d", port, owner.Uid)
+}
+
+// parseProcNetTcp parses the content of /proc/net/tcp or /proc/net/tcp6 and
+// returns the sockets in the listening state.
+//
+// Parameters:
+//   - output: The raw content of the socket table
+//
+// Returns:
+//   - []ListeningPort: A slice of listening sockets
+func parseProcNetTcp(output string) []ListeningPort {
+	ports := []ListeningPort{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[0] == "sl" {
+			continue // Skip header and malformed lines
+		}
+		if fields[3] != tcpListenState {
+			continue
+		}
+		addrPort := strings.Split(fields[1], ":")
+		if len(addrPort) != 2 {
+			continue
+		}
+		port, err := strconv.ParseInt(addrPort[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		uid, _ := strconv.Atoi(fields[7])
+		ports = append(ports, ListeningPort{
+			Address: parseHexAddress(addrPort[0]),
+			Port:    int(port),
+			Uid:     uid,
+			Inode:   fields[9],
+		})
+	}
+	return ports
+}
+
+// parseHexAddress converts an address from the kernel socket table into its string form.
+// Addresses are stored as 32-bit words in host (little-endian) byte order.
+func parseHexAddress(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return ""
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return ip.String()
+}
+
+type socketOwner struct {
+	pid  int
+	name string
+}
+
+// socketOwners maps socket inodes to the processes holding them by scanning /proc/<pid>/fd.
+// Without root privileges only the agent's own processes can be resolved.
+func socketOwners() map[string]socketOwner {
+	owners := map[string]socketOwner{}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		target, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(target, "socket:[") {
+			continue
+		}
+		inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+		if _, ok := owners[inode]; ok {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.Split(fd, "/")[2])
+		if err != nil {
+			continue
+		}
+		comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		owners[inode] = socketOwner{pid: pid, name: strings.TrimSpace(string(comm))}
+	}
+	return owners
+}
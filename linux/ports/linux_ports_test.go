@@ -0,0 +1,37 @@
+package linux_ports
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testProcNetTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 21714 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0CEA 00000000:0000 0A 00000000:00000000 00:00000000 00000000   999        0 31337 1 0000000000000000 100 0 0 10 0
+   2: 0F02000A:0016 0202000A:C5B4 01 00000000:00000000 02:0008F0A2 00000000     0        0 41234 2 0000000000000000 20 4 31 10 -1
+`
+
+const testProcNetTcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 51234 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseProcNetTcp(t *testing.T) {
+	expected := []ListeningPort{
+		{Address: "0.0.0.0", Port: 22, Uid: 0, Inode: "21714"},
+		{Address: "127.0.0.1", Port: 3306, Uid: 999, Inode: "31337"},
+	}
+	result := parseProcNetTcp(testProcNetTcp)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseProcNetTcp6(t *testing.T) {
+	expected := []ListeningPort{
+		{Address: "::1", Port: 80, Uid: 0, Inode: "51234"},
+	}
+	result := parseProcNetTcp(testProcNetTcp6)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
@@ -0,0 +1,162 @@
+// Package linux_power reports the AC and battery state of laptops and edge devices and
+// the state of UPSes monitored by NUT, so power events at remote sites are visible.
+package linux_power
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud-guardian/linux"
+)
+
+// SysfsPath contains the default path to the power supplies exported by the kernel
+var SysfsPath = "/sys/class/power_supply"
+
+// upscTimeout limits upsc, which waits for an unreachable upsd
+const upscTimeout = 5 * time.Second
+
+type Supply struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`               // Mains, Battery or UPS
+	Online   bool   `json:"online"`             // A mains adapter is connected
+	Status   string `json:"status,omitempty"`   // Battery status, e.g. Charging, Discharging or Full
+	Capacity int    `json:"capacity,omitempty"` // Battery charge in percent
+}
+
+type Ups struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`                   // NUT status flags, e.g. "OL" or "OB LB"
+	BatteryCharge int    `json:"battery_charge,omitempty"` // Battery charge in percent
+	Runtime       int    `json:"runtime,omitempty"`        // Remaining battery runtime in seconds
+}
+
+type Power struct {
+	OnBattery bool     `json:"on_battery"` // The host or its UPS runs on battery
+	Supplies  []Supply `json:"supplies"`
+	Ups       []Ups    `json:"ups"`
+}
+
+// GetPower reads the power supplies from sysfs and the UPSes from upsc, if NUT is installed.
+//
+// Returns:
+//   - Power: The power state of the host
+func GetPower() Power {
+	power := Power{Supplies: getSupplies(), Ups: getUps()}
+	power.OnBattery = onBattery(power)
+	return power
+}
+
+func getSupplies() []Supply {
+	supplies := []Supply{}
+	entries, err := os.ReadDir(SysfsPath)
+	if err != nil {
+		return supplies
+	}
+	for _, entry := range entries {
+		supply := Supply{
+			Name:   entry.Name(),
+			Type:   readAttribute(entry.Name(), "type"),
+			Online: readAttribute(entry.Name(), "online") == "1",
+			Status: readAttribute(entry.Name(), "status"),
+		}
+		// Peripherals like wireless mice report their batteries too, only the system supplies matter
+		if scope := readAttribute(entry.Name(), "scope"); scope == "Device" {
+			continue
+		}
+		if capacity, err := strconv.Atoi(readAttribute(entry.Name(), "capacity")); err == nil {
+			supply.Capacity = capacity
+		}
+		supplies = append(supplies, supply)
+	}
+	return supplies
+}
+
+func readAttribute(supply, name string) string {
+	data, err := os.ReadFile(filepath.Join(SysfsPath, supply, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func getUps() []Ups {
+	result := []Ups{}
+	names, err := runUpsc("-l")
+	if err != nil {
+		return result
+	}
+	for _, name := range strings.Fields(names) {
+		output, err := runUpsc(name)
+		if err != nil {
+			continue
+		}
+		result = append(result, parseUpsc(name, output))
+	}
+	return result
+}
+
+func runUpsc(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upscTimeout)
+	defer cancel()
+	stdout, _, err := linux.RunCommand(exec.CommandContext(ctx, "upsc", args...))
+	return stdout, err
+}
+
+// parseUpsc parses the variables of a UPS as printed by upsc.
+//
+// Parameters:
+//   - name: The name of the UPS
+//   - output: The output of upsc for the UPS
+//
+// Returns:
+//   - Ups: The state of the UPS
+func parseUpsc(name, output string) Ups {
+	ups := Ups{Name: name}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "ups.status":
+			ups.Status = value
+		case "battery.charge":
+			if charge, err := strconv.ParseFloat(value, 64); err == nil {
+				ups.BatteryCharge = int(charge)
+			}
+		case "battery.runtime":
+			if runtime, err := strconv.ParseFloat(value, 64); err == nil {
+				ups.Runtime = int(runtime)
+			}
+		}
+	}
+	return ups
+}
+
+// onBattery reports whether the host runs on battery: a battery discharges while
+// no mains adapter is online, or a UPS reports the OB (on battery) status.
+func onBattery(power Power) bool {
+	for _, ups := range power.Ups {
+		for _, flag := range strings.Fields(ups.Status) {
+			if flag == "OB" {
+				return true
+			}
+		}
+	}
+	mainsOnline, discharging := false, false
+	for _, supply := range power.Supplies {
+		switch supply.Type {
+		case "Mains":
+			mainsOnline = mainsOnline || supply.Online
+		case "Battery", "UPS":
+			discharging = discharging || supply.Status == "Discharging"
+		}
+	}
+	return discharging && !mainsOnline
+}
@@ -0,0 +1,55 @@
+package linux_power
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testUpsc = `battery.charge: 87
+battery.runtime: 1520
+device.mfr: EATON
+ups.status: OB DISCHRG
+Init SSL without certificate database
+`
+
+func TestParseUpsc(t *testing.T) {
+	ups := parseUpsc("eaton", testUpsc)
+	if ups.Status != "OB DISCHRG" || ups.BatteryCharge != 87 || ups.Runtime != 1520 {
+		t.Errorf("Unexpected UPS state: %+v", ups)
+	}
+	if !onBattery(Power{Ups: []Ups{ups}}) {
+		t.Errorf("Expected the host to run on battery")
+	}
+}
+
+func TestGetSupplies(t *testing.T) {
+	SysfsPath = t.TempDir()
+	defer func() { SysfsPath = "/sys/class/power_supply" }()
+	for supply, attributes := range map[string]map[string]string{
+		"AC":              {"type": "Mains\n", "online": "0\n"},
+		"BAT0":            {"type": "Battery\n", "status": "Discharging\n", "capacity": "64\n"},
+		"hidpp_battery_0": {"type": "Battery\n", "scope": "Device\n", "status": "Discharging\n"},
+	} {
+		if err := os.MkdirAll(filepath.Join(SysfsPath, supply), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range attributes {
+			if err := os.WriteFile(filepath.Join(SysfsPath, supply, name), []byte(value), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	supplies := getSupplies()
+	if len(supplies) != 2 {
+		t.Fatalf("Expected 2 system supplies, got %+v", supplies)
+	}
+	if !onBattery(Power{Supplies: supplies}) {
+		t.Errorf("Expected the host to run on battery")
+	}
+	supplies[0].Online = true // AC
+	if onBattery(Power{Supplies: supplies}) {
+		t.Errorf("Expected the host to run on mains")
+	}
+}
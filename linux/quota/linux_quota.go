@@ -0,0 +1,162 @@
+package linux_quota
+
+import (
+	"cloud-guardian/linux"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MountsPath is the mount table, the mount options show which quotas are enabled
+var MountsPath = "/proc/self/mounts"
+
+// quotaOptions map the mount options of ext4 and XFS to the quota types they enable.
+// The noenforce options of XFS only account the usage, the limits are not enforced.
+var quotaOptions = map[string]string{
+	"quota": "user", "usrquota": "user", "uquota": "user", "uqnoenforce": "user", "usrjquota": "user",
+	"grpquota": "group", "gquota": "group", "gqnoenforce": "group", "grpjquota": "group",
+	"prjquota": "project", "pquota": "project", "pqnoenforce": "project",
+}
+
+// repquotaTypes are the repquota flags of the quota types
+var repquotaTypes = map[string]string{"user": "-u", "group": "-g", "project": "-P"}
+
+// Quotas is the quota usage of the filesystems with quotas
+type Quotas struct {
+	Filesystems []Filesystem `json:"filesystems"` // Filesystems with quotas enabled
+	Usage       []Usage      `json:"usage"`       // Users, groups and projects with a limit or over a limit
+	Error       string       `json:"error,omitempty"`
+}
+
+// Filesystem is a filesystem with quotas enabled
+type Filesystem struct {
+	Device string   `json:"device"`
+	Mount  string   `json:"mount"`
+	FSType string   `json:"fstype"`
+	Types  []string `json:"types"` // user, group and/or project
+}
+
+// Usage is the quota usage of a user, group or project on a filesystem
+type Usage struct {
+	Mount            string `json:"mount"`
+	Type             string `json:"type"` // user, group or project
+	Id               string `json:"id"`   // Numeric user, group or project ID
+	BlockUsedBytes   int64  `json:"block_used_bytes"`
+	BlockSoftBytes   int64  `json:"block_soft_bytes"` // 0 if there is no limit
+	BlockHardBytes   int64  `json:"block_hard_bytes"` // 0 if there is no limit
+	FilesUsed        int64  `json:"files_used"`
+	FilesSoft        int64  `json:"files_soft"`
+	FilesHard        int64  `json:"files_hard"`
+	OverQuota        bool   `json:"over_quota"`              // Over a soft limit
+	HardLimitReached bool   `json:"hard_limit_reached"`      // Writes fail with "Disk quota exceeded"
+	GraceExpires     string `json:"grace_expires,omitempty"` // End of the grace period over a soft limit, RFC 3339
+}
+
+// GetQuotas reports the quota usage of the filesystems with quotas enabled. Quotas
+// cause "disk full" errors on filesystems with free space, which df does not explain.
+// Only users, groups and projects with a limit are reported.
+//
+// Returns:
+//   - Quotas: The filesystems with quotas and their usage, empty if no quotas are enabled
+func GetQuotas() Quotas {
+	quotas := Quotas{Filesystems: []Filesystem{}, Usage: []Usage{}}
+	data, err := os.ReadFile(MountsPath)
+	if err != nil {
+		quotas.Error = err.Error()
+		return quotas
+	}
+	quotas.Filesystems = parseQuotaMounts(string(data))
+	if len(quotas.Filesystems) == 0 {
+		return quotas
+	}
+	if !linux.CommandAvailable("repquota") {
+		quotas.Error = "repquota not found, install the quota package to report the usage"
+		return quotas
+	}
+	for _, filesystem := range quotas.Filesystems {
+		for _, quotaType := range filesystem.Types {
+			command := exec.Command("repquota", "-n", "-p", repquotaTypes[quotaType], filesystem.Mount)
+			out, stdErr, err := linux.RunCommand(command)
+			if err != nil {
+				quotas.Error = strings.TrimSpace(filesystem.Mount + ": " + stdErr + " " + err.Error())
+				continue
+			}
+			quotas.Usage = append(quotas.Usage, parseRepquota(out, filesystem.Mount, quotaType)...)
+		}
+	}
+	return quotas
+}
+
+// parseQuotaMounts returns the filesystems of a mount table with quota mount options
+func parseQuotaMounts(content string) []Filesystem {
+	filesystems := []Filesystem{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		types := []string{}
+		seen := map[string]bool{}
+		for _, option := range strings.Split(fields[3], ",") {
+			name, _, _ := strings.Cut(option, "=") // usrjquota=aquota.user
+			if quotaType, ok := quotaOptions[name]; ok && !seen[quotaType] {
+				seen[quotaType] = true
+				types = append(types, quotaType)
+			}
+		}
+		if len(types) > 0 {
+			filesystems = append(filesystems, Filesystem{Device: fields[0], Mount: linux.UnescapeMountPath(fields[1]), FSType: fields[2], Types: types})
+		}
+	}
+	return filesystems
+}
+
+// parseRepquota parses the output of "repquota -n -p", the block counts are KiB.
+// The raw grace columns of -p are always present, 0 if no grace period runs.
+//
+//	User            used    soft    hard  grace    used  soft  hard  grace
+//	----------------------------------------------------------------------
+//	#1001     +-    1100    1000    2000 1700000000   10     0     0     0
+func parseRepquota(output string, mount string, quotaType string) []Usage {
+	usage := []Usage{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 10 || !strings.HasPrefix(fields[0], "#") || len(fields[1]) != 2 {
+			continue
+		}
+		numbers := make([]int64, 8)
+		var err error
+		for i, field := range fields[2:] {
+			if numbers[i], err = strconv.ParseInt(field, 10, 64); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		entry := Usage{
+			Mount:          mount,
+			Type:           quotaType,
+			Id:             strings.TrimPrefix(fields[0], "#"),
+			BlockUsedBytes: numbers[0] * 1024,
+			BlockSoftBytes: numbers[1] * 1024,
+			BlockHardBytes: numbers[2] * 1024,
+			FilesUsed:      numbers[4],
+			FilesSoft:      numbers[5],
+			FilesHard:      numbers[6],
+			OverQuota:      strings.Contains(fields[1], "+"),
+		}
+		entry.HardLimitReached = (entry.BlockHardBytes > 0 && entry.BlockUsedBytes >= entry.BlockHardBytes) ||
+			(entry.FilesHard > 0 && entry.FilesUsed >= entry.FilesHard)
+		if grace := max(numbers[3], numbers[7]); grace > 0 {
+			entry.GraceExpires = time.Unix(grace, 0).UTC().Format(time.RFC3339)
+		}
+		if entry.BlockSoftBytes == 0 && entry.BlockHardBytes == 0 && entry.FilesSoft == 0 && entry.FilesHard == 0 && !entry.OverQuota {
+			continue // No limits
+		}
+		usage = append(usage, entry)
+	}
+	return usage
+}
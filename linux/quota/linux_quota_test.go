@@ -0,0 +1,61 @@
+package linux_quota
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testMounts = `/dev/sda1 / ext4 rw,relatime,errors=remount-ro 0 0
+/dev/sdb1 /home ext4 rw,relatime,usrjquota=aquota.user,grpjquota=aquota.group,jqfmt=vfsv1 0 0
+/dev/sdc1 /srv/shared\040data xfs rw,relatime,attr2,inode64,usrquota,prjquota 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+`
+
+const testRepquota = `*** Report for user quotas on device /dev/sdb1
+Block grace time: 7days; Inode grace time: 7days
+                        Block limits                File limits
+User            used    soft    hard  grace    used  soft  hard  grace
+----------------------------------------------------------------------
+#0        --   20480       0       0      0       5     0     0      0
+#1001     +-    1100    1000    2000 1700000000  10     0     0      0
+#1002     -+     512       0       0      0     100    50   100 1700003600
+#1003     --     256    1024    4096      0       3     0     0      0
+
+`
+
+func TestParseQuotaMounts(t *testing.T) {
+	expected := []Filesystem{
+		{Device: "/dev/sdb1", Mount: "/home", FSType: "ext4", Types: []string{"user", "group"}},
+		{Device: "/dev/sdc1", Mount: "/srv/shared data", FSType: "xfs", Types: []string{"user", "project"}},
+	}
+	if filesystems := parseQuotaMounts(testMounts); !reflect.DeepEqual(filesystems, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, filesystems)
+	}
+}
+
+func TestParseRepquota(t *testing.T) {
+	expected := []Usage{
+		{Mount: "/home", Type: "user", Id: "1001", BlockUsedBytes: 1100 * 1024, BlockSoftBytes: 1000 * 1024, BlockHardBytes: 2000 * 1024,
+			FilesUsed: 10, OverQuota: true, GraceExpires: "2023-11-14T22:13:20Z"},
+		{Mount: "/home", Type: "user", Id: "1002", BlockUsedBytes: 512 * 1024, FilesUsed: 100, FilesSoft: 50, FilesHard: 100,
+			OverQuota: true, HardLimitReached: true, GraceExpires: "2023-11-14T23:13:20Z"},
+		{Mount: "/home", Type: "user", Id: "1003", BlockUsedBytes: 256 * 1024, BlockSoftBytes: 1024 * 1024, BlockHardBytes: 4096 * 1024, FilesUsed: 3},
+	}
+	if usage := parseRepquota(testRepquota, "/home", "user"); !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestGetQuotasWithoutQuotas(t *testing.T) {
+	MountsPath = filepath.Join(t.TempDir(), "mounts")
+	defer func() { MountsPath = "/proc/self/mounts" }()
+	if err := os.WriteFile(MountsPath, []byte("/dev/sda1 / ext4 rw,relatime 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quotas := GetQuotas()
+	if len(quotas.Filesystems) != 0 || len(quotas.Usage) != 0 || quotas.Error != "" {
+		t.Errorf("Expected no quotas, got %+v", quotas)
+	}
+}
@@ -1,9 +1,218 @@
 package linux_reboot
 
 import (
+	"cmp"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func Reboot() error {
-	return exec.Command("reboot").Run()
+const (
+	MethodAuto      = "auto"        // systemctl if systemd is running, reboot otherwise
+	MethodSystemctl = "systemctl"   // systemctl reboot
+	MethodReboot    = "reboot"      // reboot command
+	MethodKexec     = "kexec"       // Fast reboot into the newest installed kernel, skipping firmware (opt-in)
+	MethodLogind    = "logind"      // Reboot scheduled through the logind D-Bus API
+	MethodSoft      = "soft-reboot" // Userspace-only reboot with systemd v254+, keeps the running kernel (per job)
+)
+
+// minSoftRebootSystemdVersion is the first systemd version with soft-reboot support
+const minSoftRebootSystemdVersion = 254
+
+// MethodEnvVar can be set to override the configured reboot method
+const MethodEnvVar = "CLOUD_GUARDIAN_REBOOT_METHOD"
+
+// modulesDir and bootDir hold the installed kernels, replaced by tests
+var (
+	modulesDir = "/lib/modules"
+	bootDir    = "/boot"
+)
+
+// logindDelay is the delay of a reboot scheduled through logind, so logged in users are notified
+const logindDelay = time.Minute
+
+// ResolveMethod determines the reboot method to use. The environment variable
+// takes precedence over the configured method, "auto" picks a method based on
+// the init system.
+//
+// Parameters:
+//   - configured: The reboot method from the configuration, may be empty
+//
+// Returns:
+//   - string: The reboot method that will be used
+//   - error: An error if the method is unknown
+func ResolveMethod(configured string) (string, error) {
+	method := configured
+	if env := os.Getenv(MethodEnvVar); env != "" {
+		method = env
+	}
+	switch method {
+	case "", MethodAuto:
+		if _, err := os.Stat("/run/systemd/system"); err == nil {
+			return MethodSystemctl, nil
+		}
+		return MethodReboot, nil
+	case MethodSystemctl, MethodReboot, MethodKexec, MethodLogind:
+		return method, nil
+	default:
+		return "", fmt.Errorf("unknown reboot method: %s", method)
+	}
+}
+
+// Reboot reboots the system with the given method, as returned by ResolveMethod.
+//
+// Parameters:
+//   - method: The reboot method
+//
+// Returns:
+//   - error: Any error that occurred while initiating the reboot
+func Reboot(method string) error {
+	switch method {
+	case MethodSystemctl:
+		return exec.Command("systemctl", "reboot").Run()
+	case MethodReboot:
+		return exec.Command("reboot").Run()
+	case MethodSoft:
+		return exec.Command("systemctl", "soft-reboot").Run()
+	case MethodKexec:
+		return kexecReboot()
+	case MethodLogind:
+		// ScheduleShutdown expects the time in microseconds since the epoch
+		when := time.Now().Add(logindDelay).UnixMicro()
+		return exec.Command("busctl", "call", "org.freedesktop.login1", "/org/freedesktop/login1",
+			"org.freedesktop.login1.Manager", "ScheduleShutdown", "st", "reboot", strconv.FormatInt(when, 10)).Run()
+	default:
+		return fmt.Errorf("unknown reboot method: %s", method)
+	}
+}
+
+// kexecReboot loads the newest installed kernel and reboots into it without going
+// through the firmware.
+func kexecReboot() error {
+	kernel, initrd, err := newestKernel()
+	if err != nil {
+		return err
+	}
+	args := []string{"--load", kernel, "--reuse-cmdline"}
+	if initrd != "" {
+		args = append(args, "--initrd="+initrd)
+	}
+	if output, err := exec.Command("kexec", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to load kernel %s: %s", kernel, output)
+	}
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		return exec.Command("systemctl", "kexec").Run()
+	}
+	return exec.Command("kexec", "--exec").Run()
+}
+
+// newestKernel returns the kernel image and initrd of the newest installed kernel.
+// The kernels are ordered by version, e.g. 5.15.0-105-generic is newer than
+// 5.15.0-97-generic.
+func newestKernel() (string, string, error) {
+	modules, _ := filepath.Glob(filepath.Join(modulesDir, "*"))
+	versions := make([]string, 0, len(modules))
+	for _, module := range modules {
+		versions = append(versions, filepath.Base(module))
+	}
+	slices.SortFunc(versions, compareKernelVersions)
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		kernel := filepath.Join(bootDir, "vmlinuz-"+version)
+		if _, err := os.Stat(kernel); err != nil {
+			continue
+		}
+		for _, initrd := range []string{filepath.Join(bootDir, "initramfs-"+version+".img"), filepath.Join(bootDir, "initrd.img-"+version)} {
+			if _, err := os.Stat(initrd); err == nil {
+				return kernel, initrd, nil
+			}
+		}
+		return kernel, "", nil
+	}
+	return "", "", fmt.Errorf("no kernel image found in %s", bootDir)
+}
+
+// compareKernelVersions compares two kernel versions like sort -V. Runs of digits
+// are compared as numbers, the other characters as text.
+//
+// Returns:
+//   - int: -1 if a is older than b, 1 if it is newer, 0 if they are equal
+func compareKernelVersions(a, b string) int {
+	for a != "" && b != "" {
+		partA, restA := versionPart(a)
+		partB, restB := versionPart(b)
+		numberA, errA := strconv.ParseUint(partA, 10, 64)
+		numberB, errB := strconv.ParseUint(partB, 10, 64)
+		var result int
+		if errA == nil && errB == nil {
+			result = cmp.Compare(numberA, numberB)
+		} else {
+			result = strings.Compare(partA, partB)
+		}
+		if result != 0 {
+			return result
+		}
+		a, b = restA, restB
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// versionPart splits the leading run of digits or non-digits off a version
+func versionPart(version string) (string, string) {
+	digits := version[0] >= '0' && version[0] <= '9'
+	end := 1
+	for end < len(version) && (version[end] >= '0' && version[end] <= '9') == digits {
+		end++
+	}
+	return version[:end], version[end:]
+}
+
+// SupportsSoftReboot reports whether systemd is running with soft-reboot support (v254+).
+func SupportsSoftReboot() bool {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return false
+	}
+	output, err := exec.Command("systemctl", "--version").Output()
+	if err != nil {
+		return false
+	}
+	return parseSystemdVersion(string(output)) >= minSoftRebootSystemdVersion
+}
+
+// SoftRebootsCount returns the number of soft-reboots since the kernel was booted.
+// The kernel uptime is not reset by a soft-reboot, so this counter is used instead.
+//
+// Returns:
+//   - int64: The number of soft-reboots
+//   - error: Any error that occurred while querying systemd
+func SoftRebootsCount() (int64, error) {
+	output, err := exec.Command("systemctl", "show", "--property=SoftRebootsCount", "--value").Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query soft-reboot count: %w", err)
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+}
+
+// parseSystemdVersion parses the major version from the output of "systemctl --version".
+//
+// Parameters:
+//   - output: The output of "systemctl --version", e.g. "systemd 254 (254.5-1)"
+//
+// Returns:
+//   - int: The major version, or 0 if it could not be parsed
+func parseSystemdVersion(output string) int {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "systemd" {
+		return 0
+	}
+	version, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0
+	}
+	return version
 }
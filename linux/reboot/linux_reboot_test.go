@@ -0,0 +1,76 @@
+package linux_reboot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveMethod(t *testing.T) {
+	if method, err := ResolveMethod("kexec"); err != nil || method != MethodKexec {
+		t.Errorf("ResolveMethod(kexec) = %s, %v", method, err)
+	}
+
+	t.Setenv(MethodEnvVar, "logind")
+	if method, err := ResolveMethod("kexec"); err != nil || method != MethodLogind {
+		t.Errorf("Expected the environment to override the configuration, got %s, %v", method, err)
+	}
+
+	t.Setenv(MethodEnvVar, "")
+	if method, err := ResolveMethod(""); err != nil || (method != MethodSystemctl && method != MethodReboot) {
+		t.Errorf("Expected auto to resolve to systemctl or reboot, got %s, %v", method, err)
+	}
+
+	if _, err := ResolveMethod("halt"); err == nil {
+		t.Errorf("Expected an error for an unknown reboot method")
+	}
+}
+
+func TestParseSystemdVersion(t *testing.T) {
+	tests := map[string]int{
+		"systemd 254 (254.5-1)\n+PAM +AUDIT +SELINUX": 254,
+		"systemd 249 (249.11-0ubuntu3.12)\n":          249,
+		"":                                            0,
+		"not systemd":                                 0,
+	}
+	for output, expected := range tests {
+		if version := parseSystemdVersion(output); version != expected {
+			t.Errorf("parseSystemdVersion(%q) = %d, expected %d", output, version, expected)
+		}
+	}
+}
+
+func TestNewestKernel(t *testing.T) {
+	modulesDir, bootDir = t.TempDir(), t.TempDir()
+	defer func() { modulesDir, bootDir = "/lib/modules", "/boot" }()
+	for _, version := range []string{"5.15.0-97-generic", "5.15.0-105-generic", "5.9.0-1-generic", "6.2.0-rc1"} {
+		os.Mkdir(filepath.Join(modulesDir, version), 0755)
+	}
+	for _, file := range []string{"vmlinuz-5.15.0-97-generic", "vmlinuz-5.15.0-105-generic", "initrd.img-5.15.0-105-generic", "vmlinuz-5.9.0-1-generic"} {
+		os.WriteFile(filepath.Join(bootDir, file), nil, 0644)
+	}
+
+	// 6.2.0-rc1 has no kernel image, 5.15.0-105 is newer than 5.15.0-97 and 5.9.0
+	kernel, initrd, err := newestKernel()
+	if err != nil || kernel != filepath.Join(bootDir, "vmlinuz-5.15.0-105-generic") || initrd != filepath.Join(bootDir, "initrd.img-5.15.0-105-generic") {
+		t.Errorf("newestKernel() = %s, %s, %v", kernel, initrd, err)
+	}
+}
+
+func TestCompareKernelVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"5.15.0-105-generic", "5.15.0-97-generic", 1},
+		{"5.9.0", "5.15.0", -1},
+		{"6.1.0-13-amd64", "6.1.0-13-amd64", 0},
+		{"5.14.0-362.8.1.el9_3.x86_64", "5.14.0-362.24.1.el9_3.x86_64", -1},
+		{"6.1.0", "6.1.0-1", -1},
+	}
+	for _, test := range tests {
+		if result := compareKernelVersions(test.a, test.b); result != test.expected {
+			t.Errorf("compareKernelVersions(%s, %s) = %d, want %d", test.a, test.b, result, test.expected)
+		}
+	}
+}
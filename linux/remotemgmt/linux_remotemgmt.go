@@ -0,0 +1,154 @@
+// Package linux_remotemgmt inventories the remote management capabilities of a host,
+// the presence of a BMC reachable through IPMI and the Wake-on-LAN support of the
+// network interfaces, as groundwork for out-of-band power jobs.
+package linux_remotemgmt
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud-guardian/linux"
+)
+
+// IpmiDevicePaths contains the device nodes created by the IPMI drivers
+var IpmiDevicePaths = []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"}
+
+// NetSysfsPath contains the default path to the network interfaces exported by the kernel
+var NetSysfsPath = "/sys/class/net"
+
+// commandTimeout limits ipmitool and ethtool, a BMC that does not respond can block ipmitool for minutes
+const commandTimeout = 10 * time.Second
+
+type BmcInfo struct {
+	Present          bool   `json:"present"`
+	Manufacturer     string `json:"manufacturer,omitempty"`
+	FirmwareRevision string `json:"firmware_revision,omitempty"`
+	IpmiVersion      string `json:"ipmi_version,omitempty"`
+}
+
+type WakeOnLan struct {
+	Interface string `json:"interface"`
+	Supported string `json:"supported"` // Supported wake-on modes as reported by ethtool, e.g. "pumbg"
+	Enabled   string `json:"enabled"`   // Enabled wake-on modes, "d" if disabled
+}
+
+type RemoteManagement struct {
+	Bmc       BmcInfo     `json:"bmc"`
+	WakeOnLan []WakeOnLan `json:"wake_on_lan"`
+}
+
+// GetRemoteManagement collects the BMC and Wake-on-LAN facts of the host.
+// Details of the BMC require ipmitool and root privileges, Wake-on-LAN requires ethtool.
+//
+// Returns:
+//   - RemoteManagement: The remote management facts
+func GetRemoteManagement() RemoteManagement {
+	return RemoteManagement{
+		Bmc:       getBmcInfo(),
+		WakeOnLan: getWakeOnLan(),
+	}
+}
+
+func getBmcInfo() BmcInfo {
+	info := BmcInfo{}
+	for _, path := range IpmiDevicePaths {
+		if _, err := os.Stat(path); err == nil {
+			info.Present = true
+			break
+		}
+	}
+	if !info.Present {
+		return info
+	}
+	if output, err := runWithTimeout("ipmitool", "mc", "info"); err == nil {
+		fields := parseMcInfo(output)
+		info.Manufacturer = fields["Manufacturer Name"]
+		info.FirmwareRevision = fields["Firmware Revision"]
+		info.IpmiVersion = fields["IPMI Version"]
+	}
+	return info
+}
+
+func getWakeOnLan() []WakeOnLan {
+	result := []WakeOnLan{}
+	entries, err := os.ReadDir(NetSysfsPath)
+	if err != nil {
+		return result
+	}
+	for _, entry := range entries {
+		// Only physical interfaces have a device, bridges, bonds and tunnels cannot wake the host
+		if _, err := os.Stat(filepath.Join(NetSysfsPath, entry.Name(), "device")); err != nil {
+			continue
+		}
+		output, err := runWithTimeout("ethtool", entry.Name())
+		if err != nil {
+			continue
+		}
+		if wol, ok := parseEthtool(entry.Name(), output); ok {
+			result = append(result, wol)
+		}
+	}
+	return result
+}
+
+func runWithTimeout(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	stdout, _, err := linux.RunCommand(exec.CommandContext(ctx, name, args...))
+	return stdout, err
+}
+
+// parseMcInfo parses the "Key : Value" lines of the ipmitool mc info output.
+// Indented lines, e.g. the list of additional device support, are skipped.
+//
+// Parameters:
+//   - output: The output of ipmitool mc info
+//
+// Returns:
+//   - map[string]string: The fields by key
+func parseMcInfo(output string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		if key, value = strings.TrimSpace(key), strings.TrimSpace(value); value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// parseEthtool extracts the Wake-on-LAN modes from the ethtool output of an interface.
+//
+// Parameters:
+//   - name: The name of the interface
+//   - output: The output of ethtool for the interface
+//
+// Returns:
+//   - WakeOnLan: The supported and enabled modes
+//   - bool: False if the driver does not report Wake-on-LAN support
+func parseEthtool(name, output string) (WakeOnLan, bool) {
+	wol := WakeOnLan{Interface: name}
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), ":")
+		if !found {
+			continue
+		}
+		switch key {
+		case "Supports Wake-on":
+			wol.Supported = strings.TrimSpace(value)
+		case "Wake-on":
+			wol.Enabled = strings.TrimSpace(value)
+		}
+	}
+	return wol, wol.Supported != ""
+}
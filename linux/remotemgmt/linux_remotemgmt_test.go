@@ -0,0 +1,58 @@
+package linux_remotemgmt
+
+import "testing"
+
+const testMcInfo = `Device ID                 : 32
+Device Revision           : 1
+Firmware Revision         : 6.10
+IPMI Version              : 2.0
+Manufacturer ID           : 674
+Manufacturer Name         : DELL Inc
+Product ID                : 256 (0x0100)
+Device Available          : yes
+Additional Device Support :
+    Sensor Device
+    SDR Repository Device
+Aux Firmware Rev Info     :
+    0x00
+`
+
+const testEthtool = `Settings for eno1:
+	Supported ports: [ TP ]
+	Speed: 1000Mb/s
+	Duplex: Full
+	Supports Wake-on: pumbg
+	Wake-on: g
+	Current message level: 0x00000007 (7)
+	Link detected: yes
+`
+
+func TestParseMcInfo(t *testing.T) {
+	fields := parseMcInfo(testMcInfo)
+	expected := map[string]string{
+		"Firmware Revision": "6.10",
+		"IPMI Version":      "2.0",
+		"Manufacturer Name": "DELL Inc",
+	}
+	for key, value := range expected {
+		if fields[key] != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, fields[key])
+		}
+	}
+	if _, ok := fields["Sensor Device"]; ok {
+		t.Errorf("Expected indented lines to be skipped")
+	}
+}
+
+func TestParseEthtool(t *testing.T) {
+	wol, ok := parseEthtool("eno1", testEthtool)
+	if !ok {
+		t.Fatal("Expected Wake-on-LAN support")
+	}
+	if wol.Supported != "pumbg" || wol.Enabled != "g" {
+		t.Errorf("Unexpected Wake-on-LAN modes: %+v", wol)
+	}
+	if _, ok := parseEthtool("eth0", "Settings for eth0:\n\tLink detected: yes\n"); ok {
+		t.Errorf("Expected no Wake-on-LAN support without Supports Wake-on")
+	}
+}
@@ -0,0 +1,391 @@
+package linux_swap
+
+import (
+	"cloud-guardian/linux"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// FstabPath contains the default path to the fstab file
+var FstabPath = "/etc/fstab"
+
+// SwapsPath contains the default path to the kernel swap table
+var SwapsPath = "/proc/swaps"
+
+type Swap struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"` // Size in KB
+	Used     int64  `json:"used"` // Used space in KB
+	Priority int    `json:"priority"`
+}
+
+// GetSwaps retrieves the list of active swap areas from /proc/swaps.
+//
+// Returns:
+//   - []Swap: A slice of Swap structs describing the active swap areas
+//   - error: Any error that occurred while reading the swap table
+func GetSwaps() ([]Swap, error) {
+	data, err := os.ReadFile(SwapsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", SwapsPath, err)
+	}
+	return parseSwaps(string(data)), nil
+}
+
+// parseSwaps parses the content of /proc/swaps.
+//
+// Parameters:
+//   - output: The raw content of /proc/swaps
+//
+// Returns:
+//   - []Swap: A slice of parsed Swap structs
+func parseSwaps(output string) []Swap {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	swaps := []Swap{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] == "Filename" {
+			continue // Skip header and malformed lines
+		}
+		size, _ := strconv.ParseInt(fields[2], 10, 64)
+		used, _ := strconv.ParseInt(fields[3], 10, 64)
+		priority, _ := strconv.Atoi(fields[4])
+		swaps = append(swaps, Swap{
+			Filename: fields[0],
+			Type:     fields[1],
+			Size:     size,
+			Used:     used,
+			Priority: priority,
+		})
+	}
+	return swaps
+}
+
+// isActive checks if the given swap file or device is currently in use.
+func isActive(path string) bool {
+	swaps, err := GetSwaps()
+	if err != nil {
+		return false
+	}
+	for _, swap := range swaps {
+		if swap.Filename == path {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSwapFile creates (or resizes) a swap file, activates it and persists it in fstab.
+// An existing file is only replaced if it is a swap file, i.e. active or listed as swap
+// in fstab, so a job cannot format another file as swap. It is deactivated and recreated
+// with the new size, which also shrinks it.
+//
+// Parameters:
+//   - path: Absolute path of the swap file
+//   - sizeMB: Size of the swap file in MiB
+//
+// Returns:
+//   - string: Combined standard output of the executed commands
+//   - string: Standard error output of the failing command
+//   - error: Any error that occurred during the operation
+func CreateSwapFile(path string, sizeMB int) (string, string, error) {
+	if sizeMB <= 0 {
+		return "", "", fmt.Errorf("invalid swap size: %d", sizeMB)
+	}
+	exists, err := checkSwapFile(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	var output strings.Builder
+	if isActive(path) {
+		stdOut, stdErr, err := linux.RunCommand(exec.Command("swapoff", path))
+		output.WriteString(stdOut)
+		if err != nil {
+			return output.String(), stdErr, err
+		}
+	}
+	if exists {
+		if err := os.Remove(path); err != nil {
+			return output.String(), "", fmt.Errorf("failed to remove the old swap file: %w", err)
+		}
+	}
+	// O_EXCL fails if another file appeared at the path in the meantime, e.g. a symlink
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return output.String(), "", fmt.Errorf("failed to create swap file: %w", err)
+	}
+	file.Close()
+
+	commands := []*exec.Cmd{
+		exec.Command("fallocate", "--length", fmt.Sprintf("%dM", sizeMB), path),
+		exec.Command("mkswap", path),
+		exec.Command("swapon", path),
+	}
+	for _, command := range commands {
+		stdOut, stdErr, err := linux.RunCommand(command)
+		output.WriteString(stdOut)
+		if err != nil {
+			return output.String(), stdErr, err
+		}
+	}
+
+	if err := updateFstab(func(content string) string { return addFstabEntry(content, path) }); err != nil {
+		return output.String(), "", err
+	}
+	return output.String(), "", nil
+}
+
+// RemoveSwapFile deactivates a swap file, removes it from fstab and deletes it.
+// Files that are not swap files, i.e. neither active nor listed as swap in fstab,
+// are not touched.
+//
+// Parameters:
+//   - path: Absolute path of the swap file
+//
+// Returns:
+//   - string: Standard output of the swapoff command
+//   - string: Standard error output of the swapoff command
+//   - error: Any error that occurred during the operation
+func RemoveSwapFile(path string) (string, string, error) {
+	exists, err := checkSwapFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	var stdOut, stdErr string
+	if isActive(path) {
+		stdOut, stdErr, err = linux.RunCommand(exec.Command("swapoff", path))
+		if err != nil {
+			return stdOut, stdErr, err
+		}
+	}
+	if err := updateFstab(func(content string) string { return removeFstabEntry(content, path) }); err != nil {
+		return stdOut, stdErr, err
+	}
+	if exists {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return stdOut, stdErr, fmt.Errorf("failed to remove swap file: %w", err)
+		}
+	}
+	return stdOut, stdErr, nil
+}
+
+// checkSwapFile checks that a swap job may replace or remove the file at path: it
+// does not exist yet, or it is a regular file that is active or listed as swap in fstab.
+//
+// Parameters:
+//   - path: Absolute path of the swap file
+//
+// Returns:
+//   - bool: true if the file exists
+//   - error: An error if the path is invalid or the file is not a swap file
+func checkSwapFile(path string) (bool, error) {
+	if !strings.HasPrefix(path, "/") || filepath.Clean(path) != path {
+		return false, fmt.Errorf("swap file path must be absolute and clean: %s", path)
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return true, fmt.Errorf("%s is not a regular file", path)
+	}
+	if isActive(path) {
+		return true, nil
+	}
+	if content, err := os.ReadFile(FstabPath); err == nil && hasFstabSwapEntry(string(content), path) {
+		return true, nil
+	}
+	return true, fmt.Errorf("%s exists and is not a swap file, it is neither active nor listed as swap in %s", path, FstabPath)
+}
+
+// EnableZram creates a compressed swap device in RAM with the given size.
+// zram devices do not survive a reboot, so no fstab entry is written.
+//
+// Parameters:
+//   - sizeMB: Size of the zram device in MiB
+//
+// Returns:
+//   - string: Combined standard output of the executed commands
+//   - string: Standard error output of the failing command
+//   - error: Any error that occurred during the operation
+func EnableZram(sizeMB int) (string, string, error) {
+	if sizeMB <= 0 {
+		return "", "", fmt.Errorf("invalid zram size: %d", sizeMB)
+	}
+
+	var output strings.Builder
+	stdOut, stdErr, err := linux.RunCommand(exec.Command("modprobe", "zram"))
+	output.WriteString(stdOut)
+	if err != nil {
+		return output.String(), stdErr, err
+	}
+
+	// zramctl prints the name of the allocated device, e.g. /dev/zram0
+	device, stdErr, err := linux.RunCommand(exec.Command("zramctl", "--find", "--size", fmt.Sprintf("%dM", sizeMB)))
+	if err != nil {
+		return output.String(), stdErr, err
+	}
+	device = strings.TrimSpace(device)
+	output.WriteString(device + "\n")
+
+	commands := []*exec.Cmd{
+		exec.Command("mkswap", device),
+		exec.Command("swapon", "--priority", "100", device),
+	}
+	for _, command := range commands {
+		stdOut, stdErr, err := linux.RunCommand(command)
+		output.WriteString(stdOut)
+		if err != nil {
+			return output.String(), stdErr, err
+		}
+	}
+	return output.String(), "", nil
+}
+
+// updateFstab reads the fstab file, applies the given modification and writes it back.
+func updateFstab(modify func(string) string) error {
+	info, err := os.Stat(FstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", FstabPath, err)
+	}
+	content, err := os.ReadFile(FstabPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", FstabPath, err)
+	}
+	updated := modify(string(content))
+	if updated == string(content) {
+		return nil
+	}
+	if err := writeFstab([]byte(updated), info); err != nil {
+		return fmt.Errorf("failed to write %s: %w", FstabPath, err)
+	}
+	return nil
+}
+
+// writeFstab replaces the fstab file, so an interrupted write never leaves a
+// truncated fstab behind, which would make the host unbootable. The content is
+// written to a temporary file in the same directory with the mode and owner of
+// the fstab file, synced and renamed over it, like cloudguardian_config.WriteFileAtomic.
+//
+// Parameters:
+//   - data: The new content
+//   - info: The file info of the current fstab file
+//
+// Returns:
+//   - error: An error if the file cannot be written
+func writeFstab(data []byte, info os.FileInfo) error {
+	path, err := filepath.EvalSymlinks(FstabPath) // Keep a symlinked fstab a symlink
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails after a successful rename
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := tmp.Chown(int(stat.Uid), int(stat.Gid)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync() // Persist the rename
+		dir.Close()
+	}
+	return nil
+}
+
+// hasFstabEntry checks if the fstab content contains an entry for the given path.
+func hasFstabEntry(content string, path string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == path {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFstabSwapEntry checks if the fstab content contains a swap entry for the given path.
+func hasFstabSwapEntry(content string, path string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[0] == path && fields[2] == "swap" {
+			return true
+		}
+	}
+	return false
+}
+
+// addFstabEntry appends a swap entry for the given path to the fstab content,
+// unless an entry for the path already exists.
+//
+// Parameters:
+//   - content: The current content of the fstab file
+//   - path: The swap file path
+//
+// Returns:
+//   - string: The updated fstab content
+func addFstabEntry(content string, path string) string {
+	if hasFstabEntry(content, path) {
+		return content
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + path + " none swap sw 0 0\n"
+}
+
+// removeFstabEntry removes all swap entries for the given path from the fstab content,
+// other mounts of the path are kept.
+//
+// Parameters:
+//   - content: The current content of the fstab file
+//   - path: The swap file path
+//
+// Returns:
+//   - string: The updated fstab content
+func removeFstabEntry(content string, path string) string {
+	if !hasFstabSwapEntry(content, path) {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && fields[0] == path && fields[2] == "swap" {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,139 @@
+package linux_swap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testSwaps = `Filename				Type		Size		Used		Priority
+/swap.img                               file		4194300		0		-2
+/dev/zram0                              partition	1048572		2048		100
+`
+
+func TestParseSwaps(t *testing.T) {
+	expected := []Swap{
+		{Filename: "/swap.img", Type: "file", Size: 4194300, Used: 0, Priority: -2},
+		{Filename: "/dev/zram0", Type: "partition", Size: 1048572, Used: 2048, Priority: 100},
+	}
+	result := parseSwaps(testSwaps)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+const testFstab = `# /etc/fstab
+UUID=1234 / ext4 defaults 0 1
+/boot/efi vfat defaults 0 2`
+
+func TestAddFstabEntry(t *testing.T) {
+	expected := testFstab + "\n/swapfile none swap sw 0 0\n"
+	result := addFstabEntry(testFstab, "/swapfile")
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+
+	// Adding the same entry twice must not duplicate it
+	if again := addFstabEntry(result, "/swapfile"); again != result {
+		t.Errorf("Expected entry not to be duplicated, got %q", again)
+	}
+}
+
+func TestRemoveFstabEntry(t *testing.T) {
+	withSwap := addFstabEntry(testFstab, "/swapfile")
+	result := removeFstabEntry(withSwap, "/swapfile")
+	if hasFstabEntry(result, "/swapfile") {
+		t.Errorf("Expected swap entry to be removed, got %q", result)
+	}
+	if !hasFstabEntry(result, "UUID=1234") {
+		t.Errorf("Expected other entries to be kept, got %q", result)
+	}
+
+	// Removing a missing entry leaves the content untouched
+	if unchanged := removeFstabEntry(testFstab, "/swapfile"); unchanged != testFstab {
+		t.Errorf("Expected content to be unchanged, got %q", unchanged)
+	}
+}
+
+func TestUpdateFstab(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "fstab.real")
+	if err := os.WriteFile(target, []byte(testFstab), 0640); err != nil {
+		t.Fatal(err)
+	}
+	originalFstabPath := FstabPath
+	FstabPath = filepath.Join(dir, "fstab")
+	defer func() { FstabPath = originalFstabPath }()
+	os.Symlink(target, FstabPath)
+
+	if err := updateFstab(func(content string) string { return addFstabEntry(content, "/swapfile") }); err != nil {
+		t.Fatalf("updateFstab() error: %v", err)
+	}
+	if data, _ := os.ReadFile(FstabPath); !hasFstabSwapEntry(string(data), "/swapfile") {
+		t.Errorf("Expected the swap entry to be added, got %q", data)
+	}
+	if info, err := os.Lstat(FstabPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the fstab to stay a symlink, got %v", err)
+	}
+	if info, err := os.Stat(target); err != nil {
+		t.Errorf("Expected the fstab to be readable, got %v", err)
+	} else if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the mode 0640 to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected no temporary files to be left, got %v", entries)
+	}
+}
+
+func TestCheckSwapFile(t *testing.T) {
+	dir := t.TempDir()
+	SwapsPath = filepath.Join(dir, "swaps")
+	FstabPath = filepath.Join(dir, "fstab")
+	defer func() { SwapsPath, FstabPath = "/proc/swaps", "/etc/fstab" }()
+	swapFile := filepath.Join(dir, "swapfile")
+	regularFile := filepath.Join(dir, "data")
+	for _, file := range []string{swapFile, regularFile} {
+		if err := os.WriteFile(file, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(SwapsPath, []byte("Filename Type Size Used Priority\n"), 0644)
+	os.WriteFile(FstabPath, []byte(testFstab+"\n"+swapFile+" none swap sw 0 0\n"+regularFile+" /data ext4 defaults 0 2\n"), 0644)
+
+	if exists, err := checkSwapFile(filepath.Join(dir, "new")); exists || err != nil {
+		t.Errorf("Expected a new swap file to be allowed, got %v, %v", exists, err)
+	}
+	if exists, err := checkSwapFile(swapFile); !exists || err != nil {
+		t.Errorf("Expected a swap file listed in fstab to be allowed, got %v, %v", exists, err)
+	}
+	if _, err := checkSwapFile(regularFile); err == nil {
+		t.Errorf("Expected a regular file to be rejected")
+	}
+	if _, _, err := RemoveSwapFile(regularFile); err == nil {
+		t.Errorf("Expected the removal of a regular file to be rejected")
+	}
+	if _, err := os.Stat(regularFile); err != nil {
+		t.Errorf("Expected the regular file to be kept, got %v", err)
+	}
+	if _, err := checkSwapFile(dir + "/../etc/passwd"); err == nil {
+		t.Errorf("Expected a path with .. to be rejected")
+	}
+	link := filepath.Join(dir, "link")
+	os.Symlink(swapFile, link)
+	if _, err := checkSwapFile(link); err == nil {
+		t.Errorf("Expected a symlink to be rejected")
+	}
+
+	// A swap file is removed from fstab and deleted, other mounts are kept
+	if _, _, err := RemoveSwapFile(swapFile); err != nil {
+		t.Fatalf("RemoveSwapFile() error: %v", err)
+	}
+	content, _ := os.ReadFile(FstabPath)
+	if hasFstabEntry(string(content), swapFile) || !hasFstabEntry(string(content), regularFile) {
+		t.Errorf("Expected only the swap entry to be removed, got %q", content)
+	}
+	if _, err := os.Stat(swapFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the swap file to be deleted, got %v", err)
+	}
+}
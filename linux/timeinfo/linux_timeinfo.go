@@ -0,0 +1,291 @@
+package linux_timeinfo
+
+import (
+	"cloud-guardian/linux"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chronycTimeout limits chronyc, which waits for an unresponsive chronyd
+const chronycTimeout = 5 * time.Second
+
+var (
+	// LocaltimePath contains the default path to the localtime symlink
+	LocaltimePath = "/etc/localtime"
+	// TimezonePath contains the default path to the Debian timezone file
+	TimezonePath = "/etc/timezone"
+	// LocaleConfigPaths contains the locale configuration files, in order of preference
+	LocaleConfigPaths = []string{"/etc/locale.conf", "/etc/default/locale"}
+	// ChronyConfigPaths contains the chrony configuration files, in order of preference
+	ChronyConfigPaths = []string{"/etc/chrony.conf", "/etc/chrony/chrony.conf"}
+	// TimesyncdConfigPaths contains the systemd-timesyncd configuration files
+	TimesyncdConfigPaths = []string{"/etc/systemd/timesyncd.conf"}
+	// TimesyncdDropInDirs contains the drop-in directories of timesyncd.conf, in order of precedence
+	TimesyncdDropInDirs = []string{"/etc/systemd/timesyncd.conf.d", "/run/systemd/timesyncd.conf.d", "/usr/local/lib/systemd/timesyncd.conf.d", "/usr/lib/systemd/timesyncd.conf.d"}
+)
+
+type TimeInfo struct {
+	Timezone   string      `json:"timezone"`
+	Locale     string      `json:"locale"`
+	NtpService string      `json:"ntp_service"` // "chrony", "timesyncd" or empty if none was detected
+	NtpServers []string    `json:"ntp_servers"` // Servers and pools from the configuration
+	NtpSources []NtpSource `json:"ntp_sources"` // Live sources as reported by chronyc
+}
+
+type NtpSource struct {
+	Mode    string `json:"mode"`    // "^" server, "=" peer, "#" local clock
+	State   string `json:"state"`   // "*" selected, "+" combined, "-" not combined, "?" unreachable, ...
+	Address string `json:"address"` // Address of the source
+	Stratum string `json:"stratum"`
+}
+
+// GetTimeInfo collects the timezone, locale and NTP configuration of the host.
+//
+// Returns:
+//   - TimeInfo: A struct containing the timezone, locale and NTP details
+func GetTimeInfo() TimeInfo {
+	info := TimeInfo{
+		Timezone:   getTimezone(),
+		Locale:     getLocale(),
+		NtpServers: []string{},
+		NtpSources: []NtpSource{},
+	}
+
+	if content, ok := readFirstExisting(ChronyConfigPaths); ok {
+		info.NtpService = "chrony"
+		info.NtpServers = parseChronyConfig(content)
+		for _, path := range chronyIncludedFiles(content) {
+			if data, err := os.ReadFile(path); err == nil {
+				info.NtpServers = append(info.NtpServers, parseChronyConfig(string(data))...)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), chronycTimeout)
+		defer cancel()
+		if out, _, err := linux.RunCommand(exec.CommandContext(ctx, "chronyc", "-n", "sources")); err == nil {
+			info.NtpSources = parseChronySources(out)
+		}
+	} else if content, ok := readTimesyncdConfig(); ok {
+		info.NtpService = "timesyncd"
+		info.NtpServers = parseTimesyncdConfig(content)
+	}
+	return info
+}
+
+// getTimezone determines the configured timezone, first from the localtime
+// symlink and then from the Debian timezone file.
+func getTimezone() string {
+	if target, err := filepath.EvalSymlinks(LocaltimePath); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	if data, err := os.ReadFile(TimezonePath); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
+
+// getLocale determines the system locale from the locale configuration files,
+// falling back to the LANG environment variable.
+func getLocale() string {
+	if content, ok := readFirstExisting(LocaleConfigPaths); ok {
+		if locale := parseLocaleConfig(content); locale != "" {
+			return locale
+		}
+	}
+	return os.Getenv("LANG")
+}
+
+// readFirstExisting returns the content of the first readable file in paths.
+func readFirstExisting(paths []string) (string, bool) {
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// readTimesyncdConfig returns the timesyncd configuration followed by its drop-ins,
+// which override it in this order.
+//
+// Returns:
+//   - string: The content of timesyncd.conf and its drop-ins
+//   - bool: false if neither timesyncd.conf nor a drop-in exists
+func readTimesyncdConfig() (string, bool) {
+	content, found := readFirstExisting(TimesyncdConfigPaths)
+	for _, path := range dropInFiles(TimesyncdDropInDirs, ".conf") {
+		if data, err := os.ReadFile(path); err == nil {
+			content += "\n" + string(data)
+			found = true
+		}
+	}
+	return content, found
+}
+
+// dropInFiles returns the files with the suffix in the directories, ordered by file
+// name. A file name is taken from the first directory that contains it, so a file
+// in an earlier directory replaces the file of the same name in a later one.
+//
+// Parameters:
+//   - dirs: The directories, in order of precedence
+//   - suffix: The suffix of the files, e.g. ".conf"
+//
+// Returns:
+//   - []string: The paths of the files
+func dropInFiles(dirs []string, suffix string) []string {
+	files := map[string]string{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if _, ok := files[entry.Name()]; !ok && !entry.IsDir() && strings.HasSuffix(entry.Name(), suffix) {
+				files[entry.Name()] = filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		paths = append(paths, files[name])
+	}
+	return paths
+}
+
+// chronyIncludedFiles returns the files a chrony configuration includes with the
+// confdir (*.conf), sourcedir (*.sources) and include directives, e.g. the servers
+// in /etc/chrony/sources.d on Debian.
+//
+// Parameters:
+//   - content: The content of the chrony configuration file
+//
+// Returns:
+//   - []string: The paths of the included files, in the order chrony reads them
+func chronyIncludedFiles(content string) []string {
+	paths := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "confdir":
+			paths = append(paths, dropInFiles(fields[1:], ".conf")...)
+		case "sourcedir":
+			paths = append(paths, dropInFiles(fields[1:], ".sources")...)
+		case "include":
+			matches, _ := filepath.Glob(fields[1])
+			sort.Strings(matches)
+			paths = append(paths, matches...)
+		}
+	}
+	return paths
+}
+
+// parseLocaleConfig extracts the LANG value from a locale configuration file.
+//
+// Parameters:
+//   - content: The content of /etc/locale.conf or /etc/default/locale
+//
+// Returns:
+//   - string: The configured locale, or an empty string if none is set
+func parseLocaleConfig(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if value, found := strings.CutPrefix(line, "LANG="); found {
+			return strings.Trim(value, "\"'")
+		}
+	}
+	return ""
+}
+
+// parseChronyConfig extracts the server, pool and peer directives from a chrony configuration.
+//
+// Parameters:
+//   - content: The content of the chrony configuration file
+//
+// Returns:
+//   - []string: The configured NTP servers and pools
+func parseChronyConfig(content string) []string {
+	servers := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "server", "pool", "peer":
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// parseTimesyncdConfig extracts the NTP and FallbackNTP servers from a timesyncd configuration.
+// Fallback servers are only returned if no NTP servers are configured, as timesyncd does.
+// An empty assignment, e.g. "NTP=" in a drop-in, removes the servers assigned before.
+//
+// Parameters:
+//   - content: The content of timesyncd.conf and its drop-ins
+//
+// Returns:
+//   - []string: The configured NTP servers
+func parseTimesyncdConfig(content string) []string {
+	servers := []string{}
+	fallback := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if value, found := strings.CutPrefix(line, "NTP="); found && strings.TrimSpace(value) == "" {
+			servers = []string{}
+		} else if found {
+			servers = append(servers, strings.Fields(value)...)
+		} else if value, found := strings.CutPrefix(line, "FallbackNTP="); found && strings.TrimSpace(value) == "" {
+			fallback = []string{}
+		} else if found {
+			fallback = append(fallback, strings.Fields(value)...)
+		}
+	}
+	if len(servers) == 0 {
+		return fallback
+	}
+	return servers
+}
+
+// parseChronySources parses the output of 'chronyc -n sources'.
+//
+// Parameters:
+//   - output: The raw output string from the chronyc command
+//
+// Returns:
+//   - []NtpSource: A slice of parsed NTP sources
+func parseChronySources(output string) []NtpSource {
+	sources := []NtpSource{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || len(fields[0]) != 2 {
+			continue // Skip headers, separators and empty lines
+		}
+		mode, state := fields[0][0:1], fields[0][1:2]
+		if !strings.Contains("^=#", mode) {
+			continue
+		}
+		sources = append(sources, NtpSource{
+			Mode:    mode,
+			State:   state,
+			Address: fields[1],
+			Stratum: fields[2],
+		})
+	}
+	return sources
+}
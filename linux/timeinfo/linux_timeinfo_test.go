@@ -0,0 +1,128 @@
+package linux_timeinfo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testChronyConfig = `# Use public servers from the pool.ntp.org project.
+pool 2.rocky.pool.ntp.org iburst
+server ntp1.example.com iburst prefer
+#server ntp2.example.com iburst
+driftfile /var/lib/chrony/drift
+makestep 1.0 3
+`
+
+const testChronySources = `MS Name/IP address         Stratum Poll Reach LastRx Last sample
+===============================================================================
+^* 192.0.2.10                    2   6   377    35   +123us[ +145us] +/-   15ms
+^- 198.51.100.7                  3   6   377    34  -1021us[-1021us] +/-   41ms
+^? 203.0.113.5                   0   6     0     -     +0ns[   +0ns] +/-    0ns
+`
+
+const testTimesyncdConfig = `[Time]
+#NTP=
+NTP=ntp1.example.com ntp2.example.com
+FallbackNTP=ntp.ubuntu.com
+`
+
+func TestParseChronyConfig(t *testing.T) {
+	expected := []string{"2.rocky.pool.ntp.org", "ntp1.example.com"}
+	result := parseChronyConfig(testChronyConfig)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseChronySources(t *testing.T) {
+	expected := []NtpSource{
+		{Mode: "^", State: "*", Address: "192.0.2.10", Stratum: "2"},
+		{Mode: "^", State: "-", Address: "198.51.100.7", Stratum: "3"},
+		{Mode: "^", State: "?", Address: "203.0.113.5", Stratum: "0"},
+	}
+	result := parseChronySources(testChronySources)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseTimesyncdConfig(t *testing.T) {
+	expected := []string{"ntp1.example.com", "ntp2.example.com"}
+	result := parseTimesyncdConfig(testTimesyncdConfig)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	// Without NTP servers the fallback servers are used
+	expected = []string{"ntp.ubuntu.com"}
+	result = parseTimesyncdConfig("[Time]\nFallbackNTP=ntp.ubuntu.com\n")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestChronyIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "conf.d")
+	vendorDir := filepath.Join(dir, "vendor.d")
+	sourceDir := filepath.Join(dir, "sources.d")
+	for _, path := range []string{
+		filepath.Join(confDir, "b.conf"), filepath.Join(confDir, "notes.txt"),
+		filepath.Join(vendorDir, "a.conf"), filepath.Join(vendorDir, "b.conf"),
+		filepath.Join(sourceDir, "local.sources"), filepath.Join(dir, "extra.conf"),
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte("server ntp.example.com\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content := "confdir " + confDir + " " + vendorDir + "\nsourcedir " + sourceDir + "\ninclude " + filepath.Join(dir, "*.conf") + "\n"
+	expected := []string{
+		filepath.Join(vendorDir, "a.conf"), filepath.Join(confDir, "b.conf"), // b.conf of the first directory replaces the other
+		filepath.Join(sourceDir, "local.sources"), filepath.Join(dir, "extra.conf"),
+	}
+	if result := chronyIncludedFiles(content); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestReadTimesyncdConfig(t *testing.T) {
+	dir := t.TempDir()
+	TimesyncdConfigPaths = []string{filepath.Join(dir, "timesyncd.conf")}
+	TimesyncdDropInDirs = []string{filepath.Join(dir, "etc.d"), filepath.Join(dir, "lib.d")}
+	defer func() {
+		TimesyncdConfigPaths = []string{"/etc/systemd/timesyncd.conf"}
+		TimesyncdDropInDirs = []string{"/etc/systemd/timesyncd.conf.d", "/run/systemd/timesyncd.conf.d", "/usr/local/lib/systemd/timesyncd.conf.d", "/usr/lib/systemd/timesyncd.conf.d"}
+	}()
+
+	if _, ok := readTimesyncdConfig(); ok {
+		t.Errorf("Expected no timesyncd configuration")
+	}
+
+	// A drop-in alone configures timesyncd, a later drop-in resets the servers
+	os.MkdirAll(TimesyncdDropInDirs[0], 0755)
+	os.MkdirAll(TimesyncdDropInDirs[1], 0755)
+	os.WriteFile(filepath.Join(TimesyncdDropInDirs[1], "10-vendor.conf"), []byte("[Time]\nNTP=ntp.vendor.example.com\n"), 0644)
+	os.WriteFile(filepath.Join(TimesyncdDropInDirs[0], "20-local.conf"), []byte("[Time]\nNTP=\nNTP=ntp.local.example.com\n"), 0644)
+	os.WriteFile(TimesyncdConfigPaths[0], []byte(testTimesyncdConfig), 0644)
+	content, ok := readTimesyncdConfig()
+	if !ok {
+		t.Fatalf("Expected a timesyncd configuration")
+	}
+	expected := []string{"ntp.local.example.com"}
+	if result := parseTimesyncdConfig(content); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseLocaleConfig(t *testing.T) {
+	if result := parseLocaleConfig("LANG=\"en_US.UTF-8\"\n"); result != "en_US.UTF-8" {
+		t.Errorf("Expected en_US.UTF-8, got %s", result)
+	}
+	if result := parseLocaleConfig("# no locale\n"); result != "" {
+		t.Errorf("Expected empty locale, got %s", result)
+	}
+}
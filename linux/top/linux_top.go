@@ -2,6 +2,9 @@ package linux_top
 
 import (
 	"bufio"
+	"cloud-guardian/linux"
+	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -23,10 +26,10 @@ func GetUptime() (int64, error) {
 	}
 
 	// Split the data into two parts: uptime and idle time
-	parts := string(data)
-	uptime := parts[:len(parts)-1] // Remove the trailing newline character
-	uptimeParts := strings.Split(uptime, " ")
-	// uptimeStr := strings.TrimSpace(string(uptime))
+	uptimeParts := strings.Fields(string(data))
+	if len(uptimeParts) == 0 {
+		return 0, fmt.Errorf("no data in /proc/uptime")
+	}
 	uptimeSeconds, err := strconv.ParseFloat(uptimeParts[0], 64)
 	if err != nil {
 		return 0, err
@@ -54,16 +57,9 @@ type MemoryUsage struct {
 //   - MemoryUsage: A struct containing detailed memory usage statistics
 func GetMemory() MemoryUsage {
 	mem := map[string]float64{}
-	file, _ := os.Open("/proc/meminfo")
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
-		if len(fields) >= 2 {
-			val, _ := strconv.ParseFloat(fields[1], 64)
-			mem[fields[0][:len(fields[0])-1]] = val / 1024 // kB to MiB
-		}
+	if file, err := os.Open("/proc/meminfo"); err == nil {
+		mem = parseMeminfo(file)
+		file.Close()
 	}
 
 	cached := mem["Cached"] + mem["SReclaimable"] - mem["Shmem"]
@@ -83,6 +79,30 @@ func GetMemory() MemoryUsage {
 	}
 }
 
+// parseMeminfo parses the content of /proc/meminfo. Lines without a numeric value are skipped.
+//
+// Parameters:
+//   - r: The content of /proc/meminfo
+//
+// Returns:
+//   - map[string]float64: The values in MiB by field name
+func parseMeminfo(r io.Reader) map[string]float64 {
+	mem := map[string]float64{}
+	scanner := linux.NewProcScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		val, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		mem[strings.TrimSuffix(fields[0], ":")] = val / 1024 // kB to MiB
+	}
+	return mem
+}
+
 type LoadAverage struct {
 	OneMinute      float64
 	FiveMinutes    float64
@@ -97,6 +117,10 @@ func GetLoad() LoadAverage {
 	// Load averages
 	loadBytes, _ := os.ReadFile("/proc/loadavg")
 	loadFields := strings.Fields(string(loadBytes))
+	if len(loadFields) < 3 {
+		log.Println("Error parsing load average: unexpected content of /proc/loadavg")
+		return LoadAverage{}
+	}
 
 	return LoadAverage{
 		OneMinute:      parseLoad(loadFields[0]),
@@ -141,11 +165,18 @@ func GetCpuUsage() CpuUsage {
 	stat1 := readCpuStat()
 	time.Sleep(100 * time.Millisecond)
 	stat2 := readCpuStat()
+	if len(stat1) < 8 || len(stat2) < len(stat1) {
+		log.Println("Error parsing CPU usage: unexpected content of /proc/stat")
+		return CpuUsage{}
+	}
 
 	total1 := sum(stat1)
 	total2 := sum(stat2)
 
 	deltaTotal := float64(total2 - total1)
+	if deltaTotal <= 0 {
+		return CpuUsage{} // No ticks elapsed, percentages would be NaN
+	}
 	deltas := make([]float64, len(stat1))
 	for i := range stat1 {
 		deltas[i] = float64(stat2[i]-stat1[i]) / deltaTotal * 100
@@ -168,9 +199,12 @@ func GetCpuUsage() CpuUsage {
 // Returns:
 //   - []int64: Array of CPU time values from /proc/stat, or nil if reading fails
 func readCpuStat() []int64 {
-	file, _ := os.Open("/proc/stat")
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil
+	}
 	defer file.Close()
-	scanner := bufio.NewScanner(file)
+	scanner := linux.NewProcScanner(file)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "cpu ") {
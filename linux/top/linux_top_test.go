@@ -0,0 +1,36 @@
+package linux_top
+
+import (
+	"strings"
+	"testing"
+)
+
+const testMeminfo = `MemTotal:        8048128 kB
+MemFree:         2048000 kB
+MemAvailable:    6144000 kB
+Buffers:          102400 kB
+HugePages_Total:       0
+Broken
+Cached:          garbage kB
+`
+
+func TestParseMeminfo(t *testing.T) {
+	mem := parseMeminfo(strings.NewReader(testMeminfo))
+	if mem["MemTotal"] != 7859.5 || mem["MemFree"] != 2000 || mem["Buffers"] != 100 {
+		t.Errorf("Unexpected memory values: %v", mem)
+	}
+	if _, ok := mem["HugePages_Total"]; !ok {
+		t.Errorf("Expected values without a unit to be parsed")
+	}
+	if _, ok := mem["Cached"]; ok {
+		t.Errorf("Expected a non-numeric value to be skipped")
+	}
+}
+
+func FuzzParseMeminfo(f *testing.F) {
+	f.Add(testMeminfo)
+	f.Add(":\n: 1\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		parseMeminfo(strings.NewReader(content))
+	})
+}
@@ -0,0 +1,118 @@
+// Package linux_unitdrift hashes the systemd unit files of critical services, including
+// their drop-in overrides, so unauthorized changes to service definitions are caught.
+package linux_unitdrift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// UnitDirs contains the systemd unit search path, in order of precedence
+var UnitDirs = []string{"/etc/systemd/system", "/run/systemd/system", "/usr/lib/systemd/system", "/lib/systemd/system"}
+
+// DefaultServices is the allowlist of critical services used when none is configured
+var DefaultServices = []string{
+	"auditd",
+	"chronyd",
+	"cloud-guardian",
+	"cron",
+	"crond",
+	"rsyslog",
+	"ssh",
+	"sshd",
+	"systemd-journald",
+	"systemd-logind",
+	"systemd-timesyncd",
+}
+
+type UnitFile struct {
+	Service string `json:"service"`
+	Path    string `json:"path"`
+	Sha256  string `json:"sha256"`
+	DropIn  bool   `json:"drop_in"` // true for override files in <unit>.d directories
+}
+
+type Change struct {
+	Service string `json:"service"`
+	Path    string `json:"path"`
+	Change  string `json:"change"` // "added", "removed" or "modified"
+}
+
+// ScanUnitFiles hashes the unit files and drop-in overrides of the given services.
+// Services without a unit file are skipped.
+//
+// Parameters:
+//   - services: The service names without the .service suffix, DefaultServices is used if empty
+//
+// Returns:
+//   - []UnitFile: The hashed unit files, sorted by path
+func ScanUnitFiles(services []string) []UnitFile {
+	if len(services) == 0 {
+		services = DefaultServices
+	}
+	files := []UnitFile{}
+	for _, service := range services {
+		unit := service + ".service"
+		// Only the unit file with the highest precedence is used by systemd
+		for _, dir := range UnitDirs {
+			path := filepath.Join(dir, unit)
+			if hash, err := hashFile(path); err == nil {
+				files = append(files, UnitFile{Service: service, Path: path, Sha256: hash})
+				break
+			}
+		}
+		// Drop-ins of all directories are merged by systemd
+		for _, dir := range UnitDirs {
+			dropIns, _ := filepath.Glob(filepath.Join(dir, unit+".d", "*.conf"))
+			for _, path := range dropIns {
+				if hash, err := hashFile(path); err == nil {
+					files = append(files, UnitFile{Service: service, Path: path, Sha256: hash, DropIn: true})
+				}
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// CompareUnitFiles returns the changes between two scans.
+//
+// Parameters:
+//   - previous: The unit files of the previous scan
+//   - current: The unit files of the current scan
+//
+// Returns:
+//   - []Change: The added, removed and modified unit files, sorted by path
+func CompareUnitFiles(previous, current []UnitFile) []Change {
+	previousByPath := map[string]UnitFile{}
+	for _, file := range previous {
+		previousByPath[file.Path] = file
+	}
+	changes := []Change{}
+	for _, file := range current {
+		old, ok := previousByPath[file.Path]
+		if !ok {
+			changes = append(changes, Change{Service: file.Service, Path: file.Path, Change: "added"})
+		} else if old.Sha256 != file.Sha256 {
+			changes = append(changes, Change{Service: file.Service, Path: file.Path, Change: "modified"})
+		}
+		delete(previousByPath, file.Path)
+	}
+	for _, file := range previousByPath {
+		changes = append(changes, Change{Service: file.Service, Path: file.Path, Change: "removed"})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,60 @@
+package linux_unitdrift
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScanUnitFiles(t *testing.T) {
+	etc := t.TempDir()
+	lib := t.TempDir()
+	originalUnitDirs := UnitDirs
+	UnitDirs = []string{etc, lib}
+	defer func() { UnitDirs = originalUnitDirs }()
+
+	os.WriteFile(filepath.Join(lib, "sshd.service"), []byte("[Service]\nExecStart=/usr/sbin/sshd -D\n"), 0644)
+	os.MkdirAll(filepath.Join(etc, "sshd.service.d"), 0755)
+	os.WriteFile(filepath.Join(etc, "sshd.service.d", "override.conf"), []byte("[Service]\nExecStart=\nExecStart=/tmp/sshd\n"), 0644)
+
+	files := ScanUnitFiles([]string{"sshd", "missing"})
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 unit files, got %+v", files)
+	}
+	for _, file := range files {
+		if file.Service != "sshd" || len(file.Sha256) != 64 {
+			t.Errorf("Unexpected unit file %+v", file)
+		}
+	}
+
+	// A unit file in /etc takes precedence over the vendor unit file
+	os.WriteFile(filepath.Join(etc, "sshd.service"), []byte("[Service]\nExecStart=/tmp/sshd\n"), 0644)
+	current := ScanUnitFiles([]string{"sshd"})
+	expected := []Change{
+		{Service: "sshd", Path: filepath.Join(etc, "sshd.service"), Change: "added"},
+		{Service: "sshd", Path: filepath.Join(lib, "sshd.service"), Change: "removed"},
+	}
+	changes := CompareUnitFiles(files, current)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestCompareUnitFiles(t *testing.T) {
+	previous := []UnitFile{
+		{Service: "sshd", Path: "/usr/lib/systemd/system/sshd.service", Sha256: "aaa"},
+		{Service: "crond", Path: "/usr/lib/systemd/system/crond.service", Sha256: "bbb"},
+	}
+	current := []UnitFile{
+		{Service: "sshd", Path: "/usr/lib/systemd/system/sshd.service", Sha256: "ccc"},
+		{Service: "crond", Path: "/usr/lib/systemd/system/crond.service", Sha256: "bbb"},
+	}
+	expected := []Change{
+		{Service: "sshd", Path: "/usr/lib/systemd/system/sshd.service", Change: "modified"},
+	}
+	changes := CompareUnitFiles(previous, current)
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, changes)
+	}
+}
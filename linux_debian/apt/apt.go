@@ -3,8 +3,11 @@ package linux_debian_apt
 import (
 	"cloud-guardian/linux"
 	"fmt"
+	"os"
 	"os/exec"
+	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 type AptPackage struct {
@@ -13,6 +16,31 @@ type AptPackage struct {
 	Repo    string
 }
 
+// ConffileDecision describes how dpkg handled a modified configuration file during an upgrade
+type ConffileDecision struct {
+	Path     string
+	Decision string // "kept" if the local version was kept, "replaced" if the package version was installed
+}
+
+// dpkgOptions are passed as Dpkg::Options to apt when installing or upgrading packages.
+// The defaults keep locally modified configuration files without prompting.
+var dpkgOptions atomic.Pointer[[]string]
+
+func init() {
+	SetDpkgOptions([]string{"--force-confdef", "--force-confold"})
+}
+
+// SetDpkgOptions replaces the Dpkg::Options passed to apt. It may be called while
+// packages are upgraded, e.g. by a reload, a running apt keeps its options.
+func SetDpkgOptions(options []string) {
+	dpkgOptions.Store(&options)
+}
+
+var (
+	conffileRe    = regexp.MustCompile(`Configuration file '([^']+)'`)
+	newConffileRe = regexp.MustCompile(`Installing new version of config file (\S+) \.\.\.`)
+)
+
 type UpdateType int
 
 const (
@@ -23,13 +51,16 @@ const (
 // UpdateAllPackages upgrades all packages on the system using APT.
 // It runs the equivalent of 'apt upgrade --assume-yes --quiet' command.
 //
+// Parameters:
+//   - live: Receives the output while the upgrade runs
+//
 // Returns:
 //   - string: Standard output from the APT upgrade command
 //   - string: Standard error output from the APT upgrade command
 //   - error: Any error that occurred during the upgrade process
-func UpdateAllPackages() (string, string, error) {
-	command := exec.Command("apt", "upgrade", "--assume-yes", "--quiet")
-	return linux.RunCommand(command)
+func UpdateAllPackages(live linux.LiveOutput) (string, string, error) {
+	command := nonInteractiveCommand("upgrade", "--assume-yes", "--quiet")
+	return runWithConffileSummary(command, live)
 }
 
 // UpdatePackages updates the specified packages using the APT package manager.
@@ -37,15 +68,16 @@ func UpdateAllPackages() (string, string, error) {
 //
 // Parameters:
 //   - packages: A slice of strings containing the names of packages to update
+//   - live: Receives the output while the update runs
 //
 // Returns:
 //   - string: Standard output from the APT update command
 //   - string: Standard error output from the APT update command
 //   - error: Any error that occurred during the update process
-func UpdatePackages(packages []string) (string, string, error) {
-	command := exec.Command("apt", "--only-upgrade", "--assume-yes", "--quiet", "install")
+func UpdatePackages(packages []string, live linux.LiveOutput) (string, string, error) {
+	command := nonInteractiveCommand("--only-upgrade", "--assume-yes", "--quiet", "install")
 	command.Args = append(command.Args, packages...)
-	return linux.RunCommand(command)
+	return runWithConffileSummary(command, live)
 }
 
 // InstallPackages installs the specified packages using the APT package manager.
@@ -59,8 +91,78 @@ func UpdatePackages(packages []string) (string, string, error) {
 //   - string: Standard error output from the APT install command
 //   - error: Any error that occurred during the installation process
 func InstallPackages(packages []string) (string, string, error) {
-	command := exec.Command("apt", "install", "--assume-yes", "--quiet", strings.Join(packages, " "))
-	return linux.RunCommand(command)
+	command := nonInteractiveCommand("install", "--assume-yes", "--quiet")
+	command.Args = append(command.Args, packages...)
+	return runWithConffileSummary(command, linux.LiveOutput{})
+}
+
+// nonInteractiveCommand creates an apt command that never waits for user input.
+// debconf prompts are answered with their defaults and conffile questions are
+// answered according to the Dpkg::Options, see SetDpkgOptions.
+//
+// Parameters:
+//   - args: The apt arguments
+//
+// Returns:
+//   - *exec.Cmd: The prepared apt command
+func nonInteractiveCommand(args ...string) *exec.Cmd {
+	command := exec.Command("apt")
+	for _, option := range *dpkgOptions.Load() {
+		command.Args = append(command.Args, "-o", "Dpkg::Options::="+option)
+	}
+	command.Args = append(command.Args, args...)
+	command.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive", "NEEDRESTART_MODE=l", "APT_LISTCHANGES_FRONTEND=none")
+	command.Stdin = nil // Never read from the terminal
+	return command
+}
+
+// runWithConffileSummary runs an apt command and appends the conffile decisions
+// made by dpkg to the standard output, so they are visible in the job result.
+// The summary is not part of the live output.
+func runWithConffileSummary(command *exec.Cmd, live linux.LiveOutput) (string, string, error) {
+	stdOut, stdErr, err := linux.RunCommandLive(command, live)
+	if decisions := ParseConffileDecisions(stdOut + "\n" + stdErr); len(decisions) > 0 {
+		stdOut += "\nConfiguration files:\n"
+		for _, decision := range decisions {
+			stdOut += decision.Decision + ": " + decision.Path + "\n"
+		}
+	}
+	return stdOut, stdErr, err
+}
+
+// ParseConffileDecisions parses the dpkg output of an install or upgrade and
+// returns how each modified configuration file was handled.
+//
+// Parameters:
+//   - output: The combined output of the apt command
+//
+// Returns:
+//   - []ConffileDecision: The conffile decisions in the order they were made
+func ParseConffileDecisions(output string) []ConffileDecision {
+	decisions := []ConffileDecision{}
+	var pending string
+	for _, line := range strings.Split(output, "\n") {
+		if m := conffileRe.FindStringSubmatch(line); m != nil {
+			pending = m[1]
+			continue
+		}
+		if m := newConffileRe.FindStringSubmatch(line); m != nil {
+			decisions = append(decisions, ConffileDecision{Path: m[1], Decision: "replaced"})
+			pending = ""
+			continue
+		}
+		if pending == "" {
+			continue
+		}
+		if strings.Contains(line, "Keeping old config file as default") {
+			decisions = append(decisions, ConffileDecision{Path: pending, Decision: "kept"})
+			pending = ""
+		} else if strings.Contains(line, "Using new config file as default") {
+			decisions = append(decisions, ConffileDecision{Path: pending, Decision: "replaced"})
+			pending = ""
+		}
+	}
+	return decisions
 }
 
 // GetInstalledPackages retrieves a list of all installed packages on the system.
@@ -71,13 +173,11 @@ func InstallPackages(packages []string) (string, string, error) {
 //   - error: Any error that occurred during the retrieval process
 func GetInstalledPackages() ([]AptPackage, error) {
 	command := exec.Command("apt", "list", "--installed")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
 	}
-	return parseInstalledPackages(out.String()), nil
+	return parseInstalledPackages(out), nil
 }
 
 // parseInstalledPackages parses the output from 'apt list --installed' command.
@@ -118,6 +218,50 @@ func parseInstalledPackages(output string) []AptPackage {
 	return packages
 }
 
+// GetOrphanedPackages retrieves the installed packages that are not available
+// from any configured repository anymore, e.g. abandoned third-party packages.
+// These are the packages matched by the apt pattern '~o', they are read from
+// the "local" flag of 'apt list --installed' so older apt versions without
+// patterns are supported.
+//
+// Returns:
+//   - []AptPackage: A slice of AptPackage structs of the orphaned packages
+//   - error: Any error that occurred during the retrieval process
+func GetOrphanedPackages() ([]AptPackage, error) {
+	command := exec.Command("apt", "list", "--installed")
+	out, _, err := linux.RunCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	return parseOrphanedPackages(out), nil
+}
+
+// parseOrphanedPackages parses the output from 'apt list --installed' command
+// and returns the packages flagged as "local", i.e. not downloadable anymore.
+//
+// Parameters:
+//   - output: The raw output string from the APT list installed command
+//
+// Returns:
+//   - []AptPackage: A slice of parsed AptPackage structs
+func parseOrphanedPackages(output string) []AptPackage {
+	orphaned := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		start := strings.LastIndex(line, "[")
+		end := strings.LastIndex(line, "]")
+		if start < 0 || end < start {
+			continue
+		}
+		for _, flag := range strings.Split(line[start+1:end], ",") {
+			if strings.TrimSpace(flag) == "local" {
+				orphaned = append(orphaned, line)
+				break
+			}
+		}
+	}
+	return parseInstalledPackages(strings.Join(orphaned, "\n"))
+}
+
 // AptUpdate updates the package lists using APT.
 // It runs the equivalent of 'apt update' command.
 //
@@ -125,13 +269,9 @@ func parseInstalledPackages(output string) []AptPackage {
 //   - error: Any error that occurred during the update process
 func AptUpdate() error {
 	command := exec.Command("apt", "update")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
-	if err != nil {
-		return fmt.Errorf("command failed: %s", out.String())
-	}
-	return nil
+	command.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	_, _, err := linux.RunCommand(command)
+	return err
 }
 
 // CheckUpdates checks for available package updates using APT.
@@ -146,17 +286,78 @@ func AptUpdate() error {
 func CheckUpdates(updateType UpdateType) ([]AptPackage, error) {
 	var command *exec.Cmd
 	command = exec.Command("apt", "list", "--upgradable")
-	var out strings.Builder
-	command.Stdout = &out
-
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
 	}
-	updates := parseUpdates(out.String(), updateType)
+	updates := parseUpdates(out, updateType)
 	return updates, nil
 }
 
+// EstimateUpdateSize estimates the download size and the additional disk space
+// of updating the given packages. It runs the equivalent of
+// 'apt-get --assume-no --only-upgrade install' and parses the summary, nothing is installed.
+//
+// Parameters:
+//   - packages: The names of the packages to update
+//
+// Returns:
+//   - int64: The number of bytes to download
+//   - int64: The additional disk space in bytes, negative if disk space is freed
+//   - error: An error if the summary could not be parsed
+func EstimateUpdateSize(packages []string) (int64, int64, error) {
+	if len(packages) == 0 {
+		return 0, 0, nil
+	}
+	command := exec.Command("apt-get", "--assume-no", "--only-upgrade", "install")
+	command.Args = append(command.Args, packages...)
+	command.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	command.Stdin = nil
+	out, _, _ := linux.RunCommand(command) // apt-get exits with 1 after answering no
+	return parseUpdateSize(out)
+}
+
+var (
+	needToGetRe      = regexp.MustCompile(`Need to get ([0-9.,]+ ?[a-zA-Z]*)(?:/[0-9.,]+ ?[a-zA-Z]*)? of archives`)
+	afterOperationRe = regexp.MustCompile(`After this operation, ([0-9.,]+ ?[a-zA-Z]*) (of additional disk space will be used|disk space will be freed)`)
+)
+
+// parseUpdateSize parses the summary apt prints before asking to continue, e.g.
+// "Need to get 12.3 MB of archives." and "After this operation, 1,024 kB of additional disk space will be used."
+//
+// Parameters:
+//   - output: The output of the apt-get command
+//
+// Returns:
+//   - int64: The number of bytes to download
+//   - int64: The additional disk space in bytes, negative if disk space is freed
+//   - error: An error if the output contains no summary
+func parseUpdateSize(output string) (int64, int64, error) {
+	var download, installed int64
+	found := false
+	if match := needToGetRe.FindStringSubmatch(output); match != nil {
+		size, err := linux.ParseSize(match[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		download, found = size, true
+	}
+	if match := afterOperationRe.FindStringSubmatch(output); match != nil {
+		size, err := linux.ParseSize(match[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		if strings.HasSuffix(match[2], "freed") {
+			size = -size
+		}
+		installed, found = size, true
+	}
+	if !found && !strings.Contains(output, "0 upgraded") {
+		return 0, 0, fmt.Errorf("no size summary in apt output")
+	}
+	return download, installed, nil
+}
+
 // parseUpdates parses the output from 'apt list --upgradable' command.
 // It extracts package information and filters by update type if specified.
 //
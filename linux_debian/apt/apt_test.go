@@ -1,6 +1,7 @@
 package linux_debian_apt
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -55,3 +56,120 @@ func TestParseUpdates(t *testing.T) {
 	}
 
 }
+
+// testSampleLocalized is the output of apt with a German locale
+const testSampleLocalized = `
+Auflistung… Fertig
+base-files/noble-updates 13ubuntu10.2 arm64 [aktualisierbar von: 13ubuntu10.1]
+libc6/noble-updates,noble-security 2.39-0ubuntu8.4 arm64 [aktualisierbar von: 2.39-0ubuntu8.3]
+`
+
+func TestParseUpdatesLocalized(t *testing.T) {
+	updates := parseUpdates(testSampleLocalized, AllUpdates)
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 updates, got %d: %+v", len(updates), updates)
+	}
+	expected := AptPackage{Name: "libc6", Version: "2.39-0ubuntu8.4", Repo: "noble-updates,noble-security"}
+	if updates[1] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, updates[1])
+	}
+}
+
+const testConffileOutput = `Setting up openssh-server (1:9.6p1-3ubuntu13.5) ...
+
+Configuration file '/etc/ssh/sshd_config'
+ ==> Modified (by you or by a script) since installation.
+ ==> Package distributor has shipped an updated version.
+ ==> Keeping old config file as default.
+Setting up logrotate (3.21.0-2build1) ...
+Installing new version of config file /etc/logrotate.d/rsyslog ...
+Configuration file '/etc/default/grub'
+ ==> Modified (by you or by a script) since installation.
+ ==> Using new config file as default.
+`
+
+func TestParseConffileDecisions(t *testing.T) {
+	expected := []ConffileDecision{
+		{Path: "/etc/ssh/sshd_config", Decision: "kept"},
+		{Path: "/etc/logrotate.d/rsyslog", Decision: "replaced"},
+		{Path: "/etc/default/grub", Decision: "replaced"},
+	}
+	decisions := ParseConffileDecisions(testConffileOutput)
+	if len(decisions) != len(expected) {
+		t.Fatalf("Expected %d decisions, got %d: %+v", len(expected), len(decisions), decisions)
+	}
+	for i := range expected {
+		if decisions[i] != expected[i] {
+			t.Errorf("Expected decision %+v, got %+v", expected[i], decisions[i])
+		}
+	}
+}
+
+func TestNonInteractiveCommand(t *testing.T) {
+	command := nonInteractiveCommand("upgrade", "--assume-yes")
+	expectedArgs := []string{"apt", "-o", "Dpkg::Options::=--force-confdef", "-o", "Dpkg::Options::=--force-confold", "upgrade", "--assume-yes"}
+	if strings.Join(command.Args, " ") != strings.Join(expectedArgs, " ") {
+		t.Errorf("Expected args %v, got %v", expectedArgs, command.Args)
+	}
+	found := false
+	for _, env := range command.Env {
+		if env == "DEBIAN_FRONTEND=noninteractive" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected DEBIAN_FRONTEND=noninteractive in the environment")
+	}
+}
+
+const testUpgradeSummary = `Reading package lists...
+Building dependency tree...
+Reading state information...
+The following packages will be upgraded:
+  libc-bin libc6 libssl3t64
+3 upgraded, 0 newly installed, 0 to remove and 17 not upgraded.
+Need to get 5,912 kB/6,100 kB of archives.
+After this operation, 1,024 B of additional disk space will be used.
+Do you want to continue? [Y/n] N
+Abort.
+`
+
+func TestParseUpdateSize(t *testing.T) {
+	download, installed, err := parseUpdateSize(testUpgradeSummary)
+	if err != nil {
+		t.Fatalf("parseUpdateSize() error: %v", err)
+	}
+	if download != 5912000 || installed != 1024 {
+		t.Errorf("Expected 5912000 bytes to download and 1024 bytes installed, got %d and %d", download, installed)
+	}
+
+	_, installed, err = parseUpdateSize("After this operation, 2.5 MB disk space will be freed.\n")
+	if err != nil || installed != -2500000 {
+		t.Errorf("Expected -2500000 bytes installed, got %d (%v)", installed, err)
+	}
+
+	if _, _, err := parseUpdateSize("0 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.\n"); err != nil {
+		t.Errorf("Expected no error without upgrades, got %v", err)
+	}
+	if _, _, err := parseUpdateSize("E: Could not open lock file\n"); err == nil {
+		t.Error("Expected an error without a summary")
+	}
+}
+
+func TestParseOrphanedPackages(t *testing.T) {
+	const output = `Listing... Done
+adduser/noble,now 3.137ubuntu1 all [installed,automatic]
+google-chrome-stable/now 118.0.5993.70-1 amd64 [installed,local]
+libssl1.1/now 1.1.1f-1ubuntu2.20 amd64 [installed,auto-removable,local]
+`
+	packages := parseOrphanedPackages(output)
+	if len(packages) != 2 {
+		t.Fatalf("Expected 2 orphaned packages, got %d: %v", len(packages), packages)
+	}
+	if packages[0].Name != "google-chrome-stable" || packages[0].Version != "118.0.5993.70-1" || packages[0].Repo != "now" {
+		t.Errorf("Unexpected orphaned package %v", packages[0])
+	}
+	if packages[1].Name != "libssl1.1" {
+		t.Errorf("Expected libssl1.1, got %s", packages[1].Name)
+	}
+}
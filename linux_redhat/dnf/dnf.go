@@ -32,13 +32,16 @@ const (
 // UpdateAllPackages updates all packages on the system using DNF.
 // It runs the equivalent of 'dnf update --assumeyes --quiet' command.
 //
+// Parameters:
+//   - live: Receives the output while the update runs
+//
 // Returns:
 //   - string: Standard output from the DNF update command
 //   - string: Standard error output from the DNF update command
 //   - error: Any error that occurred during the update process
-func UpdateAllPackages() (string, string, error) {
+func UpdateAllPackages(live linux.LiveOutput) (string, string, error) {
 	command := exec.Command("dnf", "update", "--assumeyes", "--quiet")
-	return linux.RunCommand(command)
+	return linux.RunCommandLive(command, live)
 }
 
 // UpdatePackages updates the specified packages using the DNF package manager.
@@ -46,6 +49,7 @@ func UpdateAllPackages() (string, string, error) {
 //
 // Parameters:
 //   - packages: A slice of strings containing the names of packages to update
+//   - live: Receives the output while the update runs
 //
 // Returns:
 //   - string: Standard output from the DNF update command
@@ -54,14 +58,14 @@ func UpdateAllPackages() (string, string, error) {
 //
 // Example:
 //
-//	stdout, stderr, err := dnf.UpdatePackages([]string{"nginx", "curl"})
+//	stdout, stderr, err := dnf.UpdatePackages([]string{"nginx", "curl"}, linux.LiveOutput{})
 //	if err != nil {
 //	    log.Printf("Update failed: %v, stderr: %s", err, stderr)
 //	}
-func UpdatePackages(packages []string) (string, string, error) {
+func UpdatePackages(packages []string, live linux.LiveOutput) (string, string, error) {
 	command := exec.Command("dnf", "update", "--assumeyes", "--quiet")
 	command.Args = append(command.Args, packages...)
-	return linux.RunCommand(command)
+	return linux.RunCommandLive(command, live)
 }
 
 // InstallPackages installs the specified packages using the DNF package manager.
@@ -88,14 +92,12 @@ func InstallPackages(packages []string) (string, string, error) {
 //   - error: Any error that occurred during the retrieval process
 func GetInstalledPackages() ([]DnfPackage, error) {
 	command := exec.Command("dnf", "repoquery", "--installed", "--qf", "%{name}.%{arch} %{epoch}:%{version}-%{release} %{from_repo}", "--quiet")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
 	}
 
-	return parseInstalledPackages(out.String()), nil
+	return parseInstalledPackages(out), nil
 }
 
 // parseInstalledPackages parses the output from 'dnf list installed' command.
@@ -127,6 +129,23 @@ func parseInstalledPackages(output string) []DnfPackage {
 	return packages
 }
 
+// GetOrphanedPackages retrieves the installed packages that are not available
+// from any enabled repository anymore, e.g. abandoned third-party packages.
+// It executes 'dnf repoquery --extras' and parses the output.
+//
+// Returns:
+//   - []DnfPackage: A slice of DnfPackage structs of the orphaned packages
+//   - error: Any error that occurred during the retrieval process
+func GetOrphanedPackages() ([]DnfPackage, error) {
+	command := exec.Command("dnf", "repoquery", "--extras", "--qf", "%{name}.%{arch} %{epoch}:%{version}-%{release} %{from_repo}", "--quiet")
+	out, _, err := linux.RunCommand(command)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseInstalledPackages(out), nil
+}
+
 // parseUpdateSummary parses the output from 'dnf updateinfo --summary' command.
 // It extracts update information including security, bugfix, and enhancement counts.
 //
@@ -176,22 +195,95 @@ func CheckUpdates(updateType UpdateType) ([]DnfPackage, error) {
 	if updateType == SecurityUpdates {
 		command.Args = append(command.Args, "--secseverity", "Important")
 	}
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
 		// Exit code 100 indicates updates are available, which is not an error in this context
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 100 {
+		if command.ProcessState != nil && command.ProcessState.ExitCode() == 100 {
 			// Treat exit code 100 as a success
 		} else {
-			return nil, fmt.Errorf("command failed: %s", out.String())
+			return nil, err
 		}
 	}
 
-	updates := parseUpdates(out.String())
+	updates := parseUpdates(out)
 	return updates, nil
 }
 
+// EstimateUpdateSize estimates the download and installed size of updating the given packages.
+// It runs the equivalent of 'dnf upgrade --assumeno' and parses the transaction summary,
+// nothing is installed.
+//
+// Parameters:
+//   - packages: The names of the packages to update
+//
+// Returns:
+//   - int64: The number of bytes to download
+//   - int64: The installed size in bytes
+//   - error: An error if the transaction summary could not be parsed
+func EstimateUpdateSize(packages []string) (int64, int64, error) {
+	if len(packages) == 0 {
+		return 0, 0, nil
+	}
+	command := exec.Command("dnf", "upgrade", "--assumeno")
+	command.Args = append(command.Args, packages...)
+	out, _, _ := linux.RunCommand(command) // dnf exits with 1 when the transaction is declined
+	return parseUpdateSize(out)
+}
+
+var (
+	// dnf4: "Total download size: 61 M" and "Installed size: 208 M"
+	downloadSizeRe  = regexp.MustCompile(`(?m)^Total download size: (.+)$`)
+	installedSizeRe = regexp.MustCompile(`(?m)^Installed size: (.+)$`)
+	// dnf5: "Total size of inbound packages is 61 MiB. Need to download 61 MiB." and
+	// "After this operation, 208 MiB extra will be used (install 208 MiB, remove 0 B)."
+	needToDownloadRe = regexp.MustCompile(`Need to download ([0-9.,]+ ?[a-zA-Z]*)\.`)
+	extraUsedRe      = regexp.MustCompile(`After this operation, ([0-9.,]+ ?[a-zA-Z]*) (extra will be used|will be freed)`)
+)
+
+// parseUpdateSize parses the transaction summary of dnf4 and dnf5.
+//
+// Parameters:
+//   - output: The output of the dnf upgrade command
+//
+// Returns:
+//   - int64: The number of bytes to download
+//   - int64: The installed size in bytes, negative if disk space is freed
+//   - error: An error if the output contains no transaction summary
+func parseUpdateSize(output string) (int64, int64, error) {
+	var download, installed int64
+	found := false
+	for _, re := range []*regexp.Regexp{downloadSizeRe, needToDownloadRe} {
+		if match := re.FindStringSubmatch(output); match != nil {
+			size, err := linux.ParseSize(match[1])
+			if err != nil {
+				return 0, 0, err
+			}
+			download, found = size, true
+		}
+	}
+	if match := installedSizeRe.FindStringSubmatch(output); match != nil {
+		size, err := linux.ParseSize(match[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		installed, found = size, true
+	}
+	if match := extraUsedRe.FindStringSubmatch(output); match != nil {
+		size, err := linux.ParseSize(match[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		if match[2] == "will be freed" {
+			size = -size
+		}
+		installed, found = size, true
+	}
+	if !found && !strings.Contains(output, "Nothing to do") {
+		return 0, 0, fmt.Errorf("no transaction summary in dnf output")
+	}
+	return download, installed, nil
+}
+
 // CheckUpdateSummary retrieves a summary of available updates categorized by type.
 // It executes 'dnf updateinfo --summary --quiet' and parses the results.
 //
@@ -200,13 +292,11 @@ func CheckUpdates(updateType UpdateType) ([]DnfPackage, error) {
 //   - error: Any error that occurred during the summary retrieval process
 func CheckUpdateSummary() (DnfUpdateSummary, error) {
 	command := exec.Command("dnf", "updateinfo", "--summary", "--quiet")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return DnfUpdateSummary{}, fmt.Errorf("command failed: %s", out.String())
+		return DnfUpdateSummary{}, err
 	}
-	summary := parseUpdateSummary(out.String())
+	summary := parseUpdateSummary(out)
 
 	return summary, nil
 }
@@ -219,14 +309,12 @@ func CheckUpdateSummary() (DnfUpdateSummary, error) {
 //   - error: Any error that occurred during the retrieval process
 func CheckUpdateInfoList() ([]DnfPackage, error) {
 	command := exec.Command("dnf", "updateinfo", "list", "--quiet")
-	var out strings.Builder
-	command.Stdout = &out
-	err := command.Run()
+	out, _, err := linux.RunCommand(command)
 	if err != nil {
-		return nil, fmt.Errorf("command failed: %s", out.String())
+		return nil, err
 	}
 
-	lines := strings.Split(out.String(), "\n")
+	lines := strings.Split(out, "\n")
 	packages := []DnfPackage{}
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "Last metadata expiration check") {
@@ -196,3 +196,60 @@ func TestParseUpdateSummaryOnlySecurityUpdates(t *testing.T) {
 		t.Errorf("Expected only security updates summary %+v, got %+v", expectedSummary, summary)
 	}
 }
+
+const testDnf4Transaction = `Dependencies resolved.
+================================================================================
+ Package          Arch       Version                 Repository          Size
+================================================================================
+Upgrading:
+ kernel-core      x86_64     5.14.0-427.el9          baseos              20 M
+ openssl-libs     x86_64     1:3.0.7-27.el9          baseos             2.2 M
+
+Transaction Summary
+================================================================================
+Upgrade  2 Packages
+
+Total download size: 22 M
+Installed size: 65 M
+Operation aborted.
+`
+
+const testDnf5Transaction = `Updating and loading repositories:
+Repositories loaded.
+Package                 Arch   Version          Repository      Size
+Upgrading:
+ openssl-libs           x86_64 1:3.2.2-3.fc41   updates      7.8 MiB
+
+Transaction Summary:
+ Upgrading:          1 package
+ Replacing:          1 package
+
+Total size of inbound packages is 2 MiB. Need to download 1.5 MiB.
+After this operation, 512 KiB extra will be used (install 7.8 MiB, remove 7.3 MiB).
+Operation aborted by the user.
+`
+
+func TestParseUpdateSize(t *testing.T) {
+	download, installed, err := parseUpdateSize(testDnf4Transaction)
+	if err != nil {
+		t.Fatalf("parseUpdateSize() error: %v", err)
+	}
+	if download != 22<<20 || installed != 65<<20 {
+		t.Errorf("Expected %d and %d bytes, got %d and %d", 22<<20, 65<<20, download, installed)
+	}
+
+	download, installed, err = parseUpdateSize(testDnf5Transaction)
+	if err != nil {
+		t.Fatalf("parseUpdateSize() error: %v", err)
+	}
+	if download != 3<<19 || installed != 512<<10 {
+		t.Errorf("Expected %d and %d bytes, got %d and %d", 3<<19, 512<<10, download, installed)
+	}
+
+	if _, _, err := parseUpdateSize("Dependencies resolved.\nNothing to do.\n"); err != nil {
+		t.Errorf("Expected no error without updates, got %v", err)
+	}
+	if _, _, err := parseUpdateSize("Error: Failed to download metadata\n"); err == nil {
+		t.Error("Expected an error without a transaction summary")
+	}
+}
@@ -0,0 +1,139 @@
+// Package cloudguardian_logging filters the output of the agent by verbosity. The agent writes
+// plain log lines, they are classified by their wording, so noisy collectors
+// can be silenced with the warn or error level while API errors stay visible.
+// Debug and trace messages are only written at their level.
+package cloudguardian_logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a verbosity level, higher levels write more
+type Level int32
+
+const (
+	LevelError Level = iota // Errors and failures only
+	LevelWarn               // Also warnings and skipped tasks
+	LevelInfo               // Also the progress of the tasks, the default
+	LevelDebug              // Also every API request and the collected data
+	LevelTrace              // Also the API request and response bodies
+)
+
+// levelNames are the names of the levels, indexed by level
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+// level is the current level
+var level atomic.Int32
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// String returns the name of the level, e.g. "info"
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// LevelNames returns the names of the levels from error to trace
+func LevelNames() []string {
+	return append([]string{}, levelNames...)
+}
+
+// ParseLevel parses the name of a level.
+//
+// Parameters:
+//   - name: error, warn, info, debug or trace
+//
+// Returns:
+//   - Level: The level
+//   - error: An error if the name is unknown
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, known levels are %s", name, strings.Join(levelNames, ", "))
+}
+
+// SetLevel sets the current level
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// CurrentLevel returns the current level
+func CurrentLevel() Level {
+	return Level(level.Load())
+}
+
+// Enabled reports whether messages of a level are written
+func Enabled(l Level) bool {
+	return l <= CurrentLevel()
+}
+
+// LineLevel classifies a plain log line as error, warn or info by its wording.
+//
+// Parameters:
+//   - line: The log line
+//
+// Returns:
+//   - Level: LevelError, LevelWarn or LevelInfo
+func LineLevel(line string) Level {
+	line = strings.ToLower(line)
+	switch {
+	case strings.Contains(line, "error") || strings.Contains(line, "failed") || strings.Contains(line, "panic"):
+		return LevelError
+	case strings.Contains(line, "warning") || strings.Contains(line, "skipping") || strings.Contains(line, "degraded"):
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// filter drops the log lines below the current level
+type filter struct {
+	next io.Writer
+}
+
+func (f *filter) Write(p []byte) (int, error) {
+	// The standard logger writes every line with a single call
+	if LineLevel(string(p)) > CurrentLevel() {
+		return len(p), nil
+	}
+	return f.next.Write(p)
+}
+
+// Install filters the standard logger by the current level.
+//
+// Parameters:
+//   - w: Receives the lines that are written, e.g. os.Stderr
+func Install(w io.Writer) {
+	log.SetOutput(&filter{next: w})
+}
+
+// Debug logs a message like log.Println at the debug level
+func Debug(v ...any) {
+	if Enabled(LevelDebug) {
+		log.Println(v...)
+	}
+}
+
+// Debugf logs a message like log.Printf at the debug level
+func Debugf(format string, v ...any) {
+	if Enabled(LevelDebug) {
+		log.Printf(format, v...)
+	}
+}
+
+// Trace logs a message like log.Println at the trace level
+func Trace(v ...any) {
+	if Enabled(LevelTrace) {
+		log.Println(v...)
+	}
+}
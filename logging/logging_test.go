@@ -0,0 +1,54 @@
+package cloudguardian_logging
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for i, name := range LevelNames() {
+		parsed, err := ParseLevel(name)
+		if err != nil || parsed != Level(i) || parsed.String() != name {
+			t.Errorf("ParseLevel(%q) = %v, %v", name, parsed, err)
+		}
+	}
+	if parsed, err := ParseLevel("DEBUG"); err != nil || parsed != LevelDebug {
+		t.Errorf("Expected the level name to be case insensitive, got %v, %v", parsed, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("Expected an unknown level to be rejected")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var output bytes.Buffer
+	Install(&output)
+	flags := log.Flags()
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+		SetLevel(LevelInfo)
+	}()
+
+	SetLevel(LevelWarn)
+	log.Println("Collected 120 processes")
+	log.Println("API circuit breaker is open, skipping monitoring submission")
+	log.Println("Error submitting monitoring (retrying later) - Status code: 503")
+	Debug("API GET /jobs -> 200")
+	expected := "API circuit breaker is open, skipping monitoring submission\nError submitting monitoring (retrying later) - Status code: 503\n"
+	if output.String() != expected {
+		t.Errorf("Expected %q at the warn level, got %q", expected, output.String())
+	}
+
+	output.Reset()
+	SetLevel(LevelDebug)
+	log.Println("Collected 120 processes")
+	Debug("API GET /jobs -> 200")
+	Trace("API response body")
+	if expected := "Collected 120 processes\nAPI GET /jobs -> 200\n"; output.String() != expected {
+		t.Errorf("Expected %q at the debug level, got %q", expected, output.String())
+	}
+}
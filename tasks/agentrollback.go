@@ -0,0 +1,115 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	"cloud-guardian/cloudguardian_version"
+	linux_installer "cloud-guardian/linux/installer"
+	"encoding/json"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// agentRollbackTimeout is how long the restarted agent has to start the new version
+// before the previous binary is restored. It is longer than agentRestartGrace, so
+// the restored agent fails the update_agent job right away.
+const agentRollbackTimeout = 5 * time.Minute
+
+// agentUpdatePath contains the agent update whose new version has not started yet
+var agentUpdatePath = cloudguardian_config.StateDir + "/agent-update.json"
+
+// pendingAgentUpdate is an installed agent binary that has not started yet
+type pendingAgentUpdate struct {
+	Path            string `json:"path"`             // The agent binary, the previous one is path.old
+	Version         string `json:"version"`          // The version of the new binary
+	PreviousVersion string `json:"previous_version"` // The version of the previous binary
+}
+
+// scheduleAgentRollback starts a systemd timer that runs the previous binary with
+// rollback-agent after agentRollbackTimeout, replaced by tests. The timer is not
+// part of the agent service, so it survives the restart.
+var scheduleAgentRollback = func(oldPath string) error {
+	return exec.Command("systemd-run", "--quiet", "--collect", "--unit="+linux_installer.ServiceName+"-rollback",
+		"--on-active="+strconv.Itoa(int(agentRollbackTimeout.Seconds())), oldPath, "rollback-agent").Run()
+}
+
+// restartUpdatedAgent restarts the agent after installAgent replaced its binary.
+// The previous binary is restored by RollbackAgentUpdate unless the new version
+// starts in time, see confirmAgentUpdate.
+//
+// Parameters:
+//   - path: The agent binary
+//   - version: The version of the new binary
+//
+// Returns:
+//   - error: An error if the service could not be restarted
+func restartUpdatedAgent(path string, version string) error {
+	update := pendingAgentUpdate{Path: path, Version: version, PreviousVersion: cloudguardian_version.Version}
+	data, err := json.Marshal(update)
+	if err == nil {
+		err = cloudguardian_config.WriteFileAtomic(agentUpdatePath, data, 0600)
+	}
+	if err == nil {
+		err = scheduleAgentRollback(path + ".old")
+	}
+	if err != nil {
+		os.Remove(agentUpdatePath)
+		log.Println("Error scheduling the rollback of the agent update, restarting without it:", err.Error())
+	}
+	return restartAgent()
+}
+
+// loadPendingAgentUpdate returns the agent update whose new version has not started yet
+//
+// Returns:
+//   - pendingAgentUpdate: The update
+//   - bool: false if no update is pending or the state is unreadable
+func loadPendingAgentUpdate() (pendingAgentUpdate, bool) {
+	var update pendingAgentUpdate
+	data, err := os.ReadFile(agentUpdatePath)
+	if err != nil {
+		return update, false
+	}
+	if err := json.Unmarshal(data, &update); err != nil || update.Path == "" {
+		log.Println("Error reading the pending agent update:", agentUpdatePath)
+		return update, false
+	}
+	return update, true
+}
+
+// confirmAgentUpdate cancels the rollback of an agent update once the agent runs
+// the new version. It is called when the agent service starts.
+func confirmAgentUpdate() {
+	update, ok := loadPendingAgentUpdate()
+	if !ok || !sameVersion(update.Version, cloudguardian_version.Version) {
+		return
+	}
+	if err := os.Remove(agentUpdatePath); err != nil {
+		log.Println("Error confirming the agent update:", err.Error())
+		return
+	}
+	log.Println("Agent version", update.Version, "started, the previous version", update.PreviousVersion, "is not restored")
+}
+
+// RollbackAgentUpdate restores the previous agent binary if the new version did
+// not start in time and restarts the service. It runs as the previous binary,
+// started by the timer of scheduleAgentRollback. The restored agent fails the
+// update_agent job, see checkAgentUpdate.
+//
+// Returns:
+//   - bool: true if the previous binary was restored, false if the new version started
+//   - error: An error if the previous binary could not be restored or the service could not be restarted
+func RollbackAgentUpdate() (bool, error) {
+	update, ok := loadPendingAgentUpdate()
+	if !ok {
+		return false, nil
+	}
+	if err := os.Rename(update.Path+".old", update.Path); err != nil {
+		return false, err
+	}
+	os.Remove(agentUpdatePath)
+	log.Println("Agent version", update.Version, "did not start, restored version", update.PreviousVersion)
+	return true, restartAgent()
+}
@@ -0,0 +1,113 @@
+package tasks
+
+import (
+	linux_df "cloud-guardian/linux/df"
+	linux_ip "cloud-guardian/linux/ip"
+	linux_loggedinusers "cloud-guardian/linux/loggedinusers"
+	linux_lsblk "cloud-guardian/linux/lsblk"
+	linux_mdstat "cloud-guardian/linux/mdstat"
+	linux_needrestart "cloud-guardian/linux/needrestart"
+	linux_pmhealth "cloud-guardian/linux/pmhealth"
+	linux_power "cloud-guardian/linux/power"
+	linux_quota "cloud-guardian/linux/quota"
+	linux_top "cloud-guardian/linux/top"
+	"maps"
+	"runtime"
+	"slices"
+	"time"
+)
+
+// BenchCollectors are the collectors measured by Bench. Collectors that read
+// several values are split, e.g. top.tasks, to find the slow part.
+var BenchCollectors = map[string]func() error{
+	"uptime": func() error {
+		_, err := linux_top.GetUptime()
+		return err
+	},
+	"loggedinusers": func() error {
+		_, err := linux_loggedinusers.GetLoggedInUsers()
+		return err
+	},
+	"df": func() error {
+		_, err := linux_df.GetDf()
+		return err
+	},
+	"ip.interfaces": func() error {
+		_, err := linux_ip.GetIPInterfaces()
+		return err
+	},
+	"ip.routes": func() error {
+		_, err := linux_ip.GetRoutes()
+		return err
+	},
+	"egress": func() error {
+		_, err := linux_ip.GetEgressIdentity(currentConfig().ApiUrl)
+		return err
+	},
+	"top.cpuusage": func() error { linux_top.GetCpuUsage(); return nil },
+	"top.cpuinfo":  func() error { linux_top.GetCpuInfo(); return nil },
+	"top.load":     func() error { linux_top.GetLoad(); return nil },
+	"top.memory":   func() error { linux_top.GetMemory(); return nil },
+	"top.tasks":    func() error { linux_top.GetTasks(); return nil },
+	"lsblk":        func() error { linux_lsblk.GetLsBlk(); return nil },
+	"mdstat":       func() error { linux_mdstat.GetMdStat(); return nil },
+	"needrestart":  func() error { linux_needrestart.GetNeedRestart(); return nil },
+	"pmhealth":     func() error { linux_pmhealth.Check(); return nil },
+	"power":        func() error { linux_power.GetPower(); return nil },
+	"quota":        func() error { linux_quota.GetQuotas(); return nil },
+}
+
+// BenchResult holds the measurements of a collector
+type BenchResult struct {
+	Collector   string
+	Runs        int
+	Errors      int
+	Min         time.Duration
+	Avg         time.Duration
+	Max         time.Duration
+	AllocsPerOp uint64 // Heap allocations per run
+	BytesPerOp  uint64 // Allocated heap bytes per run
+	LastError   error
+}
+
+// BenchCollectorNames returns the names of the benchmarked collectors in alphabetical order
+func BenchCollectorNames() []string {
+	return slices.Sorted(maps.Keys(BenchCollectors))
+}
+
+// Bench runs a collector several times and measures its duration and allocations.
+// The allocations are those of the whole process while the collector runs, the
+// agent should not process tasks at the same time.
+//
+// Parameters:
+//   - name: The name of the collector, see BenchCollectors
+//   - collector: The collector
+//   - runs: How often the collector runs, at least once
+//
+// Returns:
+//   - BenchResult: The measurements
+func Bench(name string, collector func() error, runs int) BenchResult {
+	result := BenchResult{Collector: name, Runs: max(runs, 1)}
+	var total time.Duration
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for range result.Runs {
+		start := time.Now()
+		err := collector()
+		duration := time.Since(start)
+		if err != nil {
+			result.Errors++
+			result.LastError = err
+		}
+		total += duration
+		if result.Min == 0 || duration < result.Min {
+			result.Min = duration
+		}
+		result.Max = max(result.Max, duration)
+	}
+	runtime.ReadMemStats(&after)
+	result.Avg = total / time.Duration(result.Runs)
+	result.AllocsPerOp = (after.Mallocs - before.Mallocs) / uint64(result.Runs)
+	result.BytesPerOp = (after.TotalAlloc - before.TotalAlloc) / uint64(result.Runs)
+	return result
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCollectorOverrideMinutes = 60   // Duration of a collector_intervals job without duration_minutes
+	maxCollectorOverrideMinutes     = 1440 // Upper bound of the duration of a collector_intervals job
+)
+
+// collectorIntervalSlack lets a collector run in a cycle that starts slightly before
+// its interval elapsed, the task loop does not run at exact minutes
+const collectorIntervalSlack = 30 * time.Second
+
+// collectorIntervalsJob is the job data of a collector_intervals job, e.g.
+// {"intervals": {"df": 1, "top": 1}, "duration_minutes": 120}. An empty intervals
+// map removes the overrides of an earlier job.
+type collectorIntervalsJob struct {
+	Intervals       map[string]int `json:"intervals"`        // Minutes between runs by collector
+	DurationMinutes int            `json:"duration_minutes"` // The configured intervals apply again afterwards
+}
+
+// collectorSchedule contains the interval overrides pushed by the server and the
+// last run of each collector. The overrides are kept in memory only, a restart of
+// the agent returns to the configured intervals.
+var collectorSchedule = struct {
+	sync.Mutex
+	overrides map[string]int
+	expires   time.Time
+	lastRun   map[string]time.Time
+}{lastRun: map[string]time.Time{}}
+
+// parseCollectorIntervalsJobData parses and validates the job data of a collector_intervals job
+func parseCollectorIntervalsJobData(jobData string) (collectorIntervalsJob, error) {
+	var job collectorIntervalsJob
+	if err := json.Unmarshal([]byte(jobData), &job); err != nil {
+		return job, fmt.Errorf("job data is not valid JSON: %w", err)
+	}
+	for name, interval := range job.Intervals {
+		if !slices.Contains(cloudguardian_config.Collectors, name) {
+			return job, fmt.Errorf("unknown collector %q", name)
+		}
+		if interval < cloudguardian_config.MinMonitoringInterval || interval > cloudguardian_config.MaxCollectorInterval {
+			return job, fmt.Errorf("interval of %s must be between %d and %d minutes", name, cloudguardian_config.MinMonitoringInterval, cloudguardian_config.MaxCollectorInterval)
+		}
+	}
+	if job.DurationMinutes == 0 {
+		job.DurationMinutes = defaultCollectorOverrideMinutes
+	}
+	if job.DurationMinutes < 0 || job.DurationMinutes > maxCollectorOverrideMinutes {
+		return job, fmt.Errorf("duration_minutes must be between 1 and %d", maxCollectorOverrideMinutes)
+	}
+	return job, nil
+}
+
+// processJobCollectorIntervals applies the collector intervals of a job until the
+// duration of the job elapsed, without a restart of the agent
+func processJobCollectorIntervals(hostname string, jobId string, jobData string) {
+	log.Println("Processing collector_intervals job for job ID:", jobId)
+	startedAt := time.Now()
+	job, err := parseCollectorIntervalsJobData(jobData)
+	if err != nil {
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, fmt.Sprintf("invalid collector_intervals job data: %s", err.Error())))
+		return
+	}
+
+	result := runningResult(startedAt)
+	collectorSchedule.Lock()
+	if len(job.Intervals) == 0 {
+		collectorSchedule.overrides = nil
+		result.Message = "removed the collector interval overrides"
+	} else {
+		collectorSchedule.overrides = job.Intervals
+		collectorSchedule.expires = startedAt.Add(time.Duration(job.DurationMinutes) * time.Minute)
+		result.Message = "applied the collector intervals until " + collectorSchedule.expires.UTC().Format(time.RFC3339)
+	}
+	collectorSchedule.Unlock()
+	log.Println("Collector intervals:", result.Message)
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	updateJobStatus(hostname, jobId, "completed", result)
+}
+
+// collectorInterval returns the interval of a collector, an override of the server
+// takes precedence over the configuration until it expires
+func collectorInterval(name string, now time.Time) time.Duration {
+	collectorSchedule.Lock()
+	defer collectorSchedule.Unlock()
+	if collectorSchedule.overrides != nil && now.After(collectorSchedule.expires) {
+		log.Println("Collector interval overrides expired, using the configured intervals")
+		collectorSchedule.overrides = nil
+	}
+	if interval, ok := collectorSchedule.overrides[name]; ok {
+		return time.Duration(interval) * time.Minute
+	}
+	return time.Duration(currentConfig().CollectorInterval(name)) * time.Minute
+}
+
+// collectorDue reports whether the interval of a collector elapsed since its last run
+func collectorDue(name string, now time.Time) bool {
+	interval := collectorInterval(name, now)
+	collectorSchedule.Lock()
+	defer collectorSchedule.Unlock()
+	lastRun, ok := collectorSchedule.lastRun[name]
+	return !ok || now.Sub(lastRun) >= interval-collectorIntervalSlack
+}
+
+// recordCollectorRun stores the start of a collector run
+func recordCollectorRun(name string, now time.Time) {
+	collectorSchedule.Lock()
+	defer collectorSchedule.Unlock()
+	collectorSchedule.lastRun[name] = now
+}
+
+// collectorsDue reports whether an enabled collector is due, the task loop then runs
+// the monitoring between the regular monitoring cycles
+func collectorsDue(now time.Time) bool {
+	for _, name := range cloudguardian_config.Collectors {
+		if currentConfig().CollectorEnabled(name) && collectorDue(name, now) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	cloudguardian_faults "cloud-guardian/faults"
+	linux_fileattrs "cloud-guardian/linux/fileattrs"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// criticalFilesPath contains the critical files of the last submitted drift check,
+// so owner and attribute changes made while the agent was stopped, e.g. by an
+// attacker who restarts the host, are reported after its restart
+var criticalFilesPath = cloudguardian_config.StateDir + "/critical-files.json"
+
+// loadCriticalFiles returns the critical files of the last submitted drift check
+//
+// Returns:
+//   - []linux_fileattrs.File: The critical files, nil before the first check or if the state is unreadable
+func loadCriticalFiles() []linux_fileattrs.File {
+	data, err := os.ReadFile(criticalFilesPath)
+	if err != nil {
+		return nil
+	}
+	criticalFiles := []linux_fileattrs.File{}
+	if err := json.Unmarshal(data, &criticalFiles); err != nil {
+		log.Println("Error reading the critical files of the last drift check:", err.Error())
+		return nil
+	}
+	return criticalFiles
+}
+
+// saveCriticalFiles stores the critical files of a submitted drift check, see loadCriticalFiles
+//
+// Parameters:
+//   - criticalFiles: The critical files
+func saveCriticalFiles(criticalFiles []linux_fileattrs.File) {
+	data, err := json.Marshal(criticalFiles)
+	if err != nil {
+		log.Println("Error encoding the critical files:", err.Error())
+		return
+	}
+	if err := cloudguardian_config.WriteFileAtomic(criticalFilesPath, cloudguardian_faults.CorruptState(criticalFilesPath, data), 0600); err != nil {
+		log.Println("Error writing the critical files:", err.Error())
+	}
+}
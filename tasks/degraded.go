@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	degradedInitialBackoff = 5 * time.Minute // Wait after the first persistent failure
+	degradedMaxBackoff     = 6 * time.Hour   // Upper bound of the escalating backoff
+)
+
+// degradedState tracks API failures that need an operator, e.g. a revoked API key.
+// The agent keeps running and retries with an escalating backoff instead of
+// exiting, so monitoring resumes by itself once the problem is fixed. The state
+// is sticky until the API accepts a ping again and is reported with every ping.
+type degradedState struct {
+	mutex       sync.Mutex
+	code        api.ErrorCode // Error code of the failure
+	reason      string        // Why the agent is degraded, empty if it is not
+	since       time.Time     // First failure
+	failures    int           // Consecutive failures
+	nextAttempt time.Time     // Requests are skipped until then
+}
+
+// degraded is the degraded state of the agent
+var degraded = &degradedState{}
+
+// fail records a persistent failure and schedules the next attempt.
+//
+// Parameters:
+//   - code: The error code of the failure
+//   - reason: The reason, reported with the heartbeat
+//
+// Returns:
+//   - time.Duration: The backoff until the next attempt
+func (d *degradedState) fail(code api.ErrorCode, reason string) time.Duration {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.reason == "" {
+		d.since = time.Now()
+	}
+	d.code, d.reason = code, reason
+	d.failures++
+	backoff := degradedInitialBackoff
+	for i := 1; i < d.failures && backoff < degradedMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, degradedMaxBackoff)
+	d.nextAttempt = time.Now().Add(backoff)
+	return backoff
+}
+
+// clear resets the state after the API accepted a request again
+func (d *degradedState) clear() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.reason != "" {
+		log.Println("Agent is no longer degraded after", time.Since(d.since).Round(time.Second), "- reason was:", d.reason)
+	}
+	d.code, d.reason, d.since, d.failures, d.nextAttempt = "", "", time.Time{}, 0, time.Time{}
+}
+
+// allow reports whether requests may be sent, false while backing off
+func (d *degradedState) allow() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return !time.Now().Before(d.nextAttempt)
+}
+
+// status returns the error code, the reason and the start of the degraded state, the reason is empty if it is not degraded
+func (d *degradedState) status() (api.ErrorCode, string, time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.code, d.reason, d.since
+}
@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	pm "cloud-guardian/linux/packagemanager"
+	linux_reboot "cloud-guardian/linux/reboot"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// dryRunJobTypes are the job types that are simulated in dry-run mode
+var dryRunJobTypes = map[string]bool{"update": true, "reboot": true, "command": true, "script": true, "swap": true, "update_agent": true}
+
+// simulateJob reports what a job would do with the status "simulated" instead of
+// running it, so the job plumbing can be tested on production hosts. The result
+// carries the packages, the command or the reboot method in its metadata.
+func simulateJob(hostname string, job api.HostJob) {
+	log.Println("Dry run: simulating", job.JobType, "job", job.JobId)
+	startedAt := time.Now()
+	result := runningResult(startedAt)
+	result.Metadata = map[string]string{"dry_run": "true"}
+	switch job.JobType {
+	case "update":
+		packages := strings.Split(job.JobData, ",")
+		if packages[0] == "all" {
+			packages = pendingUpdateNames()
+			result.Message = "would update all packages"
+		} else {
+			result.Message = "would update the packages"
+		}
+		result.Metadata["packages"] = strings.Join(packages, ",")
+	case "reboot":
+		method, err := linux_reboot.ResolveMethod(currentConfig().RebootMethod)
+		if err != nil {
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "Reboot would fail: "+err.Error()))
+			return
+		}
+		if strings.TrimSpace(job.JobData) == linux_reboot.MethodSoft && linux_reboot.SupportsSoftReboot() {
+			method = linux_reboot.MethodSoft
+		}
+		result.Message = "would reboot via " + method
+		result.Metadata["method"] = method
+	case "command", "script":
+		execJob, err := parseExecJobData(job.JobType, job.JobData)
+		var runAs jobUser
+		if err == nil {
+			runAs, err = lookupJobUser(execJob.User, execJob.Group)
+		}
+		if err != nil {
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, fmt.Sprintf("invalid %s job data: %s", job.JobType, err.Error())))
+			return
+		}
+		result.Message = "would execute the " + job.JobType
+		result.Metadata[job.JobType] = execJob.Command + execJob.Script
+		result.Metadata["timeout_seconds"] = fmt.Sprint(execJob.TimeoutSeconds)
+		result.Metadata["user"] = runAs.Name
+	case "swap":
+		swapJob, err := parseSwapJobData(job.JobData)
+		if err != nil {
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, fmt.Sprintf("invalid swap job data: %s", err.Error())))
+			return
+		}
+		result.Message = fmt.Sprintf("would %s swap", swapJob.Action)
+		result.Metadata["action"] = swapJob.Action
+		result.Metadata["path"] = swapJob.Path
+		result.Metadata["size_mb"] = fmt.Sprint(swapJob.SizeMB)
+	case "update_agent":
+		updateAgentJob, err := parseUpdateAgentJobData(job.JobData, currentConfig().ApiUrl)
+		if err != nil {
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid update_agent job data: "+err.Error()))
+			return
+		}
+		result.Message = "would update the agent to " + updateAgentJob.Version
+		result.Metadata["version"] = updateAgentJob.Version
+		result.Metadata["url"] = updateAgentJob.Url
+	}
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	updateJobStatus(hostname, job.JobId, "simulated", result)
+}
+
+// pendingUpdateNames returns the names of the packages with pending updates, or
+// "all" if they cannot be checked
+func pendingUpdateNames() []string {
+	packageManager, err := pm.DetectPackageManager()
+	if err != nil {
+		return []string{"all"}
+	}
+	updates, err := packageManager.CheckUpdates(pm.AllUpdates)
+	if err != nil {
+		log.Println("Dry run: error checking updates:", err.Error())
+		return []string{"all"}
+	}
+	names := make([]string, len(updates))
+	for i, update := range updates {
+		names[i] = update.Name
+	}
+	return names
+}
@@ -0,0 +1,202 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	linux "cloud-guardian/linux"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// jobProcessPath is the PATH of a job that runs as another user
+const jobProcessPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// jobProcessWaitDelay is how long the output of a killed command or script is
+// read, processes started by it may keep its output open
+const jobProcessWaitDelay = 5 * time.Second
+
+// execJob is the job data of a command or script job. The job data is either the
+// command or script itself or a JSON object that sets the timeout or the user,
+// e.g. {"command": "apt-get clean", "timeout_seconds": 60, "user": "deploy"}.
+type execJob struct {
+	Command        string `json:"command"`         // The command of a command job
+	Script         string `json:"script"`          // The script of a script job
+	TimeoutSeconds int    `json:"timeout_seconds"` // Overrides the command_timeout or script_timeout
+	User           string `json:"user"`            // Runs the job as this user, name or UID, instead of the agent user
+	Group          string `json:"group"`           // Runs the job with this group, name or GID, instead of the primary group of the user
+}
+
+// timeout returns how long the job may run
+func (job execJob) timeout() time.Duration {
+	return time.Duration(job.TimeoutSeconds) * time.Second
+}
+
+// parseExecJobData parses the job data of a command or script job. Job data that
+// is not a JSON object with the command or script, e.g. "{ echo a; }", is the
+// command or script itself. The timeout is the configured one unless the job
+// sets it.
+//
+// Parameters:
+//   - jobType: The job type, "command" or "script"
+//   - jobData: The job data
+//
+// Returns:
+//   - execJob: The job with the command or script and the timeout
+//   - error: An error if the timeout of the job is out of range
+func parseExecJobData(jobType string, jobData string) (execJob, error) {
+	var job execJob
+	if !strings.HasPrefix(strings.TrimSpace(jobData), "{") || json.Unmarshal([]byte(jobData), &job) != nil ||
+		(jobType == "command" && job.Command == "") || (jobType == "script" && job.Script == "") {
+		job = execJob{}
+		if jobType == "script" {
+			job.Script = jobData
+		} else {
+			job.Command = jobData
+		}
+	}
+	if job.TimeoutSeconds < 0 || job.TimeoutSeconds > cloudguardian_config.MaxJobTimeout {
+		return job, fmt.Errorf("timeout_seconds must be between 1 and %d", cloudguardian_config.MaxJobTimeout)
+	}
+	if job.TimeoutSeconds == 0 && jobType == "script" {
+		job.TimeoutSeconds = currentConfig().ScriptTimeout
+		if job.TimeoutSeconds == 0 {
+			job.TimeoutSeconds = cloudguardian_config.DefaultScriptTimeout
+		}
+	} else if job.TimeoutSeconds == 0 {
+		job.TimeoutSeconds = currentConfig().CommandTimeout
+		if job.TimeoutSeconds == 0 {
+			job.TimeoutSeconds = cloudguardian_config.DefaultCommandTimeout
+		}
+	}
+	return job, nil
+}
+
+// jobUser is the user a command or script job runs as
+type jobUser struct {
+	Name       string              // The name of the user, or the UID if it has no name
+	Group      string              // The name of the group, or the GID if it has no name
+	Home       string              // The home directory of the user
+	Credential *syscall.Credential // nil if the job runs as the agent user
+}
+
+// lookupJobUser resolves the user and group of a job. Without them the job runs
+// as the agent user. Other users require an agent running as root, which drops
+// its privileges for the job.
+//
+// Parameters:
+//   - userName: The name or UID of the user, the agent user if empty
+//   - groupName: The name or GID of the group, the primary group of the user if empty
+//
+// Returns:
+//   - jobUser: The user the job runs as
+//   - error: An error if the user or group does not exist or the agent cannot switch to them
+func lookupJobUser(userName string, groupName string) (jobUser, error) {
+	var account *user.User
+	var err error
+	if userName == "" {
+		account, err = user.LookupId(strconv.Itoa(os.Getuid()))
+	} else if account, err = user.Lookup(userName); err != nil {
+		if _, numErr := strconv.Atoi(userName); numErr == nil {
+			account, err = user.LookupId(userName)
+		}
+	}
+	if err != nil {
+		return jobUser{}, fmt.Errorf("unknown user %s", userName)
+	}
+	gid := account.Gid
+	if groupName != "" {
+		group, err := user.LookupGroup(groupName)
+		if _, numErr := strconv.Atoi(groupName); err != nil && numErr == nil {
+			group, err = user.LookupGroupId(groupName)
+		}
+		if err != nil {
+			return jobUser{}, fmt.Errorf("unknown group %s", groupName)
+		}
+		gid = group.Gid
+	}
+	result := jobUser{Name: account.Username, Group: gid, Home: account.HomeDir}
+	if group, err := user.LookupGroupId(gid); err == nil {
+		result.Group = group.Name
+	}
+	uidValue, _ := strconv.ParseUint(account.Uid, 10, 32)
+	gidValue, _ := strconv.ParseUint(gid, 10, 32)
+	if int(uidValue) == os.Getuid() && int(gidValue) == os.Getgid() {
+		return result, nil
+	}
+	if os.Geteuid() != 0 {
+		return jobUser{}, fmt.Errorf("the agent has to run as root to run jobs as %s:%s", result.Name, result.Group)
+	}
+	result.Credential = &syscall.Credential{Uid: uint32(uidValue), Gid: uint32(gidValue)}
+	if groupName == "" {
+		// The supplementary groups of the user, e.g. docker, unless the job sets the group
+		groupIds, _ := account.GroupIds()
+		for _, groupId := range groupIds {
+			if value, err := strconv.ParseUint(groupId, 10, 32); err == nil && groupId != gid {
+				result.Credential.Groups = append(result.Credential.Groups, uint32(value))
+			}
+		}
+	}
+	return result, nil
+}
+
+// jobEnvironment returns the environment of a job that runs as another user. It
+// is built from scratch, the environment of the agent contains secrets like
+// CLOUD_GUARDIAN_API_KEY that the user must not see.
+func jobEnvironment(runAs jobUser) []string {
+	env := []string{"PATH=" + jobProcessPath, "HOME=" + runAs.Home, "USER=" + runAs.Name, "LOGNAME=" + runAs.Name}
+	if lang, ok := os.LookupEnv("LANG"); ok {
+		env = append(env, "LANG="+lang)
+	}
+	return env
+}
+
+// runJobProcess runs the process of a command or script job in its own process
+// group, so the whole group is killed when the timeout elapses.
+//
+// Parameters:
+//   - timeout: How long the process may run
+//   - dir: The working directory, the one of the agent or / for another user if empty
+//   - runAs: The user the process runs as, with the environment of jobEnvironment
+//   - live: Receives the output while the process runs
+//   - name: The program, e.g. bash
+//   - args: The arguments of the program
+//
+// Returns:
+//   - string: The standard output of the process
+//   - string: The standard error output of the process
+//   - int: The exit code of the process, -1 if it was killed
+//   - error: context.DeadlineExceeded if the process timed out, an error if it failed
+func runJobProcess(timeout time.Duration, dir string, runAs jobUser, live linux.LiveOutput, name string, args ...string) (string, string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if runAs.Credential != nil {
+		cmd.SysProcAttr.Credential = runAs.Credential
+		cmd.Env = jobEnvironment(runAs)
+		if dir == "" {
+			cmd.Dir = "/" // The user may not have access to the directory of the agent
+		}
+	}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = jobProcessWaitDelay
+	stdOut, stdErr, err := linux.RunCommandLive(cmd, live)
+	exitCode := 0
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	} else if err != nil {
+		exitCode = 1 // The program did not start
+	}
+	if ctx.Err() != nil {
+		return stdOut, stdErr, exitCode, ctx.Err()
+	}
+	return stdOut, stdErr, exitCode, err
+}
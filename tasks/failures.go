@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Failures summarizes the failed tasks and API requests since the start, so a
+// one-shot run can exit with a code that tells automation what went wrong.
+type Failures struct {
+	Count        int  // Failed API requests and tasks that panicked
+	Unreachable  int  // Failed API requests that are retried, e.g. network errors and 5xx
+	Unauthorized bool // The API rejected the API key
+}
+
+var (
+	failuresMutex sync.Mutex
+	failures      Failures
+)
+
+// recordFailure records a failed API request or task.
+//
+// Parameters:
+//   - statusCode: The status code of the request, 0 for a task
+//   - retryable: true if the request is retried, e.g. after a network error
+func recordFailure(statusCode int, retryable bool) {
+	failuresMutex.Lock()
+	defer failuresMutex.Unlock()
+	failures.Count++
+	if retryable {
+		failures.Unreachable++
+	}
+	if statusCode == http.StatusUnauthorized {
+		failures.Unauthorized = true
+	}
+}
+
+// RecordedFailures returns the failures since the start of the agent
+func RecordedFailures() Failures {
+	failuresMutex.Lock()
+	defer failuresMutex.Unlock()
+	return failures
+}
@@ -2,55 +2,129 @@ package tasks
 
 import (
 	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_version"
 	cloudguardian_crypto "cloud-guardian/crypto"
 	pm "cloud-guardian/linux/packagemanager"
-	"encoding/json"
+	linux_reboot "cloud-guardian/linux/reboot"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 func handleAPIError(errorMsg string, err error, statusCode int) {
-	// Handle API errors by printing the error message and status code
-	// 4xx are user errors, we log them and then quit because the user needs to fix something
-	if statusCode == 404 {
-		log.Fatal("API URL is incorrect: ", Config.ApiUrl)
+	// Handle API errors by logging the error message, status code and request ID.
+	// Retryable errors (network, 5xx, 408, 429) are retried with the next cycle.
+	// An invalid API key needs to be fixed by the user, the agent is degraded and
+	// retries with an escalating backoff until the API accepts it again.
+	var apiErr *api.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = &api.APIError{StatusCode: statusCode, Err: err}
 	}
-	if statusCode == 401 {
-		log.Fatal("Invalid API key. Please check your API key in the configuration file or command line arguments.")
+	recordFailure(statusCode, apiErr.IsRetryable())
+	if apiErr.IsRetryable() {
+		log.Println(errorMsg, "(retrying later) - Status code:", statusCode, "Error:", parseErrorResponse(apiErr))
+		return
 	}
-	if statusCode >= 400 && statusCode < 500 {
-		log.Fatal(errorMsg, " - Error: ", parseErrorResponse(err), " - Status code:", statusCode)
+	if statusCode == http.StatusUnauthorized {
+		backoff := degraded.fail(api.ErrorCodeInvalidApiKey, "invalid API key (401 Unauthorized)")
+		log.Println(errorMsg, "- Invalid API key. Please check your API key in the configuration file or command line arguments. Retrying in", backoff)
+		return
 	}
-	// Everything above 500 is considered a server error, we log it
-	if statusCode >= 500 {
-		log.Println(errorMsg, " (Server error) - Status code:", statusCode, "Error:", parseErrorResponse(err))
+	if statusCode == http.StatusNotFound {
+		log.Println(errorMsg, "- the API URL may be incorrect:", currentConfig().ApiUrl, "-", apiErr.Error())
+		return
 	}
+	log.Println(errorMsg, "(Client error) - Status code:", statusCode, "Error:", apiErr.Error())
 }
 
-func parseErrorResponse(err error) string {
-	// The error might be a JSON response with an error message, in that case we try to parse it
-	var errorResponse map[string]interface{}
-	if jsonErr := json.Unmarshal([]byte(err.Error()), &errorResponse); jsonErr == nil {
-		if message, ok := errorResponse["message"].(string); ok {
-			return message
+func skipNonCriticalSubmission(submission string) bool {
+	// Skip non-critical submissions while the API circuit breaker is open.
+	// Pings and job status updates are always sent and act as probes.
+	if skipPaused(submission + " submission") {
+		return true
+	}
+	if !degraded.allow() {
+		log.Println("Agent is degraded, skipping", submission, "submission until the next retry")
+		return true
+	}
+	if !api.Breaker.Allow() {
+		log.Println("API circuit breaker is open, skipping", submission, "submission")
+		return true
+	}
+	// Skip payloads the API can not handle anymore, instead of submitting them malformed
+	if incompatible, minimum := api.IsIncompatible(); incompatible {
+		if minimum == "" {
+			minimum = "unknown"
 		}
+		log.Println("Agent version", cloudguardian_version.Version, "is not supported by the API (minimum", minimum+"), skipping", submission, "submission. Please update the agent.")
+		return true
+	}
+	return false
+}
+
+func parseErrorResponse(err error) string {
+	// API errors carry the message of the API, other errors are returned as they are
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) && apiErr.Err == nil && apiErr.Message != "" {
+		return apiErr.Message
+	}
+	if err == nil {
+		return ""
 	}
-	// If we couldn't parse the error, return the error string
 	return err.Error()
 }
 
-func updateJobStatus(hostname, jobId, status string, result string) {
+// jobRollouts holds the rollout of the jobs in progress by job ID, see trackRollout
+var (
+	jobRollouts      = map[string]api.Rollout{}
+	jobRolloutsMutex sync.Mutex
+)
+
+// trackRollout remembers the rollout of a job, so it is echoed with the final result
+func trackRollout(job api.HostJob) {
+	if job.Rollout == nil {
+		return
+	}
+	jobRolloutsMutex.Lock()
+	defer jobRolloutsMutex.Unlock()
+	jobRollouts[job.JobId] = *job.Rollout
+}
+
+// finishRollout returns the rollout of a job with its duration and outcome and forgets
+// the job. It returns nil if the job is not part of a rollout.
+func finishRollout(jobId string, status string, result api.JobResult) *api.RolloutResult {
+	jobRolloutsMutex.Lock()
+	rollout, ok := jobRollouts[jobId]
+	delete(jobRollouts, jobId)
+	jobRolloutsMutex.Unlock()
+	if !ok {
+		return nil
+	}
+	rolloutResult := &api.RolloutResult{Rollout: rollout, Success: status != "failed"}
+	startedAt, startErr := time.Parse(time.RFC3339, result.StartedAt)
+	finishedAt, finishErr := time.Parse(time.RFC3339, result.FinishedAt)
+	if startErr == nil && finishErr == nil {
+		rolloutResult.DurationMs = finishedAt.Sub(startedAt).Milliseconds()
+	}
+	return rolloutResult
+}
+
+func updateJobStatus(hostname, jobId, status string, result api.JobResult) {
 	// Update the status of a job for the given hostname
+	// Jobs outlive the task that started them, so their updates start their own traces
 	log.Println("Updating job status for", hostname, "Job ID:", jobId, "Status:", status)
+	if status == "completed" || status == "failed" || status == "simulated" {
+		result.Rollout = finishRollout(jobId, status, result)
+	}
 
-	statusCode, err := api.PutRequest(Config.ApiUrl+"jobs/"+jobId, Config.ApiKey, map[string]interface{}{
-		"status": status,
-		"result": result,
-	})
+	recordJobStatus(jobId, status, result.String())
+	statusCode, err := currentClient().UpdateJob(context.Background(), jobId, status, result.String())
 	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error updating job status", err, statusCode)
 		return
@@ -58,23 +132,112 @@ func updateJobStatus(hostname, jobId, status string, result string) {
 	log.Println("Job status updated successfully for", hostname, "Job ID:", jobId, "Status:", status)
 }
 
-func checkRebootStatus(job HostJob) (bool, error) {
-	// Check the status of a reboot job
-	// This function can be used to check if the reboot was successful or not
-	if !strings.HasPrefix(job.Result, "initiated reboot, uptime: ") {
-		log.Println("Job status:", job.Result)
-		log.Println("Error parsing uptime from job status: has not prefix")
-		return false, errors.New("status data is not in the expected format")
+// policyJobData returns the job data the job policy checks, the command of a
+// command job whose job data also sets a timeout or user
+func policyJobData(job api.HostJob) string {
+	if job.JobType != "command" {
+		return job.JobData
+	}
+	execJob, _ := parseExecJobData(job.JobType, job.JobData)
+	return execJob.Command
+}
+
+// jobStartedAt returns the start time of a running job, or the current time if
+// the job has no structured result
+func jobStartedAt(job api.HostJob) time.Time {
+	if result, ok := api.ParseJobResult(job.Result); ok {
+		if startedAt, err := time.Parse(time.RFC3339, result.StartedAt); err == nil {
+			return startedAt
+		}
 	}
+	return time.Now()
+}
+
+// runningResult returns the result of a job that was started at the given time
+func runningResult(startedAt time.Time) api.JobResult {
+	return api.JobResult{StartedAt: startedAt.UTC().Format(time.RFC3339)}
+}
+
+// failedResult returns the result of a job that failed with the given error code and message
+func failedResult(startedAt time.Time, code api.ErrorCode, message string) api.JobResult {
+	result := runningResult(startedAt)
+	result.ExitCode = 1
+	result.ErrorCode = code
+	result.Message = message
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	return result
+}
 
-	// Extract the uptime from the job data
-	// The job status should be:
-	// initiated reboot, uptime: "+fmt.Sprintf("%d", uptime)
-	uptimeBeforeReboot, err := strconv.ParseInt(strings.TrimPrefix(job.Result, "initiated reboot, uptime: "), 10, 64)
+// commandResult returns the result of a job that ran a command
+func commandResult(startedAt time.Time, stdOut string, stdErr string, err error) api.JobResult {
+	result := runningResult(startedAt)
+	result.Stdout = stdOut
+	result.Stderr = stdErr
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
 	if err != nil {
-		log.Println("Job status:", job.Result)
+		result.ExitCode = 1
+		result.ErrorCode = api.ClassifyError(err, stdErr)
+		result.Message = err.Error()
+	}
+	return result
+}
+
+// rebootResult contains the state of the host when a reboot was initiated
+type rebootResult struct {
+	Uptime      int64  // Uptime in seconds before the reboot
+	Method      string // Reboot method, empty for results of older agents
+	SoftReboots int64  // Soft-reboot count before the reboot, -1 if no soft-reboot was initiated
+}
+
+// parseRebootResult extracts the uptime before the reboot, the reboot method and
+// the soft-reboot count from the result of a running reboot job. Structured results
+// carry them as metadata, results of older agents have the format
+// "initiated reboot, uptime: <seconds>[, method: <method>[, soft_reboots: <count>]]".
+func parseRebootResult(result string) (rebootResult, error) {
+	if jobResult, ok := api.ParseJobResult(result); ok {
+		uptime, err := strconv.ParseInt(jobResult.Metadata["uptime"], 10, 64)
+		if err != nil {
+			log.Println("Job status:", result)
+			log.Println("Error parsing uptime from job status:", err.Error())
+			return rebootResult{}, errors.New("status data is not in the expected format")
+		}
+		softReboots := int64(-1)
+		if count, err := strconv.ParseInt(jobResult.Metadata["soft_reboots"], 10, 64); err == nil {
+			softReboots = count
+		}
+		return rebootResult{Uptime: uptime, Method: jobResult.Metadata["method"], SoftReboots: softReboots}, nil
+	}
+
+	if !strings.HasPrefix(result, "initiated reboot, uptime: ") {
+		log.Println("Job status:", result)
+		log.Println("Error parsing uptime from job status: has not prefix")
+		return rebootResult{}, errors.New("status data is not in the expected format")
+	}
+	uptimeStr, method, _ := strings.Cut(strings.TrimPrefix(result, "initiated reboot, uptime: "), ", method: ")
+	uptimeBeforeReboot, err := strconv.ParseInt(uptimeStr, 10, 64)
+	if err != nil {
+		log.Println("Job status:", result)
 		log.Println("Error parsing uptime from job status:", err.Error())
-		return false, errors.New("status data is not in the expected format")
+		return rebootResult{}, errors.New("status data is not in the expected format")
+	}
+	method, softRebootsStr, found := strings.Cut(method, ", soft_reboots: ")
+	softReboots := int64(-1)
+	if count, err := strconv.ParseInt(softRebootsStr, 10, 64); found && err == nil {
+		softReboots = count
+	}
+	return rebootResult{Uptime: uptimeBeforeReboot, Method: method, SoftReboots: softReboots}, nil
+}
+
+func checkRebootStatus(job api.HostJob) (bool, error) {
+	// Check the status of a reboot job
+	// This function can be used to check if the reboot was successful or not
+	reboot, err := parseRebootResult(job.Result)
+	if err != nil {
+		return false, err
+	}
+	uptimeBeforeReboot := reboot.Uptime
+	if reboot.Method == linux_reboot.MethodSoft && reboot.SoftReboots >= 0 {
+		return checkSoftRebootStatus(uptimeBeforeReboot, reboot.SoftReboots)
 	}
 
 	uptime, err := getUptime()
@@ -90,48 +253,100 @@ func checkRebootStatus(job HostJob) (bool, error) {
 	return false, nil
 }
 
-type HostJob struct {
-	JobId     string `json:"jobId"`
-	Signature string `json:"signature"`
-	CreatedAt string `json:"createdAt"`
-	JobType   string `json:"jobType"`
-	JobData   string `json:"jobData"`
-	Result    string `json:"result"`
-	Status    string `json:"status"`
+func checkSoftRebootStatus(uptimeBeforeReboot int64, softRebootsBefore int64) (bool, error) {
+	// The kernel keeps running during a soft-reboot, so the uptime is not reset
+	softReboots, err := getSoftRebootsCount()
+	if err != nil {
+		return false, errors.New("error getting uptime: " + err.Error())
+	}
+	if softReboots > softRebootsBefore {
+		return true, nil
+	}
+	uptime, err := getUptime()
+	if err != nil {
+		return false, errors.New("error getting uptime: " + err.Error())
+	}
+	if uptime < uptimeBeforeReboot {
+		return true, nil // A full reboot happened instead
+	}
+	if uptime-uptimeBeforeReboot > maxRebootDuration {
+		return false, errors.New("system is still running after the reboot was initiated")
+	}
+	return false, nil
+}
+
+// collectorTimestamps contains the capture time of each monitoring collector, by payload key
+type collectorTimestamps map[string]string
+
+// record stores the current time as the capture time of the collector
+func (c collectorTimestamps) record(collector string) {
+	c[collector] = time.Now().UTC().Format(time.RFC3339Nano)
 }
 
 type HostJobPayload struct {
 	Command string `json:"command"`
 }
 
-type HostJobResponse struct {
-	Code    int       `json:"code"`
-	Content []HostJob `json:"content"`
-	Message string    `json:"message"`
+// SwapJob describes a swap job. The job data has the format
+// "<action>,<path>,<size in MiB>", for example "create,/swapfile,2048",
+// "resize,/swapfile,4096", "remove,/swapfile" or "zram,1024".
+type SwapJob struct {
+	Action string
+	Path   string
+	SizeMB int
 }
 
-func fetchHostJobs(hostname string, status string) (*[]HostJob, error) {
-	log.Println("Fetching host jobs from API...")
-	statusCode, responseBody, err := api.GetRequest(Config.ApiUrl+"jobs/hosts/"+hostname+"?job_status="+status, Config.ApiKey)
-	if err != nil {
-		log.Println(parseErrorResponse(err))
-		return nil, err
+func parseSwapJobData(jobData string) (SwapJob, error) {
+	parts := strings.Split(strings.TrimSpace(jobData), ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	swapJob := SwapJob{Action: parts[0]}
+	switch swapJob.Action {
+	case "create", "resize":
+		if len(parts) != 3 {
+			return SwapJob{}, fmt.Errorf("expected %s,<path>,<size_mb>", swapJob.Action)
+		}
+		swapJob.Path = parts[1]
+		sizeMB, err := strconv.Atoi(parts[2])
+		if err != nil || sizeMB <= 0 {
+			return SwapJob{}, fmt.Errorf("invalid size: %s", parts[2])
+		}
+		swapJob.SizeMB = sizeMB
+	case "remove":
+		if len(parts) != 2 {
+			return SwapJob{}, errors.New("expected remove,<path>")
+		}
+		swapJob.Path = parts[1]
+	case "zram":
+		if len(parts) != 2 {
+			return SwapJob{}, errors.New("expected zram,<size_mb>")
+		}
+		sizeMB, err := strconv.Atoi(parts[1])
+		if err != nil || sizeMB <= 0 {
+			return SwapJob{}, fmt.Errorf("invalid size: %s", parts[1])
+		}
+		swapJob.SizeMB = sizeMB
+	default:
+		return SwapJob{}, fmt.Errorf("unknown swap action: %s", swapJob.Action)
+	}
+	if swapJob.Path != "" && !strings.HasPrefix(swapJob.Path, "/") {
+		return SwapJob{}, fmt.Errorf("swap file path must be absolute: %s", swapJob.Path)
 	}
+	return swapJob, nil
+}
+
+func fetchHostJobs(ctx context.Context, hostname string, status string) (*[]api.HostJob, error) {
+	log.Println("Fetching host jobs from API...")
+	statusCode, jobs, err := currentClient().FetchJobs(ctx, hostname, status)
 	if statusCode == http.StatusNotFound {
 		return nil, nil // Return nil if no jobs are found
 	}
-
-	if statusCode != http.StatusOK {
+	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error retrieving host jobs", err, statusCode)
 		return nil, errors.New("error retrieving host jobs")
 	}
-
-	var response HostJobResponse
-	if err := json.Unmarshal([]byte(responseBody), &response); err != nil {
-		log.Println("Error parsing response body:", err.Error())
-		return nil, err
-	}
-	return &response.Content, nil
+	return &jobs, nil
 }
 
 func formatPackages(packages []pm.Package) []map[string]string {
@@ -155,3 +370,22 @@ func tryValidatePayload(hostKeys []string, message string, signature string) (bo
 	}
 	return false, fmt.Errorf("failed to validate payload")
 }
+
+// deferrableJobTypes are the disruptive job types that only run in a maintenance
+// window, update_agent restarts the service
+var deferrableJobTypes = map[string]bool{"update": true, "reboot": true, "command": true, "script": true, "swap": true, "update_agent": true}
+
+// deferJob reports a job as deferred until the next maintenance window. The job
+// is fetched again with the deferred jobs once a window is open.
+func deferJob(hostname string, job api.HostJob) {
+	if job.Status == "deferred" {
+		return // Already reported
+	}
+	next := currentConfig().NextMaintenanceWindow(time.Now())
+	log.Println("Deferring", job.JobType, "job", job.JobId, "until the next maintenance window at", next.Format(time.RFC3339))
+	result := api.JobResult{
+		Message:  "deferred until the next maintenance window",
+		Metadata: map[string]string{"next_maintenance_window": next.UTC().Format(time.RFC3339)},
+	}
+	updateJobStatus(hostname, job.JobId, "deferred", result)
+}
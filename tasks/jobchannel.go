@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	longPollTimeout    = 60  // Seconds the API may hold a long-poll request open
+	longPollMaxBackoff = 300 // Maximum seconds to wait before retrying after an error
+)
+
+// jobsMutex prevents the task loop and the job channel from processing jobs at the same time
+var jobsMutex sync.Mutex
+
+// startJobChannel starts a long-poll loop in the background that waits for new jobs
+// and processes them as soon as the API announces them. The regular job
+// polling in the task loop keeps running as fallback.
+func startJobChannel(hostname string) {
+	log.Println("Starting long-poll job channel for", hostname)
+	go func() {
+		backoff := 1
+		for {
+			if skipPaused("the job channel") {
+				time.Sleep(time.Minute)
+				continue
+			}
+			available, supported, err := waitForHostJobs(hostname)
+			if !supported {
+				log.Println("Long-poll job channel is not supported by the API, falling back to polling")
+				return
+			}
+			if err != nil {
+				log.Println("Error waiting for host jobs:", err.Error(), "- retrying in", backoff, "seconds")
+				time.Sleep(time.Duration(backoff) * time.Second)
+				backoff = min(backoff*2, longPollMaxBackoff)
+				continue
+			}
+			backoff = 1
+			if available {
+				log.Println("Job channel: new jobs available for", hostname)
+				processNewJobs(context.Background(), hostname)
+			}
+		}
+	}()
+}
+
+// waitForHostJobs sends a long-poll request that returns as soon as new jobs are
+// submitted for the host or the long-poll timeout expires.
+//
+// Returns:
+//   - bool: true if new jobs are available
+//   - bool: false if the API does not support the long-poll endpoint
+//   - error: Any error that occurred during the request
+func waitForHostJobs(hostname string) (bool, bool, error) {
+	statusCode, jobs, err := currentClient().WaitForJobs(context.Background(), hostname, longPollTimeout)
+	switch statusCode {
+	case http.StatusOK:
+		if err != nil {
+			return false, true, err
+		}
+		return len(jobs) > 0, true, nil
+	case http.StatusNoContent, http.StatusNotModified, http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return false, true, nil // Long-poll timeout expired without new jobs
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return false, false, nil
+	default:
+		if err != nil {
+			return false, true, err
+		}
+		return false, true, fmt.Errorf("unexpected status code: %d", statusCode)
+	}
+}
@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	linux "cloud-guardian/linux"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// jobOutputInterval is how often a running job reports its new output, replaced by tests
+var jobOutputInterval = 10 * time.Second
+
+const (
+	maxJobOutputChunk   = 64 << 10 // Bytes of a stream sent with one update, the rest follows with the next update
+	maxJobOutputPending = 1 << 20  // Unsent bytes kept per stream, older output is dropped if the API falls behind
+)
+
+// jobOutputStream is the unsent output of a stream of a running job
+type jobOutputStream struct {
+	pending []byte
+	offset  int64 // Position of pending in the whole output of the stream
+}
+
+// jobOutput collects the output of a running update, command or script job and
+// reports the output appended since the last report with a running status every
+// jobOutputInterval, so operators can follow a long job in the console.
+type jobOutput struct {
+	mutex    sync.Mutex
+	stdout   jobOutputStream
+	stderr   jobOutputStream
+	sequence int
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// jobOutputWriter appends to a stream of a jobOutput
+type jobOutputWriter struct {
+	output *jobOutput
+	stream *jobOutputStream
+}
+
+func (writer jobOutputWriter) Write(data []byte) (int, error) {
+	writer.output.mutex.Lock()
+	defer writer.output.mutex.Unlock()
+	stream := writer.stream
+	stream.pending = append(stream.pending, data...)
+	if dropped := len(stream.pending) - maxJobOutputPending; dropped > 0 {
+		stream.pending = stream.pending[dropped:]
+		stream.offset += int64(dropped)
+	}
+	return len(data), nil
+}
+
+// startJobOutput starts reporting the output of a running job. The job passes
+// live to the command it runs and calls finish before it reports its final status.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - jobId: The ID of the job
+//   - startedAt: The start of the job
+//
+// Returns:
+//   - *jobOutput: The output of the job, see live and finish
+func startJobOutput(hostname string, jobId string, startedAt time.Time) *jobOutput {
+	output := &jobOutput{stop: make(chan struct{})}
+	output.stopped.Add(1)
+	go func() {
+		defer output.stopped.Done()
+		ticker := time.NewTicker(jobOutputInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-output.stop:
+				return
+			case <-ticker.C:
+				if chunk, ok := output.next(); ok {
+					result := runningResult(startedAt)
+					result.Output = &chunk
+					updateJobStatus(hostname, jobId, "running", result)
+				}
+			}
+		}
+	}()
+	return output
+}
+
+// live returns the writers for the output of the command of the job
+func (output *jobOutput) live() linux.LiveOutput {
+	return linux.LiveOutput{
+		Stdout: jobOutputWriter{output: output, stream: &output.stdout},
+		Stderr: jobOutputWriter{output: output, stream: &output.stderr},
+	}
+}
+
+// next takes the output appended since the last report, at most maxJobOutputChunk
+// bytes per stream
+//
+// Returns:
+//   - api.JobOutput: The new output
+//   - bool: false if there is no new output
+func (output *jobOutput) next() (api.JobOutput, bool) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+	if len(output.stdout.pending) == 0 && len(output.stderr.pending) == 0 {
+		return api.JobOutput{}, false
+	}
+	chunk := api.JobOutput{Sequence: output.sequence + 1, StdoutOffset: output.stdout.offset, StderrOffset: output.stderr.offset}
+	chunk.Stdout = output.stdout.take()
+	chunk.Stderr = output.stderr.take()
+	if chunk.Stdout == "" && chunk.Stderr == "" {
+		return api.JobOutput{}, false // Only the start of a character
+	}
+	output.sequence++
+	return chunk, true
+}
+
+// take removes up to maxJobOutputChunk bytes from the pending output. A character
+// that is not complete yet stays pending, JSON would replace its bytes.
+func (stream *jobOutputStream) take() string {
+	size := min(len(stream.pending), maxJobOutputChunk)
+	for start := size - 1; start >= 0 && start >= size-utf8.UTFMax; start-- {
+		if utf8.RuneStart(stream.pending[start]) {
+			if !utf8.FullRune(stream.pending[start:size]) {
+				size = start
+			}
+			break
+		}
+	}
+	chunk := string(stream.pending[:size])
+	stream.pending = stream.pending[size:]
+	stream.offset += int64(size)
+	return chunk
+}
+
+// finish stops the reports, the final result of the job carries the whole output
+func (output *jobOutput) finish() {
+	close(output.stop)
+	output.stopped.Wait()
+}
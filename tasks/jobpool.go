@@ -0,0 +1,140 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// jobConcurrencyGroups are groups of job types of which only one job runs at a
+// time, e.g. package managers hold a lock and fail if a second update starts
+var jobConcurrencyGroups = map[string]string{
+	"update":              "package_manager",
+	"swap":                "swap",
+	"collector_intervals": "config",
+	"maintenance_mode":    "config",
+}
+
+// exclusiveJobTypes are the job types that run alone. They wait for the running
+// jobs, and no job starts while they run, e.g. no update while the host reboots.
+var exclusiveJobTypes = map[string]bool{"reboot": true, "update_agent": true}
+
+// workerPool runs the jobs in the background, so a long update does not block
+// pings and monitoring
+var workerPool = newJobPool(processJob)
+
+// queuedJob is a job waiting for a worker
+type queuedJob struct {
+	hostname string
+	job      api.HostJob
+}
+
+// jobPool runs jobs with a bounded number of workers, see currentConfig().JobWorkers.
+// Jobs start in the order they were submitted, a job whose concurrency group is
+// busy is passed by later jobs. An exclusive job is not passed.
+type jobPool struct {
+	mutex     sync.Mutex
+	queue     []queuedJob
+	running   map[string]string // Job types of the running jobs by job ID
+	groups    map[string]bool   // Busy concurrency groups
+	exclusive bool              // An exclusive job runs
+	pending   sync.WaitGroup    // Queued and running jobs
+	process   func(hostname string, job api.HostJob)
+}
+
+// newJobPool creates a job pool that runs its jobs with process, e.g. processJob
+func newJobPool(process func(hostname string, job api.HostJob)) *jobPool {
+	return &jobPool{running: map[string]string{}, groups: map[string]bool{}, process: process}
+}
+
+// submit queues a job and starts it as soon as a worker is free
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - job: The validated job
+func (pool *jobPool) submit(hostname string, job api.HostJob) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.pending.Add(1)
+	pool.queue = append(pool.queue, queuedJob{hostname: hostname, job: job})
+	pool.schedule()
+}
+
+// contains reports whether a job is queued or running, so it is not submitted again
+// while the API still lists it as submitted
+func (pool *jobPool) contains(jobId string) bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if _, ok := pool.running[jobId]; ok {
+		return true
+	}
+	for _, queued := range pool.queue {
+		if queued.job.JobId == jobId {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until the queued and running jobs are finished, e.g. before a
+// one-shot run exits
+func (pool *jobPool) wait() {
+	pool.pending.Wait()
+}
+
+// schedule starts the queued jobs the rules allow, the mutex must be held
+func (pool *jobPool) schedule() {
+	workers := currentConfig().JobWorkers
+	if workers == 0 {
+		workers = cloudguardian_config.DefaultJobWorkers
+	}
+	for i := 0; i < len(pool.queue); {
+		if pool.exclusive || len(pool.running) >= workers {
+			return
+		}
+		queued := pool.queue[i]
+		group := jobConcurrencyGroups[queued.job.JobType]
+		if exclusiveJobTypes[queued.job.JobType] {
+			if len(pool.running) > 0 {
+				return // Later jobs wait for the exclusive job
+			}
+			pool.exclusive = true
+		} else if group != "" && pool.groups[group] {
+			i++
+			continue
+		} else if group != "" {
+			pool.groups[group] = true
+		}
+		pool.queue = append(pool.queue[:i], pool.queue[i+1:]...)
+		pool.running[queued.job.JobId] = queued.job.JobType
+		go pool.run(queued, group)
+	}
+}
+
+// run runs a job and starts the next queued jobs when it is finished. A job that
+// panics fails, the agent keeps running.
+func (pool *jobPool) run(queued queuedJob, group string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in %s job %s: %v\n%s", queued.job.JobType, queued.job.JobId, r, debug.Stack())
+			recordFailure(0, false)
+			updateJobStatus(queued.hostname, queued.job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeCommandFailed, fmt.Sprintf("job failed unexpectedly: %v", r)))
+		}
+		pool.mutex.Lock()
+		delete(pool.running, queued.job.JobId)
+		if group != "" {
+			pool.groups[group] = false
+		}
+		if exclusiveJobTypes[queued.job.JobType] {
+			pool.exclusive = false
+		}
+		pool.schedule()
+		pool.mutex.Unlock()
+		pool.pending.Done()
+	}()
+	pool.process(queued.hostname, queued.job)
+}
@@ -0,0 +1,219 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	cloudguardian_faults "cloud-guardian/faults"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	processedJobsRetention = 90 * 24 * time.Hour // Jobs older than this are removed from the store
+	maxProcessedJobs       = 1000                // Upper bound of jobs kept in the store, the oldest are removed first
+)
+
+// processedJobsPath contains the jobs the agent started, so a job the API sends
+// again, e.g. after a server restore, is not run twice
+var processedJobsPath = cloudguardian_config.StateDir + "/jobs.json"
+
+// processedJob is a job as last reported to the API
+type processedJob struct {
+	Signature string    `json:"signature"` // Identifies the job together with its ID
+	JobType   string    `json:"job_type"`
+	Status    string    `json:"status"`
+	Result    string    `json:"result"`
+	UpdatedAt time.Time `json:"updated_at"`
+	StartedAt time.Time `json:"started_at"` // Counts the job for the local job rate limits
+}
+
+// processedJobsMutex serializes read-modify-write cycles of the store
+var processedJobsMutex sync.Mutex
+
+// processedJobsFallback holds the store while it cannot be written, e.g. on a
+// read-only state directory, so re-sent jobs are still detected until the agent
+// restarts. It is nil while the file is up to date.
+var processedJobsFallback map[string]processedJob
+
+// findProcessedJob looks up a job in the store. A job with the same ID but another
+// signature is a different job.
+//
+// Returns:
+//   - processedJob: The stored job
+//   - bool: true if the job was started before
+func findProcessedJob(job api.HostJob) (processedJob, bool) {
+	processedJobsMutex.Lock()
+	defer processedJobsMutex.Unlock()
+	stored, ok := loadProcessedJobs()[job.JobId]
+	if !ok || stored.Signature != job.Signature {
+		return processedJob{}, false
+	}
+	return stored, true
+}
+
+// recordJobStart stores a job before it runs, so it is not run again if the agent
+// stops while the job is running.
+func recordJobStart(job api.HostJob) {
+	processedJobsMutex.Lock()
+	defer processedJobsMutex.Unlock()
+	jobs := loadProcessedJobs()
+	jobs[job.JobId] = processedJob{Signature: job.Signature, JobType: job.JobType, Status: "running", UpdatedAt: time.Now(), StartedAt: time.Now()}
+	saveProcessedJobs(jobs)
+}
+
+// recordJobStatus stores the status and result reported for a job that was started by the agent
+func recordJobStatus(jobId string, status string, result string) {
+	processedJobsMutex.Lock()
+	defer processedJobsMutex.Unlock()
+	jobs := loadProcessedJobs()
+	stored, ok := jobs[jobId]
+	if !ok {
+		return
+	}
+	stored.Status, stored.Result, stored.UpdatedAt = status, result, time.Now()
+	jobs[jobId] = stored
+	saveProcessedJobs(jobs)
+}
+
+// replayProcessedJob answers a job the agent already started with the stored
+// result instead of running it again. A job that was interrupted while running
+// is reported as failed, except reboot jobs, which are finished by the running
+// jobs check after the reboot.
+//
+// Returns:
+//   - bool: true if the job was started before and must not run again
+func replayProcessedJob(hostname string, job api.HostJob) bool {
+	stored, ok := findProcessedJob(job)
+	if !ok {
+		return false
+	}
+	log.Println("Job", job.JobId, "was already processed with status", stored.Status+", reporting the stored result instead of running it again")
+	if stored.Status == "running" && stored.JobType != "reboot" {
+		result := failedResult(stored.UpdatedAt, api.ErrorCodeJobInterrupted, "job was interrupted and is not run again")
+		updateJobStatus(hostname, job.JobId, "failed", result)
+		return true
+	}
+	statusCode, err := currentClient().UpdateJob(context.Background(), job.JobId, stored.Status, stored.Result)
+	if err != nil || statusCode != http.StatusOK {
+		handleAPIError("Error reporting stored job result", err, statusCode)
+	}
+	return true
+}
+
+// loadProcessedJobs reads the store, or the newer jobs kept in memory while the
+// store cannot be written. processedJobsMutex must be held.
+func loadProcessedJobs() map[string]processedJob {
+	if processedJobsFallback != nil {
+		return maps.Clone(processedJobsFallback)
+	}
+	jobs := map[string]processedJob{}
+	data, err := os.ReadFile(processedJobsPath)
+	if err != nil {
+		return jobs
+	}
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		log.Println("Error reading processed jobs, starting with an empty store:", err.Error())
+		return map[string]processedJob{}
+	}
+	return jobs
+}
+
+// saveProcessedJobs replaces the store atomically, so an interrupted write does
+// not lose the jobs. If it cannot be written the jobs are kept in memory, see
+// processedJobsFallback. processedJobsMutex must be held.
+func saveProcessedJobs(jobs map[string]processedJob) {
+	pruneProcessedJobs(jobs, time.Now())
+	data, err := json.Marshal(jobs)
+	if err == nil {
+		err = cloudguardian_config.WriteFileAtomic(processedJobsPath, cloudguardian_faults.CorruptState(processedJobsPath, data), 0600)
+	}
+	if err != nil {
+		if processedJobsFallback == nil {
+			log.Println("Warning: The processed jobs cannot be saved, jobs re-sent after a restart may run again and rate-limited jobs are not started:", err.Error())
+		}
+		processedJobsFallback = maps.Clone(jobs)
+		return
+	}
+	if processedJobsFallback != nil {
+		log.Println("The processed jobs are saved again")
+		processedJobsFallback = nil
+	}
+}
+
+// pruneProcessedJobs removes jobs older than processedJobsRetention and the
+// oldest jobs beyond maxProcessedJobs. Jobs that still count for the rate limit
+// of their job type are kept, otherwise a burst of cheap jobs could push e.g. the
+// last reboot out of the store and allow the next one.
+func pruneProcessedJobs(jobs map[string]processedJob, now time.Time) {
+	ids := make([]string, 0, len(jobs))
+	for id, job := range jobs {
+		if job.countsForRateLimit(now) {
+			continue
+		}
+		if now.Sub(job.UpdatedAt) > processedJobsRetention {
+			delete(jobs, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(jobs) <= maxProcessedJobs {
+		return
+	}
+	sort.Slice(ids, func(i, j int) bool { return jobs[ids[i]].UpdatedAt.Before(jobs[ids[j]].UpdatedAt) })
+	for _, id := range ids[:min(len(ids), len(jobs)-maxProcessedJobs)] {
+		delete(jobs, id)
+	}
+}
+
+// countsForRateLimit reports whether a job started within the period of the
+// rate limit of its job type, see jobRateLimited
+func (job processedJob) countsForRateLimit(now time.Time) bool {
+	if currentConfig() == nil || job.StartedAt.IsZero() {
+		return false
+	}
+	limit, ok := currentConfig().JobRateLimits[job.JobType]
+	return ok && now.Sub(job.StartedAt) < time.Duration(limit.PeriodMinutes)*time.Minute
+}
+
+// jobRateLimited reports whether starting a job would exceed the local rate limit
+// of its job type. The limits are enforced regardless of what the API sends and
+// count the jobs in the store, so they hold across restarts and reboots. While the
+// store cannot be saved the limit would not hold across a restart, e.g. of a
+// reboot loop, so rate-limited job types do not start at all.
+//
+// Parameters:
+//   - job: The job to start
+//   - now: The current time
+//
+// Returns:
+//   - bool: true if the job must not run
+//   - string: The reason, empty if the job may run
+func jobRateLimited(job api.HostJob, now time.Time) (bool, string) {
+	limit, ok := currentConfig().JobRateLimits[job.JobType]
+	if !ok {
+		return false, ""
+	}
+	processedJobsMutex.Lock()
+	defer processedJobsMutex.Unlock()
+	if processedJobsFallback != nil {
+		return true, fmt.Sprintf("the local rate limit of %s jobs cannot be enforced, the processed jobs cannot be saved to %s", job.JobType, processedJobsPath)
+	}
+	started := 0
+	for _, stored := range loadProcessedJobs() {
+		if stored.JobType == job.JobType && stored.countsForRateLimit(now) {
+			started++
+		}
+	}
+	if started >= limit.Max {
+		return true, fmt.Sprintf("local rate limit of %d %s jobs per %d minutes reached", limit.Max, job.JobType, limit.PeriodMinutes)
+	}
+	return false, ""
+}
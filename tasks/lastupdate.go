@@ -0,0 +1,50 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	cloudguardian_faults "cloud-guardian/faults"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// lastUpdatesPath contains the last successful update job of each package manager
+var lastUpdatesPath = cloudguardian_config.StateDir + "/last-updates.json"
+
+// recordLastUpdate stores a successful update job, so "last patched by the agent"
+// can be reported after the job history of the API was pruned
+//
+// Parameters:
+//   - packageManager: The name of the package manager, e.g. "apt"
+//   - jobId: The ID of the update job
+//   - packages: The updated packages, ["all"] for all packages
+//   - finishedAt: The end of the update
+func recordLastUpdate(packageManager string, jobId string, packages []string, finishedAt time.Time) {
+	updates := loadLastUpdates()
+	updates[packageManager] = api.LastUpdate{JobId: jobId, FinishedAt: finishedAt.UTC().Format(time.RFC3339), Packages: packages}
+	data, err := json.Marshal(updates)
+	if err != nil {
+		log.Println("Error encoding the last updates:", err.Error())
+		return
+	}
+	if err := os.WriteFile(lastUpdatesPath, cloudguardian_faults.CorruptState(lastUpdatesPath, data), 0600); err != nil {
+		log.Println("Error writing the last updates:", err.Error())
+	}
+}
+
+// loadLastUpdates returns the last successful update job of each package manager,
+// empty if no update job succeeded yet
+func loadLastUpdates() map[string]api.LastUpdate {
+	updates := map[string]api.LastUpdate{}
+	data, err := os.ReadFile(lastUpdatesPath)
+	if err != nil {
+		return updates
+	}
+	if err := json.Unmarshal(data, &updates); err != nil {
+		log.Println("Error reading the last updates:", err.Error())
+		return map[string]api.LastUpdate{}
+	}
+	return updates
+}
@@ -0,0 +1,254 @@
+package tasks
+
+import (
+	"bufio"
+	api "cloud-guardian/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogStreamSeconds = 300  // Duration of a stream_logs job without duration_seconds
+	maxLogStreamSeconds     = 3600 // Upper bound of the duration of a stream_logs job
+	maxLogStreamBatch       = 100  // Lines sent at most in one submission
+)
+
+// logStreamFlushInterval is the longest time a tailed line waits before it is sent
+var logStreamFlushInterval = 2 * time.Second
+
+// logStreamCommand returns the command that follows a log source, journalctl for
+// units and tail for files. Only lines written after the start are followed.
+var logStreamCommand = func(ctx context.Context, job logStreamJob) *exec.Cmd {
+	if job.File != "" {
+		return exec.CommandContext(ctx, "tail", "--lines=0", "--follow=name", "--retry", job.File)
+	}
+	return exec.CommandContext(ctx, "journalctl", "--follow", "--lines=0", "--output=short-iso", "--unit="+job.Unit)
+}
+
+// activeLogStreams are the stream_logs jobs running in this process
+var (
+	activeLogStreams      = map[string]bool{}
+	activeLogStreamsMutex sync.Mutex
+)
+
+// logStreamJob is the job data of a stream_logs job, e.g.
+// {"unit": "nginx.service", "duration_seconds": 600}
+type logStreamJob struct {
+	Unit            string `json:"unit,omitempty"`          // journald unit to follow
+	File            string `json:"file,omitempty"`          // Absolute path of a file to follow
+	DurationSeconds int    `json:"duration_seconds"`        // Duration of the stream, at most maxLogStreamSeconds
+	WebSocketUrl    string `json:"websocket_url,omitempty"` // Lines are sent to this ws:// or wss:// URL instead of the API
+}
+
+// source returns the unit or file of the job
+func (job logStreamJob) source() string {
+	if job.File != "" {
+		return job.File
+	}
+	return job.Unit
+}
+
+// parseLogStreamJobData parses and validates the job data of a stream_logs job
+func parseLogStreamJobData(jobData string) (logStreamJob, error) {
+	var job logStreamJob
+	if err := json.Unmarshal([]byte(jobData), &job); err != nil {
+		return job, fmt.Errorf("job data is not valid JSON: %w", err)
+	}
+	if (job.Unit == "") == (job.File == "") {
+		return job, fmt.Errorf("either unit or file is required")
+	}
+	if job.File != "" && job.File[0] != '/' {
+		return job, fmt.Errorf("file must be an absolute path")
+	}
+	if strings.ContainsAny(job.Unit, "*?[") {
+		return job, fmt.Errorf("unit must be a unit name, not a pattern")
+	}
+	if job.DurationSeconds == 0 {
+		job.DurationSeconds = defaultLogStreamSeconds
+	}
+	if job.DurationSeconds < 0 || job.DurationSeconds > maxLogStreamSeconds {
+		return job, fmt.Errorf("duration_seconds must be between 1 and %d", maxLogStreamSeconds)
+	}
+	return job, nil
+}
+
+// logSink receives the batches of tailed lines
+type logSink func(lines []string) error
+
+// apiLogSink sends the lines to the API with the job
+func apiLogSink(jobId string) logSink {
+	return func(lines []string) error {
+		statusCode, err := currentClient().SubmitJobLogs(context.Background(), jobId, lines)
+		if err == nil && statusCode != http.StatusOK {
+			err = fmt.Errorf("status code %d", statusCode)
+		}
+		return err
+	}
+}
+
+// webSocketLogSink sends every batch as a JSON message with the job ID and the lines
+func webSocketLogSink(jobId string, ws *api.WebSocket) logSink {
+	return func(lines []string) error {
+		message, err := json.Marshal(map[string]any{"job_id": jobId, "lines": lines})
+		if err != nil {
+			return err
+		}
+		return ws.WriteText(message)
+	}
+}
+
+// processJobStreamLogs starts a stream_logs job, which tails an allowlisted journald
+// unit or file for the duration of the job and pushes the lines to the API or the
+// WebSocket URL of the job. The job runs in the background, so other jobs are not
+// blocked during the stream.
+func processJobStreamLogs(hostname string, jobId string, jobData string) {
+	log.Println("Processing stream_logs job for job ID:", jobId)
+	startedAt := time.Now()
+	job, err := parseLogStreamJobData(jobData)
+	if err != nil {
+		log.Println("Error parsing stream_logs job data:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid stream_logs job data: "+err.Error()))
+		return
+	}
+	source, allowed := currentConfig().JobPolicy.ResolveLogSource(job.source())
+	if !allowed {
+		log.Println("Rejecting stream_logs job", jobId, "- log source is not allowlisted:", job.source())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeRejectedByPolicy, "log source "+job.source()+" is not in the log_stream_allowlist of the host"))
+		return
+	}
+	sink := apiLogSink(jobId)
+	var ws *api.WebSocket
+	if job.WebSocketUrl != "" {
+		if ws, err = api.DialWebSocket(job.WebSocketUrl); err != nil {
+			log.Println("Error connecting to the WebSocket of the stream_logs job:", err.Error())
+			updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ClassifyError(err, ""), "failed to connect to the WebSocket URL: "+err.Error()))
+			return
+		}
+		sink = webSocketLogSink(jobId, ws)
+	}
+	if job.File != "" {
+		job.File = source // The file the allowlist matched, not a symlink to it
+	}
+	result := runningResult(startedAt)
+	result.Metadata = map[string]string{"source": job.source(), "duration_seconds": strconv.Itoa(job.DurationSeconds)}
+	updateJobStatus(hostname, jobId, "running", result)
+
+	activeLogStreamsMutex.Lock()
+	activeLogStreams[jobId] = true
+	activeLogStreamsMutex.Unlock()
+	go func() {
+		defer func() {
+			activeLogStreamsMutex.Lock()
+			delete(activeLogStreams, jobId)
+			activeLogStreamsMutex.Unlock()
+		}()
+		if ws != nil {
+			defer ws.Close()
+		}
+		lines, err := streamLogs(job, sink)
+		result := commandResult(startedAt, "", "", err)
+		result.Metadata = map[string]string{"source": job.source(), "lines": strconv.Itoa(lines)}
+		if err != nil {
+			log.Println("Error streaming logs for job ID:", jobId, err.Error())
+			result.Message = "failed to stream logs: " + err.Error()
+			updateJobStatus(hostname, jobId, "failed", result)
+			return
+		}
+		result.Message = fmt.Sprintf("streamed %d lines of %s", lines, job.source())
+		updateJobStatus(hostname, jobId, "completed", result)
+	}()
+}
+
+// streamLogs follows the log source of a job until its duration is over and sends
+// the lines in batches. The stream ends early if the source command exits.
+//
+// Parameters:
+//   - job: The stream_logs job
+//   - sink: Receives the batches of lines
+//
+// Returns:
+//   - int: The number of lines sent
+//   - error: An error if the source cannot be followed or a batch cannot be sent
+func streamLogs(job logStreamJob, sink logSink) (int, error) {
+	if job.File != "" {
+		// The file may have been replaced by a symlink since the job was checked
+		if resolved, allowed := currentConfig().JobPolicy.ResolveLogSource(job.File); !allowed || resolved != job.File {
+			return 0, fmt.Errorf("%s is not in the log_stream_allowlist of the host anymore", job.File)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(job.DurationSeconds)*time.Second)
+	defer cancel()
+	cmd := logStreamCommand(ctx, job)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	tailed := make(chan string)
+	go func() {
+		defer close(tailed)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			tailed <- scanner.Text()
+		}
+	}()
+	defer func() {
+		// Stop the source, drain the remaining lines and reap the command
+		cancel()
+		for range tailed {
+		}
+		cmd.Wait()
+	}()
+
+	sent := 0
+	batch := []string{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := sink(batch); err != nil {
+			return err
+		}
+		sent += len(batch)
+		batch = []string{}
+		return nil
+	}
+	ticker := time.NewTicker(logStreamFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-tailed:
+			if !ok {
+				return sent, flush()
+			}
+			batch = append(batch, line)
+			if len(batch) >= maxLogStreamBatch {
+				if err := flush(); err != nil {
+					return sent, err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return sent, err
+			}
+		}
+	}
+}
+
+// logStreamActive reports whether a stream_logs job is running in this process
+func logStreamActive(jobId string) bool {
+	activeLogStreamsMutex.Lock()
+	defer activeLogStreamsMutex.Unlock()
+	return activeLogStreams[jobId]
+}
@@ -0,0 +1,152 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+const maxMaintenanceMinutes = 7 * 24 * 60 // Upper bound of the duration of a maintenance_mode job
+
+// maintenancePath holds the maintenance mode of the host. The file is read in every
+// task cycle, so the running service follows the maintenance command without a restart.
+var maintenancePath = cloudguardian_config.StateDir + "/maintenance.json"
+
+// maintenanceModeJob is the job data of a maintenance_mode job, e.g.
+// {"enabled": true, "duration_minutes": 120, "reason": "CHG-1234"}.
+// {"enabled": false} ends the maintenance mode.
+type maintenanceModeJob struct {
+	Enabled         bool   `json:"enabled"`
+	DurationMinutes int    `json:"duration_minutes"` // 0 keeps the maintenance mode until it is ended
+	Reason          string `json:"reason"`
+}
+
+// StartMaintenance puts the host in maintenance mode during planned work. Every
+// request then carries the maintenance headers and the ping reports the
+// maintenance mode, so the API suppresses alerts while it keeps recording data.
+//
+// Parameters:
+//   - reason: Why the host is in maintenance mode, may be empty
+//   - duration: The maintenance mode ends after the duration, 0 keeps it until EndMaintenance
+//   - jobId: The maintenance_mode job, empty for the maintenance command
+//
+// Returns:
+//   - api.MaintenanceMode: The written maintenance mode
+//   - error: An error if the maintenance file could not be written
+func StartMaintenance(reason string, duration time.Duration, jobId string) (api.MaintenanceMode, error) {
+	now := time.Now().UTC()
+	mode := api.MaintenanceMode{Since: now.Format(time.RFC3339), Reason: reason, JobId: jobId}
+	if duration > 0 {
+		mode.Until = now.Add(duration).Format(time.RFC3339)
+	}
+	data, err := json.Marshal(mode)
+	if err != nil {
+		return mode, err
+	}
+	if err := os.WriteFile(maintenancePath, data, 0600); err != nil {
+		return mode, err
+	}
+	api.SetMaintenance(true, mode.Until)
+	return mode, nil
+}
+
+// EndMaintenance ends the maintenance mode of the host.
+//
+// Returns:
+//   - bool: true if the host was in maintenance mode
+//   - error: An error if the maintenance file could not be removed
+func EndMaintenance() (bool, error) {
+	_, active := Maintenance()
+	err := os.Remove(maintenancePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	api.SetMaintenance(false, "")
+	return active, nil
+}
+
+// Maintenance returns the maintenance mode of the host. A maintenance mode that
+// ended is ignored.
+//
+// Returns:
+//   - api.MaintenanceMode: The maintenance mode, empty if the host is not in maintenance mode
+//   - bool: true if the host is in maintenance mode
+func Maintenance() (api.MaintenanceMode, bool) {
+	var mode api.MaintenanceMode
+	data, err := os.ReadFile(maintenancePath)
+	if err != nil {
+		return mode, false
+	}
+	if err := json.Unmarshal(data, &mode); err != nil {
+		log.Println("Error reading the maintenance file, the host is not in maintenance mode:", err.Error())
+		return api.MaintenanceMode{}, false
+	}
+	if until, err := time.Parse(time.RFC3339, mode.Until); err == nil && time.Now().After(until) {
+		return api.MaintenanceMode{}, false
+	}
+	return mode, true
+}
+
+// refreshMaintenance applies the maintenance mode to the requests of the agent,
+// it may have been changed by the maintenance command or have ended
+func refreshMaintenance() {
+	mode, active := Maintenance()
+	api.SetMaintenance(active, mode.Until)
+}
+
+// parseMaintenanceModeJobData parses and validates the job data of a maintenance_mode job
+func parseMaintenanceModeJobData(jobData string) (maintenanceModeJob, error) {
+	var job maintenanceModeJob
+	if err := json.Unmarshal([]byte(jobData), &job); err != nil {
+		return job, fmt.Errorf("job data is not valid JSON: %w", err)
+	}
+	if job.DurationMinutes < 0 || job.DurationMinutes > maxMaintenanceMinutes {
+		return job, fmt.Errorf("duration_minutes must be between 0 and %d", maxMaintenanceMinutes)
+	}
+	return job, nil
+}
+
+// processJobMaintenanceMode starts or ends the maintenance mode of the host, the
+// signed equivalent of the maintenance command
+func processJobMaintenanceMode(hostname string, jobId string, jobData string) {
+	log.Println("Processing maintenance_mode job for job ID:", jobId)
+	startedAt := time.Now()
+	job, err := parseMaintenanceModeJobData(jobData)
+	if err != nil {
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid maintenance_mode job data: "+err.Error()))
+		return
+	}
+
+	result := runningResult(startedAt)
+	if job.Enabled {
+		mode, err := StartMaintenance(job.Reason, time.Duration(job.DurationMinutes)*time.Minute, jobId)
+		if err != nil {
+			updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ClassifyError(err, ""), "error starting the maintenance mode: "+err.Error()))
+			return
+		}
+		result.Message = "started the maintenance mode"
+		if mode.Until != "" {
+			result.Message += " until " + mode.Until
+		}
+	} else {
+		active, err := EndMaintenance()
+		if err != nil {
+			updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ClassifyError(err, ""), "error ending the maintenance mode: "+err.Error()))
+			return
+		}
+		result.Message = "ended the maintenance mode"
+		if !active {
+			result.Message = "the host was not in maintenance mode"
+		}
+	}
+	log.Println("Maintenance mode:", result.Message)
+	result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	updateJobStatus(hostname, jobId, "completed", result)
+}
@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	cloudguardian_faults "cloud-guardian/faults"
+	cloudguardian_logging "cloud-guardian/logging"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// fullPackageSyncInterval is the maximum time between two full package inventory uploads
+const fullPackageSyncInterval = 7 * 24 * time.Hour
+
+// packageStatePath contains the last submitted package inventory
+var packageStatePath = cloudguardian_config.StateDir + "/packages.json"
+
+// packageState is the package inventory as last acknowledged by the API
+type packageState struct {
+	Hash         string              `json:"hash"`
+	LastFullSync time.Time           `json:"last_full_sync"`
+	Packages     []map[string]string `json:"packages"`
+}
+
+// packageDelta contains the differences between two package inventories
+type packageDelta struct {
+	Added   []map[string]string `json:"added"`
+	Removed []map[string]string `json:"removed"`
+	Changed []map[string]string `json:"changed"` // Same package with a different version, includes "previous_version"
+}
+
+// submitPackageInventory sends only the changes since the last acknowledged inventory.
+// A full inventory is sent if there is no previous state, the last full sync is older
+// than fullPackageSyncInterval, or the API rejects the delta.
+//
+// Returns:
+//   - bool: true if the inventory was submitted or was unchanged
+func submitPackageInventory(ctx context.Context, hostname string, packages []map[string]string) bool {
+	hash := hashPackages(packages)
+	state, err := loadPackageState()
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Error reading package state, sending full inventory:", err.Error())
+	}
+
+	if state != nil && time.Since(state.LastFullSync) < fullPackageSyncInterval {
+		if state.Hash == hash {
+			log.Println("Installed packages unchanged since last submission for", hostname)
+			return true
+		}
+		delta := diffPackages(state.Packages, packages)
+		statusCode, err := currentClient().SubmitPackageDelta(ctx, hostname, map[string]any{
+			"base_hash": state.Hash,
+			"hash":      hash,
+			"added":     delta.Added,
+			"removed":   delta.Removed,
+			"changed":   delta.Changed,
+		})
+		switch {
+		case err == nil && statusCode == http.StatusOK:
+			savePackageState(packageState{Hash: hash, LastFullSync: state.LastFullSync, Packages: packages})
+			log.Printf("Installed package changes submitted for %s (%d added, %d removed, %d changed)",
+				hostname, len(delta.Added), len(delta.Removed), len(delta.Changed))
+			return true
+		case statusCode == http.StatusNotFound || statusCode == http.StatusConflict:
+			// The API does not support deltas or has a different base inventory
+			log.Println("Package delta rejected with status code", statusCode, "- sending full inventory")
+		default:
+			handleAPIError("Error submitting installed package changes", err, statusCode)
+			return false
+		}
+	}
+
+	statusCode, err := currentClient().SubmitPackages(ctx, hostname, packages)
+	if err != nil || statusCode != http.StatusOK {
+		handleAPIError("Error submitting installed packages", err, statusCode)
+		return false
+	}
+	savePackageState(packageState{Hash: hash, LastFullSync: time.Now(), Packages: packages})
+	return true
+}
+
+// diffPackages compares two package inventories. A package that was removed and
+// added with another version is reported as changed.
+//
+// Parameters:
+//   - previous: The previously submitted packages
+//   - current: The currently installed packages
+//
+// Returns:
+//   - packageDelta: The added, removed and changed packages, sorted by name
+func diffPackages(previous, current []map[string]string) packageDelta {
+	previousKeys := map[string]map[string]string{}
+	for _, pkg := range previous {
+		previousKeys[packageKey(pkg)] = pkg
+	}
+	currentKeys := map[string]bool{}
+	addedByName := map[string][]map[string]string{}
+	for _, pkg := range current {
+		key := packageKey(pkg)
+		currentKeys[key] = true
+		if _, ok := previousKeys[key]; !ok {
+			addedByName[pkg["name"]] = append(addedByName[pkg["name"]], pkg)
+		}
+	}
+	removedByName := map[string][]map[string]string{}
+	for key, pkg := range previousKeys {
+		if !currentKeys[key] {
+			removedByName[pkg["name"]] = append(removedByName[pkg["name"]], pkg)
+		}
+	}
+
+	delta := packageDelta{
+		Added:   []map[string]string{},
+		Removed: []map[string]string{},
+		Changed: []map[string]string{},
+	}
+	for name, added := range addedByName {
+		removed := removedByName[name]
+		if len(added) == 1 && len(removed) == 1 {
+			delta.Changed = append(delta.Changed, map[string]string{
+				"name":             name,
+				"version":          added[0]["version"],
+				"repo":             added[0]["repo"],
+				"previous_version": removed[0]["version"],
+			})
+			delete(removedByName, name)
+			continue
+		}
+		delta.Added = append(delta.Added, added...)
+	}
+	for _, removed := range removedByName {
+		delta.Removed = append(delta.Removed, removed...)
+	}
+	for _, packages := range [][]map[string]string{delta.Added, delta.Removed, delta.Changed} {
+		sort.Slice(packages, func(i, j int) bool { return packageKey(packages[i]) < packageKey(packages[j]) })
+	}
+	return delta
+}
+
+// hashPackages returns a hash of the package inventory that does not depend on the order of the packages
+func hashPackages(packages []map[string]string) string {
+	keys := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		keys = append(keys, packageKey(pkg))
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func packageKey(pkg map[string]string) string {
+	return pkg["name"] + " " + pkg["version"] + " " + pkg["repo"]
+}
+
+func loadPackageState() (*packageState, error) {
+	data, err := os.ReadFile(packageStatePath)
+	if err != nil {
+		return nil, err
+	}
+	var state packageState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func savePackageState(state packageState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Println("Error encoding package state:", err.Error())
+		return
+	}
+	// Without a writable state directory every submission is a full inventory
+	if err := os.WriteFile(packageStatePath, cloudguardian_faults.CorruptState(packageStatePath, data), 0600); err != nil {
+		cloudguardian_logging.Debug("Error writing package state:", err.Error())
+	}
+}
@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// pausePath marks the agent as paused by an operator. The file is read in every
+// task cycle, so the running service follows pause and resume without a restart.
+var pausePath = cloudguardian_config.StateDir + "/paused"
+
+// PauseState is the content of the pause file
+type PauseState struct {
+	Since  time.Time `json:"since"`
+	Until  string    `json:"until,omitempty"`  // End of the pause, RFC 3339, empty to pause until resumed
+	Reason string    `json:"reason,omitempty"` // Why the agent was paused, e.g. an incident number
+}
+
+// Pause stops the job execution and the submissions of the agent, e.g. during
+// incident response. Pings continue and report the pause.
+//
+// Parameters:
+//   - reason: Why the agent is paused, may be empty
+//   - duration: The agent resumes after the duration, 0 pauses it until Resume
+//
+// Returns:
+//   - PauseState: The written pause state
+//   - error: An error if the pause file could not be written
+func Pause(reason string, duration time.Duration) (PauseState, error) {
+	state := PauseState{Since: time.Now().UTC(), Reason: reason}
+	if duration > 0 {
+		state.Until = state.Since.Add(duration).Format(time.RFC3339)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return state, err
+	}
+	return state, os.WriteFile(pausePath, data, 0600)
+}
+
+// Resume removes the pause of the agent.
+//
+// Returns:
+//   - bool: true if the agent was paused
+//   - error: An error if the pause file could not be removed
+func Resume() (bool, error) {
+	err := os.Remove(pausePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Paused returns the pause of the agent. A pause that ended is ignored.
+//
+// Returns:
+//   - PauseState: The pause state, empty if the agent is not paused
+//   - bool: true if the agent is paused
+func Paused() (PauseState, bool) {
+	var state PauseState
+	data, err := os.ReadFile(pausePath)
+	if err != nil {
+		return state, false
+	}
+	// An unreadable pause file still pauses, the operator asked for a pause
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Println("Error reading the pause file, the agent stays paused:", err.Error())
+		return state, true
+	}
+	if until, err := time.Parse(time.RFC3339, state.Until); err == nil && time.Now().After(until) {
+		return PauseState{}, false
+	}
+	return state, true
+}
+
+// skipPaused reports whether a task is skipped because the agent is paused
+func skipPaused(task string) bool {
+	state, paused := Paused()
+	if paused {
+		log.Println("Agent is paused since", state.Since.Format(time.RFC3339)+", skipping", task)
+	}
+	return paused
+}
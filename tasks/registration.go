@@ -0,0 +1,105 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// reregisterInterval is the minimum time between two automatic re-registration attempts
+const reregisterInterval = time.Hour
+
+// lastReregisterAttempt is the time of the last automatic re-registration attempt
+var lastReregisterAttempt time.Time
+
+// submitInventory submits the inventory after a re-registration, it can be mocked in tests
+var submitInventory = processInventoryTasks
+
+// isHostUnknown reports whether a status code of a host endpoint means that the API
+// does not know the host (anymore), e.g. because it was deleted in the dashboard.
+func isHostUnknown(statusCode int) bool {
+	return statusCode == http.StatusNotFound || statusCode == http.StatusGone
+}
+
+// handleUnknownHost registers the host again after the API deleted it, unless
+// automatic re-registration is disabled. Attempts are limited to one per
+// reregisterInterval. After a successful registration the inventory is submitted
+// again, so the new host is complete without waiting for the inventory interval.
+//
+// Parameters:
+//   - ctx: The context of the task that found the host unknown
+//   - hostname: The hostname of the agent
+//
+// Returns:
+//   - bool: true if the host was registered again
+func handleUnknownHost(ctx context.Context, hostname string) bool {
+	log.Println("The host", hostname, "is not registered with the API anymore, it may have been deleted")
+	if currentConfig().DisableAutoReregister {
+		log.Println("Automatic re-registration is disabled, run 'cloud-guardian --register' to register the host again")
+		return false
+	}
+	if since := time.Since(lastReregisterAttempt); since < reregisterInterval {
+		log.Println("Next automatic re-registration attempt in", (reregisterInterval - since).Round(time.Minute))
+		return false
+	}
+	lastReregisterAttempt = time.Now()
+
+	log.Println("Registering the host", hostname, "again...")
+	statusCode, signingSecret, err := currentClient().Register(ctx, hostname, currentConfig().Labels)
+	if err != nil || statusCode != http.StatusOK {
+		handleAPIError("Error registering the host again", err, statusCode)
+		return false
+	}
+	config := *currentConfig()
+	if err := UseSigningSecret(&config, signingSecret); err != nil {
+		log.Println("Warning: The new signing secret could not be saved, requests are signed with it until the agent restarts:", err.Error())
+	}
+	SetConfig(&config)
+	log.Println("Host", hostname, "registered again successfully, submitting the inventory")
+	submitInventory(ctx, hostname)
+	return true
+}
+
+// UseSigningSecret signs the requests with the signing secret the API issued at a
+// registration and saves it to the configuration file, so the agent keeps
+// signing after a restart. The current secret is kept if the API issued none.
+//
+// Parameters:
+//   - config: The configuration of the agent, its signing secret is replaced
+//   - signingSecret: The signing secret of the registration response
+//
+// Returns:
+//   - error: An error if the configuration file could not be written
+func UseSigningSecret(config *cloudguardian_config.CloudGuardianConfig, signingSecret string) error {
+	if signingSecret == "" || signingSecret == config.SigningSecret {
+		return nil
+	}
+	config.SigningSecret = signingSecret
+	api.SetSigningKey(config.ApiKey, signingSecret)
+	if config.Source.Path == "" {
+		return nil
+	}
+	return cloudguardian_config.SaveSigningSecret(config.Source.Path, signingSecret)
+}
+
+// WipeState removes the state files of the agent, the processed jobs, the last
+// submitted package inventory, the last update jobs, a pause and the maintenance
+// mode, e.g. after the host was deregistered. A host that is registered again then starts with a full inventory and no job history.
+//
+// Returns:
+//   - error: An error if a state file exists and could not be removed
+func WipeState() error {
+	processedJobsMutex.Lock()
+	processedJobsFallback = nil
+	processedJobsMutex.Unlock()
+	for _, path := range []string{processedJobsPath, packageStatePath, lastUpdatesPath, unitFilesPath, criticalFilesPath, pausePath, maintenancePath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
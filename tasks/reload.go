@@ -0,0 +1,56 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	linux_debian_apt "cloud-guardian/linux_debian/apt"
+	cloudguardian_logging "cloud-guardian/logging"
+	"log"
+	"reflect"
+	"slices"
+)
+
+// Reloads receives a new, validated configuration when the configuration is reloaded,
+// e.g. on SIGHUP. It may be nil.
+var Reloads <-chan *cloudguardian_config.CloudGuardianConfig
+
+// applyConfig replaces the configuration of the running agent. The API client is
+// recreated if the API URLs, keys or tenants changed. Settings that are only read at start
+// are logged, they take effect after a restart. Running jobs keep the configuration
+// and client they already read, the next read returns the new ones.
+//
+// Parameters:
+//   - newConfig: The validated configuration
+func applyConfig(newConfig *cloudguardian_config.CloudGuardianConfig) {
+	// Jobs processed by the long-poll channel must not see a half applied configuration
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	oldConfig := currentConfig()
+	if newConfig.ApiUrl != oldConfig.ApiUrl || !slices.Equal(newConfig.ApiUrls, oldConfig.ApiUrls) ||
+		newConfig.ApiKey != oldConfig.ApiKey || newConfig.SigningSecret != oldConfig.SigningSecret ||
+		!reflect.DeepEqual(newConfig.Tenants, oldConfig.Tenants) {
+		api.SetSigningKey(newConfig.ApiKey, newConfig.SigningSecret)
+		SetClient(api.NewClient(newConfig))
+		log.Println("Using API URL:", newConfig.ApiUrl)
+	}
+	if level := newConfig.EffectiveLogLevel(); level != cloudguardian_logging.CurrentLevel() {
+		log.Println("Log level:", level)
+		cloudguardian_logging.SetLevel(level)
+	}
+	api.SetDebugBodies(newConfig.DebugBodies)
+	if len(newConfig.AptDpkgOptions) > 0 {
+		linux_debian_apt.SetDpkgOptions(newConfig.AptDpkgOptions)
+	}
+
+	if newConfig.LongPoll != oldConfig.LongPoll || newConfig.OtlpEndpoint != oldConfig.OtlpEndpoint ||
+		newConfig.HostnameDomain != oldConfig.HostnameDomain || newConfig.HostnameLower != oldConfig.HostnameLower ||
+		newConfig.Hostname != oldConfig.Hostname || newConfig.HostnamePrefix != oldConfig.HostnamePrefix || newConfig.HostnameSuffix != oldConfig.HostnameSuffix ||
+		newConfig.StatusListen != oldConfig.StatusListen {
+		log.Println("Changes of long_poll, otlp_endpoint, status_listen and the hostname policy take effect after a restart")
+		newConfig.LongPoll = oldConfig.LongPoll
+	}
+
+	SetConfig(newConfig)
+	log.Println("Configuration reloaded successfully")
+}
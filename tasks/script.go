@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// processJobScript runs the job data as a script with the script_interpreter and
+// reports its output and exit code like a command job. The script is written to
+// a private temporary directory, which is removed afterwards. A script that runs
+// longer than the script_timeout, or the timeout of the job, is killed together
+// with its child processes. A job that names a user or group runs with their
+// privileges, the script directory is owned by them.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - jobId: The ID of the job
+//   - jobData: The script, or a JSON object with the script, its timeout and user, see execJob
+func processJobScript(hostname string, jobId string, jobData string) {
+	log.Println("Processing script job for job ID:", jobId)
+	startedAt := time.Now()
+	interpreter := currentConfig().ScriptInterpreter
+	if interpreter == "" {
+		interpreter = cloudguardian_config.DefaultScriptInterpreter
+	}
+	job, err := parseExecJobData("script", jobData)
+	var runAs jobUser
+	if err == nil {
+		runAs, err = lookupJobUser(job.User, job.Group)
+	}
+	if err != nil {
+		log.Println("Error parsing script job data:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid script job data: "+err.Error()))
+		return
+	}
+	timeout := job.timeout()
+
+	dir, err := os.MkdirTemp("", "cloud-guardian-script")
+	if err != nil {
+		log.Println("Error creating the script directory:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ClassifyError(err, ""), "failed to write the script: "+err.Error()))
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "script")
+	err = os.WriteFile(path, []byte(job.Script), 0700)
+	if err == nil && runAs.Credential != nil {
+		err = chownAll(int(runAs.Credential.Uid), int(runAs.Credential.Gid), dir, path)
+	}
+	if err != nil {
+		log.Println("Error writing the script:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ClassifyError(err, ""), "failed to write the script: "+err.Error()))
+		return
+	}
+
+	updateJobStatus(hostname, jobId, "running", runningResult(startedAt))
+	log.Println("Executing script with", interpreter, "as", runAs.Name, "and a timeout of", timeout)
+	output := startJobOutput(hostname, jobId, startedAt)
+	stdOut, stdErr, exitCode, err := runJobProcess(timeout, dir, runAs, output.live(), interpreter, path)
+	output.finish()
+	result := commandResult(startedAt, stdOut, stdErr, err)
+	result.ExitCode = exitCode
+	result.Metadata = map[string]string{"interpreter": interpreter, "timeout_seconds": strconv.Itoa(job.TimeoutSeconds), "user": runAs.Name, "group": runAs.Group}
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("Script timed out after", timeout)
+		result.ErrorCode = api.ErrorCodeTimeout
+		result.Message = fmt.Sprintf("timed out after %s", timeout)
+		updateJobStatus(hostname, jobId, "failed", result)
+		return
+	}
+	if err != nil {
+		log.Println("Error executing script:", err.Error())
+		result.Message = "failed to execute script"
+		updateJobStatus(hostname, jobId, "failed", result)
+		return
+	}
+	updateJobStatus(hostname, jobId, "completed", result)
+}
+
+// chownAll changes the owner of files, e.g. of a script run as another user
+func chownAll(uid int, gid int, paths ...string) error {
+	for _, path := range paths {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_version"
+	linux_environment "cloud-guardian/linux/environment"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxRecentJobs = 20 // Jobs shown on the status page, the most recently updated first
+
+// agentStatus is the state of the running agent shown on the local status page
+type agentStatus struct {
+	mutex       sync.Mutex
+	startedAt   time.Time
+	lastRuns    map[string]time.Time // Last run of each task group by name
+	monitoring  *api.Monitoring      // Last collected monitoring data
+	pendingJobs []api.HostJob        // Jobs of the last fetch of submitted jobs
+}
+
+var status = &agentStatus{startedAt: time.Now(), lastRuns: map[string]time.Time{}}
+
+// Environment are the effective proxy and TLS variables, shown on the status page
+var Environment []linux_environment.Setting
+
+func (s *agentStatus) recordRun(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastRuns[name] = time.Now()
+}
+
+func (s *agentStatus) recordMonitoring(monitoring api.Monitoring) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.monitoring = &monitoring
+}
+
+func (s *agentStatus) recordPendingJobs(jobs []api.HostJob) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pendingJobs = jobs
+}
+
+// statusJob is a job on the status page. The page is readable by every local
+// user, so it has no job data, signature or result, commands and their output
+// may contain secrets.
+type statusJob struct {
+	JobId     string    `json:"job_id"`
+	JobType   string    `json:"job_type"`
+	Status    string    `json:"status,omitempty"`
+	CreatedAt string    `json:"created_at,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// statusReport is the content of the status page
+type statusReport struct {
+	Hostname       string                      `json:"hostname"`
+	AgentVersion   string                      `json:"agent_version"`
+	ApiUrl         string                      `json:"api_url"`
+	StartedAt      time.Time                   `json:"started_at"`
+	Degraded       bool                        `json:"degraded"`
+	DegradedCode   api.ErrorCode               `json:"degraded_code,omitempty"`
+	DegradedReason string                      `json:"degraded_reason,omitempty"`
+	Paused         *PauseState                 `json:"paused,omitempty"`
+	Maintenance    *api.MaintenanceMode        `json:"maintenance,omitempty"`
+	LastRuns       map[string]time.Time        `json:"last_runs"`
+	Monitoring     *api.Monitoring             `json:"monitoring"`
+	PendingJobs    []statusJob                 `json:"pending_jobs"`
+	RecentJobs     []statusJob                 `json:"recent_jobs"`
+	Environment    []linux_environment.Setting `json:"environment"` // Proxy and TLS variables with their source
+}
+
+// report collects the current state for the status page.
+func (s *agentStatus) report(hostname string) statusReport {
+	s.mutex.Lock()
+	report := statusReport{
+		Hostname:     hostname,
+		AgentVersion: cloudguardian_version.Version,
+		ApiUrl:       currentConfig().ApiUrl,
+		StartedAt:    s.startedAt,
+		LastRuns:     make(map[string]time.Time, len(s.lastRuns)),
+		Monitoring:   s.monitoring,
+		PendingJobs:  make([]statusJob, 0, len(s.pendingJobs)),
+		Environment:  append([]linux_environment.Setting{}, Environment...),
+	}
+	for name, lastRun := range s.lastRuns {
+		report.LastRuns[name] = lastRun
+	}
+	for _, job := range s.pendingJobs {
+		report.PendingJobs = append(report.PendingJobs, statusJob{JobId: job.JobId, JobType: job.JobType, Status: job.Status, CreatedAt: job.CreatedAt})
+	}
+	s.mutex.Unlock()
+
+	code, reason, _ := degraded.status()
+	report.Degraded, report.DegradedCode, report.DegradedReason = reason != "", code, reason
+	if state, paused := Paused(); paused {
+		report.Paused = &state
+	}
+	if mode, active := Maintenance(); active {
+		report.Maintenance = &mode
+	}
+
+	processedJobsMutex.Lock()
+	for jobId, job := range loadProcessedJobs() {
+		report.RecentJobs = append(report.RecentJobs, statusJob{JobId: jobId, JobType: job.JobType, Status: job.Status, UpdatedAt: job.UpdatedAt})
+	}
+	processedJobsMutex.Unlock()
+	sort.Slice(report.RecentJobs, func(i, j int) bool {
+		return report.RecentJobs[i].UpdatedAt.After(report.RecentJobs[j].UpdatedAt)
+	})
+	if len(report.RecentJobs) > maxRecentJobs {
+		report.RecentJobs = report.RecentJobs[:maxRecentJobs]
+	}
+	return report
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta http-equiv="refresh" content="60"><title>Cloud Guardian agent on {{.Report.Hostname}}</title></head>
+<body style="font-family: sans-serif">
+<h1>Cloud Guardian agent on {{.Report.Hostname}}</h1>
+<table>
+<tr><th align="left">Version</th><td>{{.Report.AgentVersion}}</td></tr>
+<tr><th align="left">API URL</th><td>{{.Report.ApiUrl}}</td></tr>
+<tr><th align="left">Started</th><td>{{.Report.StartedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+<tr><th align="left">Status</th><td>{{if .Report.Degraded}}degraded: {{.Report.DegradedCode}} {{.Report.DegradedReason}}{{else}}ok{{end}}</td></tr>
+{{with .Report.Paused}}<tr><th align="left">Paused</th><td>since {{.Since.Format "2006-01-02 15:04:05 MST"}}{{if .Until}} until {{.Until}}{{end}}{{if .Reason}}: {{.Reason}}{{end}}</td></tr>
+{{end}}{{with .Report.Maintenance}}<tr><th align="left">Maintenance</th><td>since {{.Since}}{{if .Until}} until {{.Until}}{{end}}{{if .Reason}}: {{.Reason}}{{end}}</td></tr>
+{{end}}{{range $name, $lastRun := .Report.LastRuns}}<tr><th align="left">Last {{$name}}</th><td>{{$lastRun.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{end}}{{range .Report.Environment}}<tr><th align="left">{{.Name}}</th><td>{{.Value}} ({{.Source}})</td></tr>
+{{end}}</table>
+<h2>Pending jobs</h2>
+<table>
+{{range .Report.PendingJobs}}<tr><td>{{.JobId}}</td><td>{{.JobType}}</td><td>{{.CreatedAt}}</td></tr>
+{{else}}<tr><td>No pending jobs</td></tr>
+{{end}}</table>
+<h2>Recent jobs</h2>
+<table>
+{{range .Report.RecentJobs}}<tr><td>{{.JobId}}</td><td>{{.JobType}}</td><td>{{.Status}}</td><td>{{.UpdatedAt.Format "2006-01-02 15:04:05 MST"}}</td></tr>
+{{else}}<tr><td>No recent jobs</td></tr>
+{{end}}</table>
+<h2>Monitoring</h2>
+<pre>{{.Monitoring}}</pre>
+<p><a href="/status.json">status.json</a></p>
+</body>
+</html>
+`))
+
+// statusHandler serves the read-only status page, its JSON form and a health check,
+// which fails while the agent is degraded.
+//
+// Parameters:
+//   - hostname: The hostname of the agent
+//
+// Returns:
+//   - http.Handler: The handler of the status page
+func statusHandler(hostname string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		report := status.report(hostname)
+		monitoring, _ := json.MarshalIndent(report.Monitoring, "", "  ")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		statusPageTemplate.Execute(w, struct {
+			Report     statusReport
+			Monitoring string
+		}{report, string(monitoring)})
+	})
+	mux.HandleFunc("GET /status.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status.report(hostname))
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		if _, reason, _ := degraded.status(); reason != "" {
+			http.Error(w, "degraded: "+reason, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	return mux
+}
+
+// startStatusServer serves the status page on the loopback address of status_listen.
+// The address is validated with the configuration and is only read at start.
+func startStatusServer(hostname string) {
+	server := &http.Server{
+		Addr:              currentConfig().StatusListen,
+		Handler:           statusHandler(hostname),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Println("Serving the status page on http://" + currentConfig().StatusListen + "/")
+		if err := server.ListenAndServe(); err != nil {
+			log.Println("Error serving the status page:", err.Error())
+		}
+	}()
+}
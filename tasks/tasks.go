@@ -4,81 +4,328 @@ import (
 	api "cloud-guardian/api"
 	"cloud-guardian/cloudguardian_config"
 	"cloud-guardian/cloudguardian_version"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	cloudguardian_faults "cloud-guardian/faults"
 	linux "cloud-guardian/linux"
 	linux_container "cloud-guardian/linux/container"
 	linux_df "cloud-guardian/linux/df"
+	linux_dmi "cloud-guardian/linux/dmi"
+	linux_facttags "cloud-guardian/linux/facttags"
+	linux_fileattrs "cloud-guardian/linux/fileattrs"
 	linux_ip "cloud-guardian/linux/ip"
+	linux_kmodules "cloud-guardian/linux/kmodules"
 	linux_loggedinusers "cloud-guardian/linux/loggedinusers"
 	linux_lsblk "cloud-guardian/linux/lsblk"
 	linux_mdstat "cloud-guardian/linux/mdstat"
 	linux_needrestart "cloud-guardian/linux/needrestart"
 	linux_osrelease "cloud-guardian/linux/osrelease"
 	pm "cloud-guardian/linux/packagemanager"
+	linux_pmhealth "cloud-guardian/linux/pmhealth"
+	linux_power "cloud-guardian/linux/power"
+	linux_quota "cloud-guardian/linux/quota"
 	linux_reboot "cloud-guardian/linux/reboot"
+	linux_remotemgmt "cloud-guardian/linux/remotemgmt"
+	linux_swap "cloud-guardian/linux/swap"
+	linux_timeinfo "cloud-guardian/linux/timeinfo"
 	linux_top "cloud-guardian/linux/top"
+	linux_unitdrift "cloud-guardian/linux/unitdrift"
+	cloudguardian_logging "cloud-guardian/logging"
+	cloudguardian_tracing "cloud-guardian/tracing"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"net/http"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-var Config *cloudguardian_config.CloudGuardianConfig // Configuration for the Cloud Gardian client
-const maxRebootDuration = 300                        // Maximum allowed reboot duration in seconds
+const maxRebootDuration = 300 // Maximum allowed reboot duration in seconds
+
+// configPointer and clientPointer hold the configuration and the API client. A
+// reload replaces them while jobs run in the worker pool, so they are only read
+// and replaced atomically, see currentConfig and SetConfig.
+var (
+	configPointer atomic.Pointer[cloudguardian_config.CloudGuardianConfig]
+	clientPointer atomic.Pointer[api.Client]
+)
+
+// SetConfig sets the configuration of the Cloud Guardian client. It is not
+// modified afterwards, a new configuration replaces it as a whole.
+func SetConfig(config *cloudguardian_config.CloudGuardianConfig) {
+	configPointer.Store(config)
+}
+
+// SetClient sets the client for the Cloud Guardian API
+func SetClient(client api.Client) {
+	clientPointer.Store(&client)
+}
+
+// currentConfig returns the current configuration
+func currentConfig() *cloudguardian_config.CloudGuardianConfig {
+	return configPointer.Load()
+}
+
+// currentClient returns the current client for the Cloud Guardian API
+func currentClient() api.Client {
+	if client := clientPointer.Load(); client != nil {
+		return *client
+	}
+	return nil
+}
+
+// fallbackLogged holds the collectors whose missing command was logged
+var fallbackLogged = map[string]bool{}
 
 // getUptime is a function variable that can be mocked in tests
 var getUptime = linux_top.GetUptime
 
+// Triggers receives a value when an immediate task cycle is requested, e.g. by a
+// one-shot invocation while the service is running. It may be nil.
+var Triggers <-chan struct{}
+
+// getSoftRebootsCount is a function variable that can be mocked in tests
+var getSoftRebootsCount = linux_reboot.SoftRebootsCount
+
 func ProcessTasks(hostname string, oneShot bool) {
 
-	log.Println("Using API URL:", Config.ApiUrl)
+	log.Println("Using API URL:", currentConfig().ApiUrl)
+	if currentClient() == nil {
+		SetClient(api.NewClient(currentConfig()))
+	}
 
-	var minuteCounter int = 0
+	var minuteCounter int = 0 // Minutes since the start, task groups run when it is a multiple of their interval
+
+	if !oneShot {
+		confirmAgentUpdate()
+	}
+	if currentConfig().LongPoll && !oneShot {
+		// Jobs are delivered through the long-poll channel, polling stays as fallback
+		startJobChannel(hostname)
+	}
+	if currentConfig().StatusListen != "" && !oneShot {
+		startStatusServer(hostname)
+	}
+
+	// The schedule advances once a minute, triggered task cycles do not move it
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
 	for {
 
-		if minuteCounter%5 == 0 {
-			// Process tasks that need to run every 5 minutes
-			processFiveMinuteTasks(hostname)
+		// The intervals are read in every iteration, so reloaded intervals apply immediately
+		if minuteCounter%currentConfig().MonitoringInterval == 0 {
+			runTasks("monitoring tasks", processMonitoringTasks, hostname)
+		} else if collectorsDue(time.Now()) {
+			// Collectors with a shorter interval than the monitoring run in between
+			runTasks("collector tasks", processBasicMonitoring, hostname)
 		}
-
-		if minuteCounter%60 == 0 {
-			// Process tasks that need to run every hour
-			processHourlyTasks(hostname)
+		if minuteCounter%currentConfig().JobPollInterval == 0 {
+			runTasks("job tasks", processJobTasks, hostname)
 		}
-		if minuteCounter%1440 == 0 {
-			// Process tasks that need to run every day
-			processDailyTasks(hostname)
+		if minuteCounter%currentConfig().ServiceFilesInterval == 0 {
+			runTasks("service file tasks", processServiceFileTasks, hostname)
+		}
+		if minuteCounter%currentConfig().InventoryInterval == 0 {
+			runTasks("inventory tasks", processInventoryTasks, hostname)
 		}
 
 		if oneShot {
-			// If in oneshot mode, exit after processing tasks
+			// If in oneshot mode, exit after processing tasks and the started jobs
+			workerPool.wait()
 			log.Println("Exiting after oneshot execution.")
 			return
 		}
 
-		// Sleep for 1 minute before the next iteration
-		time.Sleep(1 * time.Minute)
+		// Wait for the next minute before the next iteration
+		waitForTick(ticker.C, hostname)
 		minuteCounter++
+	}
+}
 
-		if minuteCounter > 1440 {
-			// Reset the minute counter after 24 hours
-			minuteCounter = 0
+// waitForTick waits for the next tick of the schedule. Task cycles triggered by
+// another invocation and reloaded configurations are handled while waiting, they
+// do not run the tasks due this minute again and do not delay the next tick.
+//
+// Parameters:
+//   - tick: The ticks of the schedule
+//   - hostname: The hostname of the host
+func waitForTick(tick <-chan time.Time, hostname string) {
+	for {
+		select {
+		case <-tick:
+			return
+		case <-Triggers:
+			log.Println("Task cycle triggered by another invocation")
+			runTasks("monitoring tasks", processMonitoringTasks, hostname)
+			runTasks("job tasks", processJobTasks, hostname)
+		case newConfig := <-Reloads:
+			applyConfig(newConfig)
 		}
 	}
 }
 
-func processFiveMinuteTasks(hostname string) {
-	log.Println("Processing 5-minute tasks...")
-	processPing(hostname)
-	processBasicMonitoring(hostname)
-	processRunningJobs(hostname)
-	processNewJobs(hostname)
+// runTasks runs a group of tasks and recovers from a panic, so a collector that
+// fails on unexpected input does not stop the agent loop. Every group starts with
+// a new context, its spans form a trace of their own.
+func runTasks(name string, tasks func(ctx context.Context, hostname string), hostname string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic in %s: %v\n%s", name, r, debug.Stack())
+			recordFailure(0, false)
+		}
+	}()
+	status.recordRun(name)
+	refreshMaintenance()
+	tasks(context.Background(), hostname)
+}
+
+// Tasks are the tasks that can be run once by name, e.g. to debug a failing collector
+// without waiting for the scheduler
+var Tasks = map[string]func(ctx context.Context, hostname string){
+	"ping":         processPing,
+	"monitoring":   processBasicMonitoring,
+	"systeminfo":   withPackageManager(processSystemInfo),
+	"packages":     withPackageManager(processInstalledPackages),
+	"updates":      withPackageManager(processAllUpdates),
+	"jobs":         processJobTasks,
+	"servicefiles": processServiceFileDrift,
+}
+
+// TaskNames returns the names of the tasks in alphabetical order
+func TaskNames() []string {
+	return slices.Sorted(maps.Keys(Tasks))
+}
+
+// RunTask runs a single task once, see Tasks.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - name: The name of the task
+//
+// Returns:
+//   - error: An error if the task is unknown
+func RunTask(hostname string, name string) error {
+	task, ok := Tasks[name]
+	if !ok {
+		return fmt.Errorf("unknown task %q, known tasks are %s", name, strings.Join(TaskNames(), ", "))
+	}
+	log.Println("Using API URL:", currentConfig().ApiUrl)
+	if currentClient() == nil {
+		SetClient(api.NewClient(currentConfig()))
+	}
+	runTasks(name, task, hostname)
+	workerPool.wait()
+	return nil
+}
+
+// LocalTasks are the collector tasks run by RunLocal
+var LocalTasks = []string{"monitoring", "systeminfo", "updates", "packages"}
+
+// RunLocal runs the collector tasks once and writes their payloads as JSON instead
+// of submitting them. The package state of the agent is not touched, so the next
+// submission of the agent is not affected.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - writer: Receives the payloads, e.g. os.Stdout
+func RunLocal(hostname string, writer io.Writer) {
+	SetClient(api.NewPrintClient(writer))
+	runWithoutPackageState(hostname, LocalTasks)
 }
 
-func processDailyTasks(hostname string) {
-	log.Println("Processing daily tasks...")
+// ArchiveTasks are the tasks run by RunArchive
+var ArchiveTasks = []string{"ping", "monitoring", "systeminfo", "updates", "packages"}
+
+// RunArchive runs the tasks of a one-shot run without jobs once and writes their
+// payloads to a signed archive instead of submitting them, so the data of hosts
+// without access to the API can be imported out-of-band. The full package
+// inventory is written, the package state of the agent is not touched.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - path: The archive file
+//
+// Returns:
+//   - api.ArchiveManifest: The manifest of the archive
+//   - error: An error if the archive could not be written
+func RunArchive(hostname string, path string) (api.ArchiveManifest, error) {
+	client := api.NewArchiveClient(hostname, currentConfig().SigningSecret)
+	SetClient(client)
+	runWithoutPackageState(hostname, ArchiveTasks)
+	return client.WriteArchive(path, cloudguardian_version.Version)
+}
+
+// runWithoutPackageState runs tasks once with a temporary package state, so the
+// full inventory is submitted and the next submission of the agent is not affected
+func runWithoutPackageState(hostname string, names []string) {
+	packageStatePath = "" // Always the full inventory, nothing is saved
+	unitFilesPath, criticalFilesPath = "", ""
+	if dir, err := os.MkdirTemp("", "cloud-guardian-local"); err == nil {
+		defer os.RemoveAll(dir)
+		packageStatePath = filepath.Join(dir, "packages.json")
+		unitFilesPath = filepath.Join(dir, "unit-files.json")
+		criticalFilesPath = filepath.Join(dir, "critical-files.json")
+	}
+	for _, name := range names {
+		runTasks(name, Tasks[name], hostname)
+	}
+}
+
+// withPackageManager returns a task that runs a task that needs the package manager of the host
+func withPackageManager(task func(ctx context.Context, hostname string, packageManager pm.PackageManager)) func(ctx context.Context, hostname string) {
+	return func(ctx context.Context, hostname string) {
+		packageManager, err := pm.DetectPackageManager()
+		if err != nil {
+			log.Println("Error detecting package manager:", err.Error())
+			return
+		}
+		task(ctx, hostname, packageManager)
+	}
+}
+
+// processAllUpdates submits all and the security updates
+func processAllUpdates(ctx context.Context, hostname string, packageManager pm.PackageManager) {
+	processUpdates(ctx, hostname, pm.AllUpdates, packageManager)
+	processUpdates(ctx, hostname, pm.SecurityUpdates, packageManager)
+}
+
+func processMonitoringTasks(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "monitoring_tasks")
+	defer span.End()
+	log.Println("Processing monitoring tasks...")
+	processPing(ctx, hostname)
+	processBasicMonitoring(ctx, hostname)
+}
+
+func processJobTasks(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "job_tasks")
+	defer span.End()
+	log.Println("Processing job tasks...")
+	if skipPaused("job processing") {
+		return
+	}
+	if !degraded.allow() {
+		log.Println("Agent is degraded, skipping job processing until the next retry")
+		return
+	}
+	processRunningJobs(ctx, hostname)
+	processNewJobs(ctx, hostname)
+	checkSelfUpdate(ctx, hostname)
+}
+
+func processInventoryTasks(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "inventory_tasks")
+	defer span.End()
+	log.Println("Processing inventory tasks...")
 
 	// Detect package manager
 	packageManager, err := pm.DetectPackageManager()
@@ -86,90 +333,222 @@ func processDailyTasks(hostname string) {
 		log.Println("Error detecting package manager:", err.Error())
 		return
 	}
-	processSystemInfo(hostname)
-	processUpdates(hostname, pm.AllUpdates, packageManager)
-	processUpdates(hostname, pm.SecurityUpdates, packageManager)
-	processInstalledPackages(hostname, packageManager)
+	processSystemInfo(ctx, hostname, packageManager)
+	processAllUpdates(ctx, hostname, packageManager)
+	processInstalledPackages(ctx, hostname, packageManager)
 }
 
-func processHourlyTasks(hostname string) {
-	// This function can be used to process hourly tasks if needed
-	log.Println("Processing hourly tasks...")
-	// For example, you can call processPing or other functions here
+func processServiceFileTasks(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "service_file_tasks")
+	defer span.End()
+	log.Println("Processing service file tasks...")
+	processServiceFileDrift(ctx, hostname)
 }
 
-func processPing(hostname string) {
+func processPing(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "ping")
+	defer span.End()
 	// Process ping for the given hostname
 	log.Println("Processing ping for", hostname)
 
-	statusCode, err := api.PostRequest(Config.ApiUrl+"hosts/ping/"+hostname, Config.ApiKey, map[string]any{})
+	if !degraded.allow() {
+		log.Println("Agent is degraded, skipping ping until the next retry")
+		return
+	}
+	heartbeat := api.Heartbeat{Config: currentConfig().Source, DataVolume: api.Metrics.DataVolume()}
+	if code, reason, since := degraded.status(); reason != "" {
+		heartbeat.Degraded = true
+		heartbeat.DegradedCode = code
+		heartbeat.DegradedReason = reason
+		heartbeat.DegradedSince = since.UTC().Format(time.RFC3339)
+	}
+	if state, paused := Paused(); paused {
+		heartbeat.Paused = true
+		heartbeat.PausedReason = state.Reason
+	}
+	if mode, active := Maintenance(); active {
+		heartbeat.Maintenance = &mode
+	}
+	statusCode, err := currentClient().Ping(ctx, hostname, heartbeat)
+	if isHostUnknown(statusCode) {
+		handleUnknownHost(ctx, hostname)
+		return
+	}
 
 	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error submitting ping", err, statusCode)
 		return
 	}
+	degraded.clear()
 	log.Println("Ping submitted successfully for", hostname)
 }
 
-func processBasicMonitoring(hostname string) {
+func processBasicMonitoring(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "basic_monitoring")
+	defer span.End()
 	// Process simple monitoring metrics for the given hostname
 	log.Println("Processing basic monitoring for", hostname)
+	if skipNonCriticalSubmission("basic monitoring") {
+		return
+	}
+
+	// The cycle timestamp and the capture time of each collector let the API
+	// align metrics when some collectors are delayed
+	cycleTimestamp := time.Now().UTC()
+	captured := collectorTimestamps{}
 
 	uptime, err := linux_top.GetUptime()
+	captured.record("Uptime")
 	if err != nil {
 		log.Println("Error getting uptime:", err.Error())
 		return
 	}
+	monitoring := api.Monitoring{
+		Uptime:             uptime,
+		CollectorErrors:    []api.CollectorError{},
+		DisabledCollectors: []string{},
+		SkippedCollectors:  []string{},
+		FallbackCollectors: []string{},
+	}
+
+	// collect runs a collector unless it is disabled in the configuration or its
+	// interval did not elapse since its last run
+	collect := func(name string, collector func() error) error {
+		if !currentConfig().CollectorEnabled(name) {
+			monitoring.DisabledCollectors = append(monitoring.DisabledCollectors, name)
+			return nil
+		}
+		if !collectorDue(name, cycleTimestamp) {
+			monitoring.SkippedCollectors = append(monitoring.SkippedCollectors, name)
+			return nil
+		}
+		recordCollectorRun(name, cycleTimestamp)
+		cloudguardian_faults.DelayCollector(name)
+		return collector()
+	}
+
+	// fallback checks if a collector has to use its native implementation, minimal
+	// images may lack the commands. A missing command is logged once.
+	fallback := func(name string, command string) bool {
+		if linux.CommandAvailable(command) {
+			return false
+		}
+		if !fallbackLogged[name] {
+			log.Println("Command", command, "not found, collector", name, "uses its native implementation")
+			fallbackLogged[name] = true
+		}
+		monitoring.FallbackCollectors = append(monitoring.FallbackCollectors, name)
+		return true
+	}
 
-	// Get logged in users
-	loggedInUsers, err := linux_loggedinusers.GetLoggedInUsers()
+	err = collect("loggedinusers", func() (err error) {
+		if fallback("loggedinusers", "who") {
+			monitoring.LoggedInUsers, err = linux_loggedinusers.ReadUtmp()
+		} else {
+			monitoring.LoggedInUsers, err = linux_loggedinusers.GetLoggedInUsers()
+		}
+		captured.record("LoggedInUsers")
+		return err
+	})
 	if err != nil {
 		log.Println("Error getting logged in users:", err.Error())
 		return
 	}
 
-	diskFree, err := linux_df.GetDf()
+	err = collect("df", func() (err error) {
+		if fallback("df", "df") {
+			monitoring.DiskFree, err = linux_df.GetDfNative()
+		} else {
+			monitoring.DiskFree, err = linux_df.GetDf()
+		}
+		captured.record("DiskFree")
+		return err
+	})
 	if err != nil {
 		log.Println("Error getting disk usage:", err.Error())
 		return
 	}
 
-	networkInterfaces, err := linux_ip.GetIPInterfaces()
+	err = collect("ip", func() (err error) {
+		monitoring.NetworkInterfaces, err = linux_ip.GetIPInterfaces()
+		captured.record("NetworkInterfaces")
+		if err != nil {
+			return fmt.Errorf("network interfaces: %w", err)
+		}
+		monitoring.Routes, err = linux_ip.GetRoutes()
+		captured.record("Routes")
+		if err != nil {
+			return fmt.Errorf("IP routes: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		log.Println("Error getting network interfaces:", err.Error())
+		log.Println("Error getting", err.Error())
 		return
 	}
 
-	routes, err := linux_ip.GetRoutes()
+	err = collect("egress", func() (err error) {
+		monitoring.Egress, err = linux_ip.GetEgressIdentity(currentConfig().ApiUrl)
+		captured.record("Egress")
+		return err
+	})
 	if err != nil {
-		log.Println("Error getting IP routes:", err.Error())
-		return
-	}
-
-	cpuUsage := linux_top.GetCpuUsage()
-	cpuInfo := linux_top.GetCpuInfo()
-	loadAverage := linux_top.GetLoad()
-	memory := linux_top.GetMemory()
-	tasks := linux_top.GetTasks()
-	blockdevices := linux_lsblk.GetLsBlk()
-	mdstat := linux_mdstat.GetMdStat()
-	needrestart := linux_needrestart.GetNeedRestart()
-
-	statusCode, err := api.PostRequest(Config.ApiUrl+"hosts/monitoring/"+hostname, Config.ApiKey, map[string]any{
-		"Uptime":            uptime,
-		"LoadAverage":       loadAverage,
-		"LoggedInUsers":     loggedInUsers,
-		"CpuUsage":          cpuUsage,
-		"CpuInfo":           cpuInfo,
-		"Memory":            memory,
-		"Tasks":             tasks,
-		"DiskFree":          diskFree,
-		"NetworkInterfaces": networkInterfaces,
-		"Routes":            routes,
-		"BlockDevices":      blockdevices,
-		"MdStat":            mdstat,
-		"NeedRestart":       needrestart,
+		// Not fatal for the monitoring submission, the API still sees the public address
+		log.Println("Error getting egress identity:", err.Error())
+		monitoring.CollectorErrors = append(monitoring.CollectorErrors, api.CollectorError{Collector: "Egress", Code: api.ErrorCodeCollectorFailed, Message: err.Error()})
+	}
+
+	collect("top", func() error {
+		monitoring.CpuUsage = linux_top.GetCpuUsage()
+		captured.record("CpuUsage")
+		monitoring.CpuInfo = linux_top.GetCpuInfo()
+		captured.record("CpuInfo")
+		monitoring.LoadAverage = linux_top.GetLoad()
+		captured.record("LoadAverage")
+		monitoring.Memory = linux_top.GetMemory()
+		captured.record("Memory")
+		monitoring.Tasks = linux_top.GetTasks()
+		captured.record("Tasks")
+		return nil
+	})
+	collect("lsblk", func() error {
+		monitoring.BlockDevices = linux_lsblk.GetLsBlk()
+		captured.record("BlockDevices")
+		return nil
+	})
+	collect("mdstat", func() error {
+		monitoring.MdStat = linux_mdstat.GetMdStat()
+		captured.record("MdStat")
+		return nil
+	})
+	collect("needrestart", func() error {
+		monitoring.NeedRestart = linux_needrestart.GetNeedRestart()
+		monitoring.Suggestions = linux_needrestart.Suggestions(monitoring.NeedRestart)
+		captured.record("NeedRestart")
+		return nil
 	})
+	collect("pmhealth", func() error {
+		monitoring.PackageManager = linux_pmhealth.Check()
+		captured.record("PackageManager")
+		return nil
+	})
+	collect("power", func() error {
+		monitoring.Power = linux_power.GetPower()
+		captured.record("Power")
+		return nil
+	})
+	collect("quota", func() error {
+		monitoring.Quotas = linux_quota.GetQuotas()
+		captured.record("Quotas")
+		return nil
+	})
+
+	monitoring.CycleTimestamp = cycleTimestamp.Format(time.RFC3339Nano)
+	monitoring.CaptureTimestamps = captured
+	monitoring.ApiMetrics = api.Metrics.Snapshot(true) // Requests since the last monitoring submission
+	status.recordMonitoring(monitoring)
+	exportMonitoring(monitoring, cycleTimestamp)
+	statusCode, err := currentClient().SubmitMonitoring(ctx, hostname, monitoring)
 	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error submitting basic monitoring data", err, statusCode)
 		return
@@ -178,23 +557,94 @@ func processBasicMonitoring(hostname string) {
 	log.Println("Basic monitoring submitted successfully for", hostname)
 }
 
-func processSystemInfo(hostname string) {
+func processServiceFileDrift(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "service_file_drift")
+	defer span.End()
+	// Process unit file hashes of critical services for the given hostname
+	if skipNonCriticalSubmission("service files") {
+		return
+	}
+	unitFiles := linux_unitdrift.ScanUnitFiles(currentConfig().WatchedServices)
+	changes := []linux_unitdrift.Change{}
+	if previousUnitFiles := loadUnitFiles(); previousUnitFiles != nil {
+		changes = linux_unitdrift.CompareUnitFiles(previousUnitFiles, unitFiles)
+	}
+	for _, change := range changes {
+		log.Println("Service file drift detected:", change.Path, change.Change)
+	}
+	// Immutable attributes and owners of critical files are a cheap integrity signal
+	criticalFiles := linux_fileattrs.ScanFiles(currentConfig().WatchedFiles)
+	criticalFileChanges := []linux_fileattrs.Change{}
+	if previousCriticalFiles := loadCriticalFiles(); previousCriticalFiles != nil {
+		criticalFileChanges = linux_fileattrs.CompareFiles(previousCriticalFiles, criticalFiles)
+	}
+	for _, change := range criticalFileChanges {
+		log.Println("Critical file drift detected:", change.Path, change.Change, change.Detail)
+	}
+
+	statusCode, err := currentClient().SubmitServiceFiles(ctx, hostname, map[string]any{
+		"unit_files":            unitFiles,
+		"changes":               changes,
+		"critical_files":        criticalFiles,
+		"critical_file_changes": criticalFileChanges,
+	})
+	if err != nil || statusCode != http.StatusOK {
+		handleAPIError("Error submitting service files", err, statusCode)
+		return
+	}
+	saveUnitFiles(unitFiles)
+	saveCriticalFiles(criticalFiles)
+	log.Println("Service files submitted successfully for", hostname)
+}
+
+func processSystemInfo(ctx context.Context, hostname string, packageManager pm.PackageManager) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "system_info")
+	defer span.End()
 	// Process system information for the given hostname
+	if skipNonCriticalSubmission("system info") {
+		return
+	}
 
 	linux_osrelease.GetOsReleaseInfo()
+	timeInfo := linux_timeinfo.GetTimeInfo()
+	tags := linux_facttags.Resolve(currentConfig().FactTags, map[string]string{
+		"os_id":         linux_osrelease.Release.ID,
+		"os_name":       linux_osrelease.Release.Name,
+		"os_version_id": linux_osrelease.Release.VersionID,
+		"timezone":      timeInfo.Timezone,
+	})
+	var orphanedPackages []map[string]string // Unknown if the package manager cannot tell
+	if packages, err := packageManager.GetOrphanedPackages(); err != nil {
+		log.Println("Error getting orphaned packages:", err.Error())
+	} else {
+		orphanedPackages = formatPackages(packages)
+	}
 	// The operating system:
-	if Config.Debug {
+	if cloudguardian_logging.Enabled(cloudguardian_logging.LevelDebug) {
 		log.Println("##########################################")
 		log.Println("Name" + linux_osrelease.Release.Name + " " + linux_osrelease.Release.VersionID)
 		log.Println("##########################################")
 	}
-	statusCode, err := api.PostRequest(Config.ApiUrl+"hosts/osinfo/"+hostname, Config.ApiKey, map[string]interface{}{
-		"os_name":               linux_osrelease.Release.Name,
-		"os_version_id":         linux_osrelease.Release.VersionID,
-		"is_container":          linux_container.IsRunningInContainer(),
-		"agent_version":         cloudguardian_version.Version,
-		"agent_running_as_root": linux.HasRootPrivileges(),
-		"accepted_public_keys":  Config.HostSecurityKeys,
+	statusCode, err := currentClient().SubmitSystemInfo(ctx, hostname, api.SystemInfo{
+		OsName:              linux_osrelease.Release.Name,
+		OsVersionId:         linux_osrelease.Release.VersionID,
+		IsContainer:         linux_container.IsRunningInContainer(),
+		AgentVersion:        cloudguardian_version.Version,
+		AgentRunningAsRoot:  linux.HasRootPrivileges(),
+		AcceptedPublicKeys:  currentConfig().HostSecurityKeys,
+		Timezone:            timeInfo.Timezone,
+		Locale:              timeInfo.Locale,
+		NtpService:          timeInfo.NtpService,
+		NtpServers:          timeInfo.NtpServers,
+		NtpSources:          timeInfo.NtpSources,
+		Tags:                tags,
+		Labels:              currentConfig().Labels,
+		SoftRebootSupported: linux_reboot.SupportsSoftReboot(),
+		Hardware:            linux_dmi.GetChassisInfo(),
+		RemoteManagement:    linux_remotemgmt.GetRemoteManagement(),
+		LastUpdates:         loadLastUpdates(),
+		OrphanedPackages:    orphanedPackages,
+		KernelModules:       linux_kmodules.GetKernelModules(),
 	})
 	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error submitting system info", err, statusCode)
@@ -204,15 +654,20 @@ func processSystemInfo(hostname string) {
 	log.Println("System information submitted successfully for", hostname)
 }
 
-func processInstalledPackages(hostname string, packageManager pm.PackageManager) {
+func processInstalledPackages(ctx context.Context, hostname string, packageManager pm.PackageManager) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "installed_packages")
+	defer span.End()
 	// Process installed packages for the given hostname
+	if skipNonCriticalSubmission("installed packages") {
+		return
+	}
 	packages, err := packageManager.GetInstalledPackages()
 	if err != nil {
 		log.Println("Error getting installed packages:", err.Error())
 		return
 	}
 
-	if Config.Debug {
+	if cloudguardian_logging.Enabled(cloudguardian_logging.LevelTrace) {
 		log.Println("##########################################")
 		log.Println("Installed packages for", hostname)
 		for _, pkg := range packages {
@@ -221,24 +676,24 @@ func processInstalledPackages(hostname string, packageManager pm.PackageManager)
 		log.Println("##########################################")
 	}
 
-	statusCode, err := api.PostRequest(Config.ApiUrl+"hosts/packages/"+hostname, Config.ApiKey, map[string]interface{}{
-		"packages": formatPackages(packages),
-	})
-	if err != nil || statusCode != http.StatusOK {
-		handleAPIError("Error submitting installed packages", err, statusCode)
-		return
+	if submitPackageInventory(ctx, hostname, formatPackages(packages)) {
+		log.Println("Installed packages submitted successfully for", hostname)
 	}
-	log.Println("Installed packages submitted successfully for", hostname)
 }
 
-func processUpdates(hostname string, updateType pm.UpdateType, packageManager pm.PackageManager) {
+func processUpdates(ctx context.Context, hostname string, updateType pm.UpdateType, packageManager pm.PackageManager) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "updates")
+	defer span.End()
 	// Process updates for the given hostname
+	if skipNonCriticalSubmission("updates") {
+		return
+	}
 	updates, err := packageManager.CheckUpdates(updateType)
 	if err != nil {
 		log.Println("Error checking updates:", err.Error())
 		return
 	}
-	if Config.Debug {
+	if cloudguardian_logging.Enabled(cloudguardian_logging.LevelTrace) {
 		log.Println("##########################################")
 		switch updateType {
 		case pm.SecurityUpdates:
@@ -252,18 +707,21 @@ func processUpdates(hostname string, updateType pm.UpdateType, packageManager pm
 		log.Println("##########################################")
 	}
 
-	// Submit updates to the API
-	var url string
-	switch updateType {
-	case pm.SecurityUpdates:
-		url = Config.ApiUrl + "hosts/updates/" + hostname + "?security=true"
-	default:
-		url = Config.ApiUrl + "hosts/updates/" + hostname + "?security=false"
+	// Estimate the size of the updates, so patch windows can be planned on constrained sites
+	var size *api.UpdateSize
+	names := make([]string, len(updates))
+	for i, update := range updates {
+		names[i] = update.Name
 	}
+	if download, installed, err := packageManager.EstimateUpdateSize(names); err != nil {
+		log.Println("Error estimating the update size:", err.Error())
+	} else {
+		size = &api.UpdateSize{DownloadBytes: download, InstalledBytes: installed}
+	}
+	exportUpdates(updateType, len(updates), size)
 
-	statusCode, err := api.PostRequest(url, Config.ApiKey, map[string]interface{}{
-		"updates": formatPackages(updates),
-	})
+	// Submit updates to the API
+	statusCode, err := currentClient().SubmitUpdates(ctx, hostname, updateType == pm.SecurityUpdates, formatPackages(updates), size)
 	if err != nil || statusCode != http.StatusOK {
 		handleAPIError("Error submitting updates", err, statusCode)
 		return
@@ -271,11 +729,13 @@ func processUpdates(hostname string, updateType pm.UpdateType, packageManager pm
 	log.Println("Updates submitted successfully for", hostname)
 }
 
-func processRunningJobs(hostname string) {
+func processRunningJobs(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "running_jobs")
+	defer span.End()
 	// Process running jobs for the given hostname
 	log.Println("Processing running jobs for", hostname)
 
-	runningJobs, err := fetchHostJobs(hostname, "running")
+	runningJobs, err := fetchHostJobs(ctx, hostname, "running")
 	if err != nil {
 		log.Println("Error fetching running jobs:", err.Error())
 		return
@@ -286,111 +746,244 @@ func processRunningJobs(hostname string) {
 	}
 
 	for _, job := range *runningJobs {
+		if workerPool.contains(job.JobId) {
+			continue // Still processed by a worker
+		}
 		log.Println("Running job ID:", job.JobId, "Job Type:", job.JobType)
+		trackRollout(job)
 		switch job.JobType {
 		case "reboot":
 			log.Println("Processing reboot job for job ID:", job.JobId)
 
 			// Check the status of the reboot job
+			startedAt := jobStartedAt(job)
 			rebootSuccessful, err := checkRebootStatus(job)
 			if err != nil {
 				if err.Error() == "status data is not in the expected format" {
 					log.Println("Reboot job: Status data is not in the expected format")
-					updateJobStatus(hostname, job.JobId, "failed", "We couldn't check the uptime of the host, just before the reboot")
+					updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "We couldn't check the uptime of the host, just before the reboot"))
 					return
 				}
 				if err.Error() == "system is still running after the reboot was initiated" {
 					log.Println("Reboot job: System is still running after the reboot was initiated")
-					updateJobStatus(hostname, job.JobId, "failed", "System is still running after the reboot was initiated")
+					updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "System is still running after the reboot was initiated"))
 					return
 				}
 				if strings.HasPrefix(err.Error(), "error getting uptime: ") {
 					log.Println("Reboot job: Error getting uptime:", err.Error())
-					updateJobStatus(hostname, job.JobId, "failed", "We couldn't check the uptime of the host, after the reboot")
+					updateJobStatus(hostname, job.JobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "We couldn't check the uptime of the host, after the reboot"))
 					return
 				}
 
 			}
 			if rebootSuccessful {
 				log.Println("Reboot job was successful")
-				updateJobStatus(hostname, job.JobId, "completed", "Rebooted successfully")
+				result := commandResult(startedAt, "", "", nil)
+				result.Message = "Rebooted successfully"
+				if reboot, err := parseRebootResult(job.Result); err == nil && reboot.Method != "" {
+					result.Message += " via " + reboot.Method
+					result.Metadata = map[string]string{"method": reboot.Method}
+				}
+				updateJobStatus(hostname, job.JobId, "completed", result)
 			}
-
+		case "stream_logs":
+			// A stream that is not running in this process ended with a restart of the agent
+			if !logStreamActive(job.JobId) {
+				log.Println("Stream_logs job", job.JobId, "was interrupted")
+				updateJobStatus(hostname, job.JobId, "failed", failedResult(jobStartedAt(job), api.ErrorCodeJobInterrupted, "log stream was interrupted by a restart of the agent"))
+			}
+		case "update_agent":
+			checkAgentUpdate(hostname, job)
 		}
 	}
 }
 
-func processNewJobs(hostname string) {
-	submittedJobs, err := fetchHostJobs(hostname, "submitted")
+func processNewJobs(ctx context.Context, hostname string) {
+	ctx, span := cloudguardian_tracing.Start(ctx, "new_jobs")
+	defer span.End()
+	// The job channel and the task loop can both trigger job processing
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	submittedJobs, err := fetchHostJobs(ctx, hostname, "submitted")
 	if err != nil {
-		log.Fatal("Error fetching host jobs:", err.Error())
+		log.Println("Error fetching host jobs:", err.Error())
 		return
 	}
+	inMaintenanceWindow := currentConfig().InMaintenanceWindow(time.Now())
+	if inMaintenanceWindow && len(currentConfig().MaintenanceWindows) > 0 {
+		// Jobs deferred outside of the window run now
+		if deferredJobs, err := fetchHostJobs(ctx, hostname, "deferred"); err == nil && deferredJobs != nil {
+			if submittedJobs == nil {
+				submittedJobs = &[]api.HostJob{}
+			}
+			*submittedJobs = append(*submittedJobs, *deferredJobs...)
+		}
+	}
 	if submittedJobs == nil {
+		status.recordPendingJobs(nil)
 		log.Println("No jobs found for host:", hostname)
 		return
 	}
+	status.recordPendingJobs(*submittedJobs)
 	for _, job := range *submittedJobs {
+		if workerPool.contains(job.JobId) {
+			continue // Still queued or running, the API lists it until it reports running
+		}
+		trackRollout(job)
 
 		// {"createdAt":"${job.createdAt}","hostname":"${job.hostname}","jobType":"${job.jobType}","jobData":"${job.jobData}"}
-		message := `{"createdAt":"` + job.CreatedAt + `","hostname":"` + hostname + `","jobType":"` + job.JobType + `","jobData":"` + job.JobData + `"}`
+		message := cloudguardian_crypto.JobMessage(job.CreatedAt, hostname, job.JobType, job.JobData)
 
-		validated, err := tryValidatePayload(Config.HostSecurityKeys, message, job.Signature)
+		validated, err := tryValidatePayload(currentConfig().HostSecurityKeys, message, job.Signature)
 		if err != nil {
 			log.Println("Failed to validate job payload:", job.JobId)
 			// Report back to the API that the job could not be processed
-			updateJobStatus(hostname, job.JobId, "failed", "could not find valid host security key or failed to verify job payload")
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeSignatureInvalid, "could not find valid host security key or failed to verify job payload"))
 			continue
 		}
 		if !validated {
 			log.Println("Invalid job payload signature for job ID:", job.JobId)
 			// Report back to the API that the job could not be processed
-			updateJobStatus(hostname, job.JobId, "failed", "invalid job payload signature")
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeSignatureInvalid, "invalid job payload signature"))
 			continue
 		}
 
-		switch job.JobType {
-		case "update":
-			processJobUpdate(hostname, job.JobId, job.JobData)
-		case "reboot":
-			processJobReboot(hostname, job.JobId)
-		case "command":
-			processJobCommand(hostname, job.JobId, job.JobData)
-		case "script":
-			// Process script job
-			log.Println("Processing script job for job ID:", job.JobId)
-		case "update_agent":
-			// Process update_agent job
-			log.Println("Processing update_agent job for job ID:", job.JobId)
-		default:
-			log.Println("Unknown job type for job ID:", job.JobId, "Job Type:", job.JobType)
-			// Report back to the API that the job could not be processed
-			updateJobStatus(hostname, job.JobId, "failed", "unknown job type")
+		if replayProcessedJob(hostname, job) {
 			continue
 		}
+		if err := currentConfig().JobPolicy.Check(job.JobType, policyJobData(job)); err != nil {
+			log.Println("Rejecting job", job.JobId, "by host policy:", err.Error())
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeRejectedByPolicy, "rejected by host policy: "+err.Error()))
+			continue
+		}
+		if !inMaintenanceWindow && deferrableJobTypes[job.JobType] {
+			deferJob(hostname, job)
+			continue
+		}
+		if currentConfig().DryRun && dryRunJobTypes[job.JobType] {
+			simulateJob(hostname, job)
+			continue
+		}
+		if limited, reason := jobRateLimited(job, time.Now()); limited {
+			log.Println("Refusing job", job.JobId+":", reason)
+			updateJobStatus(hostname, job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeRateLimited, reason))
+			continue
+		}
+		recordJobStart(job)
+		workerPool.submit(hostname, job)
+	}
+}
+
+// processJob runs a job that passed the checks of processNewJobs, see workerPool
+func processJob(hostname string, job api.HostJob) {
+	switch job.JobType {
+	case "update":
+		processJobUpdate(hostname, job.JobId, job.JobData)
+	case "reboot":
+		processJobReboot(hostname, job.JobId, job.JobData)
+	case "command":
+		processJobCommand(hostname, job.JobId, job.JobData)
+	case "swap":
+		processJobSwap(hostname, job.JobId, job.JobData)
+	case "script":
+		processJobScript(hostname, job.JobId, job.JobData)
+	case "stream_logs":
+		processJobStreamLogs(hostname, job.JobId, job.JobData)
+	case "collector_intervals":
+		processJobCollectorIntervals(hostname, job.JobId, job.JobData)
+	case "maintenance_mode":
+		processJobMaintenanceMode(hostname, job.JobId, job.JobData)
+	case "update_agent":
+		processJobUpdateAgent(hostname, job.JobId, job.JobData)
+	default:
+		log.Println("Unknown job type for job ID:", job.JobId, "Job Type:", job.JobType)
+		// Report back to the API that the job could not be processed
+		updateJobStatus(hostname, job.JobId, "failed", failedResult(time.Now(), api.ErrorCodeUnknownJobType, "unknown job type"))
 	}
 }
 
-func processJobCommand(hostname string, jobId string, command string) {
+// processJobCommand runs the job data with bash and reports its output and exit
+// code. A command that runs longer than the command_timeout, or the timeout of
+// the job, is killed together with its child processes. A job that names a user
+// or group runs with their privileges.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - jobId: The ID of the job
+//   - jobData: The command, or a JSON object with the command, its timeout and user, see execJob
+func processJobCommand(hostname string, jobId string, jobData string) {
 	log.Println("Processing command job for job ID:", jobId)
-	log.Println("Executing command:", command)
-	updateJobStatus(hostname, jobId, "running", "")
-	// Execute the command
-	cmd := exec.Command("bash", "-c")
-	cmd.Args = append(cmd.Args, command)
-	stdOut, stdErr, err := linux.RunCommand(cmd)
+	startedAt := time.Now()
+	job, err := parseExecJobData("command", jobData)
+	var runAs jobUser
+	if err == nil {
+		runAs, err = lookupJobUser(job.User, job.Group)
+	}
+	if err != nil {
+		log.Println("Error parsing command job data:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid command job data: "+err.Error()))
+		return
+	}
+	timeout := job.timeout()
+	log.Println("Executing command:", job.Command, "as", runAs.Name, "with a timeout of", timeout)
+	updateJobStatus(hostname, jobId, "running", runningResult(startedAt))
+	output := startJobOutput(hostname, jobId, startedAt)
+	stdOut, stdErr, exitCode, err := runJobProcess(timeout, "", runAs, output.live(), "bash", "-c", job.Command)
+	output.finish()
+	result := commandResult(startedAt, stdOut, stdErr, err)
+	result.ExitCode = exitCode
+	result.Metadata = map[string]string{"timeout_seconds": strconv.Itoa(job.TimeoutSeconds), "user": runAs.Name, "group": runAs.Group}
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Println("Command timed out after", timeout)
+		result.ErrorCode = api.ErrorCodeTimeout
+		result.Message = fmt.Sprintf("timed out after %s", timeout)
+		updateJobStatus(hostname, jobId, "failed", result)
+		return
+	}
 	if err != nil {
 		log.Println("Error executing command:", err.Error())
-		updateJobStatus(hostname, jobId, "failed", fmt.Sprintf("failed to execute command: %s", stdErr))
+		result.Message = "failed to execute command"
+		updateJobStatus(hostname, jobId, "failed", result)
+		return
+	}
+	updateJobStatus(hostname, jobId, "completed", result)
+}
+
+func processJobSwap(hostname string, jobId string, jobData string) {
+	log.Println("Processing swap job for job ID:", jobId)
+	startedAt := time.Now()
+	swapJob, err := parseSwapJobData(jobData)
+	if err != nil {
+		log.Println("Error parsing swap job data:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, fmt.Sprintf("invalid swap job data: %s", err.Error())))
+		return
+	}
+	updateJobStatus(hostname, jobId, "running", runningResult(startedAt))
+	var stdOut, stdErr string
+	switch swapJob.Action {
+	case "create", "resize":
+		stdOut, stdErr, err = linux_swap.CreateSwapFile(swapJob.Path, swapJob.SizeMB)
+	case "remove":
+		stdOut, stdErr, err = linux_swap.RemoveSwapFile(swapJob.Path)
+	case "zram":
+		stdOut, stdErr, err = linux_swap.EnableZram(swapJob.SizeMB)
+	}
+	result := commandResult(startedAt, stdOut, stdErr, err)
+	if err != nil {
+		log.Println("Error executing swap job:", err.Error())
+		result.Message = fmt.Sprintf("failed to %s swap: %s", swapJob.Action, err.Error())
+		updateJobStatus(hostname, jobId, "failed", result)
 		return
 	}
-	updateJobStatus(hostname, jobId, "completed", stdOut)
+	updateJobStatus(hostname, jobId, "completed", result)
 }
 
 func processJobUpdate(hostname string, jobId string, packages string) {
 	log.Println("Processing update job for job ID:", jobId)
 	log.Println("Updating packages:", packages)
-	updateJobStatus(hostname, jobId, "running", "")
+	startedAt := time.Now()
+	updateJobStatus(hostname, jobId, "running", runningResult(startedAt))
 	packageList := strings.Split(packages, ",")
 	packageManager, err := pm.DetectPackageManager()
 	if err != nil {
@@ -398,25 +991,31 @@ func processJobUpdate(hostname string, jobId string, packages string) {
 		return
 	}
 	var stdOut, stdErr string
+	output := startJobOutput(hostname, jobId, startedAt)
 	if packageList[0] == "all" {
-		stdOut, stdErr, err = packageManager.UpdateAllPackages()
+		stdOut, stdErr, err = packageManager.UpdateAllPackages(output.live())
 	} else {
-		stdOut, stdErr, err = packageManager.UpdatePackages(packageList)
+		stdOut, stdErr, err = packageManager.UpdatePackages(packageList, output.live())
 	}
+	output.finish()
+	result := commandResult(startedAt, stdOut, stdErr, err)
 	if err != nil {
 		log.Println("Error updating packages:", err.Error())
-		updateJobStatus(hostname, jobId, "failed", fmt.Sprintf("failed to update packages %s", stdErr))
+		result.Message = "failed to update packages"
+		updateJobStatus(hostname, jobId, "failed", result)
 		return
 	}
-	updateJobStatus(hostname, jobId, "completed", stdOut)
-	processUpdates(hostname, pm.AllUpdates, packageManager)
-	processUpdates(hostname, pm.SecurityUpdates, packageManager)
+	updateJobStatus(hostname, jobId, "completed", result)
+	recordLastUpdate(pm.Name(packageManager), jobId, packageList, time.Now())
+	processUpdates(context.Background(), hostname, pm.AllUpdates, packageManager)
+	processUpdates(context.Background(), hostname, pm.SecurityUpdates, packageManager)
 }
 
-func processJobReboot(hostname string, jobId string) {
+func processJobReboot(hostname string, jobId string, jobData string) {
 	log.Println("Processing reboot job for job ID:", jobId)
 	// For reboot we first update the job status to "running" and then reboot
 	// the system. Later we check the running jobs to see if the job was successful
+	startedAt := time.Now()
 	uptime, err := linux_top.GetUptime()
 	if uptime < maxRebootDuration {
 		log.Println("Reboot job: Uptime is less than", maxRebootDuration, " seconds. We have to wait until it is safe to reboot. Otherwise it could cause reboot loops.")
@@ -424,13 +1023,32 @@ func processJobReboot(hostname string, jobId string) {
 	}
 	if err != nil {
 		log.Println("Reboot job: Error getting uptime:", err.Error())
-		updateJobStatus(hostname, jobId, "failed", "Reboot failed, because we couldn't check the uptime of the host")
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "Reboot failed, because we couldn't check the uptime of the host"))
 		return
 	}
-	updateJobStatus(hostname, jobId, "running", "initiated reboot, uptime: "+fmt.Sprintf("%d", uptime))
-	if err := linux_reboot.Reboot(); err != nil {
+	method, err := linux_reboot.ResolveMethod(currentConfig().RebootMethod)
+	if err != nil {
+		log.Println("Reboot job:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "Reboot failed: "+err.Error()))
+		return
+	}
+	result := runningResult(startedAt)
+	result.Message = "initiated reboot"
+	result.Metadata = map[string]string{"uptime": strconv.FormatInt(uptime, 10)}
+	// A soft-reboot only restarts userspace and is requested with the job data "soft-reboot"
+	if strings.TrimSpace(jobData) == linux_reboot.MethodSoft {
+		if softReboots, err := getSoftRebootsCount(); err == nil && linux_reboot.SupportsSoftReboot() {
+			method = linux_reboot.MethodSoft
+			result.Metadata["soft_reboots"] = strconv.FormatInt(softReboots, 10)
+		} else {
+			log.Println("Reboot job: soft-reboot is not supported, falling back to", method)
+		}
+	}
+	result.Metadata["method"] = method
+	updateJobStatus(hostname, jobId, "running", result)
+	if err := linux_reboot.Reboot(method); err != nil {
 		log.Println("Reboot job: Error initiating reboot:", err.Error())
-		updateJobStatus(hostname, jobId, "failed", "Reboot failed, because we couldn't initiate the reboot")
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeRebootFailed, "Reboot failed, because we couldn't initiate the reboot"))
 		return
 	}
 }
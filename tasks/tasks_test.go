@@ -1,22 +1,152 @@
 package tasks
 
 import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"cloud-guardian/cloudguardian_version"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	linux_df "cloud-guardian/linux/df"
+	linux_fileattrs "cloud-guardian/linux/fileattrs"
+	pm "cloud-guardian/linux/packagemanager"
+	linux_unitdrift "cloud-guardian/linux/unitdrift"
+	cloudguardian_logging "cloud-guardian/logging"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	ethcrypto "github.com/ethereum/go-ethereum/crypto"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+// fakeClient implements api.Client without sending any HTTP requests
+type fakeClient struct {
+	jobs          map[string][]api.HostJob // Jobs returned by FetchJobs, by job status
+	jobUpdates    []fakeJobUpdate          // Job status updates received by UpdateJob
+	pingStatus    int                      // Status code returned by Ping, 200 if not set
+	registrations int                      // Number of Register calls
+	monitoring    *api.Monitoring          // Last monitoring data received by SubmitMonitoring
+	jobLogs       []string                 // Log lines received by SubmitJobLogs
+	serviceFiles  map[string]any           // Last data received by SubmitServiceFiles
+	mu            sync.Mutex
+}
+
+type fakeJobUpdate struct {
+	jobId  string
+	status string
+	result string
+}
+
+func (c *fakeClient) Register(ctx context.Context, hostname string, labels map[string]string) (int, string, error) {
+	c.registrations++
+	return http.StatusOK, "", nil
+}
+func (c *fakeClient) FetchSecurityKeys(ctx context.Context) (int, []string, error) {
+	return http.StatusOK, nil, nil
+}
+func (c *fakeClient) Ping(ctx context.Context, hostname string, heartbeat api.Heartbeat) (int, error) {
+	if c.pingStatus != 0 {
+		return c.pingStatus, &api.APIError{StatusCode: c.pingStatus}
+	}
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitMonitoring(ctx context.Context, hostname string, data api.Monitoring) (int, error) {
+	c.monitoring = &data
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitSystemInfo(ctx context.Context, hostname string, data api.SystemInfo) (int, error) {
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitPackages(ctx context.Context, hostname string, packages []map[string]string) (int, error) {
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitPackageDelta(ctx context.Context, hostname string, delta map[string]any) (int, error) {
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitUpdates(ctx context.Context, hostname string, security bool, updates []map[string]string, size *api.UpdateSize) (int, error) {
+	return http.StatusOK, nil
+}
+func (c *fakeClient) SubmitServiceFiles(ctx context.Context, hostname string, data map[string]any) (int, error) {
+	c.serviceFiles = data
+	return http.StatusOK, nil
+}
+func (c *fakeClient) FetchJobs(ctx context.Context, hostname string, status string) (int, []api.HostJob, error) {
+	if jobs, ok := c.jobs[status]; ok {
+		return http.StatusOK, jobs, nil
+	}
+	return http.StatusNotFound, nil, nil
+}
+func (c *fakeClient) WaitForJobs(ctx context.Context, hostname string, timeout int) (int, []api.HostJob, error) {
+	return http.StatusNoContent, nil, nil
+}
+func (c *fakeClient) UpdateJob(ctx context.Context, jobId string, status string, result string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jobUpdates = append(c.jobUpdates, fakeJobUpdate{jobId: jobId, status: status, result: result})
+	return http.StatusOK, nil
+}
+func (c *fakeClient) Deregister(ctx context.Context, hostname string) (int, error) {
+	return http.StatusOK, nil
+}
+
+func (c *fakeClient) SubmitJobLogs(ctx context.Context, jobId string, lines []string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jobLogs = append(c.jobLogs, lines...)
+	return http.StatusOK, nil
+}
+
+// useFakeClient replaces the API client and configuration for the duration of a test
+func useFakeClient(t *testing.T, client *fakeClient) {
+	originalClient, originalConfig, originalJobsPath := currentClient(), currentConfig(), processedJobsPath
+	SetClient(client)
+	SetConfig(cloudguardian_config.DefaultConfig())
+	processedJobsPath = filepath.Join(t.TempDir(), "jobs.json")
+	processedJobsFallback = nil
+	collectorSchedule.overrides, collectorSchedule.lastRun = nil, map[string]time.Time{}
+	originalLastUpdatesPath, originalUnitFilesPath := lastUpdatesPath, unitFilesPath
+	lastUpdatesPath = filepath.Join(t.TempDir(), "last-updates.json")
+	unitFilesPath = filepath.Join(t.TempDir(), "unit-files.json")
+	originalPausePath, originalMaintenancePath := pausePath, maintenancePath
+	pausePath = filepath.Join(t.TempDir(), "paused")
+	maintenancePath = filepath.Join(t.TempDir(), "maintenance.json")
+	originalAgentUpdatePath, originalCriticalFilesPath := agentUpdatePath, criticalFilesPath
+	agentUpdatePath = filepath.Join(t.TempDir(), "agent-update.json")
+	criticalFilesPath = filepath.Join(t.TempDir(), "critical-files.json")
+	t.Cleanup(func() {
+		SetClient(originalClient)
+		SetConfig(originalConfig)
+		processedJobsPath = originalJobsPath
+		processedJobsFallback = nil
+		lastUpdatesPath, unitFilesPath, pausePath, maintenancePath = originalLastUpdatesPath, originalUnitFilesPath, originalPausePath, originalMaintenancePath
+		agentUpdatePath, criticalFilesPath = originalAgentUpdatePath, originalCriticalFilesPath
+		api.SetMaintenance(false, "")
+	})
+}
+
 func TestCheckRebootStatus(t *testing.T) {
 	tests := []struct {
-		name           string
-		job            HostJob
-		mockUptime     int64
-		mockUptimeErr  error
-		expectedResult bool
-		expectedError  string
+		name            string
+		job             api.HostJob
+		mockUptime      int64
+		mockUptimeErr   error
+		mockSoftReboots int64
+		expectedResult  bool
+		expectedError   string
 	}{
 		{
 			name: "successful reboot - uptime decreased",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: 1000",
 			},
 			mockUptime:     500,
@@ -25,7 +155,7 @@ func TestCheckRebootStatus(t *testing.T) {
 		},
 		{
 			name: "failed reboot - uptime still high after max duration",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: 1000",
 			},
 			mockUptime:     1400, // 1000 + 400 > maxRebootDuration (300)
@@ -34,7 +164,7 @@ func TestCheckRebootStatus(t *testing.T) {
 		},
 		{
 			name: "reboot in progress - within max duration",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: 1000",
 			},
 			mockUptime:     1200, // 1000 + 200 < maxRebootDuration (300)
@@ -43,7 +173,7 @@ func TestCheckRebootStatus(t *testing.T) {
 		},
 		{
 			name: "invalid status format - missing prefix",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "some other status",
 			},
 			expectedResult: false,
@@ -51,7 +181,7 @@ func TestCheckRebootStatus(t *testing.T) {
 		},
 		{
 			name: "invalid status format - wrong number of parts",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: 1000, extra",
 			},
 			expectedResult: false,
@@ -59,15 +189,71 @@ func TestCheckRebootStatus(t *testing.T) {
 		},
 		{
 			name: "invalid status format - non-numeric uptime",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: abc",
 			},
 			expectedResult: false,
 			expectedError:  "status data is not in the expected format",
 		},
+		{
+			name: "successful reboot - with reboot method",
+			job: api.HostJob{
+				Result: "initiated reboot, uptime: 1000, method: kexec",
+			},
+			mockUptime:     20,
+			expectedResult: true,
+			expectedError:  "",
+		},
+		{
+			name: "successful soft-reboot - uptime not reset",
+			job: api.HostJob{
+				Result: "initiated reboot, uptime: 1000, method: soft-reboot, soft_reboots: 1",
+			},
+			mockUptime:      1100,
+			mockSoftReboots: 2,
+			expectedResult:  true,
+			expectedError:   "",
+		},
+		{
+			name: "soft-reboot in progress",
+			job: api.HostJob{
+				Result: "initiated reboot, uptime: 1000, method: soft-reboot, soft_reboots: 1",
+			},
+			mockUptime:      1100,
+			mockSoftReboots: 1,
+			expectedResult:  false,
+			expectedError:   "",
+		},
+		{
+			name: "successful reboot - structured result",
+			job: api.HostJob{
+				Result: `{"exit_code":0,"message":"initiated reboot","metadata":{"uptime":"1000","method":"systemctl"}}`,
+			},
+			mockUptime:     20,
+			expectedResult: true,
+			expectedError:  "",
+		},
+		{
+			name: "soft-reboot in progress - structured result",
+			job: api.HostJob{
+				Result: `{"exit_code":0,"metadata":{"uptime":"1000","method":"soft-reboot","soft_reboots":"3"}}`,
+			},
+			mockUptime:      1100,
+			mockSoftReboots: 3,
+			expectedResult:  false,
+			expectedError:   "",
+		},
+		{
+			name: "invalid structured result - missing uptime",
+			job: api.HostJob{
+				Result: `{"exit_code":0,"metadata":{"method":"systemctl"}}`,
+			},
+			expectedResult: false,
+			expectedError:  "status data is not in the expected format",
+		},
 		{
 			name: "error getting current uptime",
-			job: HostJob{
+			job: api.HostJob{
 				Result: "initiated reboot, uptime: 1000",
 			},
 			mockUptimeErr:  errors.New("failed to get uptime"),
@@ -83,9 +269,14 @@ func TestCheckRebootStatus(t *testing.T) {
 			getUptime = func() (int64, error) {
 				return tt.mockUptime, tt.mockUptimeErr
 			}
-			// Restore the original function after the test
+			originalGetSoftRebootsCount := getSoftRebootsCount
+			getSoftRebootsCount = func() (int64, error) {
+				return tt.mockSoftReboots, nil
+			}
+			// Restore the original functions after the test
 			defer func() {
 				getUptime = originalGetUptimeFunc
+				getSoftRebootsCount = originalGetSoftRebootsCount
 			}()
 
 			result, err := checkRebootStatus(tt.job)
@@ -108,3 +299,1303 @@ func TestCheckRebootStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSwapJobData(t *testing.T) {
+	tests := []struct {
+		name          string
+		jobData       string
+		expected      SwapJob
+		expectedError bool
+	}{
+		{
+			name:     "create swap file",
+			jobData:  "create,/swapfile,2048",
+			expected: SwapJob{Action: "create", Path: "/swapfile", SizeMB: 2048},
+		},
+		{
+			name:     "resize swap file with spaces",
+			jobData:  " resize, /swapfile, 4096 ",
+			expected: SwapJob{Action: "resize", Path: "/swapfile", SizeMB: 4096},
+		},
+		{
+			name:     "remove swap file",
+			jobData:  "remove,/swapfile",
+			expected: SwapJob{Action: "remove", Path: "/swapfile"},
+		},
+		{
+			name:     "enable zram",
+			jobData:  "zram,1024",
+			expected: SwapJob{Action: "zram", SizeMB: 1024},
+		},
+		{
+			name:          "relative path",
+			jobData:       "create,swapfile,2048",
+			expectedError: true,
+		},
+		{
+			name:          "invalid size",
+			jobData:       "create,/swapfile,-1",
+			expectedError: true,
+		},
+		{
+			name:          "missing size",
+			jobData:       "create,/swapfile",
+			expectedError: true,
+		},
+		{
+			name:          "unknown action",
+			jobData:       "grow,/swapfile,10",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseSwapJobData(tt.jobData)
+			if tt.expectedError {
+				if err == nil {
+					t.Errorf("parseSwapJobData() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("parseSwapJobData() error = %v, want nil", err)
+			}
+			if result != tt.expected {
+				t.Errorf("parseSwapJobData() = %+v, want %+v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessNewJobsRejectsUnsignedJobs(t *testing.T) {
+	client := &fakeClient{jobs: map[string][]api.HostJob{
+		"submitted": {
+			{JobId: "job-1", JobType: "command", JobData: "rm -rf /", Signature: "invalid"},
+		},
+	}}
+	useFakeClient(t, client)
+	currentConfig().HostSecurityKeys = []string{"04abcdef"}
+
+	processNewJobs(context.Background(), "host1")
+
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].jobId != "job-1" || client.jobUpdates[0].status != "failed" {
+		t.Fatalf("Expected job-1 to fail, got %+v", client.jobUpdates)
+	}
+	result, ok := api.ParseJobResult(client.jobUpdates[0].result)
+	if !ok || result.ExitCode != 1 || result.Message != "could not find valid host security key or failed to verify job payload" {
+		t.Errorf("Unexpected job result: %s", client.jobUpdates[0].result)
+	}
+}
+
+func TestProcessNewJobsWithoutJobs(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	processNewJobs(context.Background(), "host1")
+
+	if len(client.jobUpdates) != 0 {
+		t.Errorf("Expected no job updates, got %+v", client.jobUpdates)
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	t.Cleanup(func() { cloudguardian_logging.SetLevel(cloudguardian_logging.LevelInfo) })
+
+	newConfig := cloudguardian_config.DefaultConfig()
+	newConfig.Debug = true
+	applyConfig(newConfig)
+	if currentClient() != client || currentConfig() != newConfig || cloudguardian_logging.CurrentLevel() != cloudguardian_logging.LevelDebug {
+		t.Errorf("Expected the configuration to be applied without a new API client")
+	}
+
+	newConfig = cloudguardian_config.DefaultConfig()
+	newConfig.ApiUrl = "http://localhost:8080/cloudguardian-api/v1/"
+	newConfig.LongPoll = true
+	applyConfig(newConfig)
+	if httpClient, ok := currentClient().(*api.HTTPClient); !ok || httpClient.ApiUrl() != newConfig.ApiUrl {
+		t.Errorf("Expected a new API client for %s, got %+v", newConfig.ApiUrl, currentClient())
+	}
+	if currentConfig().LongPoll {
+		t.Errorf("Expected long_poll to take effect only after a restart")
+	}
+}
+
+func TestProcessPingReregistersDeletedHost(t *testing.T) {
+	client := &fakeClient{pingStatus: http.StatusGone}
+	useFakeClient(t, client)
+	inventories := 0
+	originalSubmitInventory := submitInventory
+	submitInventory = func(ctx context.Context, hostname string) { inventories++ }
+	t.Cleanup(func() {
+		submitInventory = originalSubmitInventory
+		lastReregisterAttempt = time.Time{}
+	})
+
+	processPing(context.Background(), "host1")
+	processPing(context.Background(), "host1") // Within the re-registration interval
+	if client.registrations != 1 || inventories != 1 {
+		t.Errorf("Expected 1 registration and inventory, got %d and %d", client.registrations, inventories)
+	}
+
+	lastReregisterAttempt = time.Time{}
+	currentConfig().DisableAutoReregister = true
+	processPing(context.Background(), "host1")
+	if client.registrations != 1 {
+		t.Errorf("Expected no registration when automatic re-registration is disabled")
+	}
+}
+
+func TestDegradedBackoff(t *testing.T) {
+	state := &degradedState{}
+	expected := []time.Duration{5 * time.Minute, 10 * time.Minute, 20 * time.Minute}
+	for _, backoff := range expected {
+		if got := state.fail(api.ErrorCodeInvalidApiKey, "invalid API key"); got != backoff {
+			t.Errorf("Expected backoff %s, got %s", backoff, got)
+		}
+	}
+	for range 10 {
+		state.fail(api.ErrorCodeInvalidApiKey, "invalid API key")
+	}
+	if got := state.fail(api.ErrorCodeInvalidApiKey, "invalid API key"); got != degradedMaxBackoff {
+		t.Errorf("Expected the backoff to be capped at %s, got %s", degradedMaxBackoff, got)
+	}
+	if state.allow() {
+		t.Errorf("Expected requests to be skipped while backing off")
+	}
+	state.clear()
+	if _, reason, _ := state.status(); reason != "" || !state.allow() {
+		t.Errorf("Expected the degraded state to be cleared")
+	}
+}
+
+func TestProcessPingDegradesOnInvalidApiKey(t *testing.T) {
+	client := &fakeClient{pingStatus: http.StatusUnauthorized}
+	useFakeClient(t, client)
+	t.Cleanup(func() { degraded.clear() })
+
+	processPing(context.Background(), "host1") // Does not exit the agent
+	if code, reason, _ := degraded.status(); reason == "" || code != api.ErrorCodeInvalidApiKey {
+		t.Fatalf("Expected the agent to be degraded with %s, got %q", api.ErrorCodeInvalidApiKey, code)
+	}
+	if !skipNonCriticalSubmission("basic monitoring") {
+		t.Errorf("Expected submissions to be skipped while degraded")
+	}
+
+	client.pingStatus = 0
+	degraded.nextAttempt = time.Time{} // The backoff expired
+	processPing(context.Background(), "host1")
+	if _, reason, _ := degraded.status(); reason != "" {
+		t.Errorf("Expected the degraded state to be cleared after a successful ping, got %q", reason)
+	}
+}
+
+func TestReplayProcessedJob(t *testing.T) {
+	job := api.HostJob{JobId: "job1", Signature: "signature1", JobType: "command"}
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	if replayProcessedJob("host1", job) {
+		t.Fatalf("Expected a new job to run")
+	}
+	recordJobStart(job)
+	recordJobStatus("job1", "completed", `{"exit_code":0,"stdout":"done"}`)
+
+	if !replayProcessedJob("host1", job) {
+		t.Fatalf("Expected the processed job not to run again")
+	}
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].status != "completed" || client.jobUpdates[0].result != `{"exit_code":0,"stdout":"done"}` {
+		t.Errorf("Expected the stored result to be reported, got %+v", client.jobUpdates)
+	}
+
+	// Same ID, but another job
+	if _, ok := findProcessedJob(api.HostJob{JobId: "job1", Signature: "signature2"}); ok {
+		t.Errorf("Expected a job with another signature not to be found")
+	}
+
+	// Interrupted while running
+	recordJobStart(api.HostJob{JobId: "job2", Signature: "signature2", JobType: "command"})
+	client.jobUpdates = nil
+	if !replayProcessedJob("host1", api.HostJob{JobId: "job2", Signature: "signature2"}) {
+		t.Fatalf("Expected the interrupted job not to run again")
+	}
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].status != "failed" {
+		t.Errorf("Expected the interrupted job to be reported as failed, got %+v", client.jobUpdates)
+	}
+}
+
+func TestPruneProcessedJobs(t *testing.T) {
+	now := time.Now()
+	jobs := map[string]processedJob{
+		"old":    {UpdatedAt: now.Add(-processedJobsRetention - time.Hour)},
+		"recent": {UpdatedAt: now},
+	}
+	pruneProcessedJobs(jobs, now)
+	if _, ok := jobs["old"]; ok || len(jobs) != 1 {
+		t.Errorf("Expected only the recent job to be kept, got %v", jobs)
+	}
+}
+
+func TestPruneProcessedJobsKeepsRateLimitedJobs(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	currentConfig().JobRateLimits = map[string]cloudguardian_config.JobRateLimit{"reboot": {Max: 1, PeriodMinutes: 360}}
+	now := time.Now()
+	jobs := map[string]processedJob{
+		"reboot": {JobType: "reboot", UpdatedAt: now.Add(-2 * time.Hour), StartedAt: now.Add(-2 * time.Hour)},
+	}
+	// A burst of cheap jobs must not push the last reboot out of the store
+	for i := range maxProcessedJobs {
+		jobs[fmt.Sprintf("command%d", i)] = processedJob{JobType: "command", UpdatedAt: now.Add(-time.Hour), StartedAt: now.Add(-time.Hour)}
+	}
+	pruneProcessedJobs(jobs, now)
+	if _, ok := jobs["reboot"]; !ok || len(jobs) != maxProcessedJobs {
+		t.Errorf("Expected the reboot to be kept and a command to be removed, got %d jobs", len(jobs))
+	}
+
+	// After the period of the limit the reboot is pruned like any other job
+	jobs["command-new"] = processedJob{JobType: "command", UpdatedAt: now, StartedAt: now}
+	pruneProcessedJobs(jobs, now.Add(7*time.Hour))
+	if _, ok := jobs["reboot"]; ok || len(jobs) != maxProcessedJobs {
+		t.Errorf("Expected the reboot to be removed after the period, got %d jobs", len(jobs))
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	pkg := func(name, version string) map[string]string {
+		return map[string]string{"name": name, "version": version, "repo": "main"}
+	}
+	previous := []map[string]string{pkg("bash", "5.1"), pkg("curl", "7.88"), pkg("kernel", "6.1"), pkg("vim", "9.0")}
+	current := []map[string]string{pkg("bash", "5.1"), pkg("curl", "7.89"), pkg("kernel", "6.1"), pkg("kernel", "6.2"), pkg("zsh", "5.9")}
+
+	delta := diffPackages(previous, current)
+	expected := packageDelta{
+		Added:   []map[string]string{pkg("kernel", "6.2"), pkg("zsh", "5.9")},
+		Removed: []map[string]string{pkg("vim", "9.0")},
+		Changed: []map[string]string{{"name": "curl", "version": "7.89", "repo": "main", "previous_version": "7.88"}},
+	}
+	if !reflect.DeepEqual(delta, expected) {
+		t.Errorf("diffPackages() = %+v, expected %+v", delta, expected)
+	}
+
+	if hashPackages(previous) != hashPackages([]map[string]string{previous[3], previous[1], previous[0], previous[2]}) {
+		t.Error("hashPackages() depends on the package order")
+	}
+	if hashPackages(previous) == hashPackages(current) {
+		t.Error("hashPackages() returned the same hash for different inventories")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	status.recordMonitoring(api.Monitoring{Uptime: 4242})
+	defer status.recordPendingJobs(nil)
+
+	for path, expected := range map[string]string{
+		"/":            "Cloud Guardian agent on host1",
+		"/status.json": `"Uptime":4242`,
+		"/healthz":     "ok",
+	} {
+		recorder := httptest.NewRecorder()
+		statusHandler("host1").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("Expected %s to contain %q, got %d %s", path, expected, recorder.Code, recorder.Body.String())
+		}
+	}
+	recorder := httptest.NewRecorder()
+	statusHandler("host1").ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected the status page to be read-only, got %d", recorder.Code)
+	}
+
+	// Every local user can read the page, the data and output of jobs stay private
+	status.recordPendingJobs([]api.HostJob{{JobId: "job1", JobType: "command", JobData: "echo pending-secret", Signature: "signature1"}})
+	recordJobStart(api.HostJob{JobId: "job2", JobType: "script", Signature: "signature2"})
+	recordJobStatus("job2", "completed", `{"stdout":"result-secret"}`)
+	recorder = httptest.NewRecorder()
+	statusHandler("host1").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+	for _, expected := range []string{`"job_id":"job1"`, `"job_id":"job2"`} {
+		if !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("Expected /status.json to contain %q, got %s", expected, recorder.Body.String())
+		}
+	}
+	for _, secret := range []string{"pending-secret", "signature1", "signature2", "result-secret"} {
+		if strings.Contains(recorder.Body.String(), secret) {
+			t.Errorf("Expected /status.json not to contain %q, got %s", secret, recorder.Body.String())
+		}
+	}
+}
+
+func TestProcessBasicMonitoringDisabledCollectors(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().Collectors = map[string]bool{}
+	for _, name := range cloudguardian_config.Collectors {
+		currentConfig().Collectors[name] = false
+	}
+
+	processBasicMonitoring(context.Background(), "host1")
+	if client.monitoring == nil {
+		t.Fatal("Expected the monitoring data to be submitted")
+	}
+	if !reflect.DeepEqual(client.monitoring.DisabledCollectors, cloudguardian_config.Collectors) {
+		t.Errorf("Expected all collectors to be reported as disabled, got %v", client.monitoring.DisabledCollectors)
+	}
+	if len(client.monitoring.CaptureTimestamps) != 1 || client.monitoring.BlockDevices != nil {
+		t.Errorf("Expected only the uptime to be collected, got %v", client.monitoring.CaptureTimestamps)
+	}
+}
+
+func TestProcessBasicMonitoringFallbackCollectors(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	t.Setenv("PATH", t.TempDir()) // Neither who nor df are available
+	currentConfig().Collectors = map[string]bool{}
+	for _, name := range cloudguardian_config.Collectors {
+		currentConfig().Collectors[name] = name == "loggedinusers" || name == "df"
+	}
+
+	processBasicMonitoring(context.Background(), "host1")
+	if client.monitoring == nil {
+		t.Fatal("Expected the monitoring data to be submitted")
+	}
+	if !reflect.DeepEqual(client.monitoring.FallbackCollectors, []string{"loggedinusers", "df"}) {
+		t.Errorf("Expected the native fallbacks to be reported, got %v", client.monitoring.FallbackCollectors)
+	}
+}
+
+func TestCollectorIntervals(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().CollectorIntervals = map[string]int{"df": 1}
+	now := time.Now()
+
+	processJobCollectorIntervals("host1", "job1", `{"intervals": {"lsblk": 1, "df": 2}, "duration_minutes": 10}`)
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].status != "completed" {
+		t.Fatalf("Expected the job to complete, got %+v", client.jobUpdates)
+	}
+	for name, expected := range map[string]time.Duration{"lsblk": time.Minute, "df": 2 * time.Minute, "top": 5 * time.Minute} {
+		if interval := collectorInterval(name, now); interval != expected {
+			t.Errorf("Expected an interval of %v for %s, got %v", expected, name, interval)
+		}
+	}
+	if interval := collectorInterval("lsblk", now.Add(11*time.Minute)); interval != 5*time.Minute {
+		t.Errorf("Expected the override to expire, got %v", interval)
+	}
+	if interval := collectorInterval("df", now); interval != time.Minute {
+		t.Errorf("Expected the configured interval after the override expired, got %v", interval)
+	}
+
+	recordCollectorRun("df", now)
+	if collectorDue("df", now.Add(20*time.Second)) || !collectorDue("df", now.Add(time.Minute)) {
+		t.Errorf("Expected df to be due once its interval elapsed")
+	}
+
+	processJobCollectorIntervals("host1", "job2", `{"intervals": {"unknown": 1}}`)
+	if len(client.jobUpdates) != 2 || client.jobUpdates[1].status != "failed" || !strings.Contains(client.jobUpdates[1].result, "INVALID_JOB_DATA") {
+		t.Errorf("Expected an unknown collector to be rejected, got %+v", client.jobUpdates)
+	}
+}
+
+func TestProcessBasicMonitoringSkippedCollectors(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().Collectors = map[string]bool{}
+	for _, name := range cloudguardian_config.Collectors {
+		currentConfig().Collectors[name] = name == "quota"
+	}
+
+	processBasicMonitoring(context.Background(), "host1")
+	if client.monitoring == nil || len(client.monitoring.SkippedCollectors) != 0 {
+		t.Fatalf("Expected the first cycle to run all collectors, got %+v", client.monitoring)
+	}
+	processBasicMonitoring(context.Background(), "host1")
+	if !reflect.DeepEqual(client.monitoring.SkippedCollectors, []string{"quota"}) {
+		t.Errorf("Expected the collector to be skipped until its interval elapsed, got %v", client.monitoring.SkippedCollectors)
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().Collectors = map[string]bool{}
+	for _, name := range cloudguardian_config.Collectors {
+		currentConfig().Collectors[name] = false
+	}
+
+	if err := RunTask("host1", "monitoring"); err != nil {
+		t.Fatalf("RunTask() error: %v", err)
+	}
+	if client.monitoring == nil {
+		t.Error("Expected the monitoring task to submit the monitoring data")
+	}
+	if err := RunTask("host1", "unknown"); err == nil || !strings.Contains(err.Error(), "jobs, monitoring, packages") {
+		t.Errorf("Expected an error listing the known tasks, got %v", err)
+	}
+}
+
+func TestDeferJob(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().MaintenanceWindows = []cloudguardian_config.MaintenanceWindow{{Start: "02:00", End: "04:00"}}
+
+	deferJob("host1", api.HostJob{JobId: "job1", JobType: "reboot", Status: "submitted"})
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].status != "deferred" {
+		t.Fatalf("Expected the job to be reported as deferred, got %+v", client.jobUpdates)
+	}
+	if result, ok := api.ParseJobResult(client.jobUpdates[0].result); !ok || result.Metadata["next_maintenance_window"] == "" {
+		t.Errorf("Expected the next maintenance window in the result, got %s", client.jobUpdates[0].result)
+	}
+
+	deferJob("host1", api.HostJob{JobId: "job1", JobType: "reboot", Status: "deferred"})
+	if len(client.jobUpdates) != 1 {
+		t.Errorf("Expected a deferred job not to be reported again")
+	}
+
+	// Jobs that restart the service or the host wait for the window, informational jobs do not
+	for jobType, deferrable := range map[string]bool{"reboot": true, "update_agent": true, "collector_intervals": false} {
+		if deferrableJobTypes[jobType] != deferrable {
+			t.Errorf("Expected %s jobs to be deferrable: %v", jobType, deferrable)
+		}
+	}
+}
+
+func TestRolloutEchoedWithFinalResult(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	trackRollout(api.HostJob{JobId: "job1", Rollout: &api.Rollout{Id: "rollout1", Batch: 1, Canary: true}})
+	startedAt := time.Now().Add(-90 * time.Second)
+	updateJobStatus("host1", "job1", "running", runningResult(startedAt))
+	updateJobStatus("host1", "job1", "completed", commandResult(startedAt, "", "", nil))
+
+	if running, _ := api.ParseJobResult(client.jobUpdates[0].result); running.Rollout != nil {
+		t.Errorf("Expected no rollout in the running result, got %+v", running.Rollout)
+	}
+	result, _ := api.ParseJobResult(client.jobUpdates[1].result)
+	if result.Rollout == nil || result.Rollout.Id != "rollout1" || !result.Rollout.Canary || !result.Rollout.Success || result.Rollout.DurationMs < 89000 {
+		t.Errorf("Expected the rollout with the outcome in the final result, got %+v", result.Rollout)
+	}
+
+	updateJobStatus("host1", "job2", "failed", failedResult(startedAt, api.ErrorCodeTimeout, "timeout"))
+	if result, _ := api.ParseJobResult(client.jobUpdates[2].result); result.Rollout != nil {
+		t.Errorf("Expected no rollout for a job without rollout, got %+v", result.Rollout)
+	}
+}
+
+func TestJobRateLimited(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	currentConfig().JobRateLimits = map[string]cloudguardian_config.JobRateLimit{"reboot": {Max: 1, PeriodMinutes: 360}}
+
+	reboot := api.HostJob{JobId: "job1", Signature: "signature1", JobType: "reboot"}
+	if limited, _ := jobRateLimited(reboot, time.Now()); limited {
+		t.Fatalf("Expected the first reboot to be allowed")
+	}
+	recordJobStart(reboot)
+
+	if limited, reason := jobRateLimited(api.HostJob{JobId: "job2", JobType: "reboot"}, time.Now()); !limited || reason == "" {
+		t.Errorf("Expected a second reboot within 6 hours to be refused")
+	}
+	if limited, _ := jobRateLimited(api.HostJob{JobId: "job2", JobType: "reboot"}, time.Now().Add(7*time.Hour)); limited {
+		t.Errorf("Expected a reboot after the period to be allowed")
+	}
+	if limited, _ := jobRateLimited(api.HostJob{JobId: "job3", JobType: "command"}, time.Now()); limited {
+		t.Errorf("Expected job types without a limit to be allowed")
+	}
+}
+
+func TestProcessedJobsUnwritable(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	currentConfig().JobRateLimits = map[string]cloudguardian_config.JobRateLimit{"reboot": {Max: 1, PeriodMinutes: 360}}
+	writablePath := processedJobsPath
+	processedJobsPath = filepath.Join(t.TempDir(), "missing", "jobs.json")
+
+	command := api.HostJob{JobId: "job1", Signature: "signature1", JobType: "command"}
+	recordJobStart(command)
+	if _, ok := findProcessedJob(command); !ok {
+		t.Errorf("Expected the job to be kept in memory while the store cannot be written")
+	}
+	if limited, _ := jobRateLimited(api.HostJob{JobId: "job2", JobType: "reboot"}, time.Now()); !limited {
+		t.Errorf("Expected rate-limited jobs not to start while the store cannot be written")
+	}
+
+	processedJobsPath = writablePath
+	recordJobStatus("job1", "completed", "")
+	if processedJobsFallback != nil {
+		t.Errorf("Expected the store to be written again")
+	}
+	if stored, ok := findProcessedJob(command); !ok || stored.Status != "completed" {
+		t.Errorf("Expected the job to be saved, got %+v", stored)
+	}
+	if limited, _ := jobRateLimited(api.HostJob{JobId: "job2", JobType: "reboot"}, time.Now()); limited {
+		t.Errorf("Expected the rate limit to be enforced from the store again")
+	}
+	entries, _ := os.ReadDir(filepath.Dir(writablePath))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind, got %d files", len(entries))
+	}
+}
+
+func TestProcessJobStreamLogs(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	originalCommand := logStreamCommand
+	defer func() { logStreamCommand = originalCommand }()
+	logStreamCommand = func(ctx context.Context, job logStreamJob) *exec.Cmd {
+		return exec.CommandContext(ctx, "printf", "line 1\\nline 2\\n")
+	}
+
+	processJobStreamLogs("host1", "job1", `{"unit": "nginx.service", "duration_seconds": 10}`)
+	if len(client.jobUpdates) != 1 || client.jobUpdates[0].status != "failed" || !strings.Contains(client.jobUpdates[0].result, "REJECTED_BY_POLICY") {
+		t.Fatalf("Expected a source outside of the allowlist to be rejected, got %+v", client.jobUpdates)
+	}
+
+	currentConfig().JobPolicy.LogStreamAllowlist = []string{"nginx.service"}
+	processJobStreamLogs("host1", "job2", `{"unit": "nginx.service", "duration_seconds": 10}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for logStreamActive("job2") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if !reflect.DeepEqual(client.jobLogs, []string{"line 1", "line 2"}) {
+		t.Errorf("Expected the tailed lines to be sent, got %q", client.jobLogs)
+	}
+	last := client.jobUpdates[len(client.jobUpdates)-1]
+	if last.jobId != "job2" || last.status != "completed" || !strings.Contains(last.result, "streamed 2 lines of nginx.service") {
+		t.Errorf("Expected the stream to complete, got %+v", last)
+	}
+}
+
+func TestParseLogStreamJobData(t *testing.T) {
+	job, err := parseLogStreamJobData(`{"file": "/var/log/syslog"}`)
+	if err != nil || job.DurationSeconds != defaultLogStreamSeconds || job.source() != "/var/log/syslog" {
+		t.Errorf("Unexpected job %+v, error %v", job, err)
+	}
+	for _, jobData := range []string{`{}`, `{"unit": "a", "file": "/b"}`, `{"file": "var/log/syslog"}`, `{"unit": "a", "duration_seconds": 7200}`, `{"unit": "ssh*"}`, `nginx`} {
+		if _, err := parseLogStreamJobData(jobData); err == nil {
+			t.Errorf("Expected %s to be invalid", jobData)
+		}
+	}
+}
+
+func TestExportTextfile(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	currentConfig().PrometheusTextfileDir = t.TempDir()
+
+	monitoring := api.Monitoring{Uptime: 3600}
+	monitoring.DiskFree = []linux_df.Df{
+		{Source: "/dev/sda1", FSType: "ext4", Size: 1000, Avail: 400, Target: "/"},
+		{Source: "/dev/sdb1", FSType: "xfs", Size: 2000, Avail: 100, Target: `/srv/"data"`},
+	}
+	exportMonitoring(monitoring, time.Unix(1700000000, 0))
+	data, err := os.ReadFile(filepath.Join(currentConfig().PrometheusTextfileDir, monitoringTextfile))
+	if err != nil {
+		t.Fatalf("Expected the monitoring textfile: %v", err)
+	}
+	content := string(data)
+	for _, expected := range []string{
+		"cloud_guardian_uptime_seconds 3600\n",
+		"cloud_guardian_monitoring_timestamp_seconds 1.7e+09\n",
+		"# TYPE cloud_guardian_filesystem_size_bytes gauge\n" +
+			`cloud_guardian_filesystem_size_bytes{mountpoint="/",device="/dev/sda1",fstype="ext4"} 1.024e+06` + "\n" +
+			`cloud_guardian_filesystem_size_bytes{mountpoint="/srv/\"data\"",device="/dev/sdb1",fstype="xfs"} 2.048e+06` + "\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("Expected the textfile to contain %q, got:\n%s", expected, content)
+		}
+	}
+	if strings.Count(content, "# TYPE cloud_guardian_filesystem_avail_bytes") != 1 {
+		t.Errorf("Expected one TYPE line per metric, got:\n%s", content)
+	}
+
+	exportUpdates(pm.AllUpdates, 12, &api.UpdateSize{DownloadBytes: 2048})
+	exportUpdates(pm.SecurityUpdates, 3, nil)
+	data, _ = os.ReadFile(filepath.Join(currentConfig().PrometheusTextfileDir, updatesTextfile))
+	if !strings.Contains(string(data), `cloud_guardian_updates_pending{type="all"} 12`+"\n"+`cloud_guardian_updates_pending{type="security"} 3`+"\n") {
+		t.Errorf("Expected the pending updates of both types, got:\n%s", data)
+	}
+	if entries, _ := os.ReadDir(currentConfig().PrometheusTextfileDir); len(entries) != 2 {
+		t.Errorf("Expected no temporary files to be left, got %d files", len(entries))
+	}
+}
+
+func TestSimulateJob(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	agentUser, _ := lookupJobUser("", "")
+	simulateJob("host1", api.HostJob{JobId: "job1", JobType: "command", JobData: "systemctl restart nginx"})
+	simulateJob("host1", api.HostJob{JobId: "job2", JobType: "update", JobData: "openssl,curl"})
+	simulateJob("host1", api.HostJob{JobId: "job3", JobType: "swap", JobData: "create,/swapfile,1024"})
+	if len(client.jobUpdates) != 3 {
+		t.Fatalf("Expected one final status per job, got %+v", client.jobUpdates)
+	}
+	expected := []map[string]string{
+		{"dry_run": "true", "command": "systemctl restart nginx", "timeout_seconds": "3600", "user": agentUser.Name},
+		{"dry_run": "true", "packages": "openssl,curl"},
+		{"dry_run": "true", "action": "create", "path": "/swapfile", "size_mb": "1024"},
+	}
+	for i, update := range client.jobUpdates {
+		result, _ := api.ParseJobResult(update.result)
+		if update.status != "simulated" || !reflect.DeepEqual(result.Metadata, expected[i]) {
+			t.Errorf("Expected job %s to be simulated with %v, got %s %+v", update.jobId, expected[i], update.status, result)
+		}
+	}
+}
+
+func TestWipeState(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	originalPackageState := packageStatePath
+	defer func() { packageStatePath = originalPackageState }()
+	packageStatePath = filepath.Join(t.TempDir(), "packages.json")
+	for _, path := range []string{processedJobsPath, packageStatePath, lastUpdatesPath, unitFilesPath, criticalFilesPath, pausePath, maintenancePath} {
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := WipeState(); err != nil {
+		t.Fatalf("Expected the state to be wiped, got %v", err)
+	}
+	for _, path := range []string{processedJobsPath, packageStatePath, lastUpdatesPath, unitFilesPath, criticalFilesPath, pausePath, maintenancePath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", path)
+		}
+	}
+	if err := WipeState(); err != nil {
+		t.Errorf("Expected wiping a wiped state to succeed, got %v", err)
+	}
+}
+
+func TestRecordLastUpdate(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	if updates := loadLastUpdates(); len(updates) != 0 {
+		t.Fatalf("Expected no updates before the first update job, got %v", updates)
+	}
+
+	finishedAt := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	recordLastUpdate("apt", "job1", []string{"all"}, finishedAt)
+	recordLastUpdate("apt", "job2", []string{"curl", "openssl"}, finishedAt.Add(time.Hour))
+	recordLastUpdate("dnf", "job3", []string{"all"}, finishedAt)
+	expected := map[string]api.LastUpdate{
+		"apt": {JobId: "job2", FinishedAt: "2026-03-01T11:00:00Z", Packages: []string{"curl", "openssl"}},
+		"dnf": {JobId: "job3", FinishedAt: "2026-03-01T10:00:00Z", Packages: []string{"all"}},
+	}
+	if updates := loadLastUpdates(); !reflect.DeepEqual(updates, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, updates)
+	}
+}
+
+func TestPause(t *testing.T) {
+	client := &fakeClient{jobs: map[string][]api.HostJob{"pending": {{JobId: "job1", JobType: "command"}}}}
+	useFakeClient(t, client)
+	if _, paused := Paused(); paused {
+		t.Fatalf("Expected the agent not to be paused")
+	}
+
+	if _, err := Pause("INC-42", 0); err != nil {
+		t.Fatalf("Expected the agent to be paused, got %v", err)
+	}
+	state, paused := Paused()
+	if !paused || state.Reason != "INC-42" || state.Until != "" {
+		t.Fatalf("Expected a pause until resumed for INC-42, got %+v", state)
+	}
+	if !skipNonCriticalSubmission("basic monitoring") {
+		t.Errorf("Expected submissions to be skipped while paused")
+	}
+	processJobTasks(context.Background(), "host1")
+	if len(client.jobUpdates) != 0 {
+		t.Errorf("Expected no jobs to be processed while paused, got %+v", client.jobUpdates)
+	}
+
+	if resumed, err := Resume(); !resumed || err != nil {
+		t.Fatalf("Expected the agent to be resumed, got %v %v", resumed, err)
+	}
+	if resumed, err := Resume(); resumed || err != nil {
+		t.Errorf("Expected resuming a running agent to be a no-op, got %v %v", resumed, err)
+	}
+
+	if _, err := Pause("", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, paused := Paused(); !paused {
+		t.Errorf("Expected a negative duration to pause until resumed")
+	}
+	data, _ := json.Marshal(PauseState{Since: time.Now().Add(-time.Hour), Until: time.Now().Add(-time.Minute).Format(time.RFC3339)})
+	if err := os.WriteFile(pausePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, paused := Paused(); paused {
+		t.Errorf("Expected an ended pause to be ignored")
+	}
+}
+
+func TestRecordedFailures(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	failures = Failures{}
+	t.Cleanup(func() { failures = Failures{}; degraded.clear() })
+
+	handleAPIError("Error submitting monitoring", &api.APIError{StatusCode: http.StatusServiceUnavailable}, http.StatusServiceUnavailable)
+	if recorded := RecordedFailures(); recorded.Count != 1 || recorded.Unreachable != 1 || recorded.Unauthorized {
+		t.Errorf("Expected one retryable failure, got %+v", recorded)
+	}
+	handleAPIError("Error submitting packages", &api.APIError{StatusCode: http.StatusUnauthorized}, http.StatusUnauthorized)
+	runTasks("panicking task", func(ctx context.Context, hostname string) { panic("unexpected input") }, "host1")
+	if recorded := RecordedFailures(); recorded.Count != 3 || recorded.Unreachable != 1 || !recorded.Unauthorized {
+		t.Errorf("Expected three failures with an unauthorized request, got %+v", recorded)
+	}
+}
+
+func TestProcessJobMaintenanceMode(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+
+	processJobMaintenanceMode("host1", "job1", `{"enabled": true, "duration_minutes": 120, "reason": "CHG-1234"}`)
+	mode, active := Maintenance()
+	if !active || mode.Reason != "CHG-1234" || mode.JobId != "job1" || mode.Until == "" {
+		t.Fatalf("Expected a maintenance mode of two hours for CHG-1234, got %+v", mode)
+	}
+	processJobMaintenanceMode("host1", "job2", `{"enabled": false}`)
+	if _, active := Maintenance(); active {
+		t.Errorf("Expected the maintenance mode to be ended")
+	}
+	processJobMaintenanceMode("host1", "job3", `{"enabled": true, "duration_minutes": -1}`)
+	if _, active := Maintenance(); active {
+		t.Errorf("Expected an invalid duration to be rejected")
+	}
+
+	expected := []string{"job1 completed", "job2 completed", "job3 failed"}
+	var got []string
+	for _, update := range client.jobUpdates {
+		got = append(got, update.jobId+" "+update.status)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the job updates %v, got %v", expected, got)
+	}
+
+	data, _ := json.Marshal(api.MaintenanceMode{Since: "2026-03-01T10:00:00Z", Until: "2026-03-01T12:00:00Z"})
+	if err := os.WriteFile(maintenancePath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := Maintenance(); active {
+		t.Errorf("Expected an ended maintenance mode to be ignored")
+	}
+}
+
+func TestBench(t *testing.T) {
+	calls := 0
+	result := Bench("fake", func() error {
+		calls++
+		time.Sleep(time.Duration(calls) * time.Millisecond)
+		if calls == 2 {
+			return errors.New("collector failed")
+		}
+		return nil
+	}, 3)
+	if calls != 3 || result.Runs != 3 || result.Errors != 1 || result.LastError == nil {
+		t.Fatalf("Expected 3 runs with one error, got %d calls and %+v", calls, result)
+	}
+	if result.Min < time.Millisecond || result.Max < 3*time.Millisecond || result.Avg < result.Min || result.Avg > result.Max {
+		t.Errorf("Unexpected durations min %s, avg %s, max %s", result.Min, result.Avg, result.Max)
+	}
+	for _, name := range BenchCollectorNames() {
+		if BenchCollectors[name] == nil {
+			t.Errorf("Collector %s has no function", name)
+		}
+	}
+}
+
+func TestProcessJobScript(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().ScriptInterpreter = "/bin/sh"
+
+	processJobScript("host1", "job1", "echo hello from $0\necho oops >&2\nexit 3")
+	currentConfig().ScriptTimeout = 1
+	processJobScript("host1", "job2", "echo started\nsleep 30 &\nsleep 30")
+
+	if len(client.jobUpdates) != 4 {
+		t.Fatalf("Expected running and final updates of both jobs, got %+v", client.jobUpdates)
+	}
+	failed, _ := api.ParseJobResult(client.jobUpdates[1].result)
+	if client.jobUpdates[1].status != "failed" || failed.ExitCode != 3 || !strings.Contains(failed.Stdout, "hello from") || failed.Stderr != "oops\n" {
+		t.Errorf("Expected the script to fail with exit code 3 and its output, got %s %+v", client.jobUpdates[1].status, failed)
+	}
+	if failed.Metadata["interpreter"] != "/bin/sh" {
+		t.Errorf("Expected the interpreter in the metadata, got %v", failed.Metadata)
+	}
+	timedOut, _ := api.ParseJobResult(client.jobUpdates[3].result)
+	if timedOut.ErrorCode != api.ErrorCodeTimeout || timedOut.Stdout != "started\n" {
+		t.Errorf("Expected the script to time out with its partial output, got %+v", timedOut)
+	}
+}
+
+func TestProcessJobCommandTimeout(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().CommandTimeout = 1
+
+	processJobCommand("host1", "job1", "echo started; sleep 30 & sleep 30")
+	processJobCommand("host1", "job2", `{"command": "sleep 2; echo done", "timeout_seconds": 10}`)
+	processJobCommand("host1", "job3", `{"command": "true", "timeout_seconds": 100000}`)
+
+	if len(client.jobUpdates) != 5 {
+		t.Fatalf("Expected running and final updates of two jobs and a failed job, got %+v", client.jobUpdates)
+	}
+	timedOut, _ := api.ParseJobResult(client.jobUpdates[1].result)
+	if client.jobUpdates[1].status != "failed" || timedOut.ErrorCode != api.ErrorCodeTimeout || timedOut.Stdout != "started\n" || !strings.Contains(timedOut.Message, "timed out") {
+		t.Errorf("Expected the command to time out with its partial output, got %s %+v", client.jobUpdates[1].status, timedOut)
+	}
+	completed, _ := api.ParseJobResult(client.jobUpdates[3].result)
+	if client.jobUpdates[3].status != "completed" || completed.Stdout != "done\n" || completed.Metadata["timeout_seconds"] != "10" {
+		t.Errorf("Expected the timeout of the job to override the configured one, got %s %+v", client.jobUpdates[3].status, completed)
+	}
+	invalid, _ := api.ParseJobResult(client.jobUpdates[4].result)
+	if invalid.ErrorCode != api.ErrorCodeInvalidJobData {
+		t.Errorf("Expected a timeout out of range to be rejected, got %+v", invalid)
+	}
+	if job, _ := parseExecJobData("command", "{ echo a; }"); job.Command != "{ echo a; }" || job.timeout() != time.Second {
+		t.Errorf("Expected a command that is no JSON object to run as it is, got %+v", job)
+	}
+}
+
+func TestProcessJobCommandOutput(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	originalInterval := jobOutputInterval
+	jobOutputInterval = 50 * time.Millisecond
+	t.Cleanup(func() { jobOutputInterval = originalInterval })
+
+	processJobCommand("host1", "job1", "echo first; sleep 0.5; echo second >&2; sleep 0.5; echo third")
+
+	chunks := []*api.JobOutput{}
+	for _, update := range client.jobUpdates {
+		if result, _ := api.ParseJobResult(update.result); result.Output != nil {
+			chunks = append(chunks, result.Output)
+		}
+	}
+	if len(chunks) < 2 || chunks[0].Sequence != 1 || chunks[0].Stdout != "first\n" || chunks[1].Stderr != "second\n" || chunks[1].StdoutOffset != 6 {
+		t.Errorf("Expected the output in chunks while the command runs, got %+v", chunks)
+	}
+	final, _ := api.ParseJobResult(client.jobUpdates[len(client.jobUpdates)-1].result)
+	if final.Output != nil || final.Stdout != "first\nthird\n" || final.Stderr != "second\n" {
+		t.Errorf("Expected the whole output in the final result, got %+v", final)
+	}
+
+	stream := jobOutputStream{pending: []byte("a\xc3")}
+	if chunk := stream.take(); chunk != "a" || stream.offset != 1 || len(stream.pending) != 1 {
+		t.Errorf("Expected an incomplete character to stay pending, got %q with %+v", chunk, stream)
+	}
+}
+
+func TestProcessJobRunAsUser(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("Running jobs as another user requires root")
+	}
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	currentConfig().ScriptInterpreter = "/bin/sh"
+	t.Setenv("CLOUD_GUARDIAN_API_KEY", "agent-api-key")
+
+	processJobCommand("host1", "job1", `{"command": "id -u; env", "user": "nobody"}`)
+	processJobScript("host1", "job2", `{"script": "id -u > owner; cat owner", "user": "nobody"}`)
+	processJobCommand("host1", "job3", `{"command": "id", "user": "no-such-user"}`)
+
+	if len(client.jobUpdates) != 5 {
+		t.Fatalf("Expected running and final updates of two jobs and a failed job, got %+v", client.jobUpdates)
+	}
+	for _, update := range []fakeJobUpdate{client.jobUpdates[1], client.jobUpdates[3]} {
+		result, _ := api.ParseJobResult(update.result)
+		if update.status != "completed" || !strings.HasPrefix(result.Stdout, "65534\n") || result.Metadata["user"] != "nobody" {
+			t.Errorf("Expected job %s to run as nobody, got %s %+v", update.jobId, update.status, result)
+		}
+		if strings.Contains(result.Stdout, "agent-api-key") {
+			t.Errorf("Expected the environment of the agent not to be visible to job %s, got %s", update.jobId, result.Stdout)
+		}
+	}
+	unknown, _ := api.ParseJobResult(client.jobUpdates[4].result)
+	if unknown.ErrorCode != api.ErrorCodeInvalidJobData || !strings.Contains(unknown.Message, "unknown user") {
+		t.Errorf("Expected an unknown user to be rejected, got %+v", unknown)
+	}
+}
+
+// TestReloadWhileJobsRun checks with -race that a reload does not race with the
+// jobs running in the worker pool
+func TestReloadWhileJobsRun(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	t.Cleanup(func() { cloudguardian_logging.SetLevel(cloudguardian_logging.LevelInfo) })
+	pool := newJobPool(processJob)
+	for i := 0; i < 8; i++ {
+		pool.submit("host1", api.HostJob{JobId: fmt.Sprintf("job%d", i), JobType: "command", JobData: "sleep 0.05; echo ok"})
+	}
+	for i := 0; i < 20; i++ {
+		newConfig := cloudguardian_config.DefaultConfig()
+		newConfig.JobWorkers = 1 + i%4
+		newConfig.CommandTimeout = 60 + i
+		newConfig.DebugBodies = i%2 == 0
+		newConfig.AptDpkgOptions = []string{"--force-confold"}
+		applyConfig(newConfig)
+		time.Sleep(10 * time.Millisecond)
+	}
+	pool.wait()
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	completed := 0
+	for _, update := range client.jobUpdates {
+		if update.status == "completed" {
+			completed++
+		}
+	}
+	if completed != 8 {
+		t.Errorf("Expected 8 completed jobs, got %+v", client.jobUpdates)
+	}
+}
+
+func TestJobPool(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	currentConfig().JobWorkers = 2
+	started := make(chan string, 10)
+	release := map[string]chan struct{}{}
+	pool := newJobPool(func(hostname string, job api.HostJob) {
+		started <- job.JobId
+		<-release[job.JobId]
+	})
+	jobs := []api.HostJob{
+		{JobId: "update1", JobType: "update"},
+		{JobId: "update2", JobType: "update"},
+		{JobId: "command1", JobType: "command"},
+		{JobId: "reboot1", JobType: "reboot"},
+		{JobId: "command2", JobType: "command"},
+	}
+	for _, job := range jobs {
+		release[job.JobId] = make(chan struct{})
+	}
+	for _, job := range jobs {
+		pool.submit("host1", job)
+	}
+	next := func() string {
+		select {
+		case jobId := <-started:
+			return jobId
+		case <-time.After(5 * time.Second):
+			return "none"
+		}
+	}
+
+	// The second update waits for the first one, the command passes it
+	if first, second := next(), next(); first+","+second != "update1,command1" && first+","+second != "command1,update1" {
+		t.Fatalf("Expected update1 and command1 to start, got %s and %s", first, second)
+	}
+	if !pool.contains("update2") || !pool.contains("command2") {
+		t.Errorf("Expected the waiting jobs to be queued")
+	}
+	close(release["command1"])
+	close(release["update1"])
+	// The reboot waits for the running jobs and the later command for the reboot
+	for _, expected := range []string{"update2", "reboot1", "command2"} {
+		if jobId := next(); jobId != expected {
+			t.Fatalf("Expected %s to start next, got %s", expected, jobId)
+		}
+		close(release[expected])
+	}
+	pool.wait()
+	if pool.contains("command2") {
+		t.Errorf("Expected no jobs to be left")
+	}
+}
+
+func TestWaitForTickRunsTriggeredCycles(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	triggers := make(chan struct{})
+	Triggers = triggers
+	defer func() { Triggers = nil }()
+
+	tick := make(chan time.Time)
+	done := make(chan struct{})
+	go func() { waitForTick(tick, "host1"); close(done) }()
+	triggers <- struct{}{}
+	triggers <- struct{}{} // Only received after the first triggered cycle, the wait continues
+	select {
+	case <-done:
+		t.Fatalf("Expected a triggered cycle not to end the wait for the next tick")
+	default:
+	}
+	if _, ran := status.report("host1").LastRuns["job tasks"]; !ran {
+		t.Errorf("Expected the triggered cycle to run the job tasks")
+	}
+	tick <- time.Now()
+	<-done
+}
+
+func TestWaitForTickAppliesReloads(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	reloads := make(chan *cloudguardian_config.CloudGuardianConfig)
+	Reloads = reloads
+	originalStatus := status
+	status = &agentStatus{startedAt: time.Now(), lastRuns: map[string]time.Time{}}
+	defer func() { Reloads, status = nil, originalStatus }()
+
+	tick := make(chan time.Time)
+	done := make(chan struct{})
+	go func() { waitForTick(tick, "host1"); close(done) }()
+	reloads <- cloudguardian_config.DefaultConfig()
+	reloads <- cloudguardian_config.DefaultConfig() // Only received after the first reload, the wait continues
+	select {
+	case <-done:
+		t.Fatalf("Expected a reload not to end the wait for the next tick")
+	default:
+	}
+	if _, ran := status.report("host1").LastRuns["job tasks"]; ran {
+		t.Errorf("Expected a reload not to run the tasks")
+	}
+	tick <- time.Now()
+	<-done
+}
+
+func TestProcessJobUpdateAgent(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	t.Setenv("INVOCATION_ID", "") // Not started by systemd
+	binary := []byte("#!/bin/sh\necho 'Version:    v9.9.9'\n")
+	checksum := sha256.Sum256(binary)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(binary)
+	}))
+	defer server.Close()
+	currentConfig().ApiUrl = server.URL + "/"
+	path := filepath.Join(t.TempDir(), "cloud-guardian")
+	if err := os.WriteFile(path, []byte("old agent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	originalExecutable := agentExecutable
+	agentExecutable = func() (string, error) { return path, nil }
+	defer func() { agentExecutable = originalExecutable }()
+
+	processJobUpdateAgent("host1", "job1", `{"version": "v9.9.9", "url": "agent/download", "sha256": "`+strings.Repeat("0", 64)+`"}`)
+	if data, _ := os.ReadFile(path); string(data) != "old agent" {
+		t.Fatalf("Expected a download with another checksum to keep the agent")
+	}
+	processJobUpdateAgent("host1", "job2", `{"version": "v9.9.9", "url": "agent/download", "sha256": "`+hex.EncodeToString(checksum[:])+`"}`)
+	if data, _ := os.ReadFile(path); string(data) != string(binary) {
+		t.Errorf("Expected the agent to be replaced by the download")
+	}
+	if data, _ := os.ReadFile(path + ".old"); string(data) != "old agent" {
+		t.Errorf("Expected the previous agent to be kept")
+	}
+
+	expected := []string{"job1 running", "job1 failed", "job2 running", "job2 completed"}
+	var got []string
+	for _, update := range client.jobUpdates {
+		got = append(got, update.jobId+" "+update.status)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected the job updates %v, got %v", expected, got)
+	}
+	if failed, _ := api.ParseJobResult(client.jobUpdates[1].result); failed.ErrorCode != api.ErrorCodeChecksumMismatch {
+		t.Errorf("Expected a checksum mismatch, got %+v", failed)
+	}
+	if completed, _ := api.ParseJobResult(client.jobUpdates[3].result); completed.Metadata["version"] != "v9.9.9" {
+		t.Errorf("Expected the new version in the result, got %+v", completed)
+	}
+
+	if _, err := parseUpdateAgentJobData(`{"version": "v9.9.9", "url": "http://example.com/agent", "sha256": "`+strings.Repeat("0", 64)+`"}`, currentConfig().ApiUrl); err == nil {
+		t.Errorf("Expected a plain http URL outside of the API to be rejected")
+	}
+}
+
+func TestCheckAgentVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloud-guardian")
+	binary := "#!/bin/sh\necho 'Version:    v1.2.10'\necho 'Commit:     v1.2.1'\n"
+	if err := os.WriteFile(path, []byte(binary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAgentVersion(path, "v1.2.10"); err != nil {
+		t.Errorf("Expected version v1.2.10 to match, got %v", err)
+	}
+	if err := checkAgentVersion(path, "1.2.10"); err != nil {
+		t.Errorf("Expected version 1.2.10 to match, got %v", err)
+	}
+	for _, version := range []string{"v1.2.1", "v1.2.100", "v2.10"} {
+		if err := checkAgentVersion(path, version); err == nil {
+			t.Errorf("Expected version %s not to match v1.2.10", version)
+		}
+	}
+}
+
+func TestAgentUpdateRollback(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	originalVersion := cloudguardian_version.Version
+	cloudguardian_version.Version = "v1.0.0"
+	defer func() { cloudguardian_version.Version = originalVersion }()
+	restarts, scheduled := 0, ""
+	originalRestart, originalSchedule := restartAgent, scheduleAgentRollback
+	restartAgent = func() error { restarts++; return nil }
+	scheduleAgentRollback = func(oldPath string) error { scheduled = oldPath; return nil }
+	defer func() { restartAgent, scheduleAgentRollback = originalRestart, originalSchedule }()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cloud-guardian")
+	os.WriteFile(path, []byte("old agent"), 0755)
+	os.WriteFile(path+".new", []byte("new agent"), 0755)
+	if err := replaceAgent(path, path+".new"); err != nil {
+		t.Fatalf("replaceAgent() error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new agent" {
+		t.Fatalf("Expected the new binary in place of the agent, got %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".old"); string(data) != "old agent" {
+		t.Fatalf("Expected the previous binary to be kept, got %q", data)
+	}
+
+	// The new version does not start, the timer restores the previous binary
+	if err := restartUpdatedAgent(path, "v2.0.0"); err != nil || restarts != 1 || scheduled != path+".old" {
+		t.Fatalf("Expected a restart with a scheduled rollback, got %v, %d restarts, %q scheduled", err, restarts, scheduled)
+	}
+	confirmAgentUpdate() // Still the previous version
+	if restored, err := RollbackAgentUpdate(); !restored || err != nil {
+		t.Fatalf("Expected the previous binary to be restored, got %v %v", restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old agent" || restarts != 2 {
+		t.Errorf("Expected the previous binary to be restored and restarted, got %q and %d restarts", data, restarts)
+	}
+
+	// The new version starts and cancels the rollback
+	os.WriteFile(path+".new", []byte("new agent"), 0755)
+	replaceAgent(path, path+".new")
+	restartUpdatedAgent(path, "v2.0.0")
+	cloudguardian_version.Version = "v2.0.0"
+	confirmAgentUpdate()
+	if restored, err := RollbackAgentUpdate(); restored || err != nil {
+		t.Errorf("Expected no rollback after the new version started, got %v %v", restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new agent" {
+		t.Errorf("Expected the new binary to stay, got %q", data)
+	}
+}
+
+func TestCheckSelfUpdate(t *testing.T) {
+	useFakeClient(t, &fakeClient{})
+	t.Setenv("INVOCATION_ID", "") // Not started by systemd
+	originalVersion := cloudguardian_version.Version
+	cloudguardian_version.Version = "v1.0.0"
+	defer func() { cloudguardian_version.Version = originalVersion }()
+	selfUpdateAttempted = map[string]bool{}
+	binary := []byte("#!/bin/sh\necho 'Version:    v1.5.0'\n")
+	checksum := sha256.Sum256(binary)
+	key, err := ethcrypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentConfig().HostSecurityKeys = []string{hex.EncodeToString(ethcrypto.FromECDSAPub(&key.PublicKey))}
+	jobData := `{"version": "v1.5.0", "url": "agent/download", "sha256": "` + hex.EncodeToString(checksum[:]) + `"}`
+	createdAt := "2026-10-16T12:00:00Z"
+	hash := sha256.Sum256([]byte(cloudguardian_crypto.JobMessage(createdAt, "host1", "update_agent", jobData)))
+	signature, err := ethcrypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := map[string]string{"latestVersion": "v1.5.0", "createdAt": createdAt, "jobData": jobData, "signature": hex.EncodeToString(signature[:64])}
+	minimum := "v1.5.0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if minimum != "" {
+			w.Header().Set("x-min-agent-version", minimum)
+		}
+		switch r.URL.Path {
+		case "/agent/version":
+			json.NewEncoder(w).Encode(map[string]any{"code": 200, "content": release})
+		case "/agent/download":
+			w.Write(binary)
+		}
+	}))
+	defer server.Close()
+	defer func() {
+		minimum = ""
+		api.GetRequest(context.Background(), server.URL+"/", "") // Clears the minimum version
+	}()
+	currentConfig().ApiUrl = server.URL + "/"
+	path := filepath.Join(t.TempDir(), "cloud-guardian")
+	if err := os.WriteFile(path, []byte("old agent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	originalExecutable := agentExecutable
+	agentExecutable = func() (string, error) { return path, nil }
+	defer func() { agentExecutable = originalExecutable }()
+
+	api.GetRequest(context.Background(), server.URL+"/", "")
+	checkSelfUpdate(context.Background(), "host1")
+	if data, _ := os.ReadFile(path); string(data) != "old agent" {
+		t.Fatalf("Expected no update without auto_update")
+	}
+
+	// A release signed for another host is not installed
+	currentConfig().AutoUpdate = true
+	checkSelfUpdate(context.Background(), "host2")
+	if data, _ := os.ReadFile(path); string(data) != "old agent" {
+		t.Fatalf("Expected a release without a valid signature not to be installed")
+	}
+
+	selfUpdateAttempted = map[string]bool{}
+	checkSelfUpdate(context.Background(), "host1")
+	if data, _ := os.ReadFile(path); string(data) != string(binary) {
+		t.Fatalf("Expected the agent to be replaced by the latest release")
+	}
+
+	// A minimum version is only attempted once
+	os.WriteFile(path, []byte("old agent"), 0755)
+	checkSelfUpdate(context.Background(), "host1")
+	if data, _ := os.ReadFile(path); string(data) != "old agent" {
+		t.Errorf("Expected the update not to be attempted twice")
+	}
+}
+
+func TestServiceFileDriftAfterRestart(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	dir := t.TempDir()
+	originalUnitDirs := linux_unitdrift.UnitDirs
+	linux_unitdrift.UnitDirs = []string{dir}
+	defer func() { linux_unitdrift.UnitDirs = originalUnitDirs }()
+	currentConfig().WatchedServices = []string{"sshd"}
+	unitPath := filepath.Join(dir, "sshd.service")
+	os.WriteFile(unitPath, []byte("[Service]\nExecStart=/usr/sbin/sshd -D\n"), 0644)
+
+	processServiceFileDrift(context.Background(), "host1")
+	if changes := client.serviceFiles["changes"].([]linux_unitdrift.Change); len(changes) != 0 {
+		t.Fatalf("Expected no changes on the first check, got %v", changes)
+	}
+
+	// The unit files are read from the state directory, so a restarted agent reports the change
+	os.WriteFile(unitPath, []byte("[Service]\nExecStart=/tmp/sshd\n"), 0644)
+	processServiceFileDrift(context.Background(), "host1")
+	if changes := client.serviceFiles["changes"].([]linux_unitdrift.Change); len(changes) != 1 || changes[0].Path != unitPath {
+		t.Errorf("Expected the modified unit file to be reported, got %v", changes)
+	}
+}
+
+func TestCriticalFileDriftAfterRestart(t *testing.T) {
+	client := &fakeClient{}
+	useFakeClient(t, client)
+	path := filepath.Join(t.TempDir(), "sudoers")
+	os.WriteFile(path, []byte("root ALL=(ALL) ALL\n"), 0440)
+	currentConfig().WatchedFiles = []string{path}
+
+	processServiceFileDrift(context.Background(), "host1")
+	if changes := client.serviceFiles["critical_file_changes"].([]linux_fileattrs.Change); len(changes) != 0 {
+		t.Fatalf("Expected no changes on the first check, got %v", changes)
+	}
+
+	// The critical files are read from the state directory, so a restarted agent reports the change
+	if _, err := os.Stat(criticalFilesPath); err != nil {
+		t.Fatalf("Expected the critical files to be saved, got %v", err)
+	}
+	os.Chmod(path, 0666)
+	processServiceFileDrift(context.Background(), "host1")
+	if changes := client.serviceFiles["critical_file_changes"].([]linux_fileattrs.Change); len(changes) != 1 || changes[0].Path != path {
+		t.Errorf("Expected the changed mode to be reported, got %v", changes)
+	}
+}
@@ -0,0 +1,203 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	pm "cloud-guardian/linux/packagemanager"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files written to the textfile collector directory. Every task writes its own file,
+// so a slow task does not hold back the metrics of the others.
+const (
+	monitoringTextfile = "cloud_guardian_monitoring.prom"
+	updatesTextfile    = "cloud_guardian_updates.prom"
+)
+
+// textfileMetrics builds a file in the Prometheus text exposition format. The
+// samples of a metric are grouped, as the format requires, in the order of the
+// first sample of each metric.
+type textfileMetrics struct {
+	names   []string
+	help    map[string]string
+	samples map[string][]string
+}
+
+// add adds a sample of a gauge.
+//
+// Parameters:
+//   - name: The metric name, prefixed with cloud_guardian_
+//   - help: The description of the metric
+//   - value: The value of the sample
+//   - labels: Label names and values in pairs, e.g. "mountpoint", "/"
+func (m *textfileMetrics) add(name string, help string, value float64, labels ...string) {
+	name = "cloud_guardian_" + name
+	if m.help == nil {
+		m.help, m.samples = map[string]string{}, map[string][]string{}
+	}
+	if _, ok := m.help[name]; !ok {
+		m.names = append(m.names, name)
+		m.help[name] = help
+	}
+	sample := name
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+escapeLabelValue(labels[i+1])+`"`)
+		}
+		sample += "{" + strings.Join(pairs, ",") + "}"
+	}
+	m.samples[name] = append(m.samples[name], fmt.Sprintf("%s %g", sample, value))
+}
+
+// String returns the metrics in the text exposition format
+func (m *textfileMetrics) String() string {
+	var builder strings.Builder
+	for _, name := range m.names {
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s gauge\n", name, m.help[name], name)
+		for _, sample := range m.samples[name] {
+			builder.WriteString(sample + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// escapeLabelValue escapes a label value of the text exposition format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeTextfile replaces a file in the textfile collector directory. The file is
+// written to a temporary file and renamed, so node_exporter never reads a partial file.
+func writeTextfile(name string, metrics *textfileMetrics) {
+	dir := currentConfig().PrometheusTextfileDir
+	if dir == "" {
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		log.Println("Error writing the Prometheus textfile:", err.Error())
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(metrics.String())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		log.Println("Error writing the Prometheus textfile:", err.Error())
+	}
+}
+
+// exportMonitoring writes the key metrics of a monitoring cycle to the textfile collector directory
+func exportMonitoring(monitoring api.Monitoring, cycle time.Time) {
+	if currentConfig().PrometheusTextfileDir == "" {
+		return
+	}
+	metrics := &textfileMetrics{}
+	metrics.add("monitoring_timestamp_seconds", "Start of the last monitoring cycle.", float64(cycle.Unix()))
+	metrics.add("uptime_seconds", "Uptime of the host.", float64(monitoring.Uptime))
+	metrics.add("load1", "Load average over 1 minute.", monitoring.LoadAverage.OneMinute)
+	metrics.add("load5", "Load average over 5 minutes.", monitoring.LoadAverage.FiveMinutes)
+	metrics.add("load15", "Load average over 15 minutes.", monitoring.LoadAverage.FifteenMinutes)
+	cpu := monitoring.CpuUsage
+	for _, mode := range []struct {
+		name  string
+		value float64
+	}{
+		{"user", cpu.User}, {"system", cpu.System}, {"nice", cpu.Nice}, {"idle", cpu.Idle},
+		{"iowait", cpu.IOWait}, {"irq", cpu.HardwareInterrupt}, {"softirq", cpu.SoftwareInterrupt}, {"steal", cpu.Steal},
+	} {
+		metrics.add("cpu_usage_percent", "CPU usage by mode during the monitoring cycle.", mode.value, "mode", mode.name)
+	}
+	memory := monitoring.Memory
+	for _, value := range []struct {
+		name  string
+		value float64
+	}{
+		{"total", memory.Total}, {"used", memory.Used}, {"available", memory.Available},
+		{"swap_total", memory.SwapTotal}, {"swap_used", memory.SwapUsed},
+	} {
+		metrics.add("memory_bytes", "Memory of the host.", value.value*1024*1024, "type", value.name) // MiB
+	}
+	for _, df := range monitoring.DiskFree {
+		labels := []string{"mountpoint", df.Target, "device", df.Source, "fstype", df.FSType}
+		metrics.add("filesystem_size_bytes", "Size of the filesystem.", df.Size*1024, labels...) // KB
+		metrics.add("filesystem_avail_bytes", "Space available to unprivileged users.", df.Avail*1024, labels...)
+	}
+	processes := monitoring.Tasks
+	for _, state := range []struct {
+		name  string
+		value int
+	}{
+		{"running", processes.Running}, {"sleeping", processes.Sleeping}, {"stopped", processes.Stopped},
+		{"zombie", processes.Zombie}, {"uninterruptible", processes.Uninterruptible},
+	} {
+		metrics.add("processes", "Processes by state.", float64(state.value), "state", state.name)
+	}
+	metrics.add("reboot_required", "1 if the host needs a reboot, e.g. for a new kernel.", boolValue(monitoring.NeedRestart.RebootRequired))
+	metrics.add("services_restart_required", "Services that use outdated libraries.", float64(len(monitoring.NeedRestart.Services)))
+	metrics.add("collector_errors", "Collectors that failed in the monitoring cycle.", float64(len(monitoring.CollectorErrors)))
+	writeTextfile(monitoringTextfile, metrics)
+}
+
+// pendingUpdates is the last update check of each update type, the updates textfile
+// contains all types, though they are checked one after another
+var (
+	pendingUpdates      = map[pm.UpdateType]pendingUpdateCheck{}
+	pendingUpdatesMutex sync.Mutex
+)
+
+// pendingUpdateCheck is the result of an update check
+type pendingUpdateCheck struct {
+	count     int
+	size      *api.UpdateSize
+	checkedAt time.Time
+}
+
+// exportUpdates writes the pending updates to the textfile collector directory.
+//
+// Parameters:
+//   - updateType: The type of the checked updates
+//   - count: The number of pending updates
+//   - size: The estimated size of the updates, nil if unknown
+func exportUpdates(updateType pm.UpdateType, count int, size *api.UpdateSize) {
+	if currentConfig().PrometheusTextfileDir == "" {
+		return
+	}
+	pendingUpdatesMutex.Lock()
+	defer pendingUpdatesMutex.Unlock()
+	pendingUpdates[updateType] = pendingUpdateCheck{count: count, size: size, checkedAt: time.Now()}
+	metrics := &textfileMetrics{}
+	for _, updateType := range []pm.UpdateType{pm.AllUpdates, pm.SecurityUpdates} {
+		check, ok := pendingUpdates[updateType]
+		if !ok {
+			continue
+		}
+		metrics.add("updates_pending", "Pending package updates.", float64(check.count), "type", updateType.String())
+		if check.size != nil {
+			metrics.add("updates_download_bytes", "Estimated download size of the pending updates.", float64(check.size.DownloadBytes), "type", updateType.String())
+		}
+		metrics.add("updates_timestamp_seconds", "Time of the last update check.", float64(check.checkedAt.Unix()), "type", updateType.String())
+	}
+	writeTextfile(updatesTextfile, metrics)
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
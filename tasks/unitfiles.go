@@ -0,0 +1,46 @@
+package tasks
+
+import (
+	"cloud-guardian/cloudguardian_config"
+	cloudguardian_faults "cloud-guardian/faults"
+	linux_unitdrift "cloud-guardian/linux/unitdrift"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// unitFilesPath contains the unit files of the last submitted drift check, so
+// changes made while the agent was stopped are reported after its restart
+var unitFilesPath = cloudguardian_config.StateDir + "/unit-files.json"
+
+// loadUnitFiles returns the unit files of the last submitted drift check
+//
+// Returns:
+//   - []linux_unitdrift.UnitFile: The unit files, nil before the first check or if the state is unreadable
+func loadUnitFiles() []linux_unitdrift.UnitFile {
+	data, err := os.ReadFile(unitFilesPath)
+	if err != nil {
+		return nil
+	}
+	unitFiles := []linux_unitdrift.UnitFile{}
+	if err := json.Unmarshal(data, &unitFiles); err != nil {
+		log.Println("Error reading the unit files of the last drift check:", err.Error())
+		return nil
+	}
+	return unitFiles
+}
+
+// saveUnitFiles stores the unit files of a submitted drift check, see loadUnitFiles
+//
+// Parameters:
+//   - unitFiles: The unit files
+func saveUnitFiles(unitFiles []linux_unitdrift.UnitFile) {
+	data, err := json.Marshal(unitFiles)
+	if err != nil {
+		log.Println("Error encoding the unit files:", err.Error())
+		return
+	}
+	if err := cloudguardian_config.WriteFileAtomic(unitFilesPath, cloudguardian_faults.CorruptState(unitFilesPath, data), 0600); err != nil {
+		log.Println("Error writing the unit files:", err.Error())
+	}
+}
@@ -0,0 +1,363 @@
+package tasks
+
+import (
+	api "cloud-guardian/api"
+	"cloud-guardian/cloudguardian_config"
+	"cloud-guardian/cloudguardian_version"
+	cloudguardian_crypto "cloud-guardian/crypto"
+	linux "cloud-guardian/linux"
+	linux_installer "cloud-guardian/linux/installer"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	agentVersionTimeout = 10 * time.Second // Limits the --version check of a downloaded agent
+	agentRestartGrace   = 2 * time.Minute  // An update_agent job fails if the agent was not restarted in time
+)
+
+// agentExecutable returns the path of the running agent, replaced by tests
+var agentExecutable = os.Executable
+
+// restartAgent restarts the agent service, replaced by tests. The restart is not
+// awaited, systemd stops this process while the job is still running.
+var restartAgent = func() error {
+	return exec.Command("systemctl", "--no-block", "restart", linux_installer.ServiceName).Run()
+}
+
+// updateAgentJob is the job data of an update_agent job, e.g.
+// {"version": "v1.5.0", "url": "agent/download/v1.5.0/linux-amd64", "sha256": "9f86d0..."}.
+// The checksum is part of the signed job data, so a binary that matches it is
+// the one the API signed.
+type updateAgentJob struct {
+	Version string `json:"version"` // The version the new binary reports with --version
+	Url     string `json:"url"`     // A path below the API URL or an https URL, e.g. a presigned URL
+	Sha256  string `json:"sha256"`  // Hex encoded SHA-256 of the binary
+}
+
+// parseUpdateAgentJobData parses and validates the job data of an update_agent job
+// and resolves a relative URL against the API URL.
+func parseUpdateAgentJobData(jobData string, apiUrl string) (updateAgentJob, error) {
+	var job updateAgentJob
+	if err := json.Unmarshal([]byte(jobData), &job); err != nil {
+		return job, fmt.Errorf("job data is not valid JSON: %w", err)
+	}
+	return job.resolve(apiUrl)
+}
+
+// resolve validates an agent update and resolves a relative URL against the API URL
+func (job updateAgentJob) resolve(apiUrl string) (updateAgentJob, error) {
+	if job.Version == "" {
+		return job, fmt.Errorf("version is required")
+	}
+	if job.Url == "" {
+		return job, fmt.Errorf("url is required")
+	}
+	if !strings.Contains(job.Url, "://") {
+		job.Url = apiUrl + strings.TrimPrefix(job.Url, "/")
+	} else if !strings.HasPrefix(job.Url, "https://") && !strings.HasPrefix(job.Url, apiUrl) {
+		return job, fmt.Errorf("url must be an https URL or below the API URL")
+	}
+	if checksum, err := hex.DecodeString(job.Sha256); err != nil || len(checksum) != sha256.Size {
+		return job, fmt.Errorf("sha256 must be a hex encoded SHA-256 checksum")
+	}
+	job.Sha256 = strings.ToLower(job.Sha256)
+	return job, nil
+}
+
+// processJobUpdateAgent replaces the agent binary with the one of the job and
+// restarts the service. The binary is downloaded next to the running binary,
+// checked against the checksum of the job and asked for its version before it
+// replaces the running binary, which is kept with the suffix ".old". The job
+// stays running while the service restarts, the new agent completes it, see
+// checkAgentUpdate. If the new version does not start in time, the previous
+// binary is restored and fails the job, see RollbackAgentUpdate. An agent that
+// does not run as a service completes the job right away, the new binary is
+// used from its next start.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - jobId: The ID of the job
+//   - jobData: The job data, see updateAgentJob
+func processJobUpdateAgent(hostname string, jobId string, jobData string) {
+	log.Println("Processing update_agent job for job ID:", jobId)
+	startedAt := time.Now()
+	job, err := parseUpdateAgentJobData(jobData, currentConfig().ApiUrl)
+	if err != nil {
+		log.Println("Error parsing update_agent job data:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, api.ErrorCodeInvalidJobData, "invalid update_agent job data: "+err.Error()))
+		return
+	}
+	result := runningResult(startedAt)
+	result.Metadata = map[string]string{"previous_version": cloudguardian_version.Version, "version": job.Version}
+	if sameVersion(job.Version, cloudguardian_version.Version) {
+		result.Message = "the agent already runs version " + job.Version
+		result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		updateJobStatus(hostname, jobId, "completed", result)
+		return
+	}
+	updateJobStatus(hostname, jobId, "running", result)
+
+	path, errorCode, err := installAgent(job)
+	if err != nil {
+		log.Println("Error updating the agent:", err.Error())
+		updateJobStatus(hostname, jobId, "failed", failedResult(startedAt, errorCode, err.Error()))
+		return
+	}
+	log.Println("Agent binary", path, "updated from", cloudguardian_version.Version, "to", job.Version)
+
+	if os.Getenv("INVOCATION_ID") == "" {
+		// Not started by systemd, e.g. a one-shot run
+		result.Message = "updated to " + job.Version + ", it is used from the next start of the agent"
+		result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		updateJobStatus(hostname, jobId, "completed", result)
+		return
+	}
+	result.Message = "restarting the agent"
+	result.Metadata["restart_initiated_at"] = time.Now().UTC().Format(time.RFC3339)
+	updateJobStatus(hostname, jobId, "running", result)
+	if err := restartUpdatedAgent(path, job.Version); err != nil {
+		log.Println("Error restarting the agent:", err.Error())
+		failed := failedResult(startedAt, api.ClassifyError(err, ""), "updated to "+job.Version+", but the service could not be restarted: "+err.Error())
+		failed.Metadata = result.Metadata
+		updateJobStatus(hostname, jobId, "failed", failed)
+	}
+}
+
+// installAgent replaces the running agent binary with the binary of an agent
+// update, see processJobUpdateAgent. The service is not restarted.
+//
+// Parameters:
+//   - job: The agent update
+//
+// Returns:
+//   - string: The path of the replaced binary
+//   - api.ErrorCode: The error code of a failure
+//   - error: An error if the binary could not be downloaded, checked or replaced
+func installAgent(job updateAgentJob) (string, api.ErrorCode, error) {
+	path, err := agentExecutable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		return "", api.ClassifyError(err, ""), fmt.Errorf("failed to find the agent binary: %w", err)
+	}
+	newPath := path + ".new"
+	if errorCode, err := downloadAgent(job, newPath); err != nil {
+		os.Remove(newPath)
+		return "", errorCode, fmt.Errorf("failed to download the agent: %w", err)
+	}
+	if err := checkAgentVersion(newPath, job.Version); err != nil {
+		os.Remove(newPath)
+		return "", api.ErrorCodeCommandFailed, fmt.Errorf("the downloaded agent is not usable: %w", err)
+	}
+	if err := replaceAgent(path, newPath); err != nil {
+		os.Remove(newPath)
+		return "", api.ClassifyError(err, ""), fmt.Errorf("failed to replace the agent: %w", err)
+	}
+	return path, "", nil
+}
+
+// downloadAgent downloads the binary of an update_agent job and checks its checksum.
+//
+// Parameters:
+//   - job: The update_agent job
+//   - path: Receives the binary, executable
+//
+// Returns:
+//   - api.ErrorCode: The error code of a failure
+//   - error: An error if the download failed or does not match the checksum
+func downloadAgent(job updateAgentJob, path string) (api.ErrorCode, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return api.ClassifyError(err, ""), err
+	}
+	hash := sha256.New()
+	_, err = api.DownloadAgent(job.Url, currentConfig().ApiUrl, currentConfig().ApiKey, io.MultiWriter(file, hash))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return api.ClassifyError(err, ""), err
+	}
+	if checksum := hex.EncodeToString(hash.Sum(nil)); checksum != job.Sha256 {
+		return api.ErrorCodeChecksumMismatch, fmt.Errorf("the checksum %s does not match %s", checksum, job.Sha256)
+	}
+	return "", nil
+}
+
+// checkAgentVersion runs a downloaded agent with --version, so a binary for
+// another architecture or of another version is not installed
+func checkAgentVersion(path string, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), agentVersionTimeout)
+	defer cancel()
+	stdOut, _, err := linux.RunCommand(exec.CommandContext(ctx, path, "--version"))
+	if err != nil {
+		return err
+	}
+	reported := parseAgentVersion(stdOut)
+	if !sameVersion(reported, version) {
+		return fmt.Errorf("it reports version %q instead of %s", reported, version)
+	}
+	return nil
+}
+
+// parseAgentVersion extracts the version from the output of the agent with
+// --version, e.g. v1.5.0 from "Version:    v1.5.0".
+//
+// Parameters:
+//   - output: The standard output of the agent
+//
+// Returns:
+//   - string: The version, empty if the output has no version line
+func parseAgentVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if value, found := strings.CutPrefix(strings.TrimSpace(line), "Version:"); found {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// sameVersion compares two versions with or without the "v" prefix, e.g. v1.5.0 and 1.5.0
+func sameVersion(a string, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// replaceAgent keeps the running binary as path.old and moves the new binary in
+// its place with a single rename, so a binary exists at path at any time
+func replaceAgent(path string, newPath string) error {
+	if err := os.Remove(path + ".old"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, path+".old"); err != nil {
+		// E.g. a filesystem without hard links
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := cloudguardian_config.WriteFileAtomic(path+".old", data, 0755); err != nil {
+			return err
+		}
+	}
+	return os.Rename(newPath, path)
+}
+
+// checkAgentUpdate completes a running update_agent job once the agent runs the
+// new version after the restart. The job fails if the agent still runs another
+// version when the restart should have happened.
+//
+// Parameters:
+//   - hostname: The hostname of the host
+//   - job: The running update_agent job
+func checkAgentUpdate(hostname string, job api.HostJob) {
+	result, ok := api.ParseJobResult(job.Result)
+	if !ok || result.Metadata["version"] == "" {
+		return
+	}
+	restartedAt, err := time.Parse(time.RFC3339, result.Metadata["restart_initiated_at"])
+	if err != nil {
+		return // The binary is not replaced yet
+	}
+	if sameVersion(cloudguardian_version.Version, result.Metadata["version"]) {
+		log.Println("Update_agent job", job.JobId, "completed, the agent runs version", cloudguardian_version.Version)
+		result.Message = "updated from " + result.Metadata["previous_version"] + " to " + result.Metadata["version"]
+		result.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		updateJobStatus(hostname, job.JobId, "completed", result)
+		return
+	}
+	if time.Since(restartedAt) < agentRestartGrace {
+		return
+	}
+	log.Println("Update_agent job", job.JobId, "failed, the agent still runs version", cloudguardian_version.Version)
+	failed := failedResult(jobStartedAt(job), api.ErrorCodeCommandFailed, "the agent still runs version "+cloudguardian_version.Version+" after the restart")
+	failed.Metadata = result.Metadata
+	updateJobStatus(hostname, job.JobId, "failed", failed)
+}
+
+// selfUpdateAttempted holds the minimum versions announced by the API that a self
+// update was attempted for, "" for a 426 response without one. A failed update is
+// not retried until the API announces another minimum version or the agent restarts.
+var (
+	selfUpdateAttempted = map[string]bool{}
+	selfUpdateMutex     sync.Mutex
+)
+
+// checkSelfUpdate installs the latest agent release when auto_update is enabled
+// and the API no longer supports the running version. The API offers the release
+// as the job data of an update_agent job for the host. It is only installed if it
+// is signed with a host security key and allowed by the job policy, like a job,
+// the checksum alone proves nothing if the API is compromised. The binary is
+// checked like the one of an update_agent job and the service is restarted.
+//
+// Parameters:
+//   - ctx: The context of the task
+//   - hostname: The hostname of the host
+func checkSelfUpdate(ctx context.Context, hostname string) {
+	if !currentConfig().AutoUpdate {
+		return
+	}
+	incompatible, minimum := api.IsIncompatible()
+	if !incompatible {
+		return
+	}
+	selfUpdateMutex.Lock()
+	attempted := selfUpdateAttempted[minimum]
+	selfUpdateAttempted[minimum] = true
+	selfUpdateMutex.Unlock()
+	if attempted {
+		return
+	}
+	if currentConfig().DryRun {
+		log.Println("Dry run, not updating the unsupported agent version", cloudguardian_version.Version)
+		return
+	}
+
+	log.Println("Agent version", cloudguardian_version.Version, "is not supported by the API, updating to the latest release")
+	release, err := api.LatestAgentRelease(ctx, currentConfig().ApiUrl, currentConfig().ApiKey, hostname)
+	if err != nil {
+		log.Println("Error getting the latest agent release:", err.Error())
+		return
+	}
+	message := cloudguardian_crypto.JobMessage(release.CreatedAt, hostname, "update_agent", release.JobData)
+	if validated, _ := tryValidatePayload(currentConfig().HostSecurityKeys, message, release.Signature); !validated {
+		log.Println("The latest agent release", release.Version, "is not signed with a host security key, not updating")
+		return
+	}
+	job, err := parseUpdateAgentJobData(release.JobData, currentConfig().ApiUrl)
+	if err == nil {
+		err = currentConfig().JobPolicy.Check("update_agent", release.JobData)
+	}
+	if err != nil {
+		log.Println("The latest agent release", release.Version, "can not be installed:", err.Error())
+		return
+	}
+	if sameVersion(job.Version, cloudguardian_version.Version) || (minimum != "" && api.IsIncompatibleVersion(job.Version, minimum)) {
+		log.Println("The latest agent release", job.Version, "is not supported by the API either, not updating")
+		return
+	}
+	path, _, err := installAgent(job)
+	if err != nil {
+		log.Println("Error updating the agent:", err.Error())
+		return
+	}
+	log.Println("Agent binary", path, "updated from", cloudguardian_version.Version, "to", job.Version)
+	if os.Getenv("INVOCATION_ID") == "" {
+		log.Println("Not running as a service, version", job.Version, "is used from the next start of the agent")
+		return
+	}
+	if err := restartUpdatedAgent(path, job.Version); err != nil {
+		log.Println("Error restarting the agent:", err.Error())
+	}
+}
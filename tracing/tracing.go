@@ -0,0 +1,267 @@
+// Package cloudguardian_tracing records spans of the agent tasks and API calls and exports
+// them to an OpenTelemetry collector with OTLP/HTTP (JSON encoding).
+// Tracing is disabled unless an OTLP endpoint is configured.
+package cloudguardian_tracing
+
+import (
+	"bytes"
+	"cloud-guardian/cloudguardian_version"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	serviceName    = "cloud-guardian"
+	exportTimeout  = 10 * time.Second
+	maxQueuedSpans = 2048 // Spans are dropped when the collector can not keep up
+)
+
+// Span kinds as defined by OTLP
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+var (
+	endpoint string // OTLP/HTTP traces URL, tracing is disabled if empty
+	hostname string
+	mutex    sync.Mutex
+	traces   = map[string]*trace{} // Traces with open spans by trace ID
+
+	exportClient = &http.Client{Timeout: exportTimeout}
+)
+
+// trace holds the finished spans of a trace until its last open span ends
+type trace struct {
+	open     int     // Open spans of the trace
+	finished []*Span // Finished spans waiting to be exported
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// Span is a timed operation of the agent. A nil Span is valid and records nothing,
+// so callers do not need to check whether tracing is enabled.
+type Span struct {
+	traceId    string
+	spanId     string
+	parentId   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]any
+	err        string
+}
+
+// Configure enables tracing. Spans are exported to <otlpEndpoint>/v1/traces,
+// e.g. "http://localhost:4318". An empty endpoint disables tracing.
+//
+// Parameters:
+//   - otlpEndpoint: The base URL of the OTLP/HTTP receiver
+//   - host: The hostname reported as host.name resource attribute
+func Configure(otlpEndpoint string, host string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	endpoint = ""
+	if otlpEndpoint != "" {
+		endpoint = otlpEndpoint + "/v1/traces"
+		if otlpEndpoint[len(otlpEndpoint)-1] == '/' {
+			endpoint = otlpEndpoint + "v1/traces"
+		}
+	}
+	hostname = host
+}
+
+// Start opens an internal span, e.g. for a task. The span of the context becomes
+// its parent, a span without parent starts a new trace. Concurrent tasks start
+// from their own context, so their spans do not become each other's children.
+//
+// Parameters:
+//   - ctx: The context of the caller, with the parent span if any
+//   - name: The name of the span
+//
+// Returns:
+//   - context.Context: The context with the new span, for its child spans
+//   - *Span: The span, nil if tracing is disabled
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartWithKind(ctx, name, KindInternal)
+}
+
+// StartWithKind opens a span of the given kind, see Start.
+func StartWithKind(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if endpoint == "" {
+		return ctx, nil
+	}
+	span := &Span{spanId: randomHex(8), name: name, kind: kind, start: time.Now(), attributes: map[string]any{}}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && traces[parent.traceId] != nil {
+		span.traceId = parent.traceId
+		span.parentId = parent.spanId
+	} else {
+		span.traceId = randomHex(16)
+		traces[span.traceId] = &trace{}
+	}
+	traces[span.traceId].open++
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute adds an attribute to the span. Values are exported as int or string.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	s.err = err.Error()
+}
+
+// TraceParent returns the W3C traceparent header value of the span, so the API
+// can continue the trace.
+func (s *Span) TraceParent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.traceId + "-" + s.spanId + "-01"
+}
+
+// End finishes the span. The spans of a trace are exported in the background
+// when its last open span ends.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	mutex.Lock()
+	if !s.end.IsZero() {
+		mutex.Unlock()
+		return // Already ended
+	}
+	s.end = time.Now()
+	var batch []*Span
+	if t := traces[s.traceId]; t != nil {
+		if len(t.finished) < maxQueuedSpans {
+			t.finished = append(t.finished, s)
+		}
+		t.open--
+		if t.open == 0 {
+			batch = t.finished
+			delete(traces, s.traceId)
+		}
+	}
+	url := endpoint
+	mutex.Unlock()
+
+	if len(batch) > 0 && url != "" {
+		go export(url, batch)
+	}
+}
+
+// export sends the spans to the OTLP receiver. Errors are logged and the spans dropped.
+func export(url string, spans []*Span) {
+	data, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		log.Println("Error encoding trace spans:", err.Error())
+		return
+	}
+	resp, err := exportClient.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Println("Error exporting trace spans:", err.Error())
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Println("Error exporting trace spans: status code", resp.StatusCode)
+	}
+}
+
+// encodeSpans converts spans to an OTLP/JSON ExportTraceServiceRequest.
+//
+// Parameters:
+//   - spans: The finished spans
+//
+// Returns:
+//   - map[string]any: The request body
+func encodeSpans(spans []*Span) map[string]any {
+	encoded := []map[string]any{}
+	for _, s := range spans {
+		span := map[string]any{
+			"traceId":           s.traceId,
+			"spanId":            s.spanId,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        encodeAttributes(s.attributes),
+		}
+		if s.parentId != "" {
+			span["parentSpanId"] = s.parentId
+		}
+		if s.err != "" {
+			span["status"] = map[string]any{"code": 2, "message": s.err}
+		}
+		encoded = append(encoded, span)
+	}
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{
+				"attributes": encodeAttributes(map[string]any{
+					"service.name":    serviceName,
+					"service.version": cloudguardian_version.Version,
+					"host.name":       hostname,
+				}),
+			},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]any{"name": serviceName},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func encodeAttributes(attributes map[string]any) []map[string]any {
+	encoded := []map[string]any{}
+	for key, value := range attributes {
+		var encodedValue map[string]any
+		switch v := value.(type) {
+		case int:
+			encodedValue = map[string]any{"intValue": strconv.Itoa(v)} // 64-bit integers are strings in OTLP/JSON
+		case int64:
+			encodedValue = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case string:
+			encodedValue = map[string]any{"stringValue": v}
+		default:
+			encodedValue = map[string]any{"stringValue": fmtValue(v)}
+		}
+		encoded = append(encoded, map[string]any{"key": key, "value": encodedValue})
+	}
+	return encoded
+}
+
+func fmtValue(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func randomHex(bytes int) string {
+	b := make([]byte, bytes)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package cloudguardian_tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSpansAreDisabledWithoutEndpoint(t *testing.T) {
+	Configure("", "host1")
+	_, span := Start(context.Background(), "task")
+	if span != nil {
+		t.Fatalf("Expected no span without an OTLP endpoint")
+	}
+	// A nil span must be usable
+	span.SetAttribute("key", "value")
+	span.End()
+}
+
+func TestExportTrace(t *testing.T) {
+	received := make(chan map[string]any, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var request map[string]any
+		json.Unmarshal(body, &request)
+		received <- request
+	}))
+	defer server.Close()
+	Configure(server.URL, "host1")
+	defer Configure("", "")
+
+	ctx, task := Start(context.Background(), "basic_monitoring")
+	_, request := StartWithKind(ctx, "HTTP POST", KindClient)
+	request.SetAttribute("http.response.status_code", 200)
+	if traceParent := request.TraceParent(); len(traceParent) != 55 {
+		t.Errorf("Invalid traceparent: %s", traceParent)
+	}
+	request.End()
+	task.End()
+
+	select {
+	case request := <-received:
+		resourceSpans := request["resourceSpans"].([]any)[0].(map[string]any)
+		spans := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+		if len(spans) != 2 {
+			t.Fatalf("Expected 2 spans, got %d", len(spans))
+		}
+		child, root := spans[0].(map[string]any), spans[1].(map[string]any)
+		if child["parentSpanId"] != root["spanId"] || child["traceId"] != root["traceId"] {
+			t.Errorf("Expected the request span to be a child of the task span: %+v %+v", child, root)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No spans were exported")
+	}
+}
+
+func TestConcurrentSpansHaveTheirOwnParents(t *testing.T) {
+	received := make(chan map[string]any, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request map[string]any
+		json.Unmarshal(body, &request)
+		received <- request
+	}))
+	defer server.Close()
+	Configure(server.URL, "host1")
+	defer Configure("", "")
+
+	// A job runs while a task is open, the spans of the job must not join the task
+	taskCtx, task := Start(context.Background(), "job_tasks")
+	jobCtx, job := Start(context.Background(), "job")
+	_, jobRequest := StartWithKind(jobCtx, "HTTP PUT", KindClient)
+	_, taskRequest := StartWithKind(taskCtx, "HTTP GET", KindClient)
+	jobRequest.End()
+	job.End()
+	taskRequest.End()
+	task.End()
+
+	for range 2 {
+		select {
+		case request := <-received:
+			resourceSpans := request["resourceSpans"].([]any)[0].(map[string]any)
+			spans := resourceSpans["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+			if len(spans) != 2 {
+				t.Fatalf("Expected a trace with 2 spans, got %d", len(spans))
+			}
+			child, root := spans[0].(map[string]any), spans[1].(map[string]any)
+			if child["parentSpanId"] != root["spanId"] || child["traceId"] != root["traceId"] || root["parentSpanId"] != nil {
+				t.Errorf("Expected the request span to be a child of its own root: %+v %+v", child, root)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected both traces to be exported")
+		}
+	}
+}